@@ -0,0 +1,349 @@
+package winapi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// eventQueryTimeFormat is how TimeCreated is compared in queries, as written
+// by Event Viewer's filter dialog.
+const eventQueryTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// EventQueryOptions selects the events returned by QueryEvents.
+type EventQueryOptions struct {
+	// Channel to query, such as "Security" or
+	// "Microsoft-Windows-PowerShell/Operational".
+	Channel string
+	// XPath filters the events, such as "*[System[(EventID=4624)]]". All
+	// events are returned if empty. A structured <QueryList> query may be
+	// given instead, in which case Channel and the time range are ignored
+	// and must be part of the query.
+	XPath string
+	// Since and Until, if set, only return events created at or after
+	// Since and before Until.
+	Since time.Time
+	Until time.Time
+	// Reverse returns the newest events first.
+	Reverse bool
+	// MaxEvents stops the query after this many events, if non-zero.
+	MaxEvents int
+}
+
+// EventSubscribeOptions configures SubscribeEvents.
+type EventSubscribeOptions struct {
+	// Channel and XPath select the events, as with EventQueryOptions. A
+	// structured query may cover several channels.
+	Channel string
+	XPath   string
+	// Bookmarks, if set, keeps track of the last event acknowledged with
+	// EventSubscription.Ack, so a later subscription resumes after it rather
+	// than missing the events logged in between.
+	Bookmarks EventBookmarkStore
+	// StartAtOldest delivers the events already in the channel when there's
+	// no bookmark to resume from. Otherwise only new events are delivered.
+	StartAtOldest bool
+	// OnError is called with errors reading or rendering
+	// events. The subscription carries on regardless.
+	OnError func(error)
+	// BufferSize of the events channel, 64 if zero.
+	BufferSize int
+}
+
+// EventSubscription emits the events logged to a channel until its context
+// is done, at which point the events channel is closed.
+type EventSubscription struct {
+	events chan so.Event
+
+	mu        sync.Mutex
+	bookmarks EventBookmarkStore
+	bookmark  *eventBookmark
+}
+
+// newEventSubscription returns a subscription with a buffer of size events,
+// saving its bookmark to store, if set, starting from the saved bookmark.
+func newEventSubscription(store EventBookmarkStore, saved string, size int) (*EventSubscription, error) {
+	if size <= 0 {
+		size = 64
+	}
+	s := &EventSubscription{events: make(chan so.Event, size), bookmarks: store}
+	if store != nil {
+		b, err := parseEventBookmark(saved)
+		if err != nil {
+			return nil, err
+		}
+		s.bookmark = b
+	}
+	return s, nil
+}
+
+// Events returns the channel events are delivered on.
+func (s *EventSubscription) Events() <-chan so.Event {
+	return s.events
+}
+
+// Ack marks ev, and the events of its channel delivered before it, as
+// handled, saving the bookmark a later subscription resumes from. Events that
+// were delivered but not acknowledged are delivered again by that
+// subscription. Acknowledging an event older than one already acknowledged
+// does nothing, as does Ack without EventSubscribeOptions.Bookmarks.
+func (s *EventSubscription) Ack(ev so.Event) error {
+	if s.bookmarks == nil {
+		return nil
+	}
+	if ev.Channel == "" {
+		return fmt.Errorf("Unable to acknowledge event %d: no channel", ev.RecordID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.bookmark.update(ev.Channel, ev.RecordID) {
+		return nil
+	}
+	return s.bookmarks.SaveBookmark(s.bookmark.xml())
+}
+
+// eventBookmark is the last event handled in each channel of a subscription,
+// kept in the order the channels were first seen.
+// See: https://docs.microsoft.com/en-us/windows/win32/wes/bookmarking-events
+type eventBookmark struct {
+	channels []string
+	records  map[string]uint64
+	current  string
+}
+
+// parseEventBookmark parses a bookmark as rendered by EvtRender, or returns
+// an empty bookmark if s is empty.
+func parseEventBookmark(s string) (*eventBookmark, error) {
+	b := &eventBookmark{records: make(map[string]uint64)}
+	if strings.TrimSpace(s) == "" {
+		return b, nil
+	}
+	root, err := parseEventXML(s)
+	if err != nil || root.Name != "BookmarkList" {
+		return nil, fmt.Errorf("Invalid event bookmark: %q", s)
+	}
+	for _, e := range root.children() {
+		if e.Name != "Bookmark" {
+			continue
+		}
+		channel, _ := e.attr("Channel")
+		id, _ := e.attr("RecordId")
+		recordID, err := strconv.ParseUint(id, 10, 64)
+		if channel == "" || err != nil {
+			return nil, fmt.Errorf("Invalid event bookmark: %q", s)
+		}
+		b.update(channel, recordID)
+		if current, _ := e.attr("IsCurrent"); current == "true" {
+			b.current = channel
+		}
+	}
+	return b, nil
+}
+
+// update moves the bookmark for channel to recordID, returning false if it
+// was already there or past it.
+func (b *eventBookmark) update(channel string, recordID uint64) bool {
+	last, ok := b.records[channel]
+	if ok && recordID <= last {
+		return false
+	}
+	if !ok {
+		b.channels = append(b.channels, channel)
+	}
+	b.records[channel] = recordID
+	b.current = channel
+	return true
+}
+
+// xml renders the bookmark in the format EvtCreateBookmark reads.
+func (b *eventBookmark) xml() string {
+	var sb strings.Builder
+	sb.WriteString("<BookmarkList>\r\n")
+	for _, channel := range b.channels {
+		sb.WriteString("  <Bookmark Channel='")
+		xmlEscape(&sb, channel, true)
+		sb.WriteString("' RecordId='")
+		sb.WriteString(strconv.FormatUint(b.records[channel], 10))
+		sb.WriteString("'")
+		if channel == b.current {
+			sb.WriteString(" IsCurrent='true'")
+		}
+		sb.WriteString("/>\r\n")
+	}
+	sb.WriteString("</BookmarkList>")
+	return sb.String()
+}
+
+// EventBookmarkStore persists a subscription's bookmark, an XML fragment
+// produced by the event log, between runs.
+type EventBookmarkStore interface {
+	// LoadBookmark returns the saved bookmark, or "" if there isn't one.
+	LoadBookmark() (string, error)
+	SaveBookmark(bookmark string) error
+}
+
+// FileBookmarkStore is an EventBookmarkStore keeping the bookmark in the file
+// at its path. The file is replaced, rather than rewritten, on each save so
+// that it's never left half written.
+type FileBookmarkStore string
+
+// LoadBookmark reads the bookmark file, returning "" if it doesn't exist.
+func (f FileBookmarkStore) LoadBookmark() (string, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Unable to read bookmark: %s", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SaveBookmark writes bookmark to a temporary file beside the bookmark file,
+// then moves it into place.
+func (f FileBookmarkStore) SaveBookmark(bookmark string) error {
+	path := string(f)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("Unable to save bookmark: %s", err)
+	}
+	_, err = tmp.WriteString(bookmark)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Unable to save bookmark: %s", err)
+	}
+	return nil
+}
+
+// eventQuery returns the query for a channel and XPath filter, restricted to
+// events created in [since, until) when either is set.
+//
+// XPath filters can't reliably be combined with another condition, as the
+// event log only supports a subset of XPath, so a time range is applied by
+// wrapping the filter in a structured query, suppressing events outside it.
+// See: https://docs.microsoft.com/en-us/windows/win32/wes/consuming-events#xpath-10-limitations
+func eventQuery(channel string, xpath string, since time.Time, until time.Time) (string, error) {
+	xpath = strings.TrimSpace(xpath)
+	structured := strings.HasPrefix(xpath, "<")
+	if structured && (!since.IsZero() || !until.IsZero()) {
+		return "", fmt.Errorf("A time range can't be applied to a structured query")
+	}
+	if structured {
+		return xpath, nil
+	}
+	if xpath == "" {
+		xpath = "*"
+	}
+	if since.IsZero() && until.IsZero() {
+		return xpath, nil
+	}
+	if channel == "" {
+		return "", fmt.Errorf("A channel is required to query a time range")
+	}
+
+	var b strings.Builder
+	path := func() {
+		b.WriteString(" Path='")
+		xmlEscape(&b, channel, true)
+		b.WriteString("'>")
+	}
+	b.WriteString("<QueryList><Query Id='0'")
+	path()
+	b.WriteString("<Select")
+	path()
+	xmlEscape(&b, xpath, false)
+	b.WriteString("</Select>")
+	if !since.IsZero() {
+		b.WriteString("<Suppress")
+		path()
+		xmlEscape(&b, "*[System[TimeCreated[@SystemTime<'"+since.UTC().Format(eventQueryTimeFormat)+"']]]", false)
+		b.WriteString("</Suppress>")
+	}
+	if !until.IsZero() {
+		b.WriteString("<Suppress")
+		path()
+		xmlEscape(&b, "*[System[TimeCreated[@SystemTime>='"+until.UTC().Format(eventQueryTimeFormat)+"']]]", false)
+		b.WriteString("</Suppress>")
+	}
+	b.WriteString("</Query></QueryList>")
+	return b.String(), nil
+}
+
+// eventFromRenderedXML parses an event rendered as XML by EvtRender, keeping
+// the XML itself in the event.
+func eventFromRenderedXML(s string) (so.Event, error) {
+	root, err := parseEventXML(s)
+	if err != nil {
+		return so.Event{}, err
+	}
+	if root.Name != "Event" {
+		return so.Event{}, fmt.Errorf("Unable to parse event XML: unexpected <%s> element", root.Name)
+	}
+	ev := eventFromXML(root)
+	ev.XML = s
+	return ev, nil
+}
+
+// parseEventXML parses XML text into an element tree. Namespaces are
+// dropped, leaving the local names eventFromXML looks for.
+func parseEventXML(s string) (*xmlElement, error) {
+	d := xml.NewDecoder(strings.NewReader(s))
+	var (
+		root  *xmlElement
+		stack []*xmlElement
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse event XML: %s", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &xmlElement{Name: t.Name.Local}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				e.Attrs = append(e.Attrs, xmlAttr{Name: a.Name.Local, Value: a.Value})
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Nodes = append(parent.Nodes, xmlNode{Elem: e})
+			} else if root == nil {
+				root = e
+			} else {
+				return nil, fmt.Errorf("Unable to parse event XML: more than one root element")
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Nodes = append(parent.Nodes, xmlNode{Text: string(t)})
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("Unable to parse event XML: no root element")
+	}
+	return root, nil
+}
@@ -0,0 +1,262 @@
+package winapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// renderedLogon is a 4624 event as EvtRender returns it.
+const renderedLogon = `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System>` +
+	`<Provider Name='Microsoft-Windows-Security-Auditing' Guid='{54849625-5478-4994-A5BA-3E3B0328C30D}'/>` +
+	`<EventID>4624</EventID><Version>2</Version><Level>0</Level><Task>12544</Task><Opcode>0</Opcode>` +
+	`<Keywords>0x8020000000000000</Keywords><TimeCreated SystemTime='2020-03-02T09:15:30.1234567Z'/>` +
+	`<EventRecordID>3</EventRecordID><Correlation ActivityID='{B4F1A2C3-0000-0000-0000-000000000001}'/>` +
+	`<Execution ProcessID='716' ThreadID='3392'/><Channel>Security</Channel>` +
+	`<Computer>PC01.corp.example.com</Computer><Security/></System><EventData>` +
+	`<Data Name='TargetUserName'>bob</Data><Data Name='TargetDomainName'>PC01</Data>` +
+	`<Data Name='LogonType'>10</Data><Data Name='WorkstationName'>LAPTOP7</Data>` +
+	`<Data Name='IpAddress'>192.0.2.10</Data><Data Name='ProcessName'>-</Data>` +
+	`<Data Name='Empty'></Data></EventData></Event>`
+
+func TestEventFromRenderedXML(t *testing.T) {
+	ev, err := eventFromRenderedXML(renderedLogon)
+	if err != nil {
+		t.Fatalf("eventFromRenderedXML: %s", err)
+	}
+	if ev.Provider != "Microsoft-Windows-Security-Auditing" || ev.ProviderGUID != "{54849625-5478-4994-A5BA-3E3B0328C30D}" ||
+		ev.EventID != 4624 || ev.Version != 2 || ev.Task != 12544 || ev.Keywords != 0x8020000000000000 ||
+		ev.RecordID != 3 || ev.ProcessID != 716 || ev.ThreadID != 3392 || ev.Channel != "Security" ||
+		ev.Computer != "PC01.corp.example.com" || ev.UserSID != "" || ev.XML != renderedLogon {
+		t.Errorf("eventFromRenderedXML = %+v", ev)
+	}
+	if want := time.Date(2020, 3, 2, 9, 15, 30, 123456700, time.UTC); !ev.TimeCreated.Equal(want) {
+		t.Errorf("TimeCreated = %s, want %s", ev.TimeCreated, want)
+	}
+	want := map[string]string{
+		"TargetUserName":   "bob",
+		"TargetDomainName": "PC01",
+		"LogonType":        "10",
+		"WorkstationName":  "LAPTOP7",
+		"IpAddress":        "192.0.2.10",
+		"ProcessName":      "-",
+		"Empty":            "",
+	}
+	if !reflect.DeepEqual(ev.Data, want) {
+		t.Errorf("Data = %v, want %v", ev.Data, want)
+	}
+}
+
+func TestEventFromRenderedXMLErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"<Event><System>",
+		"<Event/><Event/>",
+		"<Bookmark RecordId='1'/>",
+		"not xml",
+	} {
+		if ev, err := eventFromRenderedXML(s); err == nil {
+			t.Errorf("eventFromRenderedXML(%q) = %+v, want an error", s, ev)
+		}
+	}
+}
+
+// Events read from an .evtx file and those rendered by the event log have to
+// come out the same, so the XML the file reader produces is parsed back.
+func TestEventFromRenderedXMLMatchesEvtx(t *testing.T) {
+	events, err := ReadEvtxFile(securityEvtx)
+	if err != nil {
+		t.Fatalf("ReadEvtxFile: %s", err)
+	}
+	for _, want := range events {
+		got, err := eventFromRenderedXML(want.XML)
+		if err != nil {
+			t.Errorf("record %d: %s", want.RecordID, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("record %d:\n got %+v\nwant %+v", want.RecordID, got, want)
+		}
+	}
+}
+
+func TestEventQuery(t *testing.T) {
+	since := time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC)
+	until := time.Date(2020, 3, 3, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name         string
+		xpath        string
+		since, until time.Time
+		want         string
+	}{
+		{"all", "", time.Time{}, time.Time{}, "*"},
+		{"xpath", " *[System[(EventID=4624)]] ", time.Time{}, time.Time{}, "*[System[(EventID=4624)]]"},
+		{"structured", "<QueryList/>", time.Time{}, time.Time{}, "<QueryList/>"},
+		{"since", "", since, time.Time{}, "<QueryList><Query Id='0' Path='Security'>" +
+			"<Select Path='Security'>*</Select>" +
+			"<Suppress Path='Security'>*[System[TimeCreated[@SystemTime&lt;'2020-03-02T08:00:00.000Z']]]</Suppress>" +
+			"</Query></QueryList>"},
+		{"range", "*[System[(EventID=4624 or EventID=4625)]]", since, until, "<QueryList><Query Id='0' Path='Security'>" +
+			"<Select Path='Security'>*[System[(EventID=4624 or EventID=4625)]]</Select>" +
+			"<Suppress Path='Security'>*[System[TimeCreated[@SystemTime&lt;'2020-03-02T08:00:00.000Z']]]</Suppress>" +
+			"<Suppress Path='Security'>*[System[TimeCreated[@SystemTime&gt;='2020-03-03T08:30:00.000Z']]]</Suppress>" +
+			"</Query></QueryList>"},
+	}
+	for _, tt := range tests {
+		got, err := eventQuery("Security", tt.xpath, tt.since, tt.until)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+		if strings.HasPrefix(got, "<QueryList><") {
+			if _, err := parseEventXML(got); err != nil {
+				t.Errorf("%s: query isn't valid XML: %s", tt.name, err)
+			}
+		}
+	}
+
+	if _, err := eventQuery("Security", "<QueryList/>", since, time.Time{}); err == nil {
+		t.Errorf("a time range with a structured query should fail")
+	}
+	if _, err := eventQuery("", "", since, time.Time{}); err == nil {
+		t.Errorf("a time range without a channel should fail")
+	}
+}
+
+func TestFileBookmarkStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bookmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := FileBookmarkStore(filepath.Join(dir, "security.xml"))
+
+	if b, err := store.LoadBookmark(); b != "" || err != nil {
+		t.Errorf("LoadBookmark before saving = %q, %v", b, err)
+	}
+	for _, b := range []string{
+		"<BookmarkList><Bookmark Channel='Security' RecordId='3' IsCurrent='true'/></BookmarkList>",
+		"<BookmarkList><Bookmark Channel='Security' RecordId='12' IsCurrent='true'/></BookmarkList>",
+	} {
+		if err := store.SaveBookmark(b); err != nil {
+			t.Fatalf("SaveBookmark: %s", err)
+		}
+		if got, err := store.LoadBookmark(); got != b || err != nil {
+			t.Errorf("LoadBookmark = %q, %v, want %q", got, err, b)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("temporary files left behind: %d files", len(files))
+	}
+
+	if err := FileBookmarkStore(filepath.Join(dir, "missing", "b.xml")).SaveBookmark("x"); err == nil {
+		t.Errorf("saving to a missing directory should fail")
+	}
+}
+
+type memoryBookmarkStore struct {
+	saved []string
+}
+
+func (m *memoryBookmarkStore) LoadBookmark() (string, error) {
+	if len(m.saved) == 0 {
+		return "", nil
+	}
+	return m.saved[len(m.saved)-1], nil
+}
+
+func (m *memoryBookmarkStore) SaveBookmark(bookmark string) error {
+	m.saved = append(m.saved, bookmark)
+	return nil
+}
+
+func TestEventSubscriptionAck(t *testing.T) {
+	store := &memoryBookmarkStore{}
+	s, err := newEventSubscription(store, "", 0)
+	if err != nil {
+		t.Fatalf("newEventSubscription: %s", err)
+	}
+	if cap(s.events) != 64 {
+		t.Errorf("default buffer = %d, want 64", cap(s.events))
+	}
+
+	// Nothing is saved until an event is acknowledged.
+	if len(store.saved) != 0 {
+		t.Errorf("saved %v before any Ack", store.saved)
+	}
+	for _, ev := range []so.Event{
+		{Channel: "Security", RecordID: 10},
+		{Channel: "Security", RecordID: 12},
+		// Older than an event already acknowledged.
+		{Channel: "Security", RecordID: 11},
+		{Channel: "System", RecordID: 7},
+	} {
+		if err := s.Ack(ev); err != nil {
+			t.Fatalf("Ack(%d): %s", ev.RecordID, err)
+		}
+	}
+	want := []string{
+		"<BookmarkList>\r\n  <Bookmark Channel='Security' RecordId='10' IsCurrent='true'/>\r\n</BookmarkList>",
+		"<BookmarkList>\r\n  <Bookmark Channel='Security' RecordId='12' IsCurrent='true'/>\r\n</BookmarkList>",
+		"<BookmarkList>\r\n  <Bookmark Channel='Security' RecordId='12'/>\r\n  <Bookmark Channel='System' RecordId='7' IsCurrent='true'/>\r\n</BookmarkList>",
+	}
+	if !reflect.DeepEqual(store.saved, want) {
+		t.Errorf("saved %q, want %q", store.saved, want)
+	}
+	if err := s.Ack(so.Event{RecordID: 13}); err == nil {
+		t.Errorf("acknowledging an event without a channel should fail")
+	}
+
+	// A later subscription carries on from the saved bookmark.
+	s, err = newEventSubscription(store, store.saved[len(store.saved)-1], 8)
+	if err != nil {
+		t.Fatalf("newEventSubscription: %s", err)
+	}
+	if err := s.Ack(so.Event{Channel: "System", RecordID: 7}); err != nil || len(store.saved) != 3 {
+		t.Errorf("re-acknowledging the bookmarked event = %v, saved %d", err, len(store.saved))
+	}
+	if err := s.Ack(so.Event{Channel: "Security", RecordID: 13}); err != nil {
+		t.Fatalf("Ack: %s", err)
+	}
+	if got, want := store.saved[3], "<BookmarkList>\r\n  <Bookmark Channel='Security' RecordId='13' IsCurrent='true'/>\r\n  <Bookmark Channel='System' RecordId='7'/>\r\n</BookmarkList>"; got != want {
+		t.Errorf("saved %q, want %q", got, want)
+	}
+
+	// Without a store, Ack does nothing.
+	s, _ = newEventSubscription(nil, "", 0)
+	if err := s.Ack(so.Event{Channel: "Security", RecordID: 1}); err != nil {
+		t.Errorf("Ack without a store = %v", err)
+	}
+}
+
+func TestParseEventBookmark(t *testing.T) {
+	b, err := parseEventBookmark("<BookmarkList>\r\n  <Bookmark Channel='Microsoft-Windows-PowerShell/Operational' RecordId='5'/>\r\n  <Bookmark Channel='Security' RecordId='1234' IsCurrent='true'/>\r\n</BookmarkList>")
+	if err != nil {
+		t.Fatalf("parseEventBookmark: %s", err)
+	}
+	if want := []string{"Microsoft-Windows-PowerShell/Operational", "Security"}; !reflect.DeepEqual(b.channels, want) {
+		t.Errorf("channels = %v, want %v", b.channels, want)
+	}
+	if b.records["Security"] != 1234 || b.current != "Security" {
+		t.Errorf("parsed %+v", b)
+	}
+	for _, s := range []string{
+		"not xml",
+		"<Event/>",
+		"<BookmarkList><Bookmark RecordId='3'/></BookmarkList>",
+		"<BookmarkList><Bookmark Channel='Security' RecordId='x'/></BookmarkList>",
+	} {
+		if _, err := parseEventBookmark(s); err == nil {
+			t.Errorf("parseEventBookmark(%q) should fail", s)
+		}
+	}
+}
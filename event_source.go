@@ -0,0 +1,129 @@
+package winapi
+
+import (
+	"io"
+	"strings"
+)
+
+// Event types, for EventLogEntry.Type.
+const (
+	EVENTLOG_SUCCESS          = 0x0000
+	EVENTLOG_ERROR_TYPE       = 0x0001
+	EVENTLOG_WARNING_TYPE     = 0x0002
+	EVENTLOG_INFORMATION_TYPE = 0x0004
+	EVENTLOG_AUDIT_SUCCESS    = 0x0008
+	EVENTLOG_AUDIT_FAILURE    = 0x0010
+)
+
+const (
+	// DefaultEventMessageFile has a message for each event ID from 1 to
+	// 1000 that's simply the event's first insert, so sources without a
+	// message file of their own can log arbitrary text.
+	DefaultEventMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+
+	// maxEventInsertLength is the longest string ReportEvent accepts as an
+	// insert.
+	maxEventInsertLength = 31839
+)
+
+// EventSource describes an event source for RegisterEventSource.
+type EventSource struct {
+	// Name of the source, as shown in the event log.
+	Name string
+	// Log the source writes to, "Application" if empty.
+	Log string
+	// MessageFile is the DLL or executable holding the source's message
+	// table, DefaultEventMessageFile if empty. Environment variables such
+	// as %SystemRoot% are expanded by the event log.
+	MessageFile string
+	// CategoryMessageFile holds the messages naming CategoryCount
+	// categories, numbered from 1, if the source uses categories.
+	CategoryMessageFile string
+	CategoryCount       uint32
+	// ParameterMessageFile holds messages for %%n parameter inserts.
+	ParameterMessageFile string
+	// TypesSupported is a mask of the EVENTLOG_*_TYPE event types the
+	// source logs. Errors, warnings and information if zero.
+	TypesSupported uint32
+}
+
+// EventLogEntry is an event to write to the event log.
+//
+// EventID selects the message from the source's message file, and Inserts
+// replace its %1, %2 and so on. Category is zero unless the source has
+// categories. Data is binary data shown alongside the event.
+type EventLogEntry struct {
+	Type     uint16
+	Category uint16
+	EventID  uint32
+	Inserts  []string
+	Data     []byte
+}
+
+// EventReporter writes events to an event log. *EventLog is an EventReporter.
+type EventReporter interface {
+	Report(e EventLogEntry) error
+}
+
+// eventLogWriter writes each Write as an event.
+type eventLogWriter struct {
+	r        EventReporter
+	typ      uint16
+	category uint16
+	eventID  uint32
+}
+
+// NewEventLogWriter returns an io.Writer that writes each Write as an event of
+// the given type and ID, with the text as its only insert. It suits log.New,
+// which writes each line in a single call, and a source using
+// DefaultEventMessageFile with an event ID between 1 and 1000.
+func NewEventLogWriter(r EventReporter, typ uint16, category uint16, eventID uint32) io.Writer {
+	return &eventLogWriter{r: r, typ: typ, category: category, eventID: eventID}
+}
+
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	err := w.r.Report(EventLogEntry{
+		Type:     w.typ,
+		Category: w.category,
+		EventID:  w.eventID,
+		Inserts:  []string{msg},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// eventLogInserts prepares inserts for ReportEvent, which takes them as NUL
+// terminated strings of limited length, and shows bare line feeds poorly.
+func eventLogInserts(inserts []string) []string {
+	retVal := make([]string, len(inserts))
+	for i, s := range inserts {
+		s = strings.Replace(s, "\x00", "", -1)
+		s = strings.Replace(s, "\r\n", "\n", -1)
+		s = strings.Replace(s, "\n", "\r\n", -1)
+		if len(s) > maxEventInsertLength {
+			s = truncateUTF16(s, maxEventInsertLength)
+		}
+		retVal[i] = s
+	}
+	return retVal
+}
+
+// truncateUTF16 shortens s to at most n UTF-16 code units, without splitting
+// a character.
+func truncateUTF16(s string, n int) string {
+	units := 0
+	for i, r := range s {
+		size := 1
+		if r >= 0x10000 {
+			size = 2
+		}
+		if units+size > n {
+			return s[:i]
+		}
+		units += size
+	}
+	return s
+}
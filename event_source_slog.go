@@ -0,0 +1,113 @@
+//go:build go1.21
+// +build go1.21
+
+package winapi
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// EventLogHandlerOptions configures NewEventLogHandler.
+type EventLogHandlerOptions struct {
+	// Level is the minimum level logged, slog.LevelInfo if nil.
+	Level slog.Leveler
+	// EventID of the events written, 1 if zero. With
+	// DefaultEventMessageFile it must be between 1 and 1000.
+	EventID uint32
+	// Category of the events written.
+	Category uint16
+	// AddSource includes the source file and line of the log call.
+	AddSource bool
+}
+
+// EventLogHandler is a slog.Handler writing each record as an event, with
+// the message followed by its attributes, formatted as slog.TextHandler
+// does, as the only insert. Errors are written as error events, warnings as
+// warnings, and everything else as information.
+type EventLogHandler struct {
+	opts EventLogHandlerOptions
+	out  *eventLogOutput
+	text slog.Handler
+}
+
+// eventLogOutput is shared by an EventLogHandler and those derived from it,
+// as their text handlers all write to its buffer.
+type eventLogOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	r   EventReporter
+}
+
+// NewEventLogHandler returns a handler writing to r, such as an *EventLog.
+func NewEventLogHandler(r EventReporter, opts *EventLogHandlerOptions) *EventLogHandler {
+	h := &EventLogHandler{out: &eventLogOutput{r: r}}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	if h.opts.EventID == 0 {
+		h.opts.EventID = 1
+	}
+	h.text = slog.NewTextHandler(&h.out.buf, &slog.HandlerOptions{
+		AddSource: h.opts.AddSource,
+		Level:     h.opts.Level,
+		// The event log records the time and level itself, and the
+		// message is written separately.
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return h
+}
+
+func (h *EventLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *EventLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.text.Handle(ctx, r); err != nil {
+		return err
+	}
+	msg := r.Message
+	if attrs := strings.TrimSpace(h.out.buf.String()); attrs != "" {
+		msg += " " + attrs
+	}
+	return h.out.r.Report(EventLogEntry{
+		Type:     eventLogTypeForLevel(r.Level),
+		Category: h.opts.Category,
+		EventID:  h.opts.EventID,
+		Inserts:  []string{msg},
+	})
+}
+
+func (h *EventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &EventLogHandler{opts: h.opts, out: h.out, text: h.text.WithAttrs(attrs)}
+}
+
+func (h *EventLogHandler) WithGroup(name string) slog.Handler {
+	return &EventLogHandler{opts: h.opts, out: h.out, text: h.text.WithGroup(name)}
+}
+
+func eventLogTypeForLevel(level slog.Level) uint16 {
+	switch {
+	case level >= slog.LevelError:
+		return EVENTLOG_ERROR_TYPE
+	case level >= slog.LevelWarn:
+		return EVENTLOG_WARNING_TYPE
+	default:
+		return EVENTLOG_INFORMATION_TYPE
+	}
+}
@@ -0,0 +1,53 @@
+//go:build go1.21
+// +build go1.21
+
+package winapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventLogHandler(t *testing.T) {
+	r := &fakeEventReporter{}
+	logger := slog.New(NewEventLogHandler(r, &EventLogHandlerOptions{EventID: 7, Category: 3}))
+
+	logger.Debug("not logged")
+	logger.Info("agent started", "version", "1.2.3")
+	logger.With("component", "updater").WithGroup("job").Warn("check failed", "id", 42, "err", errors.New("timed out"))
+	logger.Error("stopping")
+
+	want := []EventLogEntry{
+		{Type: EVENTLOG_INFORMATION_TYPE, Category: 3, EventID: 7, Inserts: []string{"agent started version=1.2.3"}},
+		{Type: EVENTLOG_WARNING_TYPE, Category: 3, EventID: 7, Inserts: []string{`check failed component=updater job.id=42 job.err="timed out"`}},
+		{Type: EVENTLOG_ERROR_TYPE, Category: 3, EventID: 7, Inserts: []string{"stopping"}},
+	}
+	if !reflect.DeepEqual(r.entries, want) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", r.entries, want)
+	}
+}
+
+func TestEventLogHandlerDefaults(t *testing.T) {
+	r := &fakeEventReporter{}
+	h := NewEventLogHandler(r, nil)
+	logger := slog.New(h)
+	logger.Info("hello")
+	if len(r.entries) != 1 || r.entries[0].EventID != 1 || r.entries[0].Inserts[0] != "hello" {
+		t.Errorf("entries = %+v", r.entries)
+	}
+
+	var level slog.LevelVar
+	level.Set(slog.LevelDebug)
+	r = &fakeEventReporter{err: errors.New("log full")}
+	h = NewEventLogHandler(r, &EventLogHandlerOptions{Level: &level})
+	if !h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("debug should be enabled by the level var")
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "x", 0)); err != r.err {
+		t.Errorf("Handle = %v, want the reporter's error", err)
+	}
+}
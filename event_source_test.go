@@ -0,0 +1,55 @@
+package winapi
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeEventReporter records the events written to it.
+type fakeEventReporter struct {
+	entries []EventLogEntry
+	err     error
+}
+
+func (r *fakeEventReporter) Report(e EventLogEntry) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+func TestEventLogWriter(t *testing.T) {
+	r := &fakeEventReporter{}
+	logger := log.New(NewEventLogWriter(r, EVENTLOG_WARNING_TYPE, 2, 100), "agent: ", 0)
+	logger.Println("disk nearly full")
+	logger.Printf("retrying in %ds\n", 5)
+
+	want := []EventLogEntry{
+		{Type: EVENTLOG_WARNING_TYPE, Category: 2, EventID: 100, Inserts: []string{"agent: disk nearly full"}},
+		{Type: EVENTLOG_WARNING_TYPE, Category: 2, EventID: 100, Inserts: []string{"agent: retrying in 5s"}},
+	}
+	if !reflect.DeepEqual(r.entries, want) {
+		t.Errorf("entries = %+v, want %+v", r.entries, want)
+	}
+
+	r.err = errors.New("log full")
+	if n, err := NewEventLogWriter(r, EVENTLOG_ERROR_TYPE, 0, 1).Write([]byte("x\n")); n != 0 || err != r.err {
+		t.Errorf("Write = %d, %v, want the reporter's error", n, err)
+	}
+}
+
+func TestEventLogInserts(t *testing.T) {
+	long := strings.Repeat("a", maxEventInsertLength-1) + "😀"
+	got := eventLogInserts([]string{"a\x00b", "line 1\nline 2\r\nline 3", long, ""})
+	want := []string{"ab", "line 1\r\nline 2\r\nline 3", strings.Repeat("a", maxEventInsertLength-1), ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("eventLogInserts = %q (long insert %d bytes), want %q", got[:2], len(got[2]), want[:2])
+	}
+	if s := strings.Repeat("é", maxEventInsertLength); eventLogInserts([]string{s})[0] != s {
+		t.Errorf("inserts within the limit in UTF-16 should be left whole")
+	}
+}
@@ -0,0 +1,240 @@
+package winapi
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// xmlElement is an element of an event's XML, however it was obtained.
+type xmlElement struct {
+	Name  string
+	Attrs []xmlAttr
+	Nodes []xmlNode
+}
+
+type xmlAttr struct {
+	Name  string
+	Value string
+}
+
+// xmlNode is a child of an element: another element, or text if Elem is nil.
+type xmlNode struct {
+	Elem *xmlElement
+	Text string
+}
+
+// attr returns the value of the named attribute.
+func (e *xmlElement) attr(name string) (string, bool) {
+	for _, a := range e.Attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// child returns the first child element with the given name.
+func (e *xmlElement) child(name string) *xmlElement {
+	for _, n := range e.Nodes {
+		if n.Elem != nil && n.Elem.Name == name {
+			return n.Elem
+		}
+	}
+	return nil
+}
+
+// children returns the element's child elements.
+func (e *xmlElement) children() []*xmlElement {
+	retVal := make([]*xmlElement, 0, len(e.Nodes))
+	for _, n := range e.Nodes {
+		if n.Elem != nil {
+			retVal = append(retVal, n.Elem)
+		}
+	}
+	return retVal
+}
+
+// text returns the element's text content, including that of its
+// descendants.
+func (e *xmlElement) text() string {
+	var b strings.Builder
+	for _, n := range e.Nodes {
+		if n.Elem != nil {
+			b.WriteString(n.Elem.text())
+		} else {
+			b.WriteString(n.Text)
+		}
+	}
+	return b.String()
+}
+
+// renderXML writes the element the way EvtRender does, on a single line with
+// single quoted attributes.
+func (e *xmlElement) renderXML(b *strings.Builder) {
+	b.WriteByte('<')
+	b.WriteString(e.Name)
+	for _, a := range e.Attrs {
+		b.WriteByte(' ')
+		b.WriteString(a.Name)
+		b.WriteString("='")
+		xmlEscape(b, a.Value, true)
+		b.WriteByte('\'')
+	}
+	if len(e.Nodes) == 0 {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteByte('>')
+	for _, n := range e.Nodes {
+		if n.Elem != nil {
+			n.Elem.renderXML(b)
+		} else {
+			xmlEscape(b, n.Text, false)
+		}
+	}
+	b.WriteString("</")
+	b.WriteString(e.Name)
+	b.WriteByte('>')
+}
+
+func (e *xmlElement) xml() string {
+	var b strings.Builder
+	e.renderXML(&b)
+	return b.String()
+}
+
+func xmlEscape(b *strings.Builder, s string, attr bool) {
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '\'' && attr:
+			b.WriteString("&apos;")
+		case r == '"' && attr:
+			b.WriteString("&quot;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// eventFromXML fills in an Event from the <Event> element of its XML.
+// Fields that are missing or malformed are left at their zero values, as
+// providers are free to leave most of System out.
+func eventFromXML(root *xmlElement) so.Event {
+	ev := so.Event{}
+	if sys := root.child("System"); sys != nil {
+		if p := sys.child("Provider"); p != nil {
+			ev.Provider, _ = p.attr("Name")
+			ev.ProviderGUID, _ = p.attr("Guid")
+			if ev.Provider == "" {
+				ev.Provider, _ = p.attr("EventSourceName")
+			}
+		}
+		if id := sys.child("EventID"); id != nil {
+			ev.EventID = uint16(parseXMLUint(id.text(), 16))
+			if q, ok := id.attr("Qualifiers"); ok {
+				ev.Qualifiers = uint16(parseXMLUint(q, 16))
+			}
+		}
+		ev.Version = uint8(parseXMLUint(childText(sys, "Version"), 8))
+		ev.Level = uint8(parseXMLUint(childText(sys, "Level"), 8))
+		ev.Task = uint16(parseXMLUint(childText(sys, "Task"), 16))
+		ev.Opcode = uint8(parseXMLUint(childText(sys, "Opcode"), 8))
+		ev.Keywords = parseXMLUint(childText(sys, "Keywords"), 64)
+		if tc := sys.child("TimeCreated"); tc != nil {
+			if st, ok := tc.attr("SystemTime"); ok {
+				if t, err := time.Parse(time.RFC3339Nano, st); err == nil {
+					ev.TimeCreated = t.UTC()
+				}
+			}
+		}
+		ev.RecordID = parseXMLUint(childText(sys, "EventRecordID"), 64)
+		if c := sys.child("Correlation"); c != nil {
+			ev.ActivityID, _ = c.attr("ActivityID")
+		}
+		if ex := sys.child("Execution"); ex != nil {
+			pid, _ := ex.attr("ProcessID")
+			tid, _ := ex.attr("ThreadID")
+			ev.ProcessID = uint32(parseXMLUint(pid, 32))
+			ev.ThreadID = uint32(parseXMLUint(tid, 32))
+		}
+		ev.Channel = childText(sys, "Channel")
+		ev.Computer = childText(sys, "Computer")
+		if sec := sys.child("Security"); sec != nil {
+			ev.UserSID, _ = sec.attr("UserID")
+		}
+	}
+	ev.Data = eventDataFromXML(root)
+	return ev
+}
+
+// eventDataFromXML collects the fields of an event's EventData or UserData.
+//
+// EventData holds <Data Name='...'> elements, or unnamed ones from classic
+// sources, which are numbered from 1. UserData holds a single provider
+// defined element whose children are the fields.
+func eventDataFromXML(root *xmlElement) map[string]string {
+	var fields []*xmlElement
+	named := false
+	if ed := root.child("EventData"); ed != nil {
+		fields = ed.children()
+		named = true
+	} else if ud := root.child("UserData"); ud != nil {
+		for _, e := range ud.children() {
+			fields = append(fields, e.children()...)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	retVal := make(map[string]string, len(fields))
+	unnamed := 0
+	for _, f := range fields {
+		name := f.Name
+		if named && f.Name == "Data" {
+			if n, ok := f.attr("Name"); ok && n != "" {
+				name = n
+			} else {
+				unnamed++
+				name = strconv.Itoa(unnamed)
+			}
+		}
+		retVal[name] = f.text()
+	}
+	return retVal
+}
+
+func childText(e *xmlElement, name string) string {
+	if c := e.child(name); c != nil {
+		return strings.TrimSpace(c.text())
+	}
+	return ""
+}
+
+// parseXMLUint parses a decimal or 0x prefixed hexadecimal value, returning
+// zero if it isn't valid.
+func parseXMLUint(s string, bits int) uint64 {
+	s = strings.TrimSpace(s)
+	var (
+		v   uint64
+		err error
+	)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err = strconv.ParseUint(s[2:], 16, bits)
+	} else {
+		v, err = strconv.ParseUint(s, 10, bits)
+	}
+	if err != nil {
+		return 0
+	}
+	return v
+}
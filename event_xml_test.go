@@ -0,0 +1,69 @@
+package winapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func elem(name string, attrs []xmlAttr, nodes ...xmlNode) xmlNode {
+	return xmlNode{Elem: &xmlElement{Name: name, Attrs: attrs, Nodes: nodes}}
+}
+
+func text(s string) xmlNode {
+	return xmlNode{Text: s}
+}
+
+func TestEventFromXMLClassic(t *testing.T) {
+	// A classic event source, with qualifiers and unnamed inserts.
+	root := elem("Event", nil,
+		elem("System", nil,
+			elem("Provider", []xmlAttr{{"Name", "MsiInstaller"}}),
+			elem("EventID", []xmlAttr{{"Qualifiers", "0"}}, text("11707")),
+			elem("Level", nil, text("4")),
+			elem("Keywords", nil, text("0x80000000000000")),
+			elem("TimeCreated", []xmlAttr{{"SystemTime", "2020-03-02T08:00:00.5Z"}}),
+			elem("Security", []xmlAttr{{"UserID", "S-1-5-18"}}),
+		),
+		elem("EventData", nil,
+			elem("Data", nil, text("Product: Tools -- Installation completed successfully.")),
+			elem("Data", nil, text("(NULL)")),
+			elem("Binary", nil, text("7B41")),
+		),
+	).Elem
+
+	ev := eventFromXML(root)
+	if ev.Provider != "MsiInstaller" || ev.EventID != 11707 || ev.Level != 4 || ev.Keywords != 0x80000000000000 ||
+		ev.UserSID != "S-1-5-18" || ev.TimeCreated.Nanosecond() != 500000000 {
+		t.Errorf("eventFromXML = %+v", ev)
+	}
+	want := map[string]string{
+		"1":      "Product: Tools -- Installation completed successfully.",
+		"2":      "(NULL)",
+		"Binary": "7B41",
+	}
+	if !reflect.DeepEqual(ev.Data, want) {
+		t.Errorf("Data = %v, want %v", ev.Data, want)
+	}
+}
+
+func TestEventFromXMLMalformed(t *testing.T) {
+	root := elem("Event", nil,
+		elem("System", nil,
+			elem("EventID", nil, text("70000")),
+			elem("Execution", []xmlAttr{{"ProcessID", "x"}}),
+			elem("TimeCreated", []xmlAttr{{"SystemTime", "yesterday"}}),
+		),
+	).Elem
+	ev := eventFromXML(root)
+	if ev.EventID != 0 || ev.ProcessID != 0 || !ev.TimeCreated.IsZero() || ev.Data != nil {
+		t.Errorf("malformed fields should be left empty: %+v", ev)
+	}
+}
+
+func TestXMLRender(t *testing.T) {
+	e := elem("Data", []xmlAttr{{"Name", `it's "quoted"`}}, text("a < b & c > d"), elem("Empty", nil)).Elem
+	want := `<Data Name='it&apos;s &quot;quoted&quot;'>a &lt; b &amp; c &gt; d<Empty/></Data>`
+	if got := e.xml(); got != want {
+		t.Errorf("xml = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,293 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	modWevtapi        = syscall.NewLazyDLL("wevtapi.dll")
+	evtQuery          = modWevtapi.NewProc("EvtQuery")
+	evtSubscribe      = modWevtapi.NewProc("EvtSubscribe")
+	evtNext           = modWevtapi.NewProc("EvtNext")
+	evtRender         = modWevtapi.NewProc("EvtRender")
+	evtCreateBookmark = modWevtapi.NewProc("EvtCreateBookmark")
+	evtClose          = modWevtapi.NewProc("EvtClose")
+	procCreateEvent   = modKernel32.NewProc("CreateEventW")
+	procResetEvent    = modKernel32.NewProc("ResetEvent")
+)
+
+const (
+	evtQueryChannelPath      = 0x1
+	evtQueryForwardDirection = 0x100
+	evtQueryReverseDirection = 0x200
+
+	evtSubscribeToFutureEvents      = 1
+	evtSubscribeStartAtOldestRecord = 2
+	evtSubscribeStartAfterBookmark  = 3
+
+	evtRenderEventXml = 1
+
+	evtErrorInsufficientBuffer syscall.Errno = 122
+	evtErrorNoMoreItems        syscall.Errno = 259
+	evtErrorTimeout            syscall.Errno = 1460
+
+	// Initial size of the buffer events are rendered into, in bytes.
+	evtRenderBufferSize = 4096
+
+	// How many event handles are fetched by each EvtNext call.
+	evtBatchSize = 64
+
+	// How long a subscription waits for its signal before checking whether
+	// its context is done.
+	evtWaitMilliseconds = 500
+)
+
+// QueryEvents returns the events in a channel matching opts, oldest first
+// unless opts.Reverse is set. Events that can't be rendered are skipped, and
+// the first such error is returned along with the rest.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtquery
+func QueryEvents(opts EventQueryOptions) ([]so.Event, error) {
+	query, err := eventQuery(opts.Channel, opts.XPath, opts.Since, opts.Until)
+	if err != nil {
+		return nil, err
+	}
+	var path *uint16
+	if query[0] != '<' {
+		if opts.Channel == "" {
+			return nil, fmt.Errorf("A channel is required to query events")
+		}
+		path, _ = syscall.UTF16PtrFromString(opts.Channel)
+	}
+	queryPtr, err := syscall.UTF16PtrFromString(query)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid event query: %s", err)
+	}
+	flags := uintptr(evtQueryChannelPath | evtQueryForwardDirection)
+	if opts.Reverse {
+		flags = evtQueryChannelPath | evtQueryReverseDirection
+	}
+
+	results, _, lastError := evtQuery.Call(0, uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(queryPtr)), flags)
+	if results == 0 {
+		return nil, fmt.Errorf("Unable to query events: %s", lastError)
+	}
+	defer evtClose.Call(results)
+
+	var (
+		events   = make([]so.Event, 0)
+		firstErr error
+		handles  [evtBatchSize]uintptr
+	)
+	for opts.MaxEvents <= 0 || len(events) < opts.MaxEvents {
+		n, err := evtNextHandles(results, handles[:], syscall.INFINITE)
+		if err != nil {
+			return events, err
+		}
+		if n == 0 {
+			break
+		}
+		for _, h := range handles[:n] {
+			if opts.MaxEvents <= 0 || len(events) < opts.MaxEvents {
+				ev, err := renderEvent(h)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					events = append(events, ev)
+				}
+			}
+			evtClose.Call(h)
+		}
+	}
+	return events, firstErr
+}
+
+// SubscribeEvents starts an EventSubscription delivering the events logged to
+// a channel, matching opts.XPath, until ctx is done. opts.Channel isn't needed
+// if opts.XPath is a structured query.
+//
+// With opts.Bookmarks the subscription resumes after the saved bookmark, and
+// saves a new one as events are acknowledged with EventSubscription.Ack.
+// Events delivered but not yet acknowledged when the process stops, including
+// those still buffered in the events channel, are delivered again by the next
+// subscription. If the bookmarked event has since been overwritten, the
+// subscription starts with the oldest event.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtsubscribe
+func SubscribeEvents(ctx context.Context, opts EventSubscribeOptions) (*EventSubscription, error) {
+	query, err := eventQuery(opts.Channel, opts.XPath, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	var channelPtr *uint16
+	if query[0] != '<' {
+		if opts.Channel == "" {
+			return nil, fmt.Errorf("A channel is required to subscribe to events")
+		}
+		channelPtr, _ = syscall.UTF16PtrFromString(opts.Channel)
+	}
+	queryPtr, err := syscall.UTF16PtrFromString(query)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid event query: %s", err)
+	}
+
+	flags := uintptr(evtSubscribeToFutureEvents)
+	if opts.StartAtOldest {
+		flags = evtSubscribeStartAtOldestRecord
+	}
+	saved := ""
+	if opts.Bookmarks != nil {
+		if saved, err = opts.Bookmarks.LoadBookmark(); err != nil {
+			return nil, err
+		}
+	}
+	s, err := newEventSubscription(opts.Bookmarks, saved, opts.BufferSize)
+	if err != nil {
+		return nil, err
+	}
+	var bookmark uintptr
+	if saved != "" {
+		savedPtr, err := syscall.UTF16PtrFromString(saved)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid event bookmark: %s", err)
+		}
+		var lastError error
+		bookmark, _, lastError = evtCreateBookmark.Call(uintptr(unsafe.Pointer(savedPtr)))
+		if bookmark == 0 {
+			return nil, fmt.Errorf("Unable to create event bookmark: %s", lastError)
+		}
+		// The subscription keeps its own copy of the bookmark.
+		defer evtClose.Call(bookmark)
+		flags = evtSubscribeStartAfterBookmark
+	}
+
+	// The signal is manual reset, and left set by the subscription while
+	// there are events to read.
+	signal, _, lastError := procCreateEvent.Call(0, 1, 1, 0)
+	if signal == 0 {
+		return nil, fmt.Errorf("Unable to create event: %s", lastError)
+	}
+	sub, _, lastError := evtSubscribe.Call(0, signal, uintptr(unsafe.Pointer(channelPtr)), uintptr(unsafe.Pointer(queryPtr)), bookmark, 0, 0, flags)
+	if sub == 0 {
+		procCloseHandle.Call(signal)
+		return nil, fmt.Errorf("Unable to subscribe to events: %s", lastError)
+	}
+
+	go func() {
+		defer close(s.events)
+		defer procCloseHandle.Call(signal)
+		defer evtClose.Call(sub)
+
+		report := func(err error) {
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+		}
+		var handles [evtBatchSize]uintptr
+		for {
+			ret, _, _ := procWaitForSingleObject.Call(signal, evtWaitMilliseconds)
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			if ret != PROC_WAIT_OBJECT_0 {
+				continue
+			}
+			procResetEvent.Call(signal)
+
+			for {
+				n, err := evtNextHandles(sub, handles[:], 0)
+				if err != nil {
+					report(err)
+					break
+				}
+				if n == 0 {
+					break
+				}
+				for i, h := range handles[:n] {
+					ev, err := renderEvent(h)
+					if err != nil {
+						report(err)
+					} else {
+						select {
+						case s.events <- ev:
+						case <-ctx.Done():
+							for _, rest := range handles[i:n] {
+								evtClose.Call(rest)
+							}
+							return
+						}
+					}
+					evtClose.Call(h)
+				}
+			}
+		}
+	}()
+	return s, nil
+}
+
+// evtNextHandles fills handles with the next events from a query or
+// subscription, returning how many there were. None are returned once there
+// are no more events, or none arrived before timeout.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtnext
+func evtNextHandles(results uintptr, handles []uintptr, timeout uint32) (int, error) {
+	var returned uint32
+	ret, _, lastError := evtNext.Call(
+		results,
+		uintptr(len(handles)),
+		uintptr(unsafe.Pointer(&handles[0])),
+		uintptr(timeout),
+		0,
+		uintptr(unsafe.Pointer(&returned)),
+	)
+	if ret == 0 {
+		if errno, ok := lastError.(syscall.Errno); ok && (errno == evtErrorNoMoreItems || errno == evtErrorTimeout) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Unable to read events: %s", lastError)
+	}
+	return int(returned), nil
+}
+
+// renderEvent renders an event handle as XML, and parses it into an Event.
+func renderEvent(h uintptr) (so.Event, error) {
+	s, err := evtRenderXML(h, evtRenderEventXml)
+	if err != nil {
+		return so.Event{}, err
+	}
+	return eventFromRenderedXML(s)
+}
+
+// evtRenderXML renders an event or bookmark handle as XML.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtrender
+func evtRenderXML(h uintptr, flags uint32) (string, error) {
+	buf := make([]uint16, evtRenderBufferSize/2)
+	for {
+		var used, count uint32
+		ret, _, lastError := evtRender.Call(
+			0,
+			h,
+			uintptr(flags),
+			uintptr(len(buf)*2),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(unsafe.Pointer(&used)),
+			uintptr(unsafe.Pointer(&count)),
+		)
+		if ret != 0 {
+			return syscall.UTF16ToString(buf), nil
+		}
+		if lastError.(syscall.Errno) != evtErrorInsufficientBuffer || int(used) <= len(buf)*2 {
+			return "", fmt.Errorf("Unable to render event: %s", lastError)
+		}
+		buf = make([]uint16, (used+1)/2)
+	}
+}
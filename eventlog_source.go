@@ -0,0 +1,176 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	advRegisterEventSource   = modAdvapi32.NewProc("RegisterEventSourceW")
+	advDeregisterEventSource = modAdvapi32.NewProc("DeregisterEventSource")
+	advReportEvent           = modAdvapi32.NewProc("ReportEventW")
+)
+
+const eventLogRegistryKey = `SYSTEM\CurrentControlSet\Services\EventLog`
+
+// EventLog is an event source opened for writing by OpenEventSource.
+type EventLog struct {
+	handle uintptr
+}
+
+// RegisterEventSource adds an event source to the registry, or updates it if
+// it's already there, so the event log can find its messages. Registering a
+// source requires administrator rights.
+// See: https://docs.microsoft.com/en-us/windows/win32/eventlog/event-sources
+func RegisterEventSource(src EventSource) error {
+	if src.Name == "" {
+		return fmt.Errorf("An event source name is required")
+	}
+	if src.Log == "" {
+		src.Log = "Application"
+	}
+	if src.MessageFile == "" {
+		src.MessageFile = DefaultEventMessageFile
+	}
+	if src.TypesSupported == 0 {
+		src.TypesSupported = EVENTLOG_ERROR_TYPE | EVENTLOG_WARNING_TYPE | EVENTLOG_INFORMATION_TYPE
+	}
+
+	k, _, err := registry.CreateKey(registry.LOCAL_MACHINE, eventLogRegistryKey+`\`+src.Log+`\`+src.Name, registry.SET_VALUE|registry.QUERY_VALUE)
+	if err != nil {
+		return fmt.Errorf("Unable to register event source %s: %s", src.Name, err)
+	}
+	defer k.Close()
+
+	set := func(name string, value string) error {
+		if value == "" {
+			if err := k.DeleteValue(name); err != nil && err != registry.ErrNotExist {
+				return err
+			}
+			return nil
+		}
+		return k.SetExpandStringValue(name, value)
+	}
+	if err = set("EventMessageFile", src.MessageFile); err == nil {
+		err = set("CategoryMessageFile", src.CategoryMessageFile)
+	}
+	if err == nil {
+		err = set("ParameterMessageFile", src.ParameterMessageFile)
+	}
+	if err == nil && src.CategoryMessageFile != "" {
+		err = k.SetDWordValue("CategoryCount", src.CategoryCount)
+	} else if err == nil {
+		if err = k.DeleteValue("CategoryCount"); err == registry.ErrNotExist {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = k.SetDWordValue("TypesSupported", src.TypesSupported)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to register event source %s: %s", src.Name, err)
+	}
+	return nil
+}
+
+// UnregisterEventSource removes an event source from the registry. The events
+// it wrote stay in the log, but their messages can no longer be shown. log is
+// "Application" if empty.
+func UnregisterEventSource(log string, name string) error {
+	if log == "" {
+		log = "Application"
+	}
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, eventLogRegistryKey+`\`+log, registry.ENUMERATE_SUB_KEYS|registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("Unable to unregister event source %s: %s", name, err)
+	}
+	defer k.Close()
+	if err := registry.DeleteKey(k, name); err != nil {
+		return fmt.Errorf("Unable to unregister event source %s: %s", name, err)
+	}
+	return nil
+}
+
+// OpenEventSource opens an event source for writing events. Sources that
+// aren't registered write to the Application log, but their events are shown
+// with a note that their description can't be found.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-registereventsourcew
+func OpenEventSource(name string) (*EventLog, error) {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid event source name: %s", err)
+	}
+	h, _, lastError := advRegisterEventSource.Call(0, uintptr(unsafe.Pointer(namePtr)))
+	if h == 0 {
+		return nil, fmt.Errorf("Unable to open event source %s: %s", name, lastError)
+	}
+	return &EventLog{handle: h}, nil
+}
+
+// Close closes the event source.
+func (l *EventLog) Close() error {
+	if ret, _, lastError := advDeregisterEventSource.Call(l.handle); ret == 0 {
+		return fmt.Errorf("Unable to close event source: %s", lastError)
+	}
+	return nil
+}
+
+// Report writes an event.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-reporteventw
+func (l *EventLog) Report(e EventLogEntry) error {
+	inserts := eventLogInserts(e.Inserts)
+	ptrs := make([]*uint16, len(inserts))
+	for i, s := range inserts {
+		// eventLogInserts has removed any NULs.
+		ptrs[i], _ = syscall.UTF16PtrFromString(s)
+	}
+	var (
+		strs uintptr
+		data uintptr
+	)
+	if len(ptrs) > 0 {
+		strs = uintptr(unsafe.Pointer(&ptrs[0]))
+	}
+	if len(e.Data) > 0 {
+		data = uintptr(unsafe.Pointer(&e.Data[0]))
+	}
+	ret, _, lastError := advReportEvent.Call(
+		l.handle,
+		uintptr(e.Type),
+		uintptr(e.Category),
+		uintptr(e.EventID),
+		0,
+		uintptr(len(ptrs)),
+		uintptr(len(e.Data)),
+		strs,
+		data,
+	)
+	runtime.KeepAlive(ptrs)
+	runtime.KeepAlive(e.Data)
+	if ret == 0 {
+		return fmt.Errorf("Unable to write event %d: %s", e.EventID, lastError)
+	}
+	return nil
+}
+
+// Info writes an information event with msg as its only insert.
+func (l *EventLog) Info(eventID uint32, msg string) error {
+	return l.Report(EventLogEntry{Type: EVENTLOG_INFORMATION_TYPE, EventID: eventID, Inserts: []string{msg}})
+}
+
+// Warning writes a warning event with msg as its only insert.
+func (l *EventLog) Warning(eventID uint32, msg string) error {
+	return l.Report(EventLogEntry{Type: EVENTLOG_WARNING_TYPE, EventID: eventID, Inserts: []string{msg}})
+}
+
+// Error writes an error event with msg as its only insert.
+func (l *EventLog) Error(eventID uint32, msg string) error {
+	return l.Report(EventLogEntry{Type: EVENTLOG_ERROR_TYPE, EventID: eventID, Inserts: []string{msg}})
+}
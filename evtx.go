@@ -0,0 +1,233 @@
+package winapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// .evtx layout: a 4KB file header followed by 64KB chunks, each holding a
+// 512 byte chunk header and event records in binary XML.
+// See: https://github.com/libyal/libevtx/blob/main/documentation/Windows%20XML%20Event%20Log%20(EVTX).asciidoc
+const (
+	evtxFileSignature     = "ElfFile\x00"
+	evtxChunkSignature    = "ElfChnk\x00"
+	evtxFileHeaderSize    = 4096
+	evtxChunkSize         = 65536
+	evtxChunkHeaderSize   = 512
+	evtxRecordSignature   = 0x00002a2a
+	evtxRecordHeaderSize  = 24
+	evtxRecordTrailerSize = 4
+)
+
+// EvtxHeader.Flags values.
+const (
+	EVTX_FLAG_DIRTY = 0x1
+	EVTX_FLAG_FULL  = 0x2
+)
+
+// EvtxHeader is the file header of an .evtx file. A log that wasn't closed
+// cleanly, such as one copied while in use, has EVTX_FLAG_DIRTY set and may
+// have more chunks than ChunkCount says.
+type EvtxHeader struct {
+	FirstChunk   uint64
+	LastChunk    uint64
+	NextRecordID uint64
+	MajorVersion uint16
+	MinorVersion uint16
+	ChunkCount   uint16
+	Flags        uint32
+}
+
+// EvtxReader reads the events in an .evtx file, in the order they're stored.
+//
+// Damaged chunks and records are reported as errors from Next, after which
+// reading carries on with the next record or chunk that can be read; only
+// io.EOF ends the file.
+type EvtxReader struct {
+	// SkipChecksums reads chunks whose CRCs don't match, which is common
+	// for the last chunk of a log copied while it was being written.
+	SkipChecksums bool
+
+	r      io.ReaderAt
+	header EvtxHeader
+
+	// The chunk being read, and the offset of its next record.
+	chunkIndex int64
+	chunk      []byte
+	parser     *binxmlParser
+	recordOff  int
+	recordEnd  int
+}
+
+// NewEvtxReader reads the file header from r.
+func NewEvtxReader(r io.ReaderAt) (*EvtxReader, error) {
+	buf := make([]byte, 128)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("Unable to read EVTX header: %s", err)
+	}
+	header, err := decodeEvtxHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &EvtxReader{r: r, header: header, chunkIndex: -1}, nil
+}
+
+// ReadEvtxFile returns every event that can be read from the .evtx file at
+// path. If parts of the file are damaged, the events from the rest of it are
+// returned along with the first error encountered.
+func ReadEvtxFile(path string) ([]so.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := NewEvtxReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		events   = make([]so.Event, 0)
+		firstErr error
+	)
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		events = append(events, *ev)
+	}
+	return events, firstErr
+}
+
+// Header returns the file header.
+func (r *EvtxReader) Header() EvtxHeader {
+	return r.header
+}
+
+// Next returns the next event, or io.EOF after the last.
+func (r *EvtxReader) Next() (*so.Event, error) {
+	for {
+		if r.chunk != nil && r.recordOff+evtxRecordHeaderSize <= r.recordEnd {
+			return r.nextRecord()
+		}
+		r.chunk = nil
+		r.chunkIndex++
+		buf := make([]byte, evtxChunkSize)
+		off := evtxFileHeaderSize + r.chunkIndex*evtxChunkSize
+		if n, err := r.r.ReadAt(buf, off); n < evtxChunkSize {
+			if err == nil || err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("Unable to read EVTX chunk %d: %s", r.chunkIndex, err)
+		}
+		if err := r.loadChunk(buf); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// loadChunk validates a chunk and makes it the one being read. Unused
+// chunks, which are all zero, are passed over.
+func (r *EvtxReader) loadChunk(buf []byte) error {
+	if !bytes.Equal(buf[:8], []byte(evtxChunkSignature)) {
+		if bytes.Equal(buf[:8], make([]byte, 8)) {
+			return nil
+		}
+		return fmt.Errorf("EVTX chunk %d has an invalid signature", r.chunkIndex)
+	}
+	freeOff := int(binary.LittleEndian.Uint32(buf[48:]))
+	if freeOff < evtxChunkHeaderSize || freeOff > evtxChunkSize {
+		return fmt.Errorf("EVTX chunk %d has an invalid free space offset %d", r.chunkIndex, freeOff)
+	}
+	if !r.SkipChecksums {
+		if sum := evtxChunkHeaderChecksum(buf); sum != binary.LittleEndian.Uint32(buf[124:]) {
+			return fmt.Errorf("EVTX chunk %d header checksum mismatch", r.chunkIndex)
+		}
+		if sum := crc32.ChecksumIEEE(buf[evtxChunkHeaderSize:freeOff]); sum != binary.LittleEndian.Uint32(buf[52:]) {
+			return fmt.Errorf("EVTX chunk %d records checksum mismatch", r.chunkIndex)
+		}
+	}
+	r.chunk = buf
+	r.parser = newBinxmlParser(buf)
+	r.recordOff = evtxChunkHeaderSize
+	r.recordEnd = freeOff
+	return nil
+}
+
+// nextRecord decodes the record at recordOff and moves on to the next. A
+// record whose size can't be trusted ends the chunk.
+func (r *EvtxReader) nextRecord() (*so.Event, error) {
+	off := r.recordOff
+	buf := r.chunk
+	if binary.LittleEndian.Uint32(buf[off:]) != evtxRecordSignature {
+		r.recordOff = r.recordEnd
+		return nil, fmt.Errorf("EVTX chunk %d has an invalid record signature at offset %d", r.chunkIndex, off)
+	}
+	size := int(binary.LittleEndian.Uint32(buf[off+4:]))
+	if size < evtxRecordHeaderSize+evtxRecordTrailerSize || off+size > r.recordEnd ||
+		int(binary.LittleEndian.Uint32(buf[off+size-4:])) != size {
+		r.recordOff = r.recordEnd
+		return nil, fmt.Errorf("EVTX chunk %d has an invalid record size at offset %d", r.chunkIndex, off)
+	}
+	r.recordOff += size
+
+	recordID := binary.LittleEndian.Uint64(buf[off+8:])
+	written := fileTimeToTime(binary.LittleEndian.Uint64(buf[off+16:]))
+	root, err := r.parser.parseRecord(off+evtxRecordHeaderSize, off+size-evtxRecordTrailerSize)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse EVTX record %d: %s", recordID, err)
+	}
+
+	ev := eventFromXML(root)
+	ev.XML = root.xml()
+	if ev.RecordID == 0 {
+		ev.RecordID = recordID
+	}
+	if ev.TimeCreated.IsZero() {
+		ev.TimeCreated = written
+	}
+	return &ev, nil
+}
+
+// decodeEvtxHeader decodes and checks the first 128 bytes of an .evtx file.
+func decodeEvtxHeader(buf []byte) (EvtxHeader, error) {
+	if len(buf) < 128 || !bytes.Equal(buf[:8], []byte(evtxFileSignature)) {
+		return EvtxHeader{}, fmt.Errorf("Not an EVTX file")
+	}
+	if sum := crc32.ChecksumIEEE(buf[:120]); sum != binary.LittleEndian.Uint32(buf[124:]) {
+		return EvtxHeader{}, fmt.Errorf("EVTX header checksum mismatch")
+	}
+	h := EvtxHeader{
+		FirstChunk:   binary.LittleEndian.Uint64(buf[8:]),
+		LastChunk:    binary.LittleEndian.Uint64(buf[16:]),
+		NextRecordID: binary.LittleEndian.Uint64(buf[24:]),
+		MinorVersion: binary.LittleEndian.Uint16(buf[36:]),
+		MajorVersion: binary.LittleEndian.Uint16(buf[38:]),
+		ChunkCount:   binary.LittleEndian.Uint16(buf[42:]),
+		Flags:        binary.LittleEndian.Uint32(buf[120:]),
+	}
+	if h.MajorVersion != 3 {
+		return h, fmt.Errorf("Unsupported EVTX version %d.%d", h.MajorVersion, h.MinorVersion)
+	}
+	return h, nil
+}
+
+// evtxChunkHeaderChecksum is the CRC32 of a chunk header, less the checksum
+// itself and the flags before it.
+func evtxChunkHeaderChecksum(buf []byte) uint32 {
+	sum := crc32.ChecksumIEEE(buf[:120])
+	return crc32.Update(sum, crc32.IEEETable, buf[128:evtxChunkHeaderSize])
+}
@@ -0,0 +1,679 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binary XML tokens. Those with binxmlHasMore set (0x40) are variants:
+// elements with attributes, or an attribute or value followed by another.
+// See: https://github.com/libyal/libevtx/blob/main/documentation/Windows%20XML%20Event%20Log%20(EVTX).asciidoc
+const (
+	binxmlEndOfStream          = 0x00
+	binxmlOpenStartElement     = 0x01
+	binxmlCloseStartElement    = 0x02
+	binxmlCloseEmptyElement    = 0x03
+	binxmlEndElement           = 0x04
+	binxmlValueText            = 0x05
+	binxmlAttribute            = 0x06
+	binxmlCDataSection         = 0x07
+	binxmlCharRef              = 0x08
+	binxmlEntityRef            = 0x09
+	binxmlPITarget             = 0x0a
+	binxmlPIData               = 0x0b
+	binxmlTemplateInstance     = 0x0c
+	binxmlNormalSubstitution   = 0x0d
+	binxmlOptionalSubstitution = 0x0e
+	binxmlFragmentHeader       = 0x0f
+
+	binxmlHasMore = 0x40
+)
+
+// Binary XML value types. binxmlArray is set for arrays of the base type.
+const (
+	binxmlTypeNull       = 0x00
+	binxmlTypeString     = 0x01
+	binxmlTypeAnsiString = 0x02
+	binxmlTypeInt8       = 0x03
+	binxmlTypeUint8      = 0x04
+	binxmlTypeInt16      = 0x05
+	binxmlTypeUint16     = 0x06
+	binxmlTypeInt32      = 0x07
+	binxmlTypeUint32     = 0x08
+	binxmlTypeInt64      = 0x09
+	binxmlTypeUint64     = 0x0a
+	binxmlTypeReal32     = 0x0b
+	binxmlTypeReal64     = 0x0c
+	binxmlTypeBool       = 0x0d
+	binxmlTypeBinary     = 0x0e
+	binxmlTypeGUID       = 0x0f
+	binxmlTypeSizeT      = 0x10
+	binxmlTypeFileTime   = 0x11
+	binxmlTypeSystemTime = 0x12
+	binxmlTypeSID        = 0x13
+	binxmlTypeHexInt32   = 0x14
+	binxmlTypeHexInt64   = 0x15
+	binxmlTypeBinXml     = 0x21
+
+	binxmlArray = 0x80
+)
+
+// binxmlMaxDepth bounds element and template nesting, so a corrupt record
+// can't recurse forever.
+const binxmlMaxDepth = 64
+
+// binxmlCursor reads little endian values from a chunk. Offsets are relative
+// to the start of the chunk, as the offsets within binary XML are. The first
+// out of range read is kept in err and later reads return zero values, so
+// callers can check once after a sequence of reads.
+type binxmlCursor struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (c *binxmlCursor) bytes(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || c.off+n > len(c.buf) {
+		c.err = fmt.Errorf("binary XML truncated reading %d bytes at offset %d", n, c.off)
+		return nil
+	}
+	b := c.buf[c.off : c.off+n]
+	c.off += n
+	return b
+}
+
+func (c *binxmlCursor) u8() uint8 {
+	if b := c.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (c *binxmlCursor) u16() uint16 {
+	if b := c.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (c *binxmlCursor) u32() uint32 {
+	if b := c.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// peek returns the next byte without consuming it, or false at the end.
+func (c *binxmlCursor) peek() (uint8, bool) {
+	if c.err != nil || c.off >= len(c.buf) {
+		return 0, false
+	}
+	return c.buf[c.off], true
+}
+
+// utf16 reads n UTF-16 code units.
+func (c *binxmlCursor) utf16(n int) string {
+	return utf16BytesToString(c.bytes(2 * n))
+}
+
+// binxmlNode is a node of parsed binary XML. Template definitions contain
+// substitutions (Subst) to be filled in with each instance's values; expanded
+// template instances and BinXml values are already resolved (Resolved).
+type binxmlNode struct {
+	Elem     *binxmlElement
+	Text     string
+	Subst    *binxmlSubst
+	Resolved []xmlNode
+}
+
+type binxmlElement struct {
+	Name  string
+	Attrs []binxmlAttr
+	Nodes []binxmlNode
+}
+
+type binxmlAttr struct {
+	Name  string
+	Value []binxmlNode
+}
+
+type binxmlSubst struct {
+	ID       uint16
+	Type     uint8
+	Optional bool
+}
+
+// binxmlValue is a substitution value of a template instance. Offset is
+// where Data starts in the chunk, which nested BinXml needs.
+type binxmlValue struct {
+	Type   uint8
+	Data   []byte
+	Offset int
+}
+
+// binxmlParser parses the binary XML in a chunk. Names and template
+// definitions are stored once per chunk and referenced by offset, so they're
+// cached for the life of the chunk.
+type binxmlParser struct {
+	chunk     []byte
+	names     map[uint32]string
+	templates map[uint32][]binxmlNode
+}
+
+func newBinxmlParser(chunk []byte) *binxmlParser {
+	return &binxmlParser{
+		chunk:     chunk,
+		names:     make(map[uint32]string),
+		templates: make(map[uint32][]binxmlNode),
+	}
+}
+
+// parseRecord parses the binary XML of an event record at [off, end) and
+// returns its root element.
+func (p *binxmlParser) parseRecord(off, end int) (*xmlElement, error) {
+	c := &binxmlCursor{buf: p.chunk[:end], off: off}
+	nodes, err := p.parseFragment(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := p.instantiate(nodes, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range resolved {
+		if n.Elem != nil {
+			return n.Elem, nil
+		}
+	}
+	return nil, fmt.Errorf("Event record at offset %d has no root element", off)
+}
+
+// parseFragment parses an optional fragment header and the content following
+// it, up to the end of stream.
+func (p *binxmlParser) parseFragment(c *binxmlCursor, depth int) ([]binxmlNode, error) {
+	if depth > binxmlMaxDepth {
+		return nil, fmt.Errorf("binary XML nested too deeply")
+	}
+	if tok, ok := c.peek(); ok && tok == binxmlFragmentHeader {
+		c.bytes(4) // token, major and minor version, flags
+	}
+	return p.parseContent(c, depth)
+}
+
+// parseContent parses nodes until an end of element or stream token, which
+// is consumed.
+func (p *binxmlParser) parseContent(c *binxmlCursor, depth int) ([]binxmlNode, error) {
+	nodes := make([]binxmlNode, 0)
+	for {
+		tok, ok := c.peek()
+		if !ok {
+			if c.err != nil {
+				return nil, c.err
+			}
+			// Running off the end of the record ends the stream.
+			return nodes, nil
+		}
+		switch tok &^ binxmlHasMore {
+		case binxmlEndOfStream, binxmlEndElement:
+			c.u8()
+			return nodes, nil
+		case binxmlFragmentHeader:
+			c.bytes(4)
+		case binxmlOpenStartElement:
+			e, err := p.parseElement(c, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, binxmlNode{Elem: e})
+		case binxmlTemplateInstance:
+			c.u8()
+			resolved, err := p.parseTemplateInstance(c, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, binxmlNode{Resolved: resolved})
+		case binxmlPITarget:
+			c.u8()
+			p.name(c)
+		case binxmlPIData:
+			c.u8()
+			c.utf16(int(c.u16()))
+		default:
+			n, err := p.parseValueNode(c)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		if c.err != nil {
+			return nil, c.err
+		}
+	}
+}
+
+// parseValueNode parses a token that can appear in content or an attribute's
+// value: text, a character or entity reference, or a substitution.
+func (p *binxmlParser) parseValueNode(c *binxmlCursor) (binxmlNode, error) {
+	tok := c.u8()
+	switch tok &^ binxmlHasMore {
+	case binxmlValueText:
+		if t := c.u8(); t != binxmlTypeString {
+			return binxmlNode{}, fmt.Errorf("Unsupported binary XML value type 0x%02x at offset %d", t, c.off-1)
+		}
+		return binxmlNode{Text: c.utf16(int(c.u16()))}, c.err
+	case binxmlCDataSection:
+		return binxmlNode{Text: c.utf16(int(c.u16()))}, c.err
+	case binxmlCharRef:
+		return binxmlNode{Text: string(rune(c.u16()))}, c.err
+	case binxmlEntityRef:
+		return binxmlNode{Text: xmlEntity(p.name(c))}, c.err
+	case binxmlNormalSubstitution, binxmlOptionalSubstitution:
+		s := &binxmlSubst{ID: c.u16(), Type: c.u8(), Optional: tok == binxmlOptionalSubstitution}
+		return binxmlNode{Subst: s}, c.err
+	}
+	if c.err != nil {
+		return binxmlNode{}, c.err
+	}
+	return binxmlNode{}, fmt.Errorf("Unexpected binary XML token 0x%02x at offset %d", tok, c.off-1)
+}
+
+// parseElement parses an element, from its open start element token.
+func (p *binxmlParser) parseElement(c *binxmlCursor, depth int) (*binxmlElement, error) {
+	if depth > binxmlMaxDepth {
+		return nil, fmt.Errorf("binary XML nested too deeply")
+	}
+	tok := c.u8()
+	c.u16() // dependency identifier
+	c.u32() // size
+	e := &binxmlElement{Name: p.name(c)}
+
+	if tok&binxmlHasMore != 0 {
+		c.u32() // size of the attribute list
+		for {
+			tok, ok := c.peek()
+			if !ok || tok&^binxmlHasMore != binxmlAttribute {
+				break
+			}
+			c.u8()
+			a := binxmlAttr{Name: p.name(c)}
+			for {
+				tok, ok := c.peek()
+				if !ok {
+					break
+				}
+				switch tok &^ binxmlHasMore {
+				case binxmlValueText, binxmlCharRef, binxmlEntityRef, binxmlNormalSubstitution, binxmlOptionalSubstitution:
+					n, err := p.parseValueNode(c)
+					if err != nil {
+						return nil, err
+					}
+					a.Value = append(a.Value, n)
+					continue
+				}
+				break
+			}
+			e.Attrs = append(e.Attrs, a)
+		}
+	}
+
+	switch tok := c.u8(); tok {
+	case binxmlCloseEmptyElement:
+	case binxmlCloseStartElement:
+		nodes, err := p.parseContent(c, depth)
+		if err != nil {
+			return nil, err
+		}
+		e.Nodes = nodes
+	default:
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, fmt.Errorf("Unexpected binary XML token 0x%02x closing <%s> at offset %d", tok, e.Name, c.off-1)
+	}
+	return e, c.err
+}
+
+// name reads a name offset and returns the name it refers to. Names are
+// stored inline the first time they're used in a chunk, in which case the
+// cursor is moved past them.
+func (p *binxmlParser) name(c *binxmlCursor) string {
+	off := c.u32()
+	if c.err != nil {
+		return ""
+	}
+	name, ok := p.names[off]
+	if !ok {
+		nc := &binxmlCursor{buf: p.chunk, off: int(off)}
+		nc.u32() // offset of the next name in the hash bucket
+		nc.u16() // hash
+		name = nc.utf16(int(nc.u16()))
+		nc.u16() // NUL terminator
+		if nc.err != nil {
+			c.err = fmt.Errorf("Invalid name at offset %d: %s", off, nc.err)
+			return ""
+		}
+		p.names[off] = name
+	}
+	if int(off) == c.off {
+		c.bytes(10 + 2*int(binary.LittleEndian.Uint16(p.chunk[off+6:])))
+	}
+	return name
+}
+
+// parseTemplateInstance parses a template instance, after its token, and
+// returns the template filled in with the instance's values.
+func (p *binxmlParser) parseTemplateInstance(c *binxmlCursor, depth int) ([]xmlNode, error) {
+	if depth > binxmlMaxDepth {
+		return nil, fmt.Errorf("binary XML nested too deeply")
+	}
+	c.u8()  // unknown
+	c.u32() // template identifier
+	defOff := c.u32()
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	tmpl, ok := p.templates[defOff]
+	if int(defOff) == c.off {
+		// The definition is inline, skip over it.
+		c.bytes(20) // offset of the next template, GUID
+		c.bytes(int(c.u32()))
+		if c.err != nil {
+			return nil, c.err
+		}
+	}
+	if !ok {
+		var err error
+		if tmpl, err = p.parseTemplate(defOff, depth); err != nil {
+			return nil, err
+		}
+		p.templates[defOff] = tmpl
+	}
+
+	count := int(c.u32())
+	descs := c.bytes(4 * count)
+	if c.err != nil {
+		return nil, c.err
+	}
+	values := make([]binxmlValue, count)
+	for i := range values {
+		size := int(binary.LittleEndian.Uint16(descs[4*i:]))
+		values[i].Type = descs[4*i+2]
+		values[i].Offset = c.off
+		values[i].Data = c.bytes(size)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return p.instantiate(tmpl, values, depth)
+}
+
+// parseTemplate parses the template definition at off.
+func (p *binxmlParser) parseTemplate(off uint32, depth int) ([]binxmlNode, error) {
+	c := &binxmlCursor{buf: p.chunk, off: int(off)}
+	c.bytes(20) // offset of the next template, GUID
+	size := int(c.u32())
+	if c.err != nil || c.off+size > len(p.chunk) {
+		return nil, fmt.Errorf("Invalid template definition at offset %d", off)
+	}
+	c.buf = p.chunk[:c.off+size]
+	return p.parseFragment(c, depth)
+}
+
+// instantiate resolves the substitutions in nodes with values.
+func (p *binxmlParser) instantiate(nodes []binxmlNode, values []binxmlValue, depth int) ([]xmlNode, error) {
+	if depth > binxmlMaxDepth {
+		return nil, fmt.Errorf("binary XML nested too deeply")
+	}
+	retVal := make([]xmlNode, 0, len(nodes))
+	for _, n := range nodes {
+		switch {
+		case n.Elem != nil:
+			e, err := p.instantiateElement(n.Elem, values, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			retVal = append(retVal, xmlNode{Elem: e})
+		case n.Subst != nil:
+			resolved, err := p.substitute(n.Subst, values, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			retVal = append(retVal, resolved...)
+		case n.Resolved != nil:
+			retVal = append(retVal, n.Resolved...)
+		default:
+			retVal = append(retVal, xmlNode{Text: n.Text})
+		}
+	}
+	return mergeText(retVal), nil
+}
+
+func (p *binxmlParser) instantiateElement(e *binxmlElement, values []binxmlValue, depth int) (*xmlElement, error) {
+	retVal := &xmlElement{Name: e.Name}
+	for _, a := range e.Attrs {
+		if isNullSubstitution(a.Value, values) {
+			// An optional attribute without a value is left out.
+			continue
+		}
+		nodes, err := p.instantiate(a.Value, values, depth)
+		if err != nil {
+			return nil, err
+		}
+		v := &xmlElement{Nodes: nodes}
+		retVal.Attrs = append(retVal.Attrs, xmlAttr{Name: a.Name, Value: v.text()})
+	}
+	nodes, err := p.instantiate(e.Nodes, values, depth)
+	if err != nil {
+		return nil, err
+	}
+	retVal.Nodes = nodes
+	return retVal, nil
+}
+
+// isNullSubstitution reports whether value consists only of optional
+// substitutions whose values are missing or null.
+func isNullSubstitution(value []binxmlNode, values []binxmlValue) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for _, n := range value {
+		if n.Subst == nil || !n.Subst.Optional {
+			return false
+		}
+		if int(n.Subst.ID) < len(values) && values[n.Subst.ID].Type != binxmlTypeNull && len(values[n.Subst.ID].Data) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// substitute returns the nodes for a substitution's value: text, or the
+// content of a BinXml value.
+func (p *binxmlParser) substitute(s *binxmlSubst, values []binxmlValue, depth int) ([]xmlNode, error) {
+	if int(s.ID) >= len(values) {
+		if s.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Substitution %d out of range of %d values", s.ID, len(values))
+	}
+	v := values[s.ID]
+	switch v.Type {
+	case binxmlTypeNull:
+		return nil, nil
+	case binxmlTypeBinXml:
+		c := &binxmlCursor{buf: p.chunk[:v.Offset+len(v.Data)], off: v.Offset}
+		nodes, err := p.parseFragment(c, depth)
+		if err != nil {
+			return nil, err
+		}
+		return p.instantiate(nodes, nil, depth)
+	}
+	text, err := formatBinxmlValue(v.Type, v.Data)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return []xmlNode{{Text: text}}, nil
+}
+
+// mergeText joins adjacent text nodes, such as a value split around a
+// character reference.
+func mergeText(nodes []xmlNode) []xmlNode {
+	retVal := nodes[:0]
+	for _, n := range nodes {
+		if last := len(retVal) - 1; n.Elem == nil && last >= 0 && retVal[last].Elem == nil {
+			retVal[last].Text += n.Text
+			continue
+		}
+		retVal = append(retVal, n)
+	}
+	return retVal
+}
+
+// xmlEntity returns the text of a predefined XML entity reference.
+func xmlEntity(name string) string {
+	switch name {
+	case "amp":
+		return "&"
+	case "lt":
+		return "<"
+	case "gt":
+		return ">"
+	case "apos":
+		return "'"
+	case "quot":
+		return "\""
+	}
+	return "&" + name + ";"
+}
+
+// binxmlTypeSizes are the sizes of the fixed size value types, used to split
+// arrays of them.
+var binxmlTypeSizes = map[uint8]int{
+	binxmlTypeInt8: 1, binxmlTypeUint8: 1,
+	binxmlTypeInt16: 2, binxmlTypeUint16: 2,
+	binxmlTypeInt32: 4, binxmlTypeUint32: 4, binxmlTypeHexInt32: 4, binxmlTypeReal32: 4, binxmlTypeBool: 4,
+	binxmlTypeInt64: 8, binxmlTypeUint64: 8, binxmlTypeHexInt64: 8, binxmlTypeReal64: 8, binxmlTypeFileTime: 8,
+	binxmlTypeGUID: 16, binxmlTypeSystemTime: 16,
+}
+
+// formatBinxmlValue renders a substitution value as EvtRender does. Array
+// elements are separated by ", ".
+func formatBinxmlValue(t uint8, b []byte) (string, error) {
+	if t&binxmlArray != 0 {
+		base := t &^ binxmlArray
+		var items []string
+		switch base {
+		case binxmlTypeString:
+			items = strings.Split(strings.TrimRight(utf16BytesToString(b), "\x00"), "\x00")
+		case binxmlTypeAnsiString:
+			items = strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+		default:
+			size, ok := binxmlTypeSizes[base]
+			if !ok || len(b)%size != 0 {
+				return "", fmt.Errorf("Invalid binary XML array of type 0x%02x and size %d", base, len(b))
+			}
+			for i := 0; i < len(b); i += size {
+				s, err := formatBinxmlValue(base, b[i:i+size])
+				if err != nil {
+					return "", err
+				}
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, ", "), nil
+	}
+
+	if size, ok := binxmlTypeSizes[t]; ok && len(b) < size {
+		return "", fmt.Errorf("Binary XML value of type 0x%02x too short, %d bytes", t, len(b))
+	}
+	switch t {
+	case binxmlTypeNull:
+		return "", nil
+	case binxmlTypeString:
+		return strings.TrimRight(utf16BytesToString(b), "\x00"), nil
+	case binxmlTypeAnsiString:
+		return strings.TrimRight(string(b), "\x00"), nil
+	case binxmlTypeInt8:
+		return strconv.FormatInt(int64(int8(b[0])), 10), nil
+	case binxmlTypeUint8:
+		return strconv.FormatUint(uint64(b[0]), 10), nil
+	case binxmlTypeInt16:
+		return strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10), nil
+	case binxmlTypeUint16:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint16(b)), 10), nil
+	case binxmlTypeInt32:
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b))), 10), nil
+	case binxmlTypeUint32:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b)), 10), nil
+	case binxmlTypeInt64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(b)), 10), nil
+	case binxmlTypeUint64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(b), 10), nil
+	case binxmlTypeReal32:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32), nil
+	case binxmlTypeReal64:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64), nil
+	case binxmlTypeBool:
+		return strconv.FormatBool(binary.LittleEndian.Uint32(b) != 0), nil
+	case binxmlTypeBinary:
+		return strings.ToUpper(hex.EncodeToString(b)), nil
+	case binxmlTypeGUID:
+		var g GUID
+		copy(g[:], b)
+		return "{" + strings.ToUpper(g.String()) + "}", nil
+	case binxmlTypeSizeT, binxmlTypeHexInt32, binxmlTypeHexInt64:
+		switch len(b) {
+		case 4:
+			return fmt.Sprintf("0x%x", binary.LittleEndian.Uint32(b)), nil
+		case 8:
+			return fmt.Sprintf("0x%x", binary.LittleEndian.Uint64(b)), nil
+		}
+		return "", fmt.Errorf("Invalid binary XML hex value size %d", len(b))
+	case binxmlTypeFileTime:
+		return formatEventTime(fileTimeToTime(binary.LittleEndian.Uint64(b))), nil
+	case binxmlTypeSystemTime:
+		return formatEventTime(systemTimeToTime(b)), nil
+	case binxmlTypeSID:
+		sid, _, err := ReadSID(b)
+		if err != nil {
+			return "", err
+		}
+		return sid.String(), nil
+	}
+	return "", fmt.Errorf("Unsupported binary XML value type 0x%02x", t)
+}
+
+// fileTimeToTime converts a FILETIME to UTC. Times before 1970 aren't
+// expected in event logs and come out as the Unix epoch.
+func fileTimeToTime(ft uint64) time.Time {
+	const epochDelta = 116444736000000000 // 1601 to 1970 in 100ns intervals
+	if ft < epochDelta {
+		return time.Unix(0, 0).UTC()
+	}
+	ft -= epochDelta
+	return time.Unix(int64(ft/1e7), int64(ft%1e7)*100).UTC()
+}
+
+// systemTimeToTime converts a SYSTEMTIME, which is in UTC in event data.
+func systemTimeToTime(b []byte) time.Time {
+	u := func(i int) int { return int(binary.LittleEndian.Uint16(b[2*i:])) }
+	// Year, month, day of week, day, hour, minute, second, milliseconds.
+	return time.Date(u(0), time.Month(u(1)), u(3), u(4), u(5), u(6), u(7)*int(time.Millisecond), time.UTC)
+}
+
+// formatEventTime formats a time as event XML does, with 100ns precision.
+func formatEventTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.0000000Z")
+}
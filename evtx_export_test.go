@@ -0,0 +1,98 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// TestEvtxFromWevtutil reads a log exported by Windows itself, writing a few
+// events from an unregistered source, which doesn't need elevation, and
+// exporting just those with "wevtutil epl".
+func TestEvtxFromWevtutil(t *testing.T) {
+	source := fmt.Sprintf("go-win64api-test-%d", os.Getpid())
+	l, err := OpenEventSource(source)
+	if err != nil {
+		t.Fatalf("Unable to open test event source: %s", err)
+	}
+	defer l.Close()
+
+	for _, err := range []error{
+		l.Info(1, "first"),
+		l.Warning(2, "second"),
+		l.Report(EventLogEntry{Type: EVENTLOG_ERROR_TYPE, EventID: 3, Inserts: []string{"third", "Hello, wörld"}}),
+	} {
+		if err != nil {
+			t.Fatalf("Unable to write test event: %s", err)
+		}
+	}
+
+	// The event log service writes events asynchronously.
+	query := fmt.Sprintf("*[System[Provider[@Name='%s']]]", source)
+	var logged []so.Event
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		if logged, err = QueryEvents(EventQueryOptions{Channel: "Application", XPath: query}); err != nil {
+			t.Fatalf("QueryEvents: %s", err)
+		}
+		if len(logged) >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of 3 test events were logged", len(logged))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	dir, err := ioutil.TempDir("", "evtx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.evtx")
+	if out, err := exec.Command("wevtutil", "epl", "Application", file, "/q:"+query).CombinedOutput(); err != nil {
+		t.Fatalf("wevtutil epl: %s: %s", err, out)
+	}
+
+	events, err := ReadEvtxFile(file)
+	if err != nil {
+		t.Fatalf("ReadEvtxFile: %s", err)
+	}
+	if len(events) != len(logged) {
+		t.Fatalf("got %d events, want %d", len(events), len(logged))
+	}
+	want := []struct {
+		eventID uint16
+		level   uint8
+		data    []string
+	}{
+		{1, so.EVENT_LEVEL_INFORMATION, []string{"first"}},
+		{2, so.EVENT_LEVEL_WARNING, []string{"second"}},
+		{3, so.EVENT_LEVEL_ERROR, []string{"third", "Hello, wörld"}},
+	}
+	for i, ev := range events {
+		if ev.Provider != source || ev.Channel != "Application" || ev.EventID != want[i].eventID || ev.Level != want[i].level {
+			t.Errorf("event %d = %s/%s %d level %d", i, ev.Channel, ev.Provider, ev.EventID, ev.Level)
+		}
+		for j, s := range want[i].data {
+			if got := ev.Data[fmt.Sprint(j+1)]; got != s {
+				t.Errorf("event %d insert %d = %q, want %q", i, j+1, got, s)
+			}
+		}
+
+		// The exported events are the ones the event log returns.
+		q := logged[i]
+		if ev.RecordID != q.RecordID || !ev.TimeCreated.Equal(q.TimeCreated) || ev.Computer != q.Computer || ev.ProcessID != q.ProcessID {
+			t.Errorf("event %d = record %d at %s on %s by %d, QueryEvents has record %d at %s on %s by %d", i,
+				ev.RecordID, ev.TimeCreated, ev.Computer, ev.ProcessID, q.RecordID, q.TimeCreated, q.Computer, q.ProcessID)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package winapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// testdata/Security.evtx is a small Security log laid out as Windows writes
+// them: a System template shared by every event, with the EventData or
+// UserData in a nested template instance, and names and templates stored
+// once per chunk. It has two chunks, the second starting at record 8. It's
+// written by testdata/mkevtx.go, which also documents its events, while
+// TestEvtxFromWevtutil reads a log exported by Windows itself.
+const securityEvtx = "testdata/Security.evtx"
+
+func readEvtx(r *EvtxReader) ([]so.Event, []error) {
+	var (
+		events []so.Event
+		errs   []error
+	)
+	for {
+		ev, err := r.Next()
+		if err == io.EOF {
+			return events, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		events = append(events, *ev)
+	}
+}
+
+func TestReadEvtxFile(t *testing.T) {
+	events, err := ReadEvtxFile(securityEvtx)
+	if err != nil {
+		t.Fatalf("ReadEvtxFile: %v", err)
+	}
+	if len(events) != 12 {
+		t.Fatalf("got %d events, want 12", len(events))
+	}
+	for i, ev := range events {
+		if ev.RecordID != uint64(i+1) {
+			t.Errorf("event %d has record ID %d", i, ev.RecordID)
+		}
+	}
+
+	first := events[0]
+	first.Data, first.XML = nil, ""
+	want := so.Event{
+		Provider:     "Microsoft-Windows-Security-Auditing",
+		ProviderGUID: "{54849625-5478-4994-A5BA-3E3B0328C30D}",
+		EventID:      4624,
+		Version:      2,
+		Task:         12544,
+		Keywords:     0x8020000000000000,
+		TimeCreated:  time.Date(2020, 3, 2, 8, 0, 0, 123456000, time.UTC),
+		RecordID:     1,
+		ActivityID:   "{C9A2D5F4-1E1F-0003-A1D6-A2C91F1ED601}",
+		ProcessID:    708,
+		ThreadID:     3460,
+		Channel:      "Security",
+		Computer:     "PC01.corp.example.com",
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("first event = %+v, want %+v", first, want)
+	}
+	data := events[0].Data
+	if len(data) != 27 || data["TargetUserName"] != "alice" || data["TargetLogonId"] != "0x1a2b3d" ||
+		data["LogonType"] != "2" || data["TargetUserSid"] != "S-1-5-21-1004336348-1177238915-682003330-1105" ||
+		data["LogonGuid"] != "{7D3F4A6E-8B2C-4F11-9E0A-5C6D7E8F9A0B}" || data["ElevatedToken"] != "%%1842" {
+		t.Errorf("first event data = %v", data)
+	}
+
+	failed := events[3]
+	if failed.EventID != 4625 || failed.Data["Status"] != "0xc000006d" || failed.Data["IpAddress"] != "198.51.100.7" {
+		t.Errorf("failed logon = %+v", failed)
+	}
+
+	// The first event of the second chunk, with UserData rather than EventData.
+	cleared := events[7]
+	if cleared.Provider != "Microsoft-Windows-Eventlog" || cleared.EventID != 1102 || cleared.Level != so.EVENT_LEVEL_INFORMATION || cleared.GetLevel() != "INFORMATION" {
+		t.Errorf("log cleared event = %+v", cleared)
+	}
+	if want := map[string]string{
+		"SubjectUserSid":    "S-1-5-21-1004336348-1177238915-682003330-1105",
+		"SubjectUserName":   "alice",
+		"SubjectDomainName": "CORP",
+		"SubjectLogonId":    "0x1a2b3d",
+	}; !reflect.DeepEqual(cleared.Data, want) {
+		t.Errorf("log cleared data = %v, want %v", cleared.Data, want)
+	}
+}
+
+func TestEvtxXML(t *testing.T) {
+	events, err := ReadEvtxFile(securityEvtx)
+	if err != nil {
+		t.Fatalf("ReadEvtxFile: %v", err)
+	}
+	// The null Qualifiers, RelatedActivityID, EventSourceName and UserID are
+	// left out.
+	want := "<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System>" +
+		"<Provider Name='Microsoft-Windows-Security-Auditing' Guid='{54849625-5478-4994-A5BA-3E3B0328C30D}'/>" +
+		"<EventID>4634</EventID><Version>0</Version><Level>0</Level><Task>12545</Task><Opcode>0</Opcode>" +
+		"<Keywords>0x8020000000000000</Keywords><TimeCreated SystemTime='2020-03-02T11:45:10.0000000Z'/>" +
+		"<EventRecordID>7</EventRecordID><Correlation ActivityID='{C9A2D5F4-1E1F-0003-A1D6-A2C91F1ED601}'/>" +
+		"<Execution ProcessID='708' ThreadID='5120'/><Channel>Security</Channel>" +
+		"<Computer>PC01.corp.example.com</Computer><Security/></System><EventData>" +
+		"<Data Name='TargetUserSid'>S-1-5-21-3623811015-3361044348-30300820-1001</Data>" +
+		"<Data Name='TargetUserName'>bob</Data><Data Name='TargetDomainName'>PC01</Data>" +
+		"<Data Name='TargetLogonId'>0x2000a1</Data><Data Name='LogonType'>10</Data></EventData></Event>"
+	if got := events[6].XML; got != want {
+		t.Errorf("XML =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEvtxReaderHeader(t *testing.T) {
+	raw, err := ioutil.ReadFile(securityEvtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewEvtxReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("NewEvtxReader: %v", err)
+	}
+	want := EvtxHeader{LastChunk: 1, NextRecordID: 13, MajorVersion: 3, MinorVersion: 1, ChunkCount: 2}
+	if h := r.Header(); h != want {
+		t.Errorf("Header = %+v, want %+v", h, want)
+	}
+
+	if _, err := NewEvtxReader(bytes.NewReader(raw[evtxFileHeaderSize:])); err == nil {
+		t.Errorf("a chunk isn't an EVTX file")
+	}
+	bad := append([]byte{}, raw[:evtxFileHeaderSize]...)
+	bad[24]++
+	if _, err := NewEvtxReader(bytes.NewReader(bad)); err == nil {
+		t.Errorf("header with a bad checksum should fail")
+	}
+}
+
+// recordOffset returns the offset in the file of the nth record of a chunk.
+func recordOffset(raw []byte, chunk, n int) int {
+	off := evtxFileHeaderSize + chunk*evtxChunkSize + evtxChunkHeaderSize
+	for ; n > 0; n-- {
+		off += int(binary.LittleEndian.Uint32(raw[off+4:]))
+	}
+	return off
+}
+
+// fixChunkChecksums recomputes a chunk's CRCs after it's been altered.
+func fixChunkChecksums(raw []byte, chunk int) {
+	buf := raw[evtxFileHeaderSize+chunk*evtxChunkSize:][:evtxChunkSize]
+	free := binary.LittleEndian.Uint32(buf[48:])
+	binary.LittleEndian.PutUint32(buf[52:], crc32.ChecksumIEEE(buf[evtxChunkHeaderSize:free]))
+	binary.LittleEndian.PutUint32(buf[124:], evtxChunkHeaderChecksum(buf))
+}
+
+func TestEvtxReaderDamaged(t *testing.T) {
+	raw, err := ioutil.ReadFile(securityEvtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A chunk failing its checksum is skipped unless checksums are ignored.
+	damaged := append([]byte{}, raw...)
+	damaged[evtxFileHeaderSize+60] ^= 0xff
+	r, _ := NewEvtxReader(bytes.NewReader(damaged))
+	events, errs := readEvtx(r)
+	if len(events) != 5 || len(errs) != 1 || events[0].RecordID != 8 {
+		t.Errorf("with a damaged chunk got %d events, errors %v", len(events), errs)
+	}
+	r, _ = NewEvtxReader(bytes.NewReader(damaged))
+	r.SkipChecksums = true
+	if events, errs = readEvtx(r); len(events) != 12 || len(errs) != 0 {
+		t.Errorf("skipping checksums got %d events, errors %v", len(events), errs)
+	}
+
+	// A record that can't be parsed is skipped, and the rest of its chunk
+	// still read. Record 3's template instance now points at a bogus
+	// template definition.
+	damaged = append([]byte{}, raw...)
+	off := recordOffset(damaged, 0, 2) + evtxRecordHeaderSize + 4 + 6
+	binary.LittleEndian.PutUint32(damaged[off:], 0xfff0)
+	fixChunkChecksums(damaged, 0)
+	r, _ = NewEvtxReader(bytes.NewReader(damaged))
+	events, errs = readEvtx(r)
+	if len(events) != 11 || len(errs) != 1 {
+		t.Fatalf("with a damaged record got %d events, errors %v", len(events), errs)
+	}
+	if events[2].RecordID != 4 {
+		t.Errorf("record after the damaged one is %d", events[2].RecordID)
+	}
+
+	// A record with a bad size ends its chunk.
+	damaged = append([]byte{}, raw...)
+	binary.LittleEndian.PutUint32(damaged[recordOffset(damaged, 0, 5)+4:], 3)
+	fixChunkChecksums(damaged, 0)
+	r, _ = NewEvtxReader(bytes.NewReader(damaged))
+	events, errs = readEvtx(r)
+	if len(events) != 10 || len(errs) != 1 {
+		t.Errorf("with a bad record size got %d events, errors %v", len(events), errs)
+	}
+}
+
+func TestEvtxReaderUnusedChunks(t *testing.T) {
+	raw, err := ioutil.ReadFile(securityEvtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Windows allocates chunks ahead of use, and copies can be truncated
+	// part way through one.
+	padded := append(append([]byte{}, raw...), make([]byte, evtxChunkSize+100)...)
+	r, _ := NewEvtxReader(bytes.NewReader(padded))
+	events, errs := readEvtx(r)
+	if len(events) != 12 || len(errs) != 0 {
+		t.Errorf("with an unused chunk got %d events, errors %v", len(events), errs)
+	}
+
+	// Damaged chunks are reported and passed over too.
+	r, _ = NewEvtxReader(bytes.NewReader(append(append([]byte{}, raw[:evtxFileHeaderSize+evtxChunkSize]...), bytes.Repeat([]byte{0xee}, evtxChunkSize)...)))
+	events, errs = readEvtx(r)
+	if len(events) != 7 || len(errs) != 1 {
+		t.Errorf("with a garbage chunk got %d events, errors %v", len(events), errs)
+	}
+}
+
+func TestFormatBinxmlValue(t *testing.T) {
+	ft := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ft, 132276960001234567)
+	st := []byte{0xe4, 0x07, 3, 0, 1, 0, 2, 0, 8, 0, 30, 0, 15, 0, 0xf4, 0x01}
+	tests := []struct {
+		typ  uint8
+		data []byte
+		want string
+	}{
+		{binxmlTypeNull, nil, ""},
+		{binxmlTypeString, utf16Bytes("héllo\x00"), "héllo"},
+		{binxmlTypeAnsiString, []byte("abc\x00"), "abc"},
+		{binxmlTypeInt8, []byte{0xff}, "-1"},
+		{binxmlTypeUint8, []byte{0xff}, "255"},
+		{binxmlTypeInt16, []byte{0xfe, 0xff}, "-2"},
+		{binxmlTypeUint32, []byte{0x10, 0x27, 0, 0}, "10000"},
+		{binxmlTypeInt64, []byte{0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "-3"},
+		{binxmlTypeReal64, []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}, "1.5"},
+		{binxmlTypeBool, []byte{1, 0, 0, 0}, "true"},
+		{binxmlTypeBinary, []byte{0xde, 0xad, 0x01}, "DEAD01"},
+		{binxmlTypeHexInt32, []byte{0x6d, 0, 0, 0xc0}, "0xc000006d"},
+		{binxmlTypeHexInt64, []byte{0xe7, 0x03, 0, 0, 0, 0, 0, 0}, "0x3e7"},
+		{binxmlTypeSizeT, []byte{0, 0x10, 0, 0, 0, 0, 0, 0}, "0x1000"},
+		{binxmlTypeFileTime, ft, "2020-03-03T08:00:00.1234567Z"},
+		{binxmlTypeSystemTime, st, "2020-03-02T08:30:15.5000000Z"},
+		{binxmlTypeSID, []byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}, "S-1-5-18"},
+		{binxmlTypeString | binxmlArray, utf16Bytes("a\x00bc\x00"), "a, bc"},
+		{binxmlTypeUint16 | binxmlArray, []byte{1, 0, 2, 0}, "1, 2"},
+	}
+	for _, test := range tests {
+		got, err := formatBinxmlValue(test.typ, test.data)
+		if err != nil || got != test.want {
+			t.Errorf("formatBinxmlValue(0x%02x, %x) = %q, %v, want %q", test.typ, test.data, got, err, test.want)
+		}
+	}
+
+	for _, bad := range []struct {
+		typ  uint8
+		data []byte
+	}{
+		{binxmlTypeUint32, []byte{1, 2}},
+		{binxmlTypeUint32 | binxmlArray, []byte{1, 2, 3}},
+		{binxmlTypeSID, []byte{1, 5, 0}},
+		{0x7f, []byte{1}},
+	} {
+		if _, err := formatBinxmlValue(bad.typ, bad.data); err == nil {
+			t.Errorf("formatBinxmlValue(0x%02x, %x) should fail", bad.typ, bad.data)
+		}
+	}
+}
+
+// TestBinxmlReferences covers tokens that Windows rarely writes: character
+// and entity references, CDATA and a processing instruction.
+func TestBinxmlReferences(t *testing.T) {
+	chunk := make([]byte, 0x100)
+	var b []byte
+	name := func(s string) {
+		off := uint32(0x100 + len(b) + 4)
+		b = append(b, byte(off), byte(off>>8), 0, 0, 0, 0, 0, 0, 0, 0, byte(len(s)), 0)
+		b = append(b, utf16Bytes(s)...)
+		b = append(b, 0, 0)
+	}
+	text := func(s string) {
+		b = append(b, binxmlValueText, binxmlTypeString, byte(len(s)), 0)
+		b = append(b, utf16Bytes(s)...)
+	}
+	b = append(b, binxmlFragmentHeader, 1, 1, 0)
+	b = append(b, binxmlPITarget)
+	name("xml-stylesheet")
+	b = append(b, binxmlPIData, 4, 0)
+	b = append(b, utf16Bytes("a=b ")...)
+	b = append(b, binxmlOpenStartElement|binxmlHasMore, 0xff, 0xff, 0, 0, 0, 0)
+	name("Msg")
+	b = append(b, 0, 0, 0, 0, binxmlAttribute)
+	name("Title")
+	text("R")
+	b = append(b, binxmlCharRef, '&', 0)
+	text("D")
+	b = append(b, binxmlCloseStartElement)
+	text("1 ")
+	b = append(b, binxmlEntityRef)
+	name("lt")
+	text(" 2")
+	b = append(b, binxmlCDataSection, 3, 0)
+	b = append(b, utf16Bytes("<x>")...)
+	b = append(b, binxmlEndElement, binxmlEndOfStream)
+	chunk = append(chunk, b...)
+
+	root, err := newBinxmlParser(chunk).parseRecord(0x100, len(chunk))
+	if err != nil {
+		t.Fatalf("parseRecord: %v", err)
+	}
+	if got, want := root.xml(), "<Msg Title='R&amp;D'>1 &lt; 2&lt;x&gt;</Msg>"; got != want {
+		t.Errorf("xml = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Execution state flags for SetThreadExecutionState.
+const (
+	ES_AWAYMODE_REQUIRED = 0x00000040
+	ES_CONTINUOUS        = 0x80000000
+	ES_DISPLAY_REQUIRED  = 0x00000002
+	ES_SYSTEM_REQUIRED   = 0x00000001
+	ES_USER_PRESENT      = 0x00000004
+)
+
+// KeepAwakeOptions selects what KeepAwake keeps awake. If none are set,
+// System is assumed.
+type KeepAwakeOptions struct {
+	// System stops the machine sleeping.
+	System bool
+	// Display stops the display turning off.
+	Display bool
+	// AwayMode lets the machine enter away mode instead of sleeping, where
+	// it's enabled, and implies System.
+	AwayMode bool
+	// OnError is called if the execution state can't be released once the
+	// context is done.
+	OnError func(error)
+}
+
+func (o KeepAwakeOptions) flags() uint32 {
+	var flags uint32
+	if o.System || o.AwayMode || !o.Display {
+		flags |= ES_SYSTEM_REQUIRED
+	}
+	if o.Display {
+		flags |= ES_DISPLAY_REQUIRED
+	}
+	if o.AwayMode {
+		flags |= ES_AWAYMODE_REQUIRED
+	}
+	return flags
+}
+
+// executionStateFlags are the flags executionStateHolder counts references
+// to.
+var executionStateFlags = []uint32{ES_SYSTEM_REQUIRED, ES_DISPLAY_REQUIRED, ES_AWAYMODE_REQUIRED}
+
+// executionStateHolder holds the union of the execution states asked for by
+// overlapping KeepAwake calls, counting references to each flag. Execution
+// state belongs to a thread, so set is always called from the same goroutine,
+// locked to its OS thread, which runs while any state is held.
+type executionStateHolder struct {
+	set func(state uint32) error
+
+	mu      sync.Mutex
+	counts  map[uint32]int
+	current uint32
+	calls   chan executionStateCall
+}
+
+type executionStateCall struct {
+	state  uint32
+	result chan error
+}
+
+func newExecutionStateHolder(set func(uint32) error) *executionStateHolder {
+	return &executionStateHolder{set: set, counts: make(map[uint32]int)}
+}
+
+// acquire adds a reference to each of flags, returning the execution state
+// held for all callers before this one, and a function that drops the
+// references again.
+func (h *executionStateHolder) acquire(flags uint32) (uint32, func() error, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previous := ES_CONTINUOUS | h.current
+	if want := h.current | flags; want != h.current {
+		if h.calls == nil {
+			h.calls = make(chan executionStateCall)
+			go h.run(h.calls)
+		}
+		if err := h.apply(ES_CONTINUOUS | want); err != nil {
+			h.stopIfIdle()
+			return 0, nil, err
+		}
+		h.current = want
+	}
+	for _, f := range executionStateFlags {
+		if flags&f != 0 {
+			h.counts[f]++
+		}
+	}
+
+	var once sync.Once
+	release := func() error {
+		var err error
+		once.Do(func() { err = h.release(flags) })
+		return err
+	}
+	return previous, release, nil
+}
+
+func (h *executionStateHolder) release(flags uint32) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var want uint32
+	for _, f := range executionStateFlags {
+		if flags&f != 0 {
+			h.counts[f]--
+		}
+		if h.counts[f] > 0 {
+			want |= f
+		}
+	}
+	// The state is dropped even if setting it fails, so the thread still
+	// stops once nothing is held, and its state goes with it.
+	var err error
+	if want != h.current {
+		err = h.apply(ES_CONTINUOUS | want)
+		h.current = want
+	}
+	h.stopIfIdle()
+	return err
+}
+
+// apply sets state on the holder's thread. h.mu must be held.
+func (h *executionStateHolder) apply(state uint32) error {
+	result := make(chan error)
+	h.calls <- executionStateCall{state: state, result: result}
+	return <-result
+}
+
+// stopIfIdle ends the holder's thread once nothing is held. h.mu must be held.
+func (h *executionStateHolder) stopIfIdle() {
+	if h.current == 0 && h.calls != nil {
+		close(h.calls)
+		h.calls = nil
+	}
+}
+
+func (h *executionStateHolder) run(calls chan executionStateCall) {
+	// The thread isn't unlocked, so it exits with the goroutine and can't be
+	// reused with state left on it.
+	runtime.LockOSThread()
+	for c := range calls {
+		c.result <- h.set(c.state)
+	}
+}
+
+// keepAwake holds opts with h until ctx is done.
+func keepAwake(ctx context.Context, h *executionStateHolder, opts KeepAwakeOptions) (uint32, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	previous, release, err := h.acquire(opts.flags())
+	if err != nil {
+		return 0, fmt.Errorf("Unable to set execution state: %s", err)
+	}
+	go func() {
+		<-ctx.Done()
+		if err := release(); err != nil && opts.OnError != nil {
+			opts.OnError(fmt.Errorf("Unable to release execution state: %s", err))
+		}
+	}()
+	return previous, nil
+}
@@ -0,0 +1,157 @@
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeExecutionState records the states set.
+type fakeExecutionState struct {
+	mu     sync.Mutex
+	calls  []uint32
+	failOn uint32
+}
+
+func (f *fakeExecutionState) set(state uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if state == f.failOn {
+		return fmt.Errorf("refused")
+	}
+	f.calls = append(f.calls, state)
+	return nil
+}
+
+func (f *fakeExecutionState) history() []uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uint32(nil), f.calls...)
+}
+
+func TestKeepAwakeOptionsFlags(t *testing.T) {
+	tests := []struct {
+		opts KeepAwakeOptions
+		want uint32
+	}{
+		{KeepAwakeOptions{}, ES_SYSTEM_REQUIRED},
+		{KeepAwakeOptions{System: true}, ES_SYSTEM_REQUIRED},
+		{KeepAwakeOptions{Display: true}, ES_DISPLAY_REQUIRED},
+		{KeepAwakeOptions{System: true, Display: true}, ES_SYSTEM_REQUIRED | ES_DISPLAY_REQUIRED},
+		{KeepAwakeOptions{AwayMode: true}, ES_SYSTEM_REQUIRED | ES_AWAYMODE_REQUIRED},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.flags(); got != tt.want {
+			t.Errorf("%+v.flags() = 0x%x, want 0x%x", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestExecutionStateHolderNesting(t *testing.T) {
+	f := &fakeExecutionState{}
+	h := newExecutionStateHolder(f.set)
+
+	prev, releaseSystem, err := h.acquire(ES_SYSTEM_REQUIRED)
+	if err != nil || prev != ES_CONTINUOUS {
+		t.Fatalf("first acquire = 0x%x, %v", prev, err)
+	}
+	prev, releaseSystem2, _ := h.acquire(ES_SYSTEM_REQUIRED)
+	if prev != ES_CONTINUOUS|ES_SYSTEM_REQUIRED {
+		t.Errorf("nested acquire previous = 0x%x", prev)
+	}
+	if got := f.history(); len(got) != 1 {
+		t.Errorf("nested acquire set the state again: %#x", got)
+	}
+	prev, releaseDisplay, _ := h.acquire(ES_DISPLAY_REQUIRED)
+	if prev != ES_CONTINUOUS|ES_SYSTEM_REQUIRED {
+		t.Errorf("display acquire previous = 0x%x", prev)
+	}
+
+	releaseSystem()
+	releaseSystem() // releasing twice only drops one reference
+	releaseDisplay()
+	if h.calls == nil {
+		t.Fatalf("holder stopped while a reference is held")
+	}
+	releaseSystem2()
+
+	want := []uint32{
+		ES_CONTINUOUS | ES_SYSTEM_REQUIRED,
+		ES_CONTINUOUS | ES_SYSTEM_REQUIRED | ES_DISPLAY_REQUIRED,
+		ES_CONTINUOUS | ES_SYSTEM_REQUIRED,
+		ES_CONTINUOUS,
+	}
+	if got := f.history(); !reflect.DeepEqual(got, want) {
+		t.Errorf("states = %#x, want %#x", got, want)
+	}
+	if h.calls != nil || h.current != 0 {
+		t.Errorf("holder not idle after last release")
+	}
+
+	// The holder starts a new thread when used again.
+	if _, release, err := h.acquire(ES_SYSTEM_REQUIRED); err != nil {
+		t.Errorf("acquire after idle: %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestExecutionStateHolderError(t *testing.T) {
+	f := &fakeExecutionState{failOn: ES_CONTINUOUS | ES_AWAYMODE_REQUIRED | ES_SYSTEM_REQUIRED}
+	h := newExecutionStateHolder(f.set)
+	if _, _, err := h.acquire(ES_SYSTEM_REQUIRED | ES_AWAYMODE_REQUIRED); err == nil {
+		t.Fatalf("expected error")
+	}
+	if h.calls != nil || h.counts[ES_SYSTEM_REQUIRED] != 0 {
+		t.Errorf("failed acquire left state behind: %+v", h)
+	}
+
+	// A failed release is returned, and the holder still stops.
+	f = &fakeExecutionState{failOn: ES_CONTINUOUS}
+	h = newExecutionStateHolder(f.set)
+	_, release, err := h.acquire(ES_SYSTEM_REQUIRED)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if err := release(); err == nil {
+		t.Errorf("expected release error")
+	}
+	if h.calls != nil || h.current != 0 {
+		t.Errorf("failed release left the holder running: %+v", h)
+	}
+}
+
+func TestKeepAwake(t *testing.T) {
+	f := &fakeExecutionState{}
+	h := newExecutionStateHolder(f.set)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if prev, err := keepAwake(ctx, h, KeepAwakeOptions{Display: true}); err != nil || prev != ES_CONTINUOUS {
+		t.Fatalf("keepAwake = 0x%x, %v", prev, err)
+	}
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.mu.Lock()
+		idle := h.current == 0
+		h.mu.Unlock()
+		if idle {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state still held after ctx was cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want := []uint32{ES_CONTINUOUS | ES_DISPLAY_REQUIRED, ES_CONTINUOUS}; !reflect.DeepEqual(f.history(), want) {
+		t.Errorf("states = %#x, want %#x", f.history(), want)
+	}
+
+	if _, err := keepAwake(ctx, h, KeepAwakeOptions{}); err == nil {
+		t.Errorf("expected error for a done context")
+	}
+}
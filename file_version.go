@@ -0,0 +1,45 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	VS_FIXEDFILEINFO_SIGNATURE = 0xFEEF04BD
+	VS_FIXEDFILEINFO_SIZE      = 52
+)
+
+// fixedFileVersion returns the file and product versions from the
+// VS_FIXEDFILEINFO in a VS_VERSIONINFO resource, as read by
+// GetFileVersionInfo.
+// See: https://docs.microsoft.com/en-us/windows/win32/menurc/vs-versioninfo
+func fixedFileVersion(block []byte) (fileVersion string, productVersion string, err error) {
+	if len(block) < 6 {
+		return "", "", fmt.Errorf("VS_VERSIONINFO too short")
+	}
+	valueLength := int(binary.LittleEndian.Uint16(block[2:]))
+	if valueLength == 0 {
+		return "", "", fmt.Errorf("VS_VERSIONINFO has no VS_FIXEDFILEINFO")
+	}
+
+	// The key and its NUL, then padding to a 32-bit boundary.
+	off := (6 + 2*(len("VS_VERSION_INFO")+1) + 3) &^ 3
+	if valueLength < VS_FIXEDFILEINFO_SIZE || off+VS_FIXEDFILEINFO_SIZE > len(block) {
+		return "", "", fmt.Errorf("VS_FIXEDFILEINFO too short")
+	}
+	if key := utf16BytesToString(block[6 : 6+2*len("VS_VERSION_INFO")]); key != "VS_VERSION_INFO" {
+		return "", "", fmt.Errorf("Unexpected VS_VERSIONINFO key %q", key)
+	}
+	info := block[off:]
+	if sig := binary.LittleEndian.Uint32(info[0:]); sig != VS_FIXEDFILEINFO_SIGNATURE {
+		return "", "", fmt.Errorf("Invalid VS_FIXEDFILEINFO signature 0x%x", sig)
+	}
+	return formatFileVersion(binary.LittleEndian.Uint32(info[8:]), binary.LittleEndian.Uint32(info[12:])),
+		formatFileVersion(binary.LittleEndian.Uint32(info[16:]), binary.LittleEndian.Uint32(info[20:])),
+		nil
+}
+
+func formatFileVersion(ms, ls uint32) string {
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+}
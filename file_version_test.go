@@ -0,0 +1,55 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// versionInfo lays out the start of a VS_VERSIONINFO resource.
+func versionInfo(fileMS, fileLS, productMS, productLS uint32) []byte {
+	buf := make([]byte, 40+VS_FIXEDFILEINFO_SIZE)
+	binary.LittleEndian.PutUint16(buf[0:], uint16(len(buf)))
+	binary.LittleEndian.PutUint16(buf[2:], VS_FIXEDFILEINFO_SIZE)
+	copy(buf[6:], utf16Bytes("VS_VERSION_INFO"))
+	info := buf[40:]
+	binary.LittleEndian.PutUint32(info[0:], VS_FIXEDFILEINFO_SIGNATURE)
+	binary.LittleEndian.PutUint32(info[4:], 0x00010000)
+	binary.LittleEndian.PutUint32(info[8:], fileMS)
+	binary.LittleEndian.PutUint32(info[12:], fileLS)
+	binary.LittleEndian.PutUint32(info[16:], productMS)
+	binary.LittleEndian.PutUint32(info[20:], productLS)
+	return buf
+}
+
+func TestFixedFileVersion(t *testing.T) {
+	file, product, err := fixedFileVersion(versionInfo(0x000a0000, 0x4a610001, 0x000a0000, 0x4a610000))
+	if err != nil {
+		t.Fatalf("fixedFileVersion: %v", err)
+	}
+	if file != "10.0.19041.1" || product != "10.0.19041.0" {
+		t.Errorf("fixedFileVersion = %q, %q", file, product)
+	}
+}
+
+func TestFixedFileVersionInvalid(t *testing.T) {
+	noFixed := versionInfo(1, 0, 1, 0)
+	binary.LittleEndian.PutUint16(noFixed[2:], 0)
+
+	badKey := versionInfo(1, 0, 1, 0)
+	copy(badKey[6:], utf16Bytes("VS_VERSION_INFX"))
+
+	badSig := versionInfo(1, 0, 1, 0)
+	binary.LittleEndian.PutUint32(badSig[40:], 0xdeadbeef)
+
+	for name, block := range map[string][]byte{
+		"truncated":     versionInfo(1, 0, 1, 0)[:60],
+		"no fixed":      noFixed,
+		"bad key":       badKey,
+		"bad signature": badSig,
+		"empty":         nil,
+	} {
+		if _, _, err := fixedFileVersion(block); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
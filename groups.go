@@ -6,11 +6,13 @@ package winapi
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 	"syscall"
 	"unsafe"
 
 	so "github.com/iamacarpet/go-win64api/shared"
+	"golang.org/x/sys/windows"
 )
 
 var (
@@ -19,6 +21,7 @@ var (
 	usrNetLocalGroupDel        = modNetapi32.NewProc("NetLocalGroupDel")
 	usrNetLocalGroupSetMembers = modNetapi32.NewProc("NetLocalGroupSetMembers")
 	usrNetLocalGroupGetMembers = modNetapi32.NewProc("NetLocalGroupGetMembers")
+	usrNetGroupGetUsers        = modNetapi32.NewProc("NetGroupGetUsers")
 )
 
 // Possible errors returned by local group management functions
@@ -47,6 +50,28 @@ type LOCALGROUP_INFO_1 struct {
 	Lgrpi1_comment *uint16 // UTF-16 group comment
 }
 
+// LOCALGROUP_MEMBERS_INFO_0 identifies a member of a local group by SID.
+// This struct matches the struct definition in the Windows headers (lmaccess.h).
+type LOCALGROUP_MEMBERS_INFO_0 struct {
+	Lgrmi0_sid uintptr // PSID
+}
+
+// LOCALGROUP_MEMBERS_INFO_2 represents level 2 information about a member of
+// a local group, including its SID.
+// This struct matches the struct definition in the Windows headers (lmaccess.h).
+type LOCALGROUP_MEMBERS_INFO_2 struct {
+	Lgrmi2_sid           uintptr // PSID
+	Lgrmi2_sidusage      uint32  // SID_NAME_USE
+	Lgrmi2_domainandname *uint16 // UTF-16 DOMAIN\name
+}
+
+// GROUP_USERS_INFO_0 represents level 0 information about a member of a
+// global (domain) group.
+// This struct matches the struct definition in the Windows headers (lmaccess.h).
+type GROUP_USERS_INFO_0 struct {
+	Grui0_name *uint16 // UTF-16 account name
+}
+
 // LocalGroupAdd adds a new local group with the specified name and comment.
 func LocalGroupAdd(name, comment string) (bool, error) {
 	var parmErr uint32
@@ -281,3 +306,354 @@ func LocalGroupGetMembers(groupname string) ([]so.LocalGroupMember, error) {
 
 	return retVal, nil
 }
+
+// LocalGroupGetMembersWithSid returns the members of the specified local
+// group along with their SIDs and SID usage types.
+//
+// Unlike LocalGroupGetMembers, this also reports members whose SID no longer
+// resolves to an account (such as deleted domain accounts), which have an
+// empty name, see LocalGroupMember.IsOrphaned.
+//
+// If an error occurs in the call to the underlying NetLocalGroupGetMembers function, the
+// returned error will be a syscall.Errno containing the error code.
+// See: https://docs.microsoft.com/en-us/windows/desktop/api/lmaccess/nf-lmaccess-netlocalgroupgetmembers
+func LocalGroupGetMembersWithSid(groupname string) ([]so.LocalGroupMember, error) {
+	members, err := localGroupMembersWithSid("", groupname)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := make([]so.LocalGroupMember, 0, len(members))
+	for _, m := range members {
+		gd := so.LocalGroupMember{
+			Domain:   m.Domain,
+			Name:     m.Name,
+			SID:      m.SID,
+			SidUsage: m.Type,
+		}
+		if m.Name != "" {
+			gd.DomainAndName = m.FullName()
+		}
+		retVal = append(retVal, gd)
+	}
+	return retVal, nil
+}
+
+func localGroupModMembersBySid(proc *syscall.LazyProc, groupname string, sids []string) (bool, error) {
+	groupnamePtr, err := syscall.UTF16PtrFromString(groupname)
+	if err != nil {
+		return false, fmt.Errorf("Unable to encode group name to UTF16: %s", err)
+	}
+
+	rawSids := make([]*windows.SID, 0, len(sids))
+	memberInfos := make([]LOCALGROUP_MEMBERS_INFO_0, 0, len(sids))
+	for _, sid := range sids {
+		rawSid, err := windows.StringToSid(sid)
+		if err != nil {
+			return false, fmt.Errorf("Invalid SID %q: %s", sid, err)
+		}
+		rawSids = append(rawSids, rawSid)
+		memberInfos = append(memberInfos, LOCALGROUP_MEMBERS_INFO_0{
+			Lgrmi0_sid: uintptr(unsafe.Pointer(rawSid)),
+		})
+	}
+
+	if len(memberInfos) == 0 {
+		// Add a fake entry just so that the slice isn't empty, so we can take
+		// the address of the first entry
+		memberInfos = append(memberInfos, LOCALGROUP_MEMBERS_INFO_0{})
+	}
+
+	ret, _, _ := proc.Call(
+		uintptr(0),                               // servername
+		uintptr(unsafe.Pointer(groupnamePtr)),    // group name
+		uintptr(0),                               // level, LOCALGROUP_MEMBERS_INFO_0
+		uintptr(unsafe.Pointer(&memberInfos[0])), // buf
+		uintptr(len(sids)),                       // totalEntries
+	)
+	runtime.KeepAlive(rawSids)
+	if ret != NET_API_STATUS_NERR_Success {
+		return false, syscall.Errno(ret)
+	}
+
+	return true, nil
+}
+
+// LocalGroupAddMembersBySid adds the accounts with the specified SIDs to the
+// group, if they are not already members.
+//
+// If an error occurs in the call to the underlying NetLocalGroupAddMembers function, the
+// returned error will be a syscall.Errno containing the error code.
+// See: https://docs.microsoft.com/en-us/windows/desktop/api/lmaccess/nf-lmaccess-netlocalgroupaddmembers
+func LocalGroupAddMembersBySid(groupname string, sids []string) (bool, error) {
+	return localGroupModMembersBySid(usrNetLocalGroupAddMembers, groupname, sids)
+}
+
+// LocalGroupDelMembersBySid removes the members with the specified SIDs from
+// the local group. Unlike LocalGroupDelMembers, this works for members whose
+// SID no longer resolves to an account name.
+//
+// If an error occurs in the call to the underlying NetLocalGroupDelMembers function, the
+// returned error will be a syscall.Errno containing the error code.
+// See: https://docs.microsoft.com/en-us/windows/desktop/api/lmaccess/nf-lmaccess-netlocalgroupdelmembers
+func LocalGroupDelMembersBySid(groupname string, sids []string) (bool, error) {
+	return localGroupModMembersBySid(usrNetLocalGroupDelMembers, groupname, sids)
+}
+
+// LocalGroupOrphans returns the members of the local group whose SID no
+// longer resolves to an account, and removes them from the group if remove
+// is true.
+//
+// Candidates reported as unresolved by NetLocalGroupGetMembers are checked
+// again with a fresh LookupAccountSids call before being reported. A SID from
+// a trusted domain whose controllers can't be reached looks the same as a
+// deleted account, so only orphans LSA reports as deleted accounts, or whose
+// domain is local or has a reachable domain controller, are removed. Removed
+// orphans have Removed set; the rest are left in the group.
+func LocalGroupOrphans(groupname string, remove bool) ([]so.LocalGroupMember, error) {
+	members, err := LocalGroupGetMembersWithSid(groupname)
+	if err != nil {
+		return nil, err
+	}
+	return findGroupOrphans(orphanSystem{}, groupname, members, remove)
+}
+
+// orphanSystem is the orphanDirectory of the local machine.
+type orphanSystem struct{}
+
+func (orphanSystem) LookupSids(sids []string) ([]so.SidAccount, error) {
+	return LookupAccountSids(sids)
+}
+
+func (orphanSystem) DomainReachable(domain string) bool {
+	if isLocalDomain(domain) {
+		return true
+	}
+	_, err := getAnyDCName(domain)
+	return err == nil
+}
+
+func (orphanSystem) RemoveMembers(group string, sids []string) error {
+	if _, err := LocalGroupDelMembersBySid(group, sids); err != nil {
+		return err
+	}
+	for _, sid := range sids {
+		sidCache.Forget(sid)
+	}
+	return nil
+}
+
+// LocalGroupGetEffectiveMembers returns every account that is a member of the
+// specified local group, either directly or through nested local and domain
+// groups, along with the path of groups by which it gained membership.
+//
+// Nested groups are expanded using NetGroupDirectory; see
+// ResolveEffectiveMembers for details.
+func LocalGroupGetEffectiveMembers(groupname string) (*so.EffectiveMembership, error) {
+	group, err := lookupAccountName(groupname)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to look up group %s: %s", groupname, err)
+	}
+	return ResolveEffectiveMembers(NetGroupDirectory{}, group)
+}
+
+// NetGroupDirectory is a GroupDirectory backed by the local machine's and
+// domain controllers' group APIs.
+//
+// Local groups are listed with NetLocalGroupGetMembers, on the local machine
+// or, for domain local groups, on a domain controller for the group's domain.
+// Domain groups are listed with NetGroupGetUsers on a domain controller, and
+// their members' SIDs looked up by name.
+type NetGroupDirectory struct{}
+
+func (NetGroupDirectory) GroupMembers(group so.SidAccount) ([]so.SidAccount, error) {
+	switch group.Type {
+	case so.SID_TYPE_ALIAS:
+		server := ""
+		if !isLocalDomain(group.Domain) {
+			dc, err := getAnyDCName(group.Domain)
+			if err != nil {
+				return nil, err
+			}
+			server = dc
+		}
+		return localGroupMembersWithSid(server, group.Name)
+	case so.SID_TYPE_GROUP:
+		if isLocalDomain(group.Domain) {
+			// The local "None" group, which has no enumerable members.
+			return []so.SidAccount{}, nil
+		}
+		dc, err := getAnyDCName(group.Domain)
+		if err != nil {
+			return nil, err
+		}
+		names, err := netGroupGetUsers(dc, group.Name)
+		if err != nil {
+			return nil, err
+		}
+		retVal := make([]so.SidAccount, 0, len(names))
+		for _, name := range names {
+			member, err := lookupAccountName(group.Domain + `\` + name)
+			if err != nil {
+				member = so.SidAccount{Domain: group.Domain, Name: name, Type: so.SID_TYPE_UNKNOWN}
+			}
+			retVal = append(retVal, member)
+		}
+		return retVal, nil
+	default:
+		return nil, fmt.Errorf("%s is not a group", group.FullName())
+	}
+}
+
+// localGroupMembersWithSid lists the members of a local group on server (or
+// the local machine, if server is empty) at level 2, which includes SIDs.
+func localGroupMembersWithSid(server, groupname string) ([]so.SidAccount, error) {
+	var (
+		dataPointer  uintptr
+		resumeHandle uintptr
+		entriesRead  uint32
+		entriesTotal uint32
+		sizeTest     LOCALGROUP_MEMBERS_INFO_2
+		serverPtr    *uint16
+		retVal       = make([]so.SidAccount, 0)
+	)
+
+	groupnamePtr, err := syscall.UTF16PtrFromString(groupname)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode group name to UTF16: %s", err)
+	}
+	if server != "" {
+		serverPtr, err = syscall.UTF16PtrFromString(server)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to encode server name to UTF16: %s", err)
+		}
+	}
+
+	ret, _, _ := usrNetLocalGroupGetMembers.Call(
+		uintptr(unsafe.Pointer(serverPtr)),         // servername
+		uintptr(unsafe.Pointer(groupnamePtr)),      // group name
+		uintptr(2),                                 // level, LOCALGROUP_MEMBERS_INFO_2
+		uintptr(unsafe.Pointer(&dataPointer)),      // bufptr
+		uintptr(uint32(USER_MAX_PREFERRED_LENGTH)), // prefmaxlen
+		uintptr(unsafe.Pointer(&entriesRead)),      // entriesread
+		uintptr(unsafe.Pointer(&entriesTotal)),     // totalentries
+		uintptr(unsafe.Pointer(&resumeHandle)),     // resumehandle
+	)
+	if ret != NET_API_STATUS_NERR_Success {
+		return nil, syscall.Errno(ret)
+	} else if dataPointer == uintptr(0) {
+		return nil, fmt.Errorf("null pointer while fetching entry")
+	}
+	defer usrNetApiBufferFree.Call(dataPointer)
+
+	var iter = dataPointer
+	for i := uint32(0); i < entriesRead; i++ {
+		var data = (*LOCALGROUP_MEMBERS_INFO_2)(unsafe.Pointer(iter))
+
+		member := so.SidAccount{Type: data.Lgrmi2_sidusage}
+		if data.Lgrmi2_sid != 0 {
+			member.SID = (*windows.SID)(unsafe.Pointer(data.Lgrmi2_sid)).String()
+		}
+		// Members whose SID doesn't resolve have no name.
+		if data.Lgrmi2_domainandname != nil && member.IsMapped() {
+			domainAndName := UTF16toString(data.Lgrmi2_domainandname)
+			if split := strings.SplitN(domainAndName, `\`, 2); len(split) == 2 {
+				member.Domain, member.Name = split[0], split[1]
+			} else {
+				member.Name = domainAndName
+			}
+		}
+		retVal = append(retVal, member)
+
+		iter = uintptr(unsafe.Pointer(iter + unsafe.Sizeof(sizeTest)))
+	}
+
+	return retVal, nil
+}
+
+// netGroupGetUsers returns the names of the members of a global group on
+// server.
+func netGroupGetUsers(server, groupname string) ([]string, error) {
+	var (
+		dataPointer  uintptr
+		resumeHandle uintptr
+		entriesRead  uint32
+		entriesTotal uint32
+		sizeTest     GROUP_USERS_INFO_0
+		retVal       = make([]string, 0)
+	)
+
+	serverPtr, err := syscall.UTF16PtrFromString(server)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode server name to UTF16: %s", err)
+	}
+	groupnamePtr, err := syscall.UTF16PtrFromString(groupname)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode group name to UTF16: %s", err)
+	}
+
+	ret, _, _ := usrNetGroupGetUsers.Call(
+		uintptr(unsafe.Pointer(serverPtr)),         // servername
+		uintptr(unsafe.Pointer(groupnamePtr)),      // group name
+		uintptr(0),                                 // level, GROUP_USERS_INFO_0
+		uintptr(unsafe.Pointer(&dataPointer)),      // bufptr
+		uintptr(uint32(USER_MAX_PREFERRED_LENGTH)), // prefmaxlen
+		uintptr(unsafe.Pointer(&entriesRead)),      // entriesread
+		uintptr(unsafe.Pointer(&entriesTotal)),     // totalentries
+		uintptr(unsafe.Pointer(&resumeHandle)),     // resumehandle
+	)
+	if ret != NET_API_STATUS_NERR_Success {
+		return nil, syscall.Errno(ret)
+	} else if dataPointer == uintptr(0) {
+		return retVal, nil
+	}
+	defer usrNetApiBufferFree.Call(dataPointer)
+
+	var iter = dataPointer
+	for i := uint32(0); i < entriesRead; i++ {
+		var data = (*GROUP_USERS_INFO_0)(unsafe.Pointer(iter))
+		retVal = append(retVal, UTF16toString(data.Grui0_name))
+		iter = uintptr(unsafe.Pointer(iter + unsafe.Sizeof(sizeTest)))
+	}
+
+	return retVal, nil
+}
+
+// getAnyDCName returns the name of a domain controller for domain, such as
+// \\DC01. If there isn't one, the returned error will be a syscall.Errno
+// containing the error code.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/nf-lmaccess-netgetanydcname
+func getAnyDCName(domain string) (string, error) {
+	var dcPointer uintptr
+	dPointer, err := syscall.UTF16PtrFromString(domain)
+	if err != nil {
+		return "", fmt.Errorf("Unable to encode domain to UTF16")
+	}
+
+	ret, _, _ := usrNetGetAnyDCName.Call(
+		uintptr(0),                        // servername
+		uintptr(unsafe.Pointer(dPointer)), // domainame
+		uintptr(unsafe.Pointer(&dcPointer)),
+	)
+	if dcPointer != uintptr(0) {
+		defer usrNetApiBufferFree.Call(dcPointer)
+	}
+	if ret != NET_API_STATUS_NERR_Success {
+		return "", syscall.Errno(ret)
+	}
+	if dcPointer == uintptr(0) {
+		return "", fmt.Errorf("Unable to find a domain controller for %s", domain)
+	}
+	return UTF16toString((*uint16)(unsafe.Pointer(dcPointer))), nil
+}
+
+// isLocalDomain reports whether accounts in domain are held by the local
+// machine rather than a domain controller.
+func isLocalDomain(domain string) bool {
+	hn, _ := os.Hostname()
+	switch strings.ToUpper(domain) {
+	case "", "BUILTIN", "NT AUTHORITY", strings.ToUpper(hn):
+		return true
+	}
+	return false
+}
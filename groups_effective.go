@@ -0,0 +1,125 @@
+package winapi
+
+import (
+	"sort"
+	"strings"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// A GroupDirectory lists the direct members of a group, and is used by
+// ResolveEffectiveMembers to expand nested groups.
+//
+// Members should be returned with their SID and Type set, as Type decides
+// whether a member is itself expanded.
+type GroupDirectory interface {
+	GroupMembers(group so.SidAccount) ([]so.SidAccount, error)
+}
+
+// ResolveEffectiveMembers expands the members of group recursively using dir,
+// returning every non-group account that is a member along with the paths by
+// which it gained membership.
+//
+// Local groups (SID_TYPE_ALIAS) and domain groups (SID_TYPE_GROUP) are
+// expanded. Each group's members are only fetched from dir once, however many
+// paths lead to it. Cycles are recorded and broken, and nested groups that dir
+// fails to list are recorded in Unexpanded rather than failing the whole
+// resolution; only an error listing group itself is returned.
+func ResolveEffectiveMembers(dir GroupDirectory, group so.SidAccount) (*so.EffectiveMembership, error) {
+	r := &effectiveResolver{
+		dir:     dir,
+		result:  &so.EffectiveMembership{Group: group, Members: make([]so.EffectiveGroupMember, 0)},
+		index:   make(map[string]int),
+		members: make(map[string][]so.SidAccount),
+		failed:  make(map[string]bool),
+	}
+
+	members, err := dir.GroupMembers(group)
+	if err != nil {
+		return nil, err
+	}
+	r.members[principalKey(group)] = members
+	r.walk(group, []so.SidAccount{group})
+
+	sort.SliceStable(r.result.Members, func(i, j int) bool {
+		return strings.ToLower(r.result.Members[i].FullName()) < strings.ToLower(r.result.Members[j].FullName())
+	})
+	return r.result, nil
+}
+
+type effectiveResolver struct {
+	dir     GroupDirectory
+	result  *so.EffectiveMembership
+	index   map[string]int
+	members map[string][]so.SidAccount
+	failed  map[string]bool
+}
+
+func (r *effectiveResolver) walk(group so.SidAccount, path []so.SidAccount) {
+	key := principalKey(group)
+	members, ok := r.members[key]
+	if !ok {
+		if r.failed[key] {
+			return
+		}
+		var err error
+		members, err = r.dir.GroupMembers(group)
+		if err != nil {
+			r.failed[key] = true
+			r.result.Unexpanded = append(r.result.Unexpanded, so.UnexpandedGroup{
+				Group: group,
+				Path:  copyPath(path[:len(path)-1]),
+				Error: err.Error(),
+			})
+			return
+		}
+		r.members[key] = members
+	}
+
+	for _, m := range members {
+		if isExpandableGroup(m) {
+			if pathContains(path, m) {
+				r.result.Cycles = append(r.result.Cycles, append(copyPath(path), m))
+				continue
+			}
+			r.walk(m, append(copyPath(path), m))
+			continue
+		}
+
+		mKey := principalKey(m)
+		i, ok := r.index[mKey]
+		if !ok {
+			i = len(r.result.Members)
+			r.index[mKey] = i
+			r.result.Members = append(r.result.Members, so.EffectiveGroupMember{SidAccount: m})
+		}
+		r.result.Members[i].Paths = append(r.result.Members[i].Paths, copyPath(path))
+	}
+}
+
+func isExpandableGroup(a so.SidAccount) bool {
+	return a.Type == so.SID_TYPE_GROUP || a.Type == so.SID_TYPE_ALIAS
+}
+
+// principalKey identifies an account by SID, falling back to its name for
+// directories that don't return SIDs.
+func principalKey(a so.SidAccount) string {
+	if a.SID != "" {
+		return strings.ToUpper(a.SID)
+	}
+	return strings.ToUpper(a.FullName())
+}
+
+func pathContains(path []so.SidAccount, a so.SidAccount) bool {
+	key := principalKey(a)
+	for _, p := range path {
+		if principalKey(p) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func copyPath(path []so.SidAccount) []so.SidAccount {
+	return append(make([]so.SidAccount, 0, len(path)+1), path...)
+}
@@ -0,0 +1,149 @@
+package winapi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+type memoryGroupDirectory struct {
+	groups map[string][]so.SidAccount
+	broken map[string]bool
+	calls  map[string]int
+}
+
+func (d *memoryGroupDirectory) GroupMembers(group so.SidAccount) ([]so.SidAccount, error) {
+	d.calls[group.SID]++
+	if d.broken[group.SID] {
+		return nil, fmt.Errorf("domain controller for %s unreachable", group.Domain)
+	}
+	members, ok := d.groups[group.SID]
+	if !ok {
+		return nil, fmt.Errorf("no such group %s", group.SID)
+	}
+	return members, nil
+}
+
+var (
+	tAdmins       = so.SidAccount{SID: "S-1-5-32-544", Domain: "BUILTIN", Name: "Administrators", Type: so.SID_TYPE_ALIAS}
+	tLocalAdmin   = so.SidAccount{SID: "S-1-5-21-1-1-1-500", Domain: "HOST", Name: "Administrator", Type: so.SID_TYPE_USER}
+	tDomainAdmins = so.SidAccount{SID: "S-1-5-21-2-2-2-512", Domain: "CORP", Name: "Domain Admins", Type: so.SID_TYPE_GROUP}
+	tHelpdesk     = so.SidAccount{SID: "S-1-5-21-2-2-2-1200", Domain: "CORP", Name: "Helpdesk", Type: so.SID_TYPE_GROUP}
+	tOtherForest  = so.SidAccount{SID: "S-1-5-21-3-3-3-1300", Domain: "PARTNER", Name: "Support", Type: so.SID_TYPE_GROUP}
+	tAlice        = so.SidAccount{SID: "S-1-5-21-2-2-2-1101", Domain: "CORP", Name: "alice", Type: so.SID_TYPE_USER}
+	tBob          = so.SidAccount{SID: "S-1-5-21-2-2-2-1102", Domain: "CORP", Name: "bob", Type: so.SID_TYPE_USER}
+	tInteractive  = so.SidAccount{SID: "S-1-5-4", Domain: "NT AUTHORITY", Name: "INTERACTIVE", Type: so.SID_TYPE_WELL_KNOWN_GROUP}
+	tOrphan       = so.SidAccount{SID: "S-1-5-21-2-2-2-9999", Type: so.SID_TYPE_UNKNOWN}
+)
+
+func newTestDirectory() *memoryGroupDirectory {
+	return &memoryGroupDirectory{
+		groups: map[string][]so.SidAccount{
+			tAdmins.SID:       {tLocalAdmin, tDomainAdmins, tHelpdesk, tInteractive, tOrphan},
+			tDomainAdmins.SID: {tAlice, tHelpdesk},
+			// Helpdesk is nested back into Domain Admins, forming a cycle.
+			tHelpdesk.SID: {tBob, tAlice, tDomainAdmins, tOtherForest},
+		},
+		broken: map[string]bool{tOtherForest.SID: true},
+		calls:  make(map[string]int),
+	}
+}
+
+func names(path []so.SidAccount) []string {
+	retVal := make([]string, 0, len(path))
+	for _, p := range path {
+		retVal = append(retVal, p.Name)
+	}
+	return retVal
+}
+
+func TestResolveEffectiveMembers(t *testing.T) {
+	dir := newTestDirectory()
+	res, err := ResolveEffectiveMembers(dir, tAdmins)
+	if err != nil {
+		t.Fatalf("ResolveEffectiveMembers: %v", err)
+	}
+
+	got := make(map[string]so.EffectiveGroupMember)
+	for _, m := range res.Members {
+		got[m.SID] = m
+	}
+	if len(got) != 5 {
+		t.Fatalf("expected 5 effective members, got %+v", res.Members)
+	}
+	if _, ok := got[tDomainAdmins.SID]; ok {
+		t.Errorf("nested group reported as a member")
+	}
+
+	admin := got[tLocalAdmin.SID]
+	if !admin.IsDirect() || len(admin.Paths) != 1 {
+		t.Errorf("local admin should be a direct member: %+v", admin)
+	}
+
+	alice := got[tAlice.SID]
+	if alice.IsDirect() {
+		t.Errorf("alice should not be a direct member")
+	}
+	wantAlice := [][]string{
+		{"Administrators", "Domain Admins"},
+		{"Administrators", "Domain Admins", "Helpdesk"},
+		{"Administrators", "Helpdesk"},
+		{"Administrators", "Helpdesk", "Domain Admins"},
+	}
+	gotAlice := make([][]string, 0)
+	for _, p := range alice.Paths {
+		gotAlice = append(gotAlice, names(p))
+	}
+	if !reflect.DeepEqual(gotAlice, wantAlice) {
+		t.Errorf("alice paths = %v, want %v", gotAlice, wantAlice)
+	}
+
+	if _, ok := got[tOrphan.SID]; !ok {
+		t.Errorf("orphaned SID not reported")
+	}
+	if _, ok := got[tInteractive.SID]; !ok {
+		t.Errorf("well-known group not reported as a member")
+	}
+
+	// Each group is only listed once, despite being reachable by several paths.
+	for sid, n := range dir.calls {
+		if n != 1 {
+			t.Errorf("group %s listed %d times", sid, n)
+		}
+	}
+}
+
+func TestResolveEffectiveMembersCyclesAndFailures(t *testing.T) {
+	res, err := ResolveEffectiveMembers(newTestDirectory(), tAdmins)
+	if err != nil {
+		t.Fatalf("ResolveEffectiveMembers: %v", err)
+	}
+
+	if len(res.Cycles) != 2 {
+		t.Fatalf("expected 2 cycles, got %d: %v", len(res.Cycles), res.Cycles)
+	}
+	if want := []string{"Administrators", "Domain Admins", "Helpdesk", "Domain Admins"}; !reflect.DeepEqual(names(res.Cycles[0]), want) {
+		t.Errorf("first cycle = %v, want %v", names(res.Cycles[0]), want)
+	}
+
+	if len(res.Unexpanded) != 1 {
+		t.Fatalf("expected 1 unexpanded group, got %+v", res.Unexpanded)
+	}
+	u := res.Unexpanded[0]
+	if u.Group.SID != tOtherForest.SID || u.Error == "" {
+		t.Errorf("unexpected unexpanded group: %+v", u)
+	}
+	if want := []string{"Administrators", "Domain Admins", "Helpdesk"}; !reflect.DeepEqual(names(u.Path), want) {
+		t.Errorf("unexpanded path = %v, want %v", names(u.Path), want)
+	}
+}
+
+func TestResolveEffectiveMembersRootError(t *testing.T) {
+	dir := newTestDirectory()
+	dir.broken[tAdmins.SID] = true
+	if _, err := ResolveEffectiveMembers(dir, tAdmins); err == nil {
+		t.Errorf("expected error when the queried group can't be listed")
+	}
+}
@@ -0,0 +1,84 @@
+package winapi
+
+import (
+	"fmt"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// orphanDirectory is what findGroupOrphans needs from the system: fresh SID
+// lookups, whether a domain's controllers can be reached, and removing
+// members from a local group.
+type orphanDirectory interface {
+	SidResolver
+	DomainReachable(domain string) bool
+	RemoveMembers(group string, sids []string) error
+}
+
+// findGroupOrphans returns the members whose SIDs are still unmapped when
+// looked up again, with SidUsage set to the result of that lookup, and
+// removes them from group if remove is true and the orphan is confirmed.
+//
+// An orphan is confirmed if LSA reports it as a deleted account, or its
+// domain is reachable, as an unreachable trusted domain's accounts can't be
+// told apart from deleted ones. Unconfirmed orphans are returned without
+// Removed set.
+func findGroupOrphans(dir orphanDirectory, group string, members []so.LocalGroupMember, remove bool) ([]so.LocalGroupMember, error) {
+	candidates := make([]so.LocalGroupMember, 0)
+	candidateSids := make([]string, 0)
+	for _, m := range members {
+		if m.IsOrphaned() {
+			candidates = append(candidates, m)
+			candidateSids = append(candidateSids, m.SID)
+		}
+	}
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	accounts, err := dir.LookupSids(candidateSids)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to confirm orphaned SIDs: %s", err)
+	}
+	if len(accounts) != len(candidates) {
+		return nil, fmt.Errorf("Unable to confirm orphaned SIDs: %d results for %d SIDs", len(accounts), len(candidates))
+	}
+
+	orphans := make([]so.LocalGroupMember, 0, len(candidates))
+	confirmed := make([]int, 0, len(candidates))
+	reachable := make(map[string]bool)
+	for i, a := range accounts {
+		if a.IsMapped() {
+			continue
+		}
+		m := candidates[i]
+		m.SidUsage = a.Type
+		if a.Type == so.SID_TYPE_DELETED_ACCOUNT {
+			confirmed = append(confirmed, len(orphans))
+		} else if a.Domain != "" {
+			ok, checked := reachable[a.Domain]
+			if !checked {
+				ok = dir.DomainReachable(a.Domain)
+				reachable[a.Domain] = ok
+			}
+			if ok {
+				confirmed = append(confirmed, len(orphans))
+			}
+		}
+		orphans = append(orphans, m)
+	}
+
+	if remove && len(confirmed) > 0 {
+		sids := make([]string, 0, len(confirmed))
+		for _, i := range confirmed {
+			sids = append(sids, orphans[i].SID)
+		}
+		if err := dir.RemoveMembers(group, sids); err != nil {
+			return orphans, err
+		}
+		for _, i := range confirmed {
+			orphans[i].Removed = true
+		}
+	}
+	return orphans, nil
+}
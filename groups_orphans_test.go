@@ -0,0 +1,170 @@
+package winapi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+type fakeOrphanDirectory struct {
+	accounts  map[string]so.SidAccount
+	reachable map[string]bool
+	lookups   [][]string
+	checked   []string
+	removed   []string
+	removeErr error
+}
+
+func (d *fakeOrphanDirectory) LookupSids(sids []string) ([]so.SidAccount, error) {
+	d.lookups = append(d.lookups, sids)
+	retVal := make([]so.SidAccount, 0, len(sids))
+	for _, sid := range sids {
+		a, ok := d.accounts[sid]
+		if !ok {
+			a = so.SidAccount{Type: so.SID_TYPE_UNKNOWN}
+		}
+		a.SID = sid
+		retVal = append(retVal, a)
+	}
+	return retVal, nil
+}
+
+func (d *fakeOrphanDirectory) DomainReachable(domain string) bool {
+	d.checked = append(d.checked, domain)
+	return d.reachable[domain]
+}
+
+func (d *fakeOrphanDirectory) RemoveMembers(group string, sids []string) error {
+	if d.removeErr != nil {
+		return d.removeErr
+	}
+	d.removed = append(d.removed, sids...)
+	return nil
+}
+
+func TestLocalGroupMemberIsOrphaned(t *testing.T) {
+	tests := []struct {
+		member so.LocalGroupMember
+		want   bool
+	}{
+		{so.LocalGroupMember{SID: "S-1-5-21-1-2-3-500", SidUsage: so.SID_TYPE_USER}, false},
+		{so.LocalGroupMember{SID: "S-1-5-21-1-2-3-512", SidUsage: so.SID_TYPE_GROUP}, false},
+		{so.LocalGroupMember{SID: "S-1-5-21-1-2-3-1001", SidUsage: so.SID_TYPE_DELETED_ACCOUNT}, true},
+		{so.LocalGroupMember{SID: "S-1-5-21-1-2-3-1002", SidUsage: so.SID_TYPE_INVALID}, true},
+		{so.LocalGroupMember{SID: "S-1-5-21-1-2-3-1003", SidUsage: so.SID_TYPE_UNKNOWN}, true},
+		// Members listed without SIDs can't be judged.
+		{so.LocalGroupMember{Name: "alice", SidUsage: so.SID_TYPE_UNKNOWN}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.member.IsOrphaned(); got != tt.want {
+			t.Errorf("IsOrphaned(%+v) = %v, want %v", tt.member, got, tt.want)
+		}
+	}
+}
+
+func TestFindGroupOrphans(t *testing.T) {
+	const (
+		live       = "S-1-5-21-1-1-1-1001"
+		resolved   = "S-1-5-21-1-1-1-1002"
+		deleted    = "S-1-5-21-1-1-1-1003"
+		goneCorp   = "S-1-5-21-2-2-2-1101"
+		goneCorp2  = "S-1-5-21-2-2-2-1102"
+		offline    = "S-1-5-21-3-3-3-1201"
+		noDomain   = "S-1-5-21-4-4-4-1301"
+		unresolved = so.SID_TYPE_UNKNOWN
+	)
+	members := []so.LocalGroupMember{
+		{Name: "admin", SID: live, SidUsage: so.SID_TYPE_USER},
+		// Unresolved when the group was listed, but resolves now.
+		{SID: resolved, SidUsage: unresolved},
+		{SID: deleted, SidUsage: so.SID_TYPE_DELETED_ACCOUNT},
+		{SID: goneCorp, SidUsage: unresolved},
+		{SID: goneCorp2, SidUsage: unresolved},
+		{SID: offline, SidUsage: unresolved},
+		{SID: noDomain, SidUsage: unresolved},
+	}
+	newDir := func() *fakeOrphanDirectory {
+		return &fakeOrphanDirectory{
+			accounts: map[string]so.SidAccount{
+				resolved:  {Domain: "CORP", Name: "bob", Type: so.SID_TYPE_USER},
+				deleted:   {Type: so.SID_TYPE_DELETED_ACCOUNT},
+				goneCorp:  {Domain: "CORP", Type: unresolved},
+				goneCorp2: {Domain: "CORP", Type: unresolved},
+				offline:   {Domain: "PARTNER", Type: unresolved},
+			},
+			reachable: map[string]bool{"CORP": true},
+		}
+	}
+	sids := func(l []so.LocalGroupMember) []string {
+		retVal := make([]string, 0, len(l))
+		for _, m := range l {
+			retVal = append(retVal, m.SID)
+		}
+		return retVal
+	}
+	wantOrphans := []string{deleted, goneCorp, goneCorp2, offline, noDomain}
+
+	dir := newDir()
+	orphans, err := findGroupOrphans(dir, "Administrators", members, false)
+	if err != nil {
+		t.Fatalf("findGroupOrphans: %s", err)
+	}
+	if !reflect.DeepEqual(sids(orphans), wantOrphans) {
+		t.Errorf("orphans = %v, want %v", sids(orphans), wantOrphans)
+	}
+	if want := [][]string{{resolved, deleted, goneCorp, goneCorp2, offline, noDomain}}; !reflect.DeepEqual(dir.lookups, want) {
+		t.Errorf("looked up %v, want only the candidates %v", dir.lookups, want)
+	}
+	if len(dir.removed) != 0 {
+		t.Errorf("removed %v without being asked to", dir.removed)
+	}
+	for _, m := range orphans {
+		if m.Removed {
+			t.Errorf("%s marked removed without being asked to", m.SID)
+		}
+	}
+
+	// Only deleted accounts and orphans of reachable domains are removed,
+	// and each domain is only checked once.
+	dir = newDir()
+	orphans, err = findGroupOrphans(dir, "Administrators", members, true)
+	if err != nil {
+		t.Fatalf("findGroupOrphans: %s", err)
+	}
+	if want := []string{deleted, goneCorp, goneCorp2}; !reflect.DeepEqual(dir.removed, want) {
+		t.Errorf("removed %v, want %v", dir.removed, want)
+	}
+	if want := []string{"CORP", "PARTNER"}; !reflect.DeepEqual(dir.checked, want) {
+		t.Errorf("checked domains %v, want %v", dir.checked, want)
+	}
+	removed := map[string]bool{deleted: true, goneCorp: true, goneCorp2: true}
+	for _, m := range orphans {
+		if m.Removed != removed[m.SID] {
+			t.Errorf("%s removed = %v, want %v", m.SID, m.Removed, removed[m.SID])
+		}
+	}
+	if orphans[0].SidUsage != so.SID_TYPE_DELETED_ACCOUNT || orphans[1].SidUsage != unresolved {
+		t.Errorf("SidUsage isn't from the fresh lookup: %+v", orphans)
+	}
+
+	// Nothing is reported as removed if removal fails.
+	dir = newDir()
+	dir.removeErr = fmt.Errorf("access denied")
+	orphans, err = findGroupOrphans(dir, "Administrators", members, true)
+	if err == nil {
+		t.Errorf("a failed removal should be returned")
+	}
+	for _, m := range orphans {
+		if m.Removed {
+			t.Errorf("%s marked removed after removal failed", m.SID)
+		}
+	}
+
+	// Without candidates, nothing is looked up.
+	dir = newDir()
+	if orphans, err := findGroupOrphans(dir, "Administrators", members[:1], true); err != nil || len(orphans) != 0 || len(dir.lookups) != 0 {
+		t.Errorf("no candidates = %v, %v after %d lookups", orphans, err, len(dir.lookups))
+	}
+}
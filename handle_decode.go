@@ -0,0 +1,127 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Layout of the 64-bit structures returned by NtQuerySystemInformation for
+// SystemExtendedHandleInformation and NtQueryObject for
+// ObjectTypesInformation.
+const (
+	SYSTEM_HANDLE_INFORMATION_EX_HEADER = 16
+	SYSTEM_HANDLE_ENTRY_EX_SIZE         = 40
+
+	OBJECT_TYPES_INFORMATION_HEADER  = 8
+	OBJECT_TYPE_INFORMATION_SIZE     = 104
+	OBJECT_TYPE_INFORMATION_TYPE_IDX = 90
+
+	// Type indexes of the first entry in the types table, before Windows 8.1
+	// started recording them.
+	OBJECT_FIRST_TYPE_INDEX = 2
+)
+
+// systemHandle is a SYSTEM_HANDLE_TABLE_ENTRY_INFO_EX.
+type systemHandle struct {
+	Object        uint64
+	Pid           uint64
+	Handle        uint64
+	GrantedAccess uint32
+	TypeIndex     uint16
+	Attributes    uint32
+}
+
+// decodeSystemHandles returns the entries of a SYSTEM_HANDLE_INFORMATION_EX
+// belonging to pid.
+func decodeSystemHandles(buf []byte, pid uint32) ([]systemHandle, error) {
+	if len(buf) < SYSTEM_HANDLE_INFORMATION_EX_HEADER {
+		return nil, fmt.Errorf("SYSTEM_HANDLE_INFORMATION_EX buffer too short")
+	}
+	count := binary.LittleEndian.Uint64(buf[0:])
+	if count > uint64((len(buf)-SYSTEM_HANDLE_INFORMATION_EX_HEADER)/SYSTEM_HANDLE_ENTRY_EX_SIZE) {
+		return nil, fmt.Errorf("SYSTEM_HANDLE_INFORMATION_EX claims %d handles, more than fit in %d bytes", count, len(buf))
+	}
+
+	retVal := make([]systemHandle, 0)
+	for i := uint64(0); i < count; i++ {
+		e := buf[SYSTEM_HANDLE_INFORMATION_EX_HEADER+i*SYSTEM_HANDLE_ENTRY_EX_SIZE:]
+		if binary.LittleEndian.Uint64(e[8:]) != uint64(pid) {
+			continue
+		}
+		retVal = append(retVal, systemHandle{
+			Object:        binary.LittleEndian.Uint64(e[0:]),
+			Pid:           binary.LittleEndian.Uint64(e[8:]),
+			Handle:        binary.LittleEndian.Uint64(e[16:]),
+			GrantedAccess: binary.LittleEndian.Uint32(e[24:]),
+			TypeIndex:     binary.LittleEndian.Uint16(e[30:]),
+			Attributes:    binary.LittleEndian.Uint32(e[32:]),
+		})
+	}
+	return retVal, nil
+}
+
+// decodeObjectTypes maps type indexes to names from an
+// OBJECT_TYPES_INFORMATION, as returned at base by NtQueryObject. Each
+// OBJECT_TYPE_INFORMATION is followed by its name, padded to 8 bytes.
+func decodeObjectTypes(buf []byte, base uintptr) (map[uint16]string, error) {
+	if len(buf) < OBJECT_TYPES_INFORMATION_HEADER {
+		return nil, fmt.Errorf("OBJECT_TYPES_INFORMATION buffer too short")
+	}
+	count := binary.LittleEndian.Uint32(buf[0:])
+
+	retVal := make(map[uint16]string, count)
+	off := OBJECT_TYPES_INFORMATION_HEADER
+	for i := uint32(0); i < count; i++ {
+		if off+OBJECT_TYPE_INFORMATION_SIZE > len(buf) {
+			return nil, fmt.Errorf("OBJECT_TYPE_INFORMATION %d outside of buffer", i)
+		}
+		name, err := decodeUnicodeString(buf[off:], base+uintptr(off))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode name of object type %d: %s", i, err)
+		}
+		index := uint16(buf[off+OBJECT_TYPE_INFORMATION_TYPE_IDX])
+		if index == 0 {
+			index = uint16(i) + OBJECT_FIRST_TYPE_INDEX
+		}
+		retVal[index] = name
+
+		maxLength := int(binary.LittleEndian.Uint16(buf[off+2:]))
+		off += OBJECT_TYPE_INFORMATION_SIZE + (maxLength+7)&^7
+	}
+	return retVal, nil
+}
+
+// Kernel namespace prefixes of registry keys, and the hive names they're
+// shown with.
+var registryObjectPrefixes = []struct {
+	prefix, hive string
+}{
+	{"\\REGISTRY\\MACHINE", "HKEY_LOCAL_MACHINE"},
+	{"\\REGISTRY\\USER", "HKEY_USERS"},
+}
+
+// dosObjectName converts the kernel name of a File or Key object to the form
+// users know: device paths become drive letter paths, using devices which
+// maps device names such as "\Device\HarddiskVolume3" to drives such as "C:",
+// and registry keys are given their hive names. Anything else is unchanged.
+func dosObjectName(typeName string, name string, devices map[string]string) string {
+	switch typeName {
+	case "File":
+		for device, drive := range devices {
+			if len(name) > len(device) && strings.EqualFold(name[:len(device)], device) && name[len(device)] == '\\' {
+				return drive + name[len(device):]
+			}
+			if strings.EqualFold(name, device) {
+				return drive + "\\"
+			}
+		}
+	case "Key":
+		for _, p := range registryObjectPrefixes {
+			if len(name) >= len(p.prefix) && strings.EqualFold(name[:len(p.prefix)], p.prefix) && (len(name) == len(p.prefix) || name[len(p.prefix)] == '\\') {
+				return p.hive + name[len(p.prefix):]
+			}
+		}
+	}
+	return name
+}
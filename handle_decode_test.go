@@ -0,0 +1,114 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func handleEntry(object, pid, handle uint64, access uint32, typeIndex uint16) []byte {
+	e := make([]byte, SYSTEM_HANDLE_ENTRY_EX_SIZE)
+	binary.LittleEndian.PutUint64(e[0:], object)
+	binary.LittleEndian.PutUint64(e[8:], pid)
+	binary.LittleEndian.PutUint64(e[16:], handle)
+	binary.LittleEndian.PutUint32(e[24:], access)
+	binary.LittleEndian.PutUint16(e[30:], typeIndex)
+	return e
+}
+
+func TestDecodeSystemHandles(t *testing.T) {
+	buf := make([]byte, SYSTEM_HANDLE_INFORMATION_EX_HEADER)
+	binary.LittleEndian.PutUint64(buf[0:], 3)
+	buf = append(buf, handleEntry(0xffff8001, 4, 0x4, 0x1fffff, 7)...)
+	buf = append(buf, handleEntry(0xffff8002, 1234, 0x10, 0x120089, 37)...)
+	buf = append(buf, handleEntry(0xffff8003, 1234, 0x14, 0x20019, 44)...)
+
+	got, err := decodeSystemHandles(buf, 1234)
+	if err != nil {
+		t.Fatalf("decodeSystemHandles: %v", err)
+	}
+	want := []systemHandle{
+		{Object: 0xffff8002, Pid: 1234, Handle: 0x10, GrantedAccess: 0x120089, TypeIndex: 37},
+		{Object: 0xffff8003, Pid: 1234, Handle: 0x14, GrantedAccess: 0x20019, TypeIndex: 44},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeSystemHandles = %+v, want %+v", got, want)
+	}
+
+	if _, err := decodeSystemHandles(buf[:len(buf)-1], 1234); err == nil {
+		t.Errorf("expected error for truncated handle table")
+	}
+}
+
+// objectTypes lays out an OBJECT_TYPES_INFORMATION at base, with the given
+// TypeIndex recorded for each type (0 to leave it unset).
+func objectTypes(base uintptr, names []string, indexes []byte) []byte {
+	buf := make([]byte, OBJECT_TYPES_INFORMATION_HEADER)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(names)))
+	for i, name := range names {
+		off := len(buf)
+		chars := utf16Bytes(name)
+		maxLength := len(chars) + 2
+		entry := make([]byte, OBJECT_TYPE_INFORMATION_SIZE+(maxLength+7)&^7)
+		binary.LittleEndian.PutUint16(entry[0:], uint16(len(chars)))
+		binary.LittleEndian.PutUint16(entry[2:], uint16(maxLength))
+		binary.LittleEndian.PutUint64(entry[8:], uint64(base)+uint64(off+OBJECT_TYPE_INFORMATION_SIZE))
+		entry[OBJECT_TYPE_INFORMATION_TYPE_IDX] = indexes[i]
+		copy(entry[OBJECT_TYPE_INFORMATION_SIZE:], chars)
+		buf = append(buf, entry...)
+	}
+	return buf
+}
+
+func TestDecodeObjectTypes(t *testing.T) {
+	const base = 0x30000
+	buf := objectTypes(base, []string{"Type", "Directory", "File", "Key"}, []byte{2, 3, 37, 44})
+	got, err := decodeObjectTypes(buf, base)
+	if err != nil {
+		t.Fatalf("decodeObjectTypes: %v", err)
+	}
+	want := map[uint16]string{2: "Type", 3: "Directory", 37: "File", 44: "Key"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeObjectTypes = %v, want %v", got, want)
+	}
+
+	// Before Windows 8.1 the index is the position in the table, from 2.
+	buf = objectTypes(base, []string{"Type", "Directory"}, []byte{0, 0})
+	got, err = decodeObjectTypes(buf, base)
+	if err != nil {
+		t.Fatalf("decodeObjectTypes: %v", err)
+	}
+	if want := map[uint16]string{2: "Type", 3: "Directory"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeObjectTypes without indexes = %v, want %v", got, want)
+	}
+
+	if _, err := decodeObjectTypes(buf[:len(buf)-8], base); err == nil {
+		t.Errorf("expected error for truncated types table")
+	}
+}
+
+func TestDosObjectName(t *testing.T) {
+	devices := map[string]string{
+		`\Device\HarddiskVolume1`:  "C:",
+		`\Device\HarddiskVolume10`: "D:",
+	}
+	tests := []struct {
+		typeName, name, want string
+	}{
+		{"File", `\Device\HarddiskVolume1\Windows\System32\en-US\kernel32.dll.mui`, `C:\Windows\System32\en-US\kernel32.dll.mui`},
+		{"File", `\Device\HarddiskVolume10\data.db`, `D:\data.db`},
+		{"File", `\device\harddiskvolume1`, `C:\`},
+		{"File", `\Device\HarddiskVolume2\other.txt`, `\Device\HarddiskVolume2\other.txt`},
+		{"File", `\Device\Afd`, `\Device\Afd`},
+		{"Key", `\REGISTRY\MACHINE\SOFTWARE\Microsoft`, `HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft`},
+		{"Key", `\REGISTRY\USER\S-1-5-21-1-2-3-1001_Classes`, `HKEY_USERS\S-1-5-21-1-2-3-1001_Classes`},
+		{"Key", `\REGISTRY\MACHINE`, `HKEY_LOCAL_MACHINE`},
+		{"Key", `\REGISTRY\MACHINEX`, `\REGISTRY\MACHINEX`},
+		{"Event", `\BaseNamedObjects\Foo`, `\BaseNamedObjects\Foo`},
+	}
+	for _, tt := range tests {
+		if got := dosObjectName(tt.typeName, tt.name, devices); got != tt.want {
+			t.Errorf("dosObjectName(%s, %q) = %q, want %q", tt.typeName, tt.name, got, tt.want)
+		}
+	}
+}
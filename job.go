@@ -0,0 +1,230 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	jobCreateJobObject           = modKernel32.NewProc("CreateJobObjectW")
+	jobOpenJobObject             = modKernel32.NewProc("OpenJobObjectW")
+	jobAssignProcessToJobObject  = modKernel32.NewProc("AssignProcessToJobObject")
+	jobSetInformationJobObject   = modKernel32.NewProc("SetInformationJobObject")
+	jobQueryInformationJobObject = modKernel32.NewProc("QueryInformationJobObject")
+	jobTerminateJobObject        = modKernel32.NewProc("TerminateJobObject")
+	jobNtResumeProcess           = modNtdll.NewProc("NtResumeProcess")
+)
+
+const (
+	JOB_OBJECT_ALL_ACCESS = 0x1F001F
+
+	PROCESS_SET_QUOTA      = 0x0100
+	PROCESS_SUSPEND_RESUME = 0x0800
+
+	PROC_CREATE_SUSPENDED = 0x00000004
+)
+
+// A Job is a Windows Job Object, which groups processes so they can be
+// limited, accounted for and terminated together.
+type Job struct {
+	Name string
+
+	handle uintptr
+}
+
+// CreateJob creates a Job Object with the given limits. A name makes the job
+// available to OpenJob, and opens the existing job if there's already one by
+// that name; an empty name creates an anonymous job.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/jobapi2/nf-jobapi2-createjobobjectw
+func CreateJob(name string, limits so.JobLimits) (*Job, error) {
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	var namePtr *uint16
+	if name != "" {
+		var err error
+		if namePtr, err = syscall.UTF16PtrFromString(name); err != nil {
+			return nil, fmt.Errorf("Unable to encode job name: %s", err)
+		}
+	}
+
+	handle, _, lastError := jobCreateJobObject.Call(
+		uintptr(0), // security attributes
+		uintptr(unsafe.Pointer(namePtr)),
+	)
+	if handle == 0 {
+		return nil, fmt.Errorf("Unable to create job object: %s", lastError)
+	}
+	j := &Job{Name: name, handle: handle}
+	if err := j.SetLimits(limits); err != nil {
+		j.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// OpenJob opens an existing named Job Object.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/jobapi2/nf-jobapi2-openjobobjectw
+func OpenJob(name string) (*Job, error) {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode job name: %s", err)
+	}
+	handle, _, lastError := jobOpenJobObject.Call(
+		uintptr(JOB_OBJECT_ALL_ACCESS),
+		uintptr(0), // inherit handle
+		uintptr(unsafe.Pointer(namePtr)),
+	)
+	if handle == 0 {
+		return nil, fmt.Errorf("Unable to open job object %s: %s", name, lastError)
+	}
+	return &Job{Name: name, handle: handle}, nil
+}
+
+// SetLimits replaces the job's limits. CPU rate limits need Windows 8 or
+// later.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/jobapi2/nf-jobapi2-setinformationjobobject
+func (j *Job) SetLimits(limits so.JobLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+
+	ext := jobExtendedLimits(limits)
+	ret, _, lastError := jobSetInformationJobObject.Call(
+		j.handle,
+		uintptr(JOB_OBJECT_INFO_EXTENDED_LIMIT),
+		uintptr(unsafe.Pointer(&ext)),
+		uintptr(uint32(unsafe.Sizeof(ext))),
+	)
+	if ret == 0 {
+		return fmt.Errorf("Unable to set job limits: %s", lastError)
+	}
+
+	rate := jobCPURateControl(limits)
+	ret, _, lastError = jobSetInformationJobObject.Call(
+		j.handle,
+		uintptr(JOB_OBJECT_INFO_CPU_RATE_CONTROL),
+		uintptr(unsafe.Pointer(&rate)),
+		uintptr(uint32(unsafe.Sizeof(rate))),
+	)
+	// Older versions of Windows don't support rate control at all, which
+	// only matters if a rate was asked for.
+	if ret == 0 && limits.CPURate != 0 {
+		return fmt.Errorf("Unable to set job CPU rate: %s", lastError)
+	}
+	return nil
+}
+
+// Assign adds the process with the given PID to the job. Processes it starts
+// from then on are in the job too.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/jobapi2/nf-jobapi2-assignprocesstojobobject
+func (j *Job) Assign(pid uint32) error {
+	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_SET_QUOTA|PROCESS_TERMINATE)), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return fmt.Errorf("Unable to open process %d: %s", pid, lastError)
+	}
+	defer procCloseHandle.Call(handle)
+	return j.assignHandle(handle, pid)
+}
+
+func (j *Job) assignHandle(handle uintptr, pid uint32) error {
+	ret, _, lastError := jobAssignProcessToJobObject.Call(j.handle, handle)
+	if ret == 0 {
+		return fmt.Errorf("Unable to assign process %d to job: %s", pid, lastError)
+	}
+	return nil
+}
+
+// StartCommand starts cmd inside the job. The process is created suspended
+// and only resumed once it's in the job, so neither it nor anything it starts
+// can escape the job's limits. The caller waits for cmd as usual.
+func (j *Job) StartCommand(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= PROC_CREATE_SUSPENDED
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	abort := func(err error) error {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	pid := uint32(cmd.Process.Pid)
+	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_SET_QUOTA|PROCESS_TERMINATE|PROCESS_SUSPEND_RESUME)), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return abort(fmt.Errorf("Unable to open process %d: %s", pid, lastError))
+	}
+	defer procCloseHandle.Call(handle)
+
+	if err := j.assignHandle(handle, pid); err != nil {
+		return abort(err)
+	}
+	// os/exec doesn't expose the main thread, so resume the whole process.
+	if status, _, _ := jobNtResumeProcess.Call(handle); status != 0 {
+		return abort(fmt.Errorf("Unable to resume process %d: NTSTATUS 0x%x", pid, status))
+	}
+	return nil
+}
+
+// Accounting returns the resource usage of every process that has run in the
+// job.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/jobapi2/nf-jobapi2-queryinformationjobobject
+func (j *Job) Accounting() (so.JobAccounting, error) {
+	var acct JOBOBJECT_BASIC_AND_IO_ACCOUNTING_INFORMATION
+	if err := j.query(JOB_OBJECT_INFO_BASIC_AND_IO_ACCOUNTING, unsafe.Pointer(&acct), unsafe.Sizeof(acct)); err != nil {
+		return so.JobAccounting{}, err
+	}
+	var ext JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	if err := j.query(JOB_OBJECT_INFO_EXTENDED_LIMIT, unsafe.Pointer(&ext), unsafe.Sizeof(ext)); err != nil {
+		return so.JobAccounting{}, err
+	}
+	return jobAccounting(acct, ext), nil
+}
+
+func (j *Job) query(class uint32, buf unsafe.Pointer, size uintptr) error {
+	ret, _, lastError := jobQueryInformationJobObject.Call(
+		j.handle,
+		uintptr(class),
+		uintptr(buf),
+		uintptr(uint32(size)),
+		uintptr(0), // return length
+	)
+	if ret == 0 {
+		return fmt.Errorf("Unable to query job information: %s", lastError)
+	}
+	return nil
+}
+
+// Terminate ends every process in the job with the given exit code.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/jobapi2/nf-jobapi2-terminatejobobject
+func (j *Job) Terminate(exitCode uint32) error {
+	ret, _, lastError := jobTerminateJobObject.Call(j.handle, uintptr(exitCode))
+	if ret == 0 {
+		return fmt.Errorf("Unable to terminate job: %s", lastError)
+	}
+	return nil
+}
+
+// Close releases the handle to the job. If it was the last handle and the job
+// has KillOnClose set, its processes are terminated.
+func (j *Job) Close() error {
+	if j.handle == 0 {
+		return nil
+	}
+	ret, _, lastError := procCloseHandle.Call(j.handle)
+	j.handle = 0
+	if ret == 0 {
+		return fmt.Errorf("Unable to close job: %s", lastError)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package winapi
+
+import (
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// Job Object information classes.
+const (
+	JOB_OBJECT_INFO_BASIC_AND_IO_ACCOUNTING = 8
+	JOB_OBJECT_INFO_EXTENDED_LIMIT          = 9
+	JOB_OBJECT_INFO_CPU_RATE_CONTROL        = 15
+)
+
+// JOBOBJECT_BASIC_LIMIT_INFORMATION LimitFlags.
+const (
+	JOB_OBJECT_LIMIT_ACTIVE_PROCESS             = 0x00000008
+	JOB_OBJECT_LIMIT_PROCESS_MEMORY             = 0x00000100
+	JOB_OBJECT_LIMIT_JOB_MEMORY                 = 0x00000200
+	JOB_OBJECT_LIMIT_DIE_ON_UNHANDLED_EXCEPTION = 0x00000400
+	JOB_OBJECT_LIMIT_BREAKAWAY_OK               = 0x00000800
+	JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE          = 0x00002000
+)
+
+// JOBOBJECT_CPU_RATE_CONTROL_INFORMATION ControlFlags.
+const (
+	JOB_OBJECT_CPU_RATE_CONTROL_ENABLE   = 0x1
+	JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP = 0x4
+)
+
+type JOBOBJECT_BASIC_LIMIT_INFORMATION struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type IO_COUNTERS struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type JOBOBJECT_EXTENDED_LIMIT_INFORMATION struct {
+	BasicLimitInformation JOBOBJECT_BASIC_LIMIT_INFORMATION
+	IoInfo                IO_COUNTERS
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+type JOBOBJECT_CPU_RATE_CONTROL_INFORMATION struct {
+	ControlFlags uint32
+	CpuRate      uint32
+}
+
+type JOBOBJECT_BASIC_ACCOUNTING_INFORMATION struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
+type JOBOBJECT_BASIC_AND_IO_ACCOUNTING_INFORMATION struct {
+	BasicInfo JOBOBJECT_BASIC_ACCOUNTING_INFORMATION
+	IoInfo    IO_COUNTERS
+}
+
+// jobExtendedLimits converts limits, which should have been validated, to the
+// structure set with JOB_OBJECT_INFO_EXTENDED_LIMIT.
+func jobExtendedLimits(limits so.JobLimits) JOBOBJECT_EXTENDED_LIMIT_INFORMATION {
+	var info JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	basic := &info.BasicLimitInformation
+	if limits.ProcessMemory != 0 {
+		basic.LimitFlags |= JOB_OBJECT_LIMIT_PROCESS_MEMORY
+		info.ProcessMemoryLimit = uintptr(limits.ProcessMemory)
+	}
+	if limits.JobMemory != 0 {
+		basic.LimitFlags |= JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(limits.JobMemory)
+	}
+	if limits.ActiveProcesses != 0 {
+		basic.LimitFlags |= JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		basic.ActiveProcessLimit = limits.ActiveProcesses
+	}
+	if limits.KillOnClose {
+		basic.LimitFlags |= JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	}
+	if limits.DieOnUnhandledException {
+		basic.LimitFlags |= JOB_OBJECT_LIMIT_DIE_ON_UNHANDLED_EXCEPTION
+	}
+	if limits.AllowBreakaway {
+		basic.LimitFlags |= JOB_OBJECT_LIMIT_BREAKAWAY_OK
+	}
+	return info
+}
+
+// jobCPURateControl converts the CPU rate in limits to the structure set with
+// JOB_OBJECT_INFO_CPU_RATE_CONTROL. A zero rate disables rate control.
+func jobCPURateControl(limits so.JobLimits) JOBOBJECT_CPU_RATE_CONTROL_INFORMATION {
+	if limits.CPURate == 0 {
+		return JOBOBJECT_CPU_RATE_CONTROL_INFORMATION{}
+	}
+	return JOBOBJECT_CPU_RATE_CONTROL_INFORMATION{
+		ControlFlags: JOB_OBJECT_CPU_RATE_CONTROL_ENABLE | JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP,
+		CpuRate:      limits.CPURateHundredths(),
+	}
+}
+
+// jobAccounting combines a job's accounting and peak memory usage.
+func jobAccounting(acct JOBOBJECT_BASIC_AND_IO_ACCOUNTING_INFORMATION, ext JOBOBJECT_EXTENDED_LIMIT_INFORMATION) so.JobAccounting {
+	return so.JobAccounting{
+		TotalUserTime:            time.Duration(acct.BasicInfo.TotalUserTime) * 100,
+		TotalKernelTime:          time.Duration(acct.BasicInfo.TotalKernelTime) * 100,
+		TotalPageFaults:          acct.BasicInfo.TotalPageFaultCount,
+		TotalProcesses:           acct.BasicInfo.TotalProcesses,
+		ActiveProcesses:          acct.BasicInfo.ActiveProcesses,
+		TotalTerminatedProcesses: acct.BasicInfo.TotalTerminatedProcesses,
+		ReadOperations:           acct.IoInfo.ReadOperationCount,
+		WriteOperations:          acct.IoInfo.WriteOperationCount,
+		OtherOperations:          acct.IoInfo.OtherOperationCount,
+		ReadBytes:                acct.IoInfo.ReadTransferCount,
+		WriteBytes:               acct.IoInfo.WriteTransferCount,
+		OtherBytes:               acct.IoInfo.OtherTransferCount,
+		PeakProcessMemory:        uint64(ext.PeakProcessMemoryUsed),
+		PeakJobMemory:            uint64(ext.PeakJobMemoryUsed),
+	}
+}
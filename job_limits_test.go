@@ -0,0 +1,125 @@
+package winapi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+func TestJobLimitsValidate(t *testing.T) {
+	valid := []so.JobLimits{
+		{},
+		{CPURate: 0.01},
+		{CPURate: 100, ActiveProcesses: 1, KillOnClose: true},
+		{ProcessMemory: 512 << 20, JobMemory: 1 << 30},
+		{ProcessMemory: 1 << 30},
+	}
+	for _, l := range valid {
+		if err := l.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v", l, err)
+		}
+	}
+
+	invalid := []so.JobLimits{
+		{CPURate: -1},
+		{CPURate: 100.5},
+		{CPURate: 0.001},
+		{CPURate: math.NaN()},
+		{ProcessMemory: 2 << 30, JobMemory: 1 << 30},
+	}
+	for _, l := range invalid {
+		if err := l.Validate(); !errors.Is(err, so.ErrInvalidJobLimits) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidJobLimits", l, err)
+		}
+	}
+}
+
+func TestJobExtendedLimits(t *testing.T) {
+	info := jobExtendedLimits(so.JobLimits{
+		ProcessMemory:   64 << 20,
+		JobMemory:       256 << 20,
+		ActiveProcesses: 4,
+		KillOnClose:     true,
+	})
+	wantFlags := uint32(JOB_OBJECT_LIMIT_PROCESS_MEMORY | JOB_OBJECT_LIMIT_JOB_MEMORY | JOB_OBJECT_LIMIT_ACTIVE_PROCESS | JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE)
+	if info.BasicLimitInformation.LimitFlags != wantFlags {
+		t.Errorf("LimitFlags = 0x%x, want 0x%x", info.BasicLimitInformation.LimitFlags, wantFlags)
+	}
+	if info.ProcessMemoryLimit != 64<<20 || info.JobMemoryLimit != 256<<20 || info.BasicLimitInformation.ActiveProcessLimit != 4 {
+		t.Errorf("limits = %+v", info)
+	}
+
+	if flags := jobExtendedLimits(so.JobLimits{}).BasicLimitInformation.LimitFlags; flags != 0 {
+		t.Errorf("no limits gave flags 0x%x", flags)
+	}
+	flags := jobExtendedLimits(so.JobLimits{DieOnUnhandledException: true, AllowBreakaway: true}).BasicLimitInformation.LimitFlags
+	if flags != JOB_OBJECT_LIMIT_DIE_ON_UNHANDLED_EXCEPTION|JOB_OBJECT_LIMIT_BREAKAWAY_OK {
+		t.Errorf("flags = 0x%x", flags)
+	}
+}
+
+func TestJobCPURateControl(t *testing.T) {
+	if rate := jobCPURateControl(so.JobLimits{CPURate: 12.5}); rate.CpuRate != 1250 || rate.ControlFlags != JOB_OBJECT_CPU_RATE_CONTROL_ENABLE|JOB_OBJECT_CPU_RATE_CONTROL_HARD_CAP {
+		t.Errorf("12.5%% = %+v", rate)
+	}
+	if rate := jobCPURateControl(so.JobLimits{CPURate: 0.29}); rate.CpuRate != 29 {
+		t.Errorf("0.29%% = %d hundredths", rate.CpuRate)
+	}
+	if rate := jobCPURateControl(so.JobLimits{}); rate != (JOBOBJECT_CPU_RATE_CONTROL_INFORMATION{}) {
+		t.Errorf("no rate = %+v, want disabled", rate)
+	}
+}
+
+func TestJobAccounting(t *testing.T) {
+	var acct JOBOBJECT_BASIC_AND_IO_ACCOUNTING_INFORMATION
+	acct.BasicInfo.TotalUserTime = 15000000 // 1.5s
+	acct.BasicInfo.TotalKernelTime = 5000000
+	acct.BasicInfo.TotalProcesses = 3
+	acct.BasicInfo.ActiveProcesses = 1
+	acct.BasicInfo.TotalTerminatedProcesses = 1
+	acct.IoInfo.ReadTransferCount = 4096
+	var ext JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	ext.PeakProcessMemoryUsed = 10 << 20
+	ext.PeakJobMemoryUsed = 30 << 20
+
+	got := jobAccounting(acct, ext)
+	want := so.JobAccounting{
+		TotalUserTime:            1500 * time.Millisecond,
+		TotalKernelTime:          500 * time.Millisecond,
+		TotalProcesses:           3,
+		ActiveProcesses:          1,
+		TotalTerminatedProcesses: 1,
+		ReadBytes:                4096,
+		PeakProcessMemory:        10 << 20,
+		PeakJobMemory:            30 << 20,
+	}
+	if got != want {
+		t.Errorf("jobAccounting = %+v, want %+v", got, want)
+	}
+	if got.CPUTime() != 2*time.Second {
+		t.Errorf("CPUTime = %s", got.CPUTime())
+	}
+}
+
+func TestJobStructSizes(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("sizes are for 64-bit Windows")
+	}
+	sizes := []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"JOBOBJECT_BASIC_LIMIT_INFORMATION", unsafe.Sizeof(JOBOBJECT_BASIC_LIMIT_INFORMATION{}), 64},
+		{"JOBOBJECT_EXTENDED_LIMIT_INFORMATION", unsafe.Sizeof(JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}), 144},
+		{"JOBOBJECT_BASIC_AND_IO_ACCOUNTING_INFORMATION", unsafe.Sizeof(JOBOBJECT_BASIC_AND_IO_ACCOUNTING_INFORMATION{}), 96},
+	}
+	for _, s := range sizes {
+		if s.got != s.want {
+			t.Errorf("sizeof(%s) = %d, want %d", s.name, s.got, s.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// keepAwakeState holds the execution state for every KeepAwake call.
+var keepAwakeState = newExecutionStateHolder(func(state uint32) error {
+	res, _, lastError := procSetThreadExecutionState.Call(uintptr(state))
+	if res == 0 {
+		return fmt.Errorf("SetThreadExecutionState failed: %s", lastError)
+	}
+	return nil
+})
+
+// KeepAwake stops the machine sleeping, or the display turning off, as
+// selected by opts, until ctx is done. It returns immediately.
+//
+// Calls may overlap: each thing kept awake is released once every call
+// asking for it has finished. The state is held on a dedicated OS thread, so
+// it doesn't depend on which thread the calling goroutine runs on. The
+// returned value is the execution state held by KeepAwake before the call, a
+// combination of the ES_* flags; requests by other threads and processes are
+// independent of it.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-setthreadexecutionstate
+func KeepAwake(ctx context.Context, opts KeepAwakeOptions) (uint32, error) {
+	return keepAwake(ctx, keepAwakeState, opts)
+}
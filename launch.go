@@ -0,0 +1,445 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	modWtsapi32             = syscall.NewLazyDLL("wtsapi32.dll")
+	wtsQueryUserToken       = modWtsapi32.NewProc("WTSQueryUserToken")
+	wtsGetActiveConsoleSess = modKernel32.NewProc("WTSGetActiveConsoleSessionId")
+	procDuplicateTokenEx    = modAdvapi32.NewProc("DuplicateTokenEx")
+	procSetTokenInformation = modAdvapi32.NewProc("SetTokenInformation")
+	procCreateProcessAsUser = modAdvapi32.NewProc("CreateProcessAsUserW")
+	procCreateEnvBlock      = modUserenv.NewProc("CreateEnvironmentBlock")
+	procDestroyEnvBlock     = modUserenv.NewProc("DestroyEnvironmentBlock")
+	procLoadUserProfile     = modUserenv.NewProc("LoadUserProfileW")
+	procUnloadUserProfile   = modUserenv.NewProc("UnloadUserProfile")
+)
+
+const (
+	PROC_TOKEN_ASSIGN_PRIMARY   = 0x0001
+	PROC_TOKEN_ADJUST_DEFAULT   = 0x0080
+	PROC_TOKEN_ADJUST_SESSIONID = 0x0100
+	PROC_MAXIMUM_ALLOWED        = 0x02000000
+
+	PROC_SECURITY_IDENTIFICATION = 1
+	PROC_TOKEN_PRIMARY           = 1
+
+	PROC_CREATE_UNICODE_ENVIRONMENT = 0x00000400
+	PROC_CREATE_NO_WINDOW           = 0x08000000
+
+	PROC_PI_NOUI = 0x00000001
+
+	// Returned by WTSGetActiveConsoleSessionId when no session is attached
+	// to the physical console.
+	WTS_NO_ACTIVE_SESSION = 0xFFFFFFFF
+
+	PROC_DEFAULT_DESKTOP = "winsta0\\default"
+)
+
+type PROFILEINFO struct {
+	Size        uint32
+	Flags       uint32
+	UserName    *uint16
+	ProfilePath *uint16
+	DefaultPath *uint16
+	ServerName  *uint16
+	PolicyPath  *uint16
+	Profile     uintptr
+}
+
+// SessionProcess is a process started by StartInSession.
+type SessionProcess struct {
+	Pid uint32
+
+	handle  uintptr
+	token   uintptr
+	profile uintptr
+
+	output         sync.WaitGroup
+	stdout, stderr bytes.Buffer
+
+	exited   bool
+	exitCode uint32
+}
+
+// ActiveConsoleSessionID returns the ID of the WTS session attached to the
+// physical console.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-wtsgetactiveconsolesessionid
+func ActiveConsoleSessionID() (uint32, error) {
+	ret, _, _ := wtsGetActiveConsoleSess.Call()
+	if uint32(ret) == WTS_NO_ACTIVE_SESSION {
+		return 0, fmt.Errorf("No session is attached to the console")
+	}
+	return uint32(ret), nil
+}
+
+// StartInSession starts cmdLine in the given WTS session, either as SYSTEM or,
+// with opts.AsUser, as the session's logged in user.
+//
+// The calling process must be running as SYSTEM (it needs SeTcbPrivilege), as
+// a service normally does. The returned SessionProcess must be waited for or
+// closed to release the token, profile and handles held for it.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/processthreadsapi/nf-processthreadsapi-createprocessasuserw
+func StartInSession(sessionID uint32, cmdLine string, opts SessionProcessOptions) (*SessionProcess, error) {
+	token, err := sessionToken(sessionID, opts)
+	if err != nil {
+		return nil, err
+	}
+	p := &SessionProcess{token: token}
+	started := false
+	defer func() {
+		if !started {
+			p.release()
+		}
+	}()
+
+	if opts.LoadProfile {
+		if p.profile, err = loadUserProfile(token); err != nil {
+			return nil, err
+		}
+	}
+
+	env := opts.Env
+	if !opts.NoDefaultEnv {
+		base, err := userEnvironment(token)
+		if err != nil {
+			return nil, err
+		}
+		env = mergeEnvironment(base, opts.Env)
+	}
+	block, err := environmentBlock(env)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdPtr, err := syscall.UTF16PtrFromString(cmdLine)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode command line: %s", err)
+	}
+	var dirPtr *uint16
+	if opts.WorkingDir != "" {
+		if dirPtr, err = syscall.UTF16PtrFromString(opts.WorkingDir); err != nil {
+			return nil, fmt.Errorf("Unable to encode working directory: %s", err)
+		}
+	}
+	desktop := opts.Desktop
+	if desktop == "" {
+		desktop = PROC_DEFAULT_DESKTOP
+	}
+	desktopPtr, err := syscall.UTF16PtrFromString(desktop)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode desktop name: %s", err)
+	}
+
+	si := syscall.StartupInfo{Desktop: desktopPtr}
+	si.Cb = uint32(unsafe.Sizeof(si))
+	flags := uint32(PROC_CREATE_UNICODE_ENVIRONMENT)
+	if opts.Hidden {
+		si.Flags |= syscall.STARTF_USESHOWWINDOW
+		si.ShowWindow = syscall.SW_HIDE
+		flags |= PROC_CREATE_NO_WINDOW
+	}
+
+	// Hold ForkLock while inheritable pipe handles exist, so they don't leak
+	// into processes started concurrently by os/exec.
+	syscall.ForkLock.Lock()
+	var readers []syscall.Handle
+	var writers []syscall.Handle
+	if opts.CaptureOutput {
+		for i := 0; i < 2; i++ {
+			r, w, err := createCapturePipe()
+			if err != nil {
+				syscall.ForkLock.Unlock()
+				closeHandles(readers)
+				closeHandles(writers)
+				return nil, err
+			}
+			readers, writers = append(readers, r), append(writers, w)
+		}
+		si.Flags |= syscall.STARTF_USESTDHANDLES
+		si.StdOutput, si.StdErr = writers[0], writers[1]
+	}
+
+	var pi syscall.ProcessInformation
+	ret, _, lastError := procCreateProcessAsUser.Call(
+		token,
+		uintptr(0),                        // application name
+		uintptr(unsafe.Pointer(cmdPtr)),   // command line
+		uintptr(0),                        // process attributes
+		uintptr(0),                        // thread attributes
+		boolToUintptr(opts.CaptureOutput), // inherit handles
+		uintptr(flags),
+		uintptr(unsafe.Pointer(&block[0])), // environment
+		uintptr(unsafe.Pointer(dirPtr)),    // current directory
+		uintptr(unsafe.Pointer(&si)),
+		uintptr(unsafe.Pointer(&pi)),
+	)
+	syscall.ForkLock.Unlock()
+	// The child has its own copies of the write ends now.
+	closeHandles(writers)
+	if ret == 0 {
+		closeHandles(readers)
+		return nil, fmt.Errorf("Unable to create process in session %d: %s", sessionID, lastError)
+	}
+	syscall.CloseHandle(pi.Thread)
+	started = true
+
+	p.Pid = pi.ProcessId
+	p.handle = uintptr(pi.Process)
+	for i, r := range readers {
+		buf := &p.stdout
+		if i == 1 {
+			buf = &p.stderr
+		}
+		p.output.Add(1)
+		go func(f *os.File, buf *bytes.Buffer) {
+			defer p.output.Done()
+			defer f.Close()
+			io.Copy(buf, f)
+		}(os.NewFile(uintptr(r), "pipe"), buf)
+	}
+
+	return p, nil
+}
+
+// RunInSession starts cmdLine with StartInSession and waits for it to exit,
+// returning its exit code and captured output. If ctx is done first, the
+// process is terminated.
+func RunInSession(ctx context.Context, sessionID uint32, cmdLine string, opts SessionProcessOptions) (uint32, []byte, []byte, error) {
+	p, err := StartInSession(sessionID, cmdLine, opts)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer p.Close()
+
+	code, err := p.Wait(ctx)
+	if err != nil {
+		procTerminateProcess.Call(p.handle, uintptr(1))
+		return 0, nil, nil, err
+	}
+	return code, p.Stdout(), p.Stderr(), nil
+}
+
+// Wait waits for the process to exit or ctx to be done, returning the exit
+// code. Once the process has exited, its captured output is complete and the
+// resources held for it are released.
+func (p *SessionProcess) Wait(ctx context.Context) (uint32, error) {
+	if p.exited {
+		return p.exitCode, nil
+	}
+	if p.handle == 0 {
+		return 0, fmt.Errorf("Process %d has been closed", p.Pid)
+	}
+
+	code, exited, err := waitProcessHandle(ctx, p.handle, -1)
+	if err != nil {
+		return 0, err
+	}
+	if !exited {
+		return 0, ctx.Err()
+	}
+	p.output.Wait()
+	p.exited, p.exitCode = true, code
+	p.release()
+	return code, nil
+}
+
+// Stdout returns the process's captured standard output, once Wait has
+// returned its exit code.
+func (p *SessionProcess) Stdout() []byte {
+	return p.stdout.Bytes()
+}
+
+// Stderr returns the process's captured standard error, once Wait has
+// returned its exit code.
+func (p *SessionProcess) Stderr() []byte {
+	return p.stderr.Bytes()
+}
+
+// Close releases the resources held for the process without waiting for it,
+// which keeps running. Its profile is unloaded if it was loaded for it.
+func (p *SessionProcess) Close() error {
+	p.release()
+	return nil
+}
+
+func (p *SessionProcess) release() {
+	if p.profile != 0 {
+		procUnloadUserProfile.Call(p.token, p.profile)
+		p.profile = 0
+	}
+	if p.token != 0 {
+		procCloseHandle.Call(p.token)
+		p.token = 0
+	}
+	if p.handle != 0 {
+		procCloseHandle.Call(p.handle)
+		p.handle = 0
+	}
+}
+
+// sessionToken returns a primary token for starting a process in the session.
+func sessionToken(sessionID uint32, opts SessionProcessOptions) (uintptr, error) {
+	if opts.AsUser {
+		var token uintptr
+		ret, _, lastError := wtsQueryUserToken.Call(uintptr(sessionID), uintptr(unsafe.Pointer(&token)))
+		if ret == 0 {
+			return 0, fmt.Errorf("Unable to get user token for session %d: %s", sessionID, lastError)
+		}
+		if opts.Elevated {
+			if et, err := getTokenUint32(token, TOKEN_INFO_ELEVATION_TYPE); err == nil && et == so.TOKEN_ELEVATION_TYPE_LIMITED {
+				var linked uintptr
+				var length uint32
+				ret, _, lastError := procGetTokenInformation.Call(
+					token,
+					uintptr(TOKEN_INFO_LINKED_TOKEN),
+					uintptr(unsafe.Pointer(&linked)),
+					uintptr(uint32(unsafe.Sizeof(linked))),
+					uintptr(unsafe.Pointer(&length)),
+				)
+				procCloseHandle.Call(token)
+				if ret != 1 {
+					return 0, fmt.Errorf("Unable to get elevated token for session %d: %s", sessionID, lastError)
+				}
+				token = linked
+			}
+		}
+		return token, nil
+	}
+
+	handle, _, _ := procGetCurrentProcess.Call()
+	var current uintptr
+	opRes, _, lastError := procOpenProcessToken.Call(
+		handle,
+		uintptr(uint32(PROC_TOKEN_DUPLICATE|PROC_TOKEN_QUERY|PROC_TOKEN_ASSIGN_PRIMARY|PROC_TOKEN_ADJUST_DEFAULT|PROC_TOKEN_ADJUST_SESSIONID)),
+		uintptr(unsafe.Pointer(&current)),
+	)
+	if opRes != 1 {
+		return 0, fmt.Errorf("Unable to open process token: %s", lastError)
+	}
+	defer procCloseHandle.Call(current)
+
+	var token uintptr
+	dupRes, _, lastError := procDuplicateTokenEx.Call(
+		current,
+		uintptr(PROC_MAXIMUM_ALLOWED),
+		uintptr(0), // token attributes
+		uintptr(PROC_SECURITY_IDENTIFICATION),
+		uintptr(PROC_TOKEN_PRIMARY),
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if dupRes != 1 {
+		return 0, fmt.Errorf("Unable to duplicate process token: %s", lastError)
+	}
+
+	setRes, _, lastError := procSetTokenInformation.Call(
+		token,
+		uintptr(TOKEN_INFO_SESSION_ID),
+		uintptr(unsafe.Pointer(&sessionID)),
+		uintptr(uint32(unsafe.Sizeof(sessionID))),
+	)
+	if setRes != 1 {
+		procCloseHandle.Call(token)
+		return 0, fmt.Errorf("Unable to move token to session %d: %s", sessionID, lastError)
+	}
+	return token, nil
+}
+
+// userEnvironment returns the default environment for the token's user.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/userenv/nf-userenv-createenvironmentblock
+func userEnvironment(token uintptr) ([]string, error) {
+	var block uintptr
+	ret, _, lastError := procCreateEnvBlock.Call(
+		uintptr(unsafe.Pointer(&block)),
+		token,
+		uintptr(0), // don't inherit our environment
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("Unable to create environment block: %s", lastError)
+	}
+	defer procDestroyEnvBlock.Call(block)
+
+	// Find the double NUL that ends the block.
+	chars := (*[1 << 24]uint16)(unsafe.Pointer(block))
+	end := 0
+	for ; end < len(chars)-1; end++ {
+		if chars[end] == 0 && chars[end+1] == 0 {
+			break
+		}
+	}
+	return parseEnvironmentBlock(append([]uint16(nil), chars[:end+2]...)), nil
+}
+
+// loadUserProfile loads the profile of the token's user, returning the handle
+// to its registry hive.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/userenv/nf-userenv-loaduserprofilew
+func loadUserProfile(token uintptr) (uintptr, error) {
+	buf, base, err := getTokenInformation(token, TOKEN_INFO_USER)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to get token user: %s", err)
+	}
+	user, err := decodeTokenUser(buf, base)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to decode token user: %s", err)
+	}
+	account, err := ResolveSid(user.SID)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to resolve token user %s: %s", user.SID, err)
+	}
+	namePtr, err := syscall.UTF16PtrFromString(account.Name)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to encode user name: %s", err)
+	}
+
+	info := PROFILEINFO{Flags: PROC_PI_NOUI, UserName: namePtr}
+	info.Size = uint32(unsafe.Sizeof(info))
+	ret, _, lastError := procLoadUserProfile.Call(token, uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, fmt.Errorf("Unable to load profile for %s: %s", account.FullName(), lastError)
+	}
+	return info.Profile, nil
+}
+
+// createCapturePipe returns a pipe whose write end can be inherited by a child
+// process, and whose read end can't.
+func createCapturePipe() (syscall.Handle, syscall.Handle, error) {
+	var r, w syscall.Handle
+	sa := syscall.SecurityAttributes{InheritHandle: 1}
+	sa.Length = uint32(unsafe.Sizeof(sa))
+	if err := syscall.CreatePipe(&r, &w, &sa, 0); err != nil {
+		return 0, 0, fmt.Errorf("Unable to create pipe: %s", err)
+	}
+	if err := syscall.SetHandleInformation(r, syscall.HANDLE_FLAG_INHERIT, 0); err != nil {
+		syscall.CloseHandle(r)
+		syscall.CloseHandle(w)
+		return 0, 0, fmt.Errorf("Unable to configure pipe: %s", err)
+	}
+	return r, w, nil
+}
+
+func closeHandles(handles []syscall.Handle) {
+	for _, h := range handles {
+		syscall.CloseHandle(h)
+	}
+}
+
+func boolToUintptr(b bool) uintptr {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package winapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// SessionProcessOptions controls how StartInSession launches a process.
+type SessionProcessOptions struct {
+	// AsUser runs the process with the session user's token, rather than a
+	// copy of the calling process's (SYSTEM) token moved into the session.
+	AsUser bool
+	// Elevated uses the user's full token when UAC has split their logon.
+	// It only applies with AsUser.
+	Elevated bool
+	// LoadProfile loads the token user's profile (HKCU) for the lifetime of
+	// the process.
+	LoadProfile bool
+
+	// Env holds KEY=VALUE entries, which are applied over the token user's
+	// default environment, unless NoDefaultEnv is set.
+	Env          []string
+	NoDefaultEnv bool
+
+	// WorkingDir defaults to the calling process's working directory.
+	WorkingDir string
+	// Desktop defaults to the interactive desktop, "winsta0\default".
+	Desktop string
+	// Hidden starts the process with its window hidden.
+	Hidden bool
+
+	// CaptureOutput collects the process's stdout and stderr, to be read
+	// after it exits.
+	CaptureOutput bool
+}
+
+// envName returns the name of a KEY=VALUE environment entry. Names may start
+// with "=", as the per-drive working directory entries like "=C:=C:\" do.
+func envName(kv string) (string, bool) {
+	if kv == "" {
+		return "", false
+	}
+	i := strings.IndexByte(kv[1:], '=')
+	if i < 0 {
+		return "", false
+	}
+	return kv[:i+1], true
+}
+
+// mergeEnvironment applies overrides to base, matching names case
+// insensitively as Windows does. An override replaces every entry of the same
+// name in base, and when an override is repeated the last one wins.
+func mergeEnvironment(base []string, overrides []string) []string {
+	idx := make(map[string]int)
+	retVal := make([]string, 0, len(base)+len(overrides))
+	for _, list := range [][]string{base, overrides} {
+		for _, kv := range list {
+			name, ok := envName(kv)
+			if !ok {
+				continue
+			}
+			key := strings.ToUpper(name)
+			if i, ok := idx[key]; ok {
+				retVal[i] = kv
+				continue
+			}
+			idx[key] = len(retVal)
+			retVal = append(retVal, kv)
+		}
+	}
+	return retVal
+}
+
+// environmentBlock encodes env as a Unicode environment block for
+// CreateProcess: NUL terminated KEY=VALUE strings, sorted case insensitively
+// by name, followed by a final NUL.
+// See: https://docs.microsoft.com/en-us/windows/win32/procthread/changing-environment-variables
+func environmentBlock(env []string) ([]uint16, error) {
+	sorted := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.IndexByte(kv, 0) >= 0 {
+			return nil, fmt.Errorf("Environment entry %q contains a NUL", kv)
+		}
+		name, ok := envName(kv)
+		if !ok || name == "" || name == "=" {
+			return nil, fmt.Errorf("Environment entry %q is not of the form KEY=VALUE", kv)
+		}
+		sorted = append(sorted, kv)
+	}
+	sorted = mergeEnvironment(nil, sorted)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ni, _ := envName(sorted[i])
+		nj, _ := envName(sorted[j])
+		return strings.ToUpper(ni) < strings.ToUpper(nj)
+	})
+
+	block := make([]uint16, 0)
+	for _, kv := range sorted {
+		block = append(block, utf16.Encode([]rune(kv))...)
+		block = append(block, 0)
+	}
+	// An empty block still needs both terminators.
+	if len(block) == 0 {
+		block = append(block, 0)
+	}
+	return append(block, 0), nil
+}
+
+// parseEnvironmentBlock decodes an environment block, such as the one
+// returned by CreateEnvironmentBlock, into KEY=VALUE entries.
+func parseEnvironmentBlock(block []uint16) []string {
+	retVal := make([]string, 0)
+	start := 0
+	for i, c := range block {
+		if c != 0 {
+			continue
+		}
+		if i == start {
+			break
+		}
+		retVal = append(retVal, string(utf16.Decode(block[start:i])))
+		start = i + 1
+	}
+	return retVal
+}
@@ -0,0 +1,74 @@
+package winapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func blockString(block []uint16) string {
+	return strings.Replace(string(utf16.Decode(block)), "\x00", "|", -1)
+}
+
+func TestEnvironmentBlock(t *testing.T) {
+	block, err := environmentBlock([]string{
+		"windir=C:\\Windows",
+		"Path=C:\\Windows\\system32",
+		"=C:=C:\\Users\\alice",
+		"APPDATA=C:\\Users\\alice\\AppData\\Roaming",
+		"zeta=ünïcödé",
+		"PATH=C:\\Tools", // replaces Path, case insensitively
+	})
+	if err != nil {
+		t.Fatalf("environmentBlock: %v", err)
+	}
+	want := "=C:=C:\\Users\\alice|APPDATA=C:\\Users\\alice\\AppData\\Roaming|PATH=C:\\Tools|windir=C:\\Windows|zeta=ünïcödé||"
+	if got := blockString(block); got != want {
+		t.Errorf("environmentBlock = %q, want %q", got, want)
+	}
+}
+
+func TestEnvironmentBlockEmpty(t *testing.T) {
+	block, err := environmentBlock(nil)
+	if err != nil {
+		t.Fatalf("environmentBlock: %v", err)
+	}
+	if !reflect.DeepEqual(block, []uint16{0, 0}) {
+		t.Errorf("empty environment block = %v", block)
+	}
+}
+
+func TestEnvironmentBlockInvalid(t *testing.T) {
+	for _, kv := range []string{"NOEQUALS", "=novalue", "=", "", "A=b\x00c=d"} {
+		if _, err := environmentBlock([]string{kv}); err == nil {
+			t.Errorf("environmentBlock(%q) should fail", kv)
+		}
+	}
+}
+
+func TestParseEnvironmentBlock(t *testing.T) {
+	env := []string{"=C:=C:\\", "A=1", "b=two words", "EMPTY="}
+	block, err := environmentBlock(env)
+	if err != nil {
+		t.Fatalf("environmentBlock: %v", err)
+	}
+	if got := parseEnvironmentBlock(block); !reflect.DeepEqual(got, env) {
+		t.Errorf("round trip = %q, want %q", got, env)
+	}
+
+	// Anything after the terminating empty string is ignored.
+	trailing := append(block, utf16.Encode([]rune("junk=1\x00"))...)
+	if got := parseEnvironmentBlock(trailing); !reflect.DeepEqual(got, env) {
+		t.Errorf("parse with trailing data = %q", got)
+	}
+}
+
+func TestMergeEnvironment(t *testing.T) {
+	base := []string{"USERNAME=alice", "Path=C:\\Windows", "TEMP=C:\\Temp", "junk"}
+	got := mergeEnvironment(base, []string{"PATH=C:\\Tools", "AGENT=1", "agent=2"})
+	want := []string{"USERNAME=alice", "PATH=C:\\Tools", "TEMP=C:\\Temp", "agent=2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEnvironment = %q, want %q", got, want)
+	}
+}
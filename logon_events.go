@@ -0,0 +1,224 @@
+package winapi
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+const (
+	securityAuditingProvider = "Microsoft-Windows-Security-Auditing"
+
+	// logonHistoryXPath selects the Security log events LogonEvents reads.
+	logonHistoryXPath = "*[System[(EventID=4624 or EventID=4625 or EventID=4634 or EventID=4647 or EventID=4800 or EventID=4801)]]"
+
+	// ElevatedToken values of a 4624 event, before they're rendered.
+	logonElevatedYes = "%%1842"
+)
+
+// logonFailureReasons describes the FailureReason of a 4625 event, which is
+// left as a message reference unless the event was rendered with its
+// message.
+var logonFailureReasons = map[string]string{
+	"%%2304": "An error occurred during logon.",
+	"%%2305": "The specified user account has expired.",
+	"%%2306": "The NetLogon component is not active.",
+	"%%2307": "Account locked out.",
+	"%%2308": "The user has not been granted the requested logon type at this machine.",
+	"%%2309": "The specified account's password has expired.",
+	"%%2310": "Account currently disabled.",
+	"%%2311": "Account logon time restriction violation.",
+	"%%2312": "User not allowed to logon at this computer.",
+	"%%2313": "Unknown user name or bad password.",
+}
+
+// logonStatusReasons describes the NTSTATUS codes of failed logons, which are
+// more specific than their FailureReason.
+// See: https://docs.microsoft.com/en-us/windows/security/threat-protection/auditing/event-4625
+var logonStatusReasons = map[uint32]string{
+	0xc000005e: "There are no logon servers available to service the logon request.",
+	0xc0000064: "The user name does not exist.",
+	0xc000006a: "The user name is correct but the password is wrong.",
+	0xc000006d: "Unknown user name or bad password.",
+	0xc000006f: "Account logon time restriction violation.",
+	0xc0000070: "User not allowed to logon at this computer.",
+	0xc0000071: "The specified account's password has expired.",
+	0xc0000072: "Account currently disabled.",
+	0xc0000133: "The clocks of the domain controller and this computer are too far out of sync.",
+	0xc000015b: "The user has not been granted the requested logon type at this machine.",
+	0xc000018c: "The trust relationship between the primary domain and the trusted domain failed.",
+	0xc0000192: "The NetLogon component is not active.",
+	0xc0000193: "The specified user account has expired.",
+	0xc0000224: "The user is required to change their password at next logon.",
+	0xc0000234: "Account locked out.",
+	0xc0000413: "The computer is protected by an authentication firewall.",
+}
+
+// LogonEvents picks the logon, failed logon, logoff, lock and unlock events
+// out of Security log events, such as those read from an exported log with
+// ReadEvtxFile. Other events are ignored.
+func LogonEvents(events []so.Event) []so.LogonEvent {
+	retVal := make([]so.LogonEvent, 0)
+	for _, ev := range events {
+		if le, ok := logonEventFromEvent(ev); ok {
+			retVal = append(retVal, le)
+		}
+	}
+	return retVal
+}
+
+// logonEventFromEvent reads the fields of a logon related Security event.
+func logonEventFromEvent(ev so.Event) (so.LogonEvent, bool) {
+	if ev.Provider != "" && ev.Provider != securityAuditingProvider {
+		return so.LogonEvent{}, false
+	}
+	switch ev.EventID {
+	case so.LOGON_EVENT_LOGON, so.LOGON_EVENT_FAILED, so.LOGON_EVENT_LOGOFF,
+		so.LOGON_EVENT_USER_LOGOFF, so.LOGON_EVENT_LOCK, so.LOGON_EVENT_UNLOCK:
+	default:
+		return so.LogonEvent{}, false
+	}
+
+	field := func(name string) string {
+		v := strings.TrimSpace(ev.Data[name])
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	le := so.LogonEvent{
+		Type:          ev.EventID,
+		Time:          ev.TimeCreated,
+		RecordID:      ev.RecordID,
+		Computer:      ev.Computer,
+		Username:      field("TargetUserName"),
+		Domain:        field("TargetDomainName"),
+		UserSID:       field("TargetUserSid"),
+		LogonID:       parseXMLUint(field("TargetLogonId"), 64),
+		LinkedLogonID: parseXMLUint(field("TargetLinkedLogonId"), 64),
+		LogonType:     uint32(parseXMLUint(field("LogonType"), 32)),
+		SessionID:     uint32(parseXMLUint(field("SessionId"), 32)),
+		Workstation:   field("WorkstationName"),
+		SourceIP:      field("IpAddress"),
+		SourcePort:    uint16(parseXMLUint(field("IpPort"), 16)),
+	}
+	if le.UserSID == "S-1-0-0" {
+		le.UserSID = ""
+	}
+	switch field("ElevatedToken") {
+	case logonElevatedYes, "Yes":
+		le.Elevated = true
+	}
+	if ev.EventID == so.LOGON_EVENT_FAILED {
+		le.Status = uint32(parseXMLUint(field("Status"), 32))
+		le.SubStatus = uint32(parseXMLUint(field("SubStatus"), 32))
+		le.FailureReason = logonFailureReason(field("FailureReason"), le.Status, le.SubStatus)
+	}
+	return le, true
+}
+
+// logonFailureReason describes why a logon failed, from its status codes
+// where they're known, falling back to the event's FailureReason.
+func logonFailureReason(reason string, status uint32, subStatus uint32) string {
+	if r, ok := logonStatusReasons[subStatus]; ok {
+		return r
+	}
+	if r, ok := logonStatusReasons[status]; ok {
+		return r
+	}
+	if r, ok := logonFailureReasons[reason]; ok {
+		return r
+	}
+	return reason
+}
+
+// PairLogonSessions pairs logons with their logoffs, returning a session for
+// each logon ordered by logon time. Events may be given in any order.
+//
+// A session ends with its first 4647 or 4634 event; the halves of a split
+// token logon each log a 4634, and the first of those ends the session. Locks
+// and unlocks add to its LockedTime. Logoffs of sessions whose logons
+// weren't included are ignored, and failed logons play no part.
+func PairLogonSessions(events []so.LogonEvent) []so.LogonSession {
+	sorted := make([]so.LogonEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].Time.Before(sorted[j].Time)
+		}
+		return sorted[i].RecordID < sorted[j].RecordID
+	})
+
+	// LUIDs are only unique to a computer, until it restarts. A LUID that
+	// logs on again without a logoff starts a new session, leaving the
+	// old one open-ended.
+	type logonKey struct {
+		computer string
+		logonID  uint64
+	}
+	var (
+		sessions = make([]so.LogonSession, 0)
+		open     = make(map[logonKey]int)
+		lockedAt = make(map[int]time.Time)
+	)
+	end := func(i int, t time.Time) {
+		s := &sessions[i]
+		s.LogoffTime = t
+		s.Duration = t.Sub(s.LogonTime)
+		if l, ok := lockedAt[i]; ok {
+			s.LockedTime += t.Sub(l)
+			delete(lockedAt, i)
+		}
+		for _, id := range []uint64{s.LogonID, s.LinkedLogonID} {
+			k := logonKey{strings.ToLower(s.Computer), id}
+			if j, ok := open[k]; ok && j == i {
+				delete(open, k)
+			}
+		}
+	}
+
+	for _, e := range sorted {
+		computer := strings.ToLower(e.Computer)
+		i, isOpen := open[logonKey{computer, e.LogonID}]
+		switch e.Type {
+		case so.LOGON_EVENT_LOGON:
+			if e.LinkedLogonID != 0 {
+				if j, ok := open[logonKey{computer, e.LinkedLogonID}]; ok && sessions[j].LinkedLogonID == e.LogonID {
+					sessions[j].Elevated = sessions[j].Elevated || e.Elevated
+					open[logonKey{computer, e.LogonID}] = j
+					continue
+				}
+			}
+			sessions = append(sessions, so.LogonSession{
+				Username:      e.Username,
+				Domain:        e.Domain,
+				UserSID:       e.UserSID,
+				Computer:      e.Computer,
+				LogonID:       e.LogonID,
+				LinkedLogonID: e.LinkedLogonID,
+				LogonType:     e.LogonType,
+				Elevated:      e.Elevated,
+				SourceIP:      e.SourceIP,
+				Workstation:   e.Workstation,
+				LogonTime:     e.Time,
+			})
+			open[logonKey{computer, e.LogonID}] = len(sessions) - 1
+		case so.LOGON_EVENT_LOGOFF, so.LOGON_EVENT_USER_LOGOFF:
+			if isOpen {
+				end(i, e.Time)
+			}
+		case so.LOGON_EVENT_LOCK:
+			if _, locked := lockedAt[i]; isOpen && !locked {
+				lockedAt[i] = e.Time
+			}
+		case so.LOGON_EVENT_UNLOCK:
+			if l, locked := lockedAt[i]; isOpen && locked {
+				sessions[i].LockedTime += e.Time.Sub(l)
+				delete(lockedAt, i)
+			}
+		}
+	}
+	return sessions
+}
@@ -0,0 +1,175 @@
+package winapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+func logonAt(hour, min, sec int) time.Time {
+	return time.Date(2020, 3, 2, hour, min, sec, 0, time.UTC)
+}
+
+func TestLogonEventsFromEvtx(t *testing.T) {
+	events, err := ReadEvtxFile(securityEvtx)
+	if err != nil {
+		t.Fatalf("ReadEvtxFile: %s", err)
+	}
+	logons := LogonEvents(events)
+	// Everything but the log being cleared.
+	if len(logons) != 11 {
+		t.Fatalf("got %d logon events, want 11", len(logons))
+	}
+
+	bob := logons[2]
+	want := so.LogonEvent{
+		Type:        so.LOGON_EVENT_LOGON,
+		Time:        logonAt(9, 15, 30),
+		RecordID:    3,
+		Computer:    "PC01.corp.example.com",
+		Username:    "bob",
+		Domain:      "PC01",
+		UserSID:     bob.UserSID,
+		LogonID:     0x2000a1,
+		LogonType:   so.SESS_REMOTE_INTERACTIVE_LOGON,
+		SourceIP:    "192.0.2.10",
+		SourcePort:  51234,
+		Workstation: "LAPTOP7",
+	}
+	if bob.UserSID == "" || !reflect.DeepEqual(bob, want) {
+		t.Errorf("bob's logon:\n got %+v\nwant %+v", bob, want)
+	}
+	if bob.GetLogonType() != "REMOTE_INTERACTIVE_LOGON" {
+		t.Errorf("GetLogonType = %s", bob.GetLogonType())
+	}
+
+	failed := logons[3]
+	if failed.Type != so.LOGON_EVENT_FAILED || failed.FullUser() != "CORP\\mallory" || failed.UserSID != "" ||
+		failed.LogonType != so.SESS_NETWORK_LOGON || failed.Workstation != "KALI" || failed.SourceIP != "198.51.100.7" ||
+		failed.Status != 0xc000006d || failed.SubStatus != 0xc000006a ||
+		failed.FailureReason != "The user name is correct but the password is wrong." {
+		t.Errorf("failed logon = %+v", failed)
+	}
+
+	alice := logons[0]
+	if !alice.Elevated || alice.LogonID != 0x1a2b3d || alice.LinkedLogonID != 0x1a2b3c || logons[1].Elevated {
+		t.Errorf("alice's split token logons = %+v, %+v", alice, logons[1])
+	}
+	if lock := logons[4]; lock.Type != so.LOGON_EVENT_LOCK || lock.SessionID != 1 || lock.LogonID != 0x1a2b3c || lock.SourceIP != "" {
+		t.Errorf("lock = %+v", lock)
+	}
+}
+
+func TestPairLogonSessionsFromEvtx(t *testing.T) {
+	events, err := ReadEvtxFile(securityEvtx)
+	if err != nil {
+		t.Fatalf("ReadEvtxFile: %s", err)
+	}
+	sessions := PairLogonSessions(LogonEvents(events))
+	if len(sessions) != 3 {
+		t.Fatalf("got %d sessions, want 3: %+v", len(sessions), sessions)
+	}
+
+	alice := sessions[0]
+	if alice.FullUser() != "CORP\\alice" || alice.LogonID != 0x1a2b3d || alice.LinkedLogonID != 0x1a2b3c ||
+		!alice.Elevated || alice.LogonType != so.SESS_INTERACTIVE_LOGON || alice.Open() {
+		t.Errorf("alice = %+v", alice)
+	}
+	// Ended by the 4647 logoff, before either half's 4634.
+	logon := logonAt(8, 0, 0).Add(123456 * time.Microsecond)
+	if !alice.LogoffTime.Equal(logonAt(17, 30, 0)) || alice.Duration != logonAt(17, 30, 0).Sub(logon) {
+		t.Errorf("alice logged off at %s after %s", alice.LogoffTime, alice.Duration)
+	}
+	if alice.LockedTime != 30*time.Minute {
+		t.Errorf("alice LockedTime = %s, want 30m", alice.LockedTime)
+	}
+
+	bob := sessions[1]
+	if bob.FullUser() != "PC01\\bob" || bob.SourceIP != "192.0.2.10" || bob.Workstation != "LAPTOP7" ||
+		bob.Duration != 2*time.Hour+29*time.Minute+40*time.Second || bob.LockedTime != 0 {
+		t.Errorf("bob = %+v", bob)
+	}
+
+	carol := sessions[2]
+	if carol.FullUser() != "CORP\\carol" || carol.LogonType != so.SESS_CACHED_INTERACTIVE_LOGON ||
+		!carol.Open() || carol.Duration != 0 {
+		t.Errorf("carol = %+v", carol)
+	}
+}
+
+func TestPairLogonSessions(t *testing.T) {
+	logon := func(id uint64, tm time.Time, computer string) so.LogonEvent {
+		return so.LogonEvent{Type: so.LOGON_EVENT_LOGON, Time: tm, Computer: computer, Username: "dave", LogonID: id, LogonType: so.SESS_NETWORK_LOGON}
+	}
+	event := func(typ uint16, id uint64, tm time.Time, computer string) so.LogonEvent {
+		return so.LogonEvent{Type: typ, Time: tm, Computer: computer, LogonID: id}
+	}
+	events := []so.LogonEvent{
+		// Given out of order.
+		event(so.LOGON_EVENT_LOGOFF, 0x10, logonAt(9, 0, 0), "PC01"),
+		logon(0x10, logonAt(8, 0, 0), "PC01"),
+		// The same LUID on another computer is another session.
+		logon(0x10, logonAt(8, 30, 0), "PC02"),
+		event(so.LOGON_EVENT_LOGOFF, 0x10, logonAt(8, 45, 0), "pc02"),
+		// A logoff of a session logged on before the events begin.
+		event(so.LOGON_EVENT_LOGOFF, 0x99, logonAt(8, 0, 0), "PC01"),
+		// Logged on again without a logoff, as after a power cut.
+		logon(0x20, logonAt(10, 0, 0), "PC01"),
+		logon(0x20, logonAt(11, 0, 0), "PC01"),
+		event(so.LOGON_EVENT_LOCK, 0x20, logonAt(11, 10, 0), "PC01"),
+		event(so.LOGON_EVENT_LOCK, 0x20, logonAt(11, 15, 0), "PC01"),
+		event(so.LOGON_EVENT_LOGOFF, 0x20, logonAt(11, 30, 0), "PC01"),
+		// Unlocks after the logoff change nothing.
+		event(so.LOGON_EVENT_UNLOCK, 0x20, logonAt(11, 40, 0), "PC01"),
+		{Type: so.LOGON_EVENT_FAILED, Time: logonAt(12, 0, 0), Computer: "PC01"},
+	}
+	sessions := PairLogonSessions(events)
+
+	type result struct {
+		computer string
+		logonID  uint64
+		logon    time.Time
+		duration time.Duration
+		locked   time.Duration
+	}
+	var got []result
+	for _, s := range sessions {
+		got = append(got, result{s.Computer, s.LogonID, s.LogonTime, s.Duration, s.LockedTime})
+	}
+	want := []result{
+		{"PC01", 0x10, logonAt(8, 0, 0), time.Hour, 0},
+		{"PC02", 0x10, logonAt(8, 30, 0), 15 * time.Minute, 0},
+		{"PC01", 0x20, logonAt(10, 0, 0), 0, 0},
+		{"PC01", 0x20, logonAt(11, 0, 0), 30 * time.Minute, 20 * time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PairLogonSessions =\n%+v\nwant\n%+v", got, want)
+	}
+	if !sessions[2].Open() {
+		t.Errorf("the session logged on again should be left open")
+	}
+	if events[0].Type != so.LOGON_EVENT_LOGOFF {
+		t.Errorf("the events given were reordered")
+	}
+}
+
+func TestLogonFailureReason(t *testing.T) {
+	tests := []struct {
+		reason            string
+		status, subStatus uint32
+		want              string
+	}{
+		{"%%2307", 0xc000006e, 0xc0000234, "Account locked out."},
+		{"%%2313", 0xc000006d, 0, "Unknown user name or bad password."},
+		{"%%2310", 0xc0000001, 0, "Account currently disabled."},
+		{"Account currently disabled.", 0xc0000001, 0xc0000002, "Account currently disabled."},
+		{"%%2399", 0xc0000001, 0, "%%2399"},
+	}
+	for _, tt := range tests {
+		if got := logonFailureReason(tt.reason, tt.status, tt.subStatus); got != tt.want {
+			t.Errorf("logonFailureReason(%q, %#x, %#x) = %q, want %q", tt.reason, tt.status, tt.subStatus, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// LogonHistory returns the logons, failed logons, logoffs, locks and unlocks
+// in the Security event log created at or after since, and before until if
+// it's set, oldest first. Reading the Security log requires administrator
+// rights or membership of Event Log Readers.
+//
+// Lock and unlock events are only logged if "Audit Other Logon/Logoff Events"
+// is enabled.
+func LogonHistory(since time.Time, until time.Time) ([]so.LogonEvent, error) {
+	events, err := QueryEvents(EventQueryOptions{
+		Channel: "Security",
+		XPath:   logonHistoryXPath,
+		Since:   since,
+		Until:   until,
+	})
+	if events == nil {
+		return nil, err
+	}
+	return LogonEvents(events), err
+}
+
+// LogonSessionHistory returns the sessions logged on between since and until,
+// paired with their logoffs by PairLogonSessions. Sessions that logged on
+// before since aren't included.
+func LogonSessionHistory(since time.Time, until time.Time) ([]so.LogonSession, error) {
+	events, err := LogonHistory(since, until)
+	if events == nil {
+		return nil, err
+	}
+	return PairLogonSessions(events), err
+}
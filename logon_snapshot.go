@@ -0,0 +1,291 @@
+package winapi
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// LUID is a locally unique identifier, as used for logon sessions. It's
+// comparable, so can be used directly as a map key.
+type LUID struct {
+	LowPart  uint32
+	HighPart int32
+}
+
+// Uint64 returns the LUID as a single 64-bit value.
+func (l LUID) Uint64() uint64 {
+	return uint64(uint32(l.HighPart))<<32 | uint64(l.LowPart)
+}
+
+// logonSession is the part of SECURITY_LOGON_SESSION_DATA used to correlate
+// processes with logged in users.
+type logonSession struct {
+	LogonID       LUID
+	UserName      string
+	Domain        string
+	DnsDomainName string
+	LogonType     uint32
+	LogonTime     time.Time
+	SessionID     uint32
+	HasSid        bool
+}
+
+// processLogon is the logon session a process's token belongs to.
+//
+// GroupsKnown is set if the token's groups could be read, in which case
+// IsAdmin and PrivilegedGroups were taken from them.
+type processLogon struct {
+	Pid              uint32
+	LogonID          LUID
+	IsAdmin          bool
+	GroupsKnown      bool
+	IsElevated       bool
+	ElevationType    uint32
+	PrivilegedGroups []string
+}
+
+// logonActivity summarises the processes running in a logon session.
+type logonActivity struct {
+	Processes int
+	// IsAdmin is set if any of the processes' tokens is a member of
+	// Administrators, and GroupsKnown if any of their groups could be read.
+	IsAdmin       bool
+	GroupsKnown   bool
+	IsElevated    bool
+	ElevationType uint32
+	// PrivilegedGroups is the union of the processes' privileged groups.
+	PrivilegedGroups []string
+}
+
+// add combines the activity of two sets of processes.
+func (a logonActivity) add(b logonActivity) logonActivity {
+	a.Processes += b.Processes
+	a.IsAdmin = a.IsAdmin || b.IsAdmin
+	a.GroupsKnown = a.GroupsKnown || b.GroupsKnown
+	a.IsElevated = a.IsElevated || b.IsElevated
+	if elevationRank(b.ElevationType) > elevationRank(a.ElevationType) {
+		a.ElevationType = b.ElevationType
+	}
+	if len(b.PrivilegedGroups) > 0 {
+		seen := make(map[string]bool, len(a.PrivilegedGroups)+len(b.PrivilegedGroups))
+		groups := make([]string, 0, len(a.PrivilegedGroups)+len(b.PrivilegedGroups))
+		for _, sid := range append(append([]string{}, a.PrivilegedGroups...), b.PrivilegedGroups...) {
+			if !seen[sid] {
+				seen[sid] = true
+				groups = append(groups, sid)
+			}
+		}
+		sort.Strings(groups)
+		a.PrivilegedGroups = groups
+	}
+	return a
+}
+
+// logonSnapshot is a point in time view of the logon sessions and the
+// processes running in them, indexed by LUID so each process or session is
+// matched with a single map lookup.
+type logonSnapshot struct {
+	sessions []logonSession
+	byLUID   map[LUID]int
+	activity map[LUID]logonActivity
+}
+
+func newLogonSnapshot(sessions []logonSession, procs []processLogon) *logonSnapshot {
+	s := &logonSnapshot{
+		sessions: sessions,
+		byLUID:   make(map[LUID]int, len(sessions)),
+		activity: make(map[LUID]logonActivity),
+	}
+	for i, sess := range sessions {
+		if _, ok := s.byLUID[sess.LogonID]; !ok {
+			s.byLUID[sess.LogonID] = i
+		}
+	}
+	for _, p := range procs {
+		s.activity[p.LogonID] = s.activity[p.LogonID].add(logonActivity{
+			Processes:        1,
+			IsAdmin:          p.IsAdmin,
+			GroupsKnown:      p.GroupsKnown,
+			IsElevated:       p.IsElevated,
+			ElevationType:    p.ElevationType,
+			PrivilegedGroups: p.PrivilegedGroups,
+		})
+	}
+	return s
+}
+
+// userName returns the "DOMAIN\user" owning the logon session, if it has a
+// SID.
+func (s *logonSnapshot) userName(luid LUID) (string, bool) {
+	i, ok := s.byLUID[luid]
+	if !ok || !s.sessions[i].HasSid {
+		return "", false
+	}
+	return logonUserKey(s.sessions[i].Domain, s.sessions[i].UserName), true
+}
+
+// userNames returns the owner of every logon session with a SID, keyed by
+// LUID.
+func (s *logonSnapshot) userNames() map[LUID]string {
+	retVal := make(map[LUID]string, len(s.sessions))
+	for _, sess := range s.sessions {
+		if sess.HasSid {
+			retVal[sess.LogonID] = logonUserKey(sess.Domain, sess.UserName)
+		}
+	}
+	return retVal
+}
+
+func logonUserKey(domain, user string) string {
+	return strings.ToUpper(domain) + "\\" + strings.ToLower(user)
+}
+
+// loggedInUsers returns a SessionDetails for each user with an interactive
+// logon session that has running processes, once per user, in session order.
+// Administrator status comes from the processes' token groups; isAdmin is
+// only consulted for users none of whose tokens could be read, and may be nil.
+func (s *logonSnapshot) loggedInUsers(hostname string, isAdmin func(so.SessionDetails) bool) []so.SessionDetails {
+	var (
+		order     = make([]string, 0)
+		first     = make(map[string]logonSession)
+		activity  = make(map[string]logonActivity)
+		uSessList = make([]so.SessionDetails, 0)
+		localHost = strings.ToUpper(hostname)
+	)
+	// A user's activity is combined across their logon sessions, as UAC
+	// gives an administrator a second, linked session for the elevated
+	// half of their split token.
+	for _, sess := range s.sessions {
+		if !sess.HasSid {
+			continue
+		}
+		switch sess.LogonType {
+		case so.SESS_INTERACTIVE_LOGON, so.SESS_CACHED_INTERACTIVE_LOGON, so.SESS_REMOTE_INTERACTIVE_LOGON:
+		default:
+			continue
+		}
+		domain := strings.ToUpper(sess.Domain)
+		if domain == "WINDOW MANAGER" || domain == "FONT DRIVER HOST" {
+			continue
+		}
+		a, ok := s.activity[sess.LogonID]
+		if !ok {
+			continue
+		}
+		key := logonUserKey(sess.Domain, sess.UserName)
+		if _, ok := first[key]; !ok {
+			first[key] = sess
+			order = append(order, key)
+		}
+		activity[key] = activity[key].add(a)
+	}
+
+	for _, key := range order {
+		sess, a := first[key], activity[key]
+		domain := strings.ToUpper(sess.Domain)
+		ud := so.SessionDetails{
+			Username:      strings.ToLower(sess.UserName),
+			Domain:        domain,
+			LocalAdmin:    a.IsAdmin,
+			LocalUser:     domain == localHost,
+			LogonType:     sess.LogonType,
+			DnsDomainName: sess.DnsDomainName,
+			LogonTime:     sess.LogonTime,
+			SessionID:     sess.SessionID,
+
+			Elevated:         a.IsElevated,
+			ElevationType:    a.ElevationType,
+			PrivilegedGroups: a.PrivilegedGroups,
+		}
+		if !ud.LocalAdmin && !a.GroupsKnown && isAdmin != nil {
+			ud.LocalAdmin = isAdmin(ud)
+		}
+		uSessList = append(uSessList, ud)
+	}
+	return uSessList
+}
+
+// DefaultUserAdminCacheTTL is how long administrator checks made by
+// ListLoggedInUsers are remembered.
+const DefaultUserAdminCacheTTL = 5 * time.Minute
+
+// userAdminCache remembers whether users are administrators, along with the
+// domain controller found for each domain, so repeated calls don't go back to
+// the network for every session. Failures are cached too, so an unreachable
+// domain only costs one lookup per TTL.
+type userAdminCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	// lookupDC finds a domain controller for a domain.
+	lookupDC func(domain string) (string, error)
+	// checkUser reports whether user is an administrator according to
+	// server, which is empty for the local machine.
+	checkUser func(server, user string) (bool, error)
+
+	mu    sync.Mutex
+	dcs   map[string]cachedDC
+	users map[string]cachedAdmin
+}
+
+type cachedDC struct {
+	server  string
+	err     error
+	expires time.Time
+}
+
+type cachedAdmin struct {
+	admin   bool
+	expires time.Time
+}
+
+func newUserAdminCache(ttl time.Duration, lookupDC func(string) (string, error), checkUser func(string, string) (bool, error)) *userAdminCache {
+	return &userAdminCache{
+		ttl:       ttl,
+		now:       time.Now,
+		lookupDC:  lookupDC,
+		checkUser: checkUser,
+		dcs:       make(map[string]cachedDC),
+		users:     make(map[string]cachedAdmin),
+	}
+}
+
+// isAdmin reports whether the user in ud is an administrator, locally for
+// local users and otherwise according to a controller for its DNS domain.
+func (c *userAdminCache) isAdmin(ud so.SessionDetails) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+
+	domain := ""
+	if !ud.LocalUser {
+		domain = strings.ToUpper(ud.DnsDomainName)
+	}
+	key := domain + "\\" + strings.ToLower(ud.Username)
+	if e, ok := c.users[key]; ok && now.Before(e.expires) {
+		return e.admin
+	}
+
+	server := ""
+	if !ud.LocalUser {
+		dc, ok := c.dcs[domain]
+		if !ok || !now.Before(dc.expires) {
+			dc.server, dc.err = c.lookupDC(ud.DnsDomainName)
+			dc.expires = now.Add(c.ttl)
+			c.dcs[domain] = dc
+		}
+		if dc.err != nil {
+			c.users[key] = cachedAdmin{expires: now.Add(c.ttl)}
+			return false
+		}
+		server = dc.server
+	}
+
+	admin, err := c.checkUser(server, ud.Username)
+	c.users[key] = cachedAdmin{admin: admin && err == nil, expires: now.Add(c.ttl)}
+	return admin && err == nil
+}
@@ -0,0 +1,195 @@
+package winapi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+func TestLUIDUint64(t *testing.T) {
+	if got := (LUID{LowPart: 0x3e7, HighPart: 1}).Uint64(); got != 0x1000003e7 {
+		t.Errorf("Uint64 = 0x%x", got)
+	}
+	if got := (LUID{LowPart: 1, HighPart: -1}).Uint64(); got != 0xffffffff00000001 {
+		t.Errorf("Uint64 with negative HighPart = 0x%x", got)
+	}
+}
+
+func TestLogonSnapshotLoggedInUsers(t *testing.T) {
+	logonTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	sessions := []logonSession{
+		{LogonID: LUID{LowPart: 0x3e7}, UserName: "PC01$", Domain: "CORP", LogonType: 5, HasSid: true}, // service,
+		{LogonID: LUID{LowPart: 0x100}, UserName: "UMFD-1", Domain: "Font Driver Host", LogonType: so.SESS_INTERACTIVE_LOGON, HasSid: true},
+		{LogonID: LUID{LowPart: 0x200}, UserName: "Alice", Domain: "corp", DnsDomainName: "corp.example.com", LogonType: so.SESS_INTERACTIVE_LOGON, LogonTime: logonTime, SessionID: 1, HasSid: true},
+		{LogonID: LUID{LowPart: 0x201}, UserName: "alice", Domain: "CORP", LogonType: so.SESS_INTERACTIVE_LOGON, HasSid: true}, // elevated half of a split token
+		{LogonID: LUID{LowPart: 0x300}, UserName: "bob", Domain: "pc01", LogonType: so.SESS_REMOTE_INTERACTIVE_LOGON, SessionID: 2, HasSid: true},
+		{LogonID: LUID{LowPart: 0x400}, UserName: "carol", Domain: "CORP", LogonType: so.SESS_CACHED_INTERACTIVE_LOGON, HasSid: true}, // no processes
+		{LogonID: LUID{LowPart: 0x500}, UserName: "dave", Domain: "CORP", LogonType: so.SESS_INTERACTIVE_LOGON},                       // no SID
+		{LogonID: LUID{LowPart: 0x600}, UserName: "erin", Domain: "PC01", LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 3, HasSid: true},
+	}
+	procs := []processLogon{
+		{Pid: 4, LogonID: LUID{LowPart: 0x3e7}, IsAdmin: true},
+		{Pid: 10, LogonID: LUID{LowPart: 0x100}},
+		{Pid: 20, LogonID: LUID{LowPart: 0x200}},
+		{Pid: 21, LogonID: LUID{LowPart: 0x201}, IsAdmin: true},
+		{Pid: 30, LogonID: LUID{LowPart: 0x300}},
+		{Pid: 31, LogonID: LUID{LowPart: 0x300}, IsAdmin: true},
+		{Pid: 50, LogonID: LUID{LowPart: 0x500}},
+		{Pid: 60, LogonID: LUID{LowPart: 0x600}},
+	}
+
+	var checked []string
+	got := newLogonSnapshot(sessions, procs).loggedInUsers("PC01", func(ud so.SessionDetails) bool {
+		checked = append(checked, ud.FullUser())
+		return false
+	})
+	want := []so.SessionDetails{
+		{Username: "alice", Domain: "CORP", LocalAdmin: true, DnsDomainName: "corp.example.com", LogonType: so.SESS_INTERACTIVE_LOGON, LogonTime: logonTime, SessionID: 1},
+		{Username: "bob", Domain: "PC01", LocalUser: true, LocalAdmin: true, LogonType: so.SESS_REMOTE_INTERACTIVE_LOGON, SessionID: 2},
+		{Username: "erin", Domain: "PC01", LocalUser: true, LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loggedInUsers = %+v, want %+v", got, want)
+	}
+	// alice's linked session and bob's process already make them admins, so
+	// only erin is checked.
+	if want := []string{"PC01\\erin"}; !reflect.DeepEqual(checked, want) {
+		t.Errorf("admin checks = %q, want %q", checked, want)
+	}
+}
+
+func TestLogonSnapshotUserNames(t *testing.T) {
+	s := newLogonSnapshot([]logonSession{
+		{LogonID: LUID{LowPart: 1}, UserName: "Alice", Domain: "corp", HasSid: true},
+		{LogonID: LUID{LowPart: 2}, UserName: "ANONYMOUS LOGON", Domain: "NT AUTHORITY"},
+	}, nil)
+	if u, ok := s.userName(LUID{LowPart: 1}); !ok || u != "CORP\\alice" {
+		t.Errorf("userName = %q, %v", u, ok)
+	}
+	if _, ok := s.userName(LUID{LowPart: 2}); ok {
+		t.Errorf("session without a SID should have no user")
+	}
+	if want := map[LUID]string{{LowPart: 1}: "CORP\\alice"}; !reflect.DeepEqual(s.userNames(), want) {
+		t.Errorf("userNames = %v", s.userNames())
+	}
+}
+
+func TestUserAdminCache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var dcLookups, userChecks []string
+	c := newUserAdminCache(time.Minute, func(domain string) (string, error) {
+		dcLookups = append(dcLookups, domain)
+		if domain == "offline.example.com" {
+			return "", fmt.Errorf("no DC")
+		}
+		return "\\\\DC01", nil
+	}, func(server, user string) (bool, error) {
+		userChecks = append(userChecks, server+"|"+user)
+		return user == "admin", nil
+	})
+	c.now = func() time.Time { return now }
+
+	domainUser := func(user, dns string) so.SessionDetails {
+		return so.SessionDetails{Username: user, Domain: "CORP", DnsDomainName: dns}
+	}
+	if !c.isAdmin(domainUser("admin", "corp.example.com")) {
+		t.Errorf("admin should be an administrator")
+	}
+	if c.isAdmin(domainUser("alice", "CORP.example.com")) || c.isAdmin(domainUser("alice", "corp.example.com")) {
+		t.Errorf("alice shouldn't be an administrator")
+	}
+	if c.isAdmin(domainUser("admin", "offline.example.com")) || c.isAdmin(domainUser("bob", "offline.example.com")) {
+		t.Errorf("users of an unreachable domain shouldn't be administrators")
+	}
+	if !c.isAdmin(so.SessionDetails{Username: "admin", Domain: "PC01", LocalUser: true}) {
+		t.Errorf("local admin should be an administrator")
+	}
+
+	if want := []string{"corp.example.com", "offline.example.com"}; !reflect.DeepEqual(dcLookups, want) {
+		t.Errorf("DC lookups = %q, want %q", dcLookups, want)
+	}
+	if want := []string{"\\\\DC01|admin", "\\\\DC01|alice", "|admin"}; !reflect.DeepEqual(userChecks, want) {
+		t.Errorf("user checks = %q, want %q", userChecks, want)
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.isAdmin(domainUser("alice", "corp.example.com"))
+	if len(dcLookups) != 3 || len(userChecks) != 4 {
+		t.Errorf("expired entries should be checked again: %q, %q", dcLookups, userChecks)
+	}
+}
+
+// syntheticLogons builds a machine with the given number of interactive
+// sessions, each running procsPerSession processes.
+func syntheticLogons(sessionCount, procsPerSession int) ([]logonSession, []processLogon) {
+	sessions := make([]logonSession, 0, sessionCount)
+	procs := make([]processLogon, 0, sessionCount*procsPerSession)
+	for i := 0; i < sessionCount; i++ {
+		luid := LUID{LowPart: uint32(0x10000 + i), HighPart: int32(i % 3)}
+		sessions = append(sessions, logonSession{
+			LogonID:   luid,
+			UserName:  fmt.Sprintf("user%d", i),
+			Domain:    "CORP",
+			LogonType: so.SESS_REMOTE_INTERACTIVE_LOGON,
+			HasSid:    true,
+		})
+		for j := 0; j < procsPerSession; j++ {
+			procs = append(procs, processLogon{Pid: uint32(4 * len(procs)), LogonID: luid, IsAdmin: j == 0 && i%2 == 0})
+		}
+	}
+	return sessions, procs
+}
+
+// linearLogonLookup is the per-session scan of every process that
+// logonSnapshot replaces, kept to compare against.
+func linearLogonLookup(needle LUID, procs []processLogon) (bool, bool) {
+	for _, p := range procs {
+		if reflect.DeepEqual(p.LogonID, needle) {
+			return true, p.IsAdmin
+		}
+	}
+	return false, false
+}
+
+func BenchmarkLogonSnapshot(b *testing.B) {
+	sessions, procs := syntheticLogons(200, 25)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := newLogonSnapshot(sessions, procs)
+		if n := len(s.loggedInUsers("PC01", nil)); n != len(sessions) {
+			b.Fatalf("got %d users", n)
+		}
+	}
+}
+
+func BenchmarkLogonLinearScan(b *testing.B) {
+	sessions, procs := syntheticLogons(200, 25)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		for _, sess := range sessions {
+			if ok, _ := linearLogonLookup(sess.LogonID, procs); ok {
+				n++
+			}
+		}
+		if n != len(sessions) {
+			b.Fatalf("got %d users", n)
+		}
+	}
+}
+
+func BenchmarkProcessUserLookup(b *testing.B) {
+	sessions, procs := syntheticLogons(200, 25)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		users := newLogonSnapshot(sessions, nil).userNames()
+		for _, p := range procs {
+			if users[p.LogonID] == "" {
+				b.Fatalf("no user for PID %d", p.Pid)
+			}
+		}
+	}
+}
@@ -5,8 +5,8 @@ package winapi
 
 import (
 	"fmt"
-	"reflect"
 	"syscall"
+	"time"
 	"unsafe"
 
 	so "github.com/iamacarpet/go-win64api/shared"
@@ -26,16 +26,12 @@ var (
 	procGetLastError              = modKernel32.NewProc("GetLastError")
 	procSetThreadExecutionState   = modKernel32.NewProc("SetThreadExecutionState")
 
-	modAdvapi32                  = syscall.NewLazyDLL("advapi32.dll")
-	procOpenProcessToken         = modAdvapi32.NewProc("OpenProcessToken")
-	procLookupPrivilegeValue     = modAdvapi32.NewProc("LookupPrivilegeValueW")
-	procAdjustTokenPrivileges    = modAdvapi32.NewProc("AdjustTokenPrivileges")
-	procGetTokenInformation      = modAdvapi32.NewProc("GetTokenInformation")
-	procLookupAccountSid         = modAdvapi32.NewProc("LookupAccountSidW")
-	procCheckTokenMembership     = modAdvapi32.NewProc("CheckTokenMembership")
-	procAllocateAndInitializeSid = modAdvapi32.NewProc("AllocateAndInitializeSid")
-	procFreeSid                  = modAdvapi32.NewProc("FreeSid")
-	procDuplicateToken           = modAdvapi32.NewProc("DuplicateToken")
+	modAdvapi32               = syscall.NewLazyDLL("advapi32.dll")
+	procOpenProcessToken      = modAdvapi32.NewProc("OpenProcessToken")
+	procLookupPrivilegeValue  = modAdvapi32.NewProc("LookupPrivilegeValueW")
+	procAdjustTokenPrivileges = modAdvapi32.NewProc("AdjustTokenPrivileges")
+	procGetTokenInformation   = modAdvapi32.NewProc("GetTokenInformation")
+	procLookupAccountSid      = modAdvapi32.NewProc("LookupAccountSidW")
 )
 
 // Some constants from the Windows API
@@ -47,12 +43,6 @@ const (
 	MAX_PATH                          = 260
 	MAX_FULL_PATH                     = 4096
 
-	ES_AWAYMODE_REQUIRED = 0x00000040
-	ES_CONTINUOUS        = 0x80000000
-	ES_DISPLAY_REQUIRED  = 0x00000002
-	ES_SYSTEM_REQUIRED   = 0x00000001
-	ES_USER_PRESENT      = 0x00000004
-
 	PROC_TOKEN_DUPLICATE         = 0x0002
 	PROC_TOKEN_QUERY             = 0x0008
 	PROC_TOKEN_ADJUST_PRIVILEGES = 0x0020
@@ -165,7 +155,58 @@ func ProcessKill(pid uint32) (bool, error) {
 	return true, nil
 }
 
+// ProcessKillTree terminates the process with the given PID and all of its
+// descendants, children before parents, returning the result for each.
+//
+// Processes are matched by creation time as well as PID before being
+// terminated, so a PID reused since the process list was taken isn't killed.
+func ProcessKillTree(pid uint32) ([]so.ProcessKillResult, error) {
+	procs, err := ProcessListFields(so.PROC_FIELD_TIMES)
+	if err != nil {
+		return nil, err
+	}
+
+	return killTree(NewProcessTree(procs), int(pid), func(p so.Process) error {
+		return processKillIfCreated(uint32(p.Pid), p.CreationTime)
+	})
+}
+
+func processKillIfCreated(pid uint32, created time.Time) error {
+	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_TERMINATE|PROCESS_QUERY_LIMITED_INFORMATION)), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return fmt.Errorf("Failed to open handle: %s", lastError)
+	}
+	defer procCloseHandle.Call(handle)
+
+	if !created.IsZero() {
+		var creation, exit, kernel, user syscall.Filetime
+		ret, _, lastError := procGetProcessTimes.Call(
+			handle,
+			uintptr(unsafe.Pointer(&creation)),
+			uintptr(unsafe.Pointer(&exit)),
+			uintptr(unsafe.Pointer(&kernel)),
+			uintptr(unsafe.Pointer(&user)),
+		)
+		if ret == 0 {
+			return fmt.Errorf("Failed to get process times: %s", lastError)
+		}
+		if c, _, _ := processTimes(filetimeUint64(creation), 0, 0); !c.Equal(created) {
+			return fmt.Errorf("Process %d has exited and its PID was reused", pid)
+		}
+	}
+
+	res, _, lastError := procTerminateProcess.Call(handle, uintptr(uint32(0)))
+	if res != 1 {
+		return fmt.Errorf("Failed to terminate process: %s", lastError)
+	}
+	return nil
+}
+
 func ProcessList() ([]so.Process, error) {
+	return processList(0)
+}
+
+func processList(fields uint32) ([]so.Process, error) {
 	err := procAssignCorrectPrivs(PROC_SE_DEBUG_NAME)
 	if err != nil {
 		return nil, fmt.Errorf("Error assigning privs... %s", err.Error())
@@ -193,15 +234,11 @@ func ProcessList() ([]so.Process, error) {
 	for {
 		path, ll, _ := getProcessFullPathAndLUID(entry.ProcessID)
 
-		var user string
-		for k, l := range lList {
-			if reflect.DeepEqual(k, ll) {
-				user = l
-				break
-			}
+		p := newProcessData(&entry, path, lList[ll])
+		if fields != 0 {
+			collectProcessFields(&p, &entry, fields)
 		}
-
-		results = append(results, newProcessData(&entry, path, user))
+		results = append(results, p)
 
 		ret, _, _ := procProcess32Next.Call(handle, uintptr(unsafe.Pointer(&entry)))
 		if ret == 0 {
@@ -218,37 +255,16 @@ type SessionLUID struct {
 }
 
 func ProcessLUIDList() (map[uint32]SessionLUID, error) {
-	err := procAssignCorrectPrivs(PROC_SE_DEBUG_NAME)
+	logons, err := processLogons()
 	if err != nil {
-		return nil, fmt.Errorf("Error assigning privs... %s", err.Error())
-	}
-
-	handle, _, _ := procCreateToolhelp32Snapshot.Call(0x00000002, 0)
-	if handle < 0 {
-		return nil, syscall.GetLastError()
-	}
-	defer procCloseHandle.Call(handle)
-
-	pMap := make(map[uint32]SessionLUID)
-
-	var entry PROCESSENTRY32
-	entry.Size = uint32(unsafe.Sizeof(entry))
-	ret, _, _ := procProcess32First.Call(handle, uintptr(unsafe.Pointer(&entry)))
-	if ret == 0 {
-		return nil, fmt.Errorf("Error retrieving process info.")
+		return nil, err
 	}
 
-	for {
-		ll, isAdmin, _ := getProcessLUID(entry.ProcessID)
-
-		pMap[entry.ProcessID] = SessionLUID{
-			Value:   ll,
-			IsAdmin: isAdmin,
-		}
-
-		ret, _, _ := procProcess32Next.Call(handle, uintptr(unsafe.Pointer(&entry)))
-		if ret == 0 {
-			break
+	pMap := make(map[uint32]SessionLUID, len(logons))
+	for _, l := range logons {
+		pMap[l.Pid] = SessionLUID{
+			Value:   l.LogonID,
+			IsAdmin: l.IsAdmin,
 		}
 	}
 
@@ -308,150 +324,6 @@ func procAssignCorrectPrivs(name string) error {
 	return nil
 }
 
-func getProcessLUID(pid uint32) (retLUID LUID, isAdmin bool, retError error) {
-	retLUID = LUID{}
-
-	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_QUERY_INFORMATION)), uintptr(0), uintptr(pid))
-	if handle < 0 {
-		retError = lastError
-		return
-	}
-	defer procCloseHandle.Call(handle)
-
-	var ptHandle uintptr
-	opRes, _, _ := procOpenProcessToken.Call(
-		uintptr(handle),
-		uintptr(uint32(PROC_TOKEN_QUERY)),
-		uintptr(unsafe.Pointer(&ptHandle)),
-	)
-	if opRes != 1 {
-		retError = fmt.Errorf("Unable to open process token.")
-		return
-	}
-	defer procCloseHandle.Call(ptHandle)
-
-	var sData TOKEN_STATISTICS
-	var sLength uint32
-	tsRes, _, _ := procGetTokenInformation.Call(
-		uintptr(ptHandle),
-		uintptr(uint32(10)), // TOKEN_STATISTICS
-		uintptr(unsafe.Pointer(&sData)),
-		uintptr(uint32(unsafe.Sizeof(sData))),
-		uintptr(unsafe.Pointer(&sLength)),
-	)
-	if tsRes != 1 {
-		retError = fmt.Errorf("Error fetching token information (LUID).")
-		return
-	}
-	retLUID = sData.AuthenticationId
-
-	// Grab the token again for the next bit,
-	// as if we try and combine this with the first bit,
-	// the token grab will fail unless run as NT AUTHORITY\SYSTEM
-	var tHandle uintptr
-	opRes2, _, _ := procOpenProcessToken.Call(
-		uintptr(handle),
-		uintptr(uint32(PROC_TOKEN_QUERY|PROC_TOKEN_DUPLICATE)),
-		uintptr(unsafe.Pointer(&tHandle)),
-	)
-	if opRes2 != 1 {
-		retError = fmt.Errorf("Unable to open process token.")
-		return
-	}
-	defer procCloseHandle.Call(tHandle)
-
-	// Generate an SID for the Administrators group.
-	NtAuthority := SID_IDENTIFIER_AUTHORITY{
-		Value: [6]byte{0, 0, 0, 0, 0, 5}, // SECURITY_NT_AUTHORITY
-	}
-	var AdministratorsGroup PSID
-	sidRes, _, _ := procAllocateAndInitializeSid.Call(
-		uintptr(unsafe.Pointer(&NtAuthority)),
-		uintptr(uint8(2)),
-		uintptr(uint32(PROC_SECURITY_BUILTIN_DOMAIN_RID)),
-		uintptr(uint32(PROC_DOMAIN_ALIAS_RID_ADMINS)),
-		uintptr(0), uintptr(0), uintptr(0), uintptr(0), uintptr(0), uintptr(0),
-		uintptr(unsafe.Pointer(&AdministratorsGroup)),
-	)
-	if sidRes != 1 {
-		retError = fmt.Errorf("Error generating Administrators SID for group membership check")
-		return
-	}
-	defer procFreeSid.Call(uintptr(AdministratorsGroup))
-
-	// Duplicate the token...
-	var ttHandle uintptr
-	dupRes, _, lastError := procDuplicateToken.Call(
-		uintptr(tHandle),
-		uintptr(1), // _SECURITY_IMPERSONATION_LEVEL = SecurityIdentification
-		uintptr(unsafe.Pointer(&ttHandle)),
-	)
-	defer procCloseHandle.Call(ttHandle)
-	if dupRes != 1 {
-		retError = fmt.Errorf("Error generating impersonation token: %s", lastError)
-		return
-	}
-
-	// Check token for membership of the Administrators group.
-	var chkRes bool
-	mbrRes, _, _ := procCheckTokenMembership.Call(
-		uintptr(ttHandle),
-		uintptr(AdministratorsGroup),
-		uintptr(unsafe.Pointer(&chkRes)),
-	)
-	if mbrRes != 1 {
-		retError = fmt.Errorf("Error checking group membership")
-		return
-	} else {
-		isAdmin = chkRes
-	}
-
-	var ltHandle uintptr
-	var length uint32
-	ltokRes, _, lastError := procGetTokenInformation.Call(
-		uintptr(tHandle),
-		uintptr(19), // TokenLinkedToken
-		uintptr(unsafe.Pointer(&ltHandle)),
-		uintptr(uint32(unsafe.Sizeof(ltHandle))),
-		uintptr(unsafe.Pointer(&length)),
-	)
-	if ltokRes != 1 {
-		if lastError.(syscall.Errno) == PROC_ERROR_NO_SUCH_LOGON_SESSION || lastError.(syscall.Errno) == PROC_ERROR_PRIVILEGE_NOT_HELD {
-			return
-		} else {
-			retError = fmt.Errorf("Error getting linked token: %d: %s", lastError.(syscall.Errno), lastError)
-			return
-		}
-	}
-	defer procCloseHandle.Call(ltHandle)
-
-	var lttHandle uintptr
-	dup2Res, _, lastError := procDuplicateToken.Call(
-		uintptr(ltHandle),
-		uintptr(1), // _SECURITY_IMPERSONATION_LEVEL = SecurityIdentification
-		uintptr(unsafe.Pointer(&lttHandle)),
-	)
-	if dup2Res != 1 {
-		retError = fmt.Errorf("Error generating impersonation token (2): %s", lastError)
-		return
-	}
-	defer procCloseHandle.Call(lttHandle)
-
-	mbr2Res, _, lastError := procCheckTokenMembership.Call(
-		uintptr(lttHandle),
-		uintptr(AdministratorsGroup),
-		uintptr(unsafe.Pointer(&chkRes)),
-	)
-	if mbr2Res != 1 {
-		retError = fmt.Errorf("Error checking group membership (2): %s", lastError)
-		return
-	} else {
-		isAdmin = chkRes
-	}
-
-	return
-}
-
 func getProcessFullPathAndLUID(pid uint32) (string, LUID, error) {
 	var fullpath string
 
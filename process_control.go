@@ -0,0 +1,221 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	modUser32                    = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows              = modUser32.NewProc("EnumWindows")
+	procGetWindowThreadProcessId = modUser32.NewProc("GetWindowThreadProcessId")
+	procPostMessage              = modUser32.NewProc("PostMessageW")
+
+	procAttachConsole            = modKernel32.NewProc("AttachConsole")
+	procFreeConsole              = modKernel32.NewProc("FreeConsole")
+	procGetConsoleProcessList    = modKernel32.NewProc("GetConsoleProcessList")
+	procGenerateConsoleCtrlEvent = modKernel32.NewProc("GenerateConsoleCtrlEvent")
+	procSetConsoleCtrlHandler    = modKernel32.NewProc("SetConsoleCtrlHandler")
+	procWaitForSingleObject      = modKernel32.NewProc("WaitForSingleObject")
+	procGetExitCodeProcess       = modKernel32.NewProc("GetExitCodeProcess")
+)
+
+const (
+	PROC_SYNCHRONIZE = 0x00100000
+
+	PROC_WM_CLOSE             = 0x0010
+	PROC_CTRL_BREAK_EVENT     = 1
+	PROC_ERROR_INVALID_HANDLE = 6
+	PROC_ERROR_GEN_FAILURE    = 31
+
+	PROC_WAIT_OBJECT_0 = 0x00000000
+	PROC_WAIT_TIMEOUT  = 0x00000102
+	PROC_WAIT_FAILED   = 0xFFFFFFFF
+
+	// How long to keep swallowing CTRL_BREAK in this process after sending
+	// it, as the event is delivered asynchronously.
+	procCtrlBreakDeliveryDelay = 250 * time.Millisecond
+)
+
+var (
+	// Callbacks are a limited resource, so they're only created once.
+	procCloseWindowsCallback = syscall.NewCallback(closeWindowsEnumProc)
+	procIgnoreBreakCallback  = syscall.NewCallback(ignoreCtrlBreakHandler)
+
+	// The console is process wide state, only one CTRL_BREAK can be sent
+	// at a time.
+	procConsoleMu sync.Mutex
+)
+
+// ProcessStop stops the process with the given PID, escalating from asking it
+// to close to terminating it.
+//
+// WM_CLOSE is posted to the process's top-level windows, then CTRL_BREAK is
+// sent to its console, waiting up to opts.StageTimeout after each for the
+// process to exit. If it still hasn't exited, or ctx is done, it is terminated
+// with opts.ExitCode. The stage that ended the process and its exit code are
+// returned, along with the polite stages that couldn't be tried from this
+// process:
+//
+// WM_CLOSE can only be posted to windows on the current process's desktop, so
+// it is unsupported when the target is in another session, such as when
+// running as a service. Windows on another window station or desktop of the
+// same session aren't seen either, and look the same as having none.
+//
+// Sending CTRL_BREAK requires temporarily attaching to the target's console,
+// and a process can only be attached to one console, so it is unsupported
+// when the current process has a console of its own.
+// See: https://docs.microsoft.com/en-us/windows/console/generateconsolectrlevent
+func ProcessStop(ctx context.Context, pid uint32, opts ProcessStopOptions) (so.ProcessStopResult, error) {
+	access := uint32(PROC_SYNCHRONIZE | PROCESS_QUERY_LIMITED_INFORMATION)
+	if !opts.NoTerminate {
+		access |= PROCESS_TERMINATE
+	}
+	handle, _, lastError := procOpenProcess.Call(uintptr(access), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return so.ProcessStopResult{}, fmt.Errorf("Failed to open handle: %s", lastError)
+	}
+	defer procCloseHandle.Call(handle)
+
+	return stopProcess(ctx, &windowsProcessStopper{pid: pid, handle: handle}, opts)
+}
+
+type windowsProcessStopper struct {
+	pid    uint32
+	handle uintptr
+}
+
+type closeWindowsState struct {
+	pid    uint32
+	posted int
+}
+
+func closeWindowsEnumProc(hwnd uintptr, lParam uintptr) uintptr {
+	state := (*closeWindowsState)(unsafe.Pointer(lParam))
+	var pid uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+	if pid == state.pid {
+		if ret, _, _ := procPostMessage.Call(hwnd, uintptr(PROC_WM_CLOSE), 0, 0); ret != 0 {
+			state.posted++
+		}
+	}
+	return 1 // continue enumeration
+}
+
+func ignoreCtrlBreakHandler(ctrlType uintptr) uintptr {
+	if ctrlType == PROC_CTRL_BREAK_EVENT {
+		return 1
+	}
+	return 0
+}
+
+// CloseWindows posts WM_CLOSE to each of the process's top-level windows on
+// the current desktop, or returns errStopStageUnsupported if the process is in
+// another session, whose windows can't be enumerated from here.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-enumwindows
+func (s *windowsProcessStopper) CloseWindows() (bool, error) {
+	var current, target uint32
+	pid, _, _ := procGetCurrentProcessId.Call()
+	if ret, _, _ := procProcessIdToSessionId.Call(pid, uintptr(unsafe.Pointer(&current))); ret != 0 {
+		if ret, _, _ := procProcessIdToSessionId.Call(uintptr(s.pid), uintptr(unsafe.Pointer(&target))); ret != 0 && target != current {
+			return false, errStopStageUnsupported
+		}
+	}
+
+	state := &closeWindowsState{pid: s.pid}
+	ret, _, lastError := procEnumWindows.Call(procCloseWindowsCallback, uintptr(unsafe.Pointer(state)))
+	if ret == 0 {
+		return false, fmt.Errorf("Unable to enumerate windows: %s", lastError)
+	}
+	return state.posted > 0, nil
+}
+
+// CtrlBreak sends CTRL_BREAK to every process attached to the process's
+// console, while swallowing it in this process. It returns
+// errStopStageUnsupported rather than give up this process's own console.
+// See: https://docs.microsoft.com/en-us/windows/console/getconsoleprocesslist
+func (s *windowsProcessStopper) CtrlBreak() (bool, error) {
+	procConsoleMu.Lock()
+	defer procConsoleMu.Unlock()
+
+	var attached [1]uint32
+	if ret, _, _ := procGetConsoleProcessList.Call(uintptr(unsafe.Pointer(&attached[0])), uintptr(len(attached))); ret != 0 {
+		return false, errStopStageUnsupported
+	}
+
+	ret, _, lastError := procAttachConsole.Call(uintptr(s.pid))
+	if ret == 0 {
+		// The process doesn't have a console to signal.
+		if errno, ok := lastError.(syscall.Errno); ok && (errno == PROC_ERROR_INVALID_HANDLE || errno == PROC_ERROR_GEN_FAILURE) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Unable to attach to console: %s", lastError)
+	}
+	defer procFreeConsole.Call()
+
+	procSetConsoleCtrlHandler.Call(procIgnoreBreakCallback, 1)
+	defer procSetConsoleCtrlHandler.Call(procIgnoreBreakCallback, 0)
+
+	ret, _, lastError = procGenerateConsoleCtrlEvent.Call(uintptr(PROC_CTRL_BREAK_EVENT), uintptr(0))
+	if ret == 0 {
+		return false, fmt.Errorf("Unable to generate CTRL_BREAK: %s", lastError)
+	}
+	time.Sleep(procCtrlBreakDeliveryDelay)
+	return true, nil
+}
+
+func (s *windowsProcessStopper) Wait(ctx context.Context, timeout time.Duration) (uint32, bool, error) {
+	return waitProcessHandle(ctx, s.handle, timeout)
+}
+
+// waitProcessHandle waits up to timeout for a process handle to be signalled,
+// returning the process's exit code if it was. The wait is done in short
+// slices so ctx is honoured, and a negative timeout waits until ctx is done.
+func waitProcessHandle(ctx context.Context, handle uintptr, timeout time.Duration) (uint32, bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		slice := 100 * time.Millisecond
+		if timeout >= 0 {
+			if remaining := time.Until(deadline); remaining < slice {
+				slice = remaining
+			}
+			if slice < 0 {
+				slice = 0
+			}
+		}
+
+		ret, _, lastError := procWaitForSingleObject.Call(handle, uintptr(uint32(slice/time.Millisecond)))
+		switch uint32(ret) {
+		case PROC_WAIT_OBJECT_0:
+			var code uint32
+			if r, _, lastError := procGetExitCodeProcess.Call(handle, uintptr(unsafe.Pointer(&code))); r == 0 {
+				return 0, true, fmt.Errorf("Unable to get exit code: %s", lastError)
+			}
+			return code, true, nil
+		case PROC_WAIT_TIMEOUT:
+		default:
+			return 0, false, fmt.Errorf("Unable to wait for process: %s", lastError)
+		}
+
+		if ctx.Err() != nil || (timeout >= 0 && !time.Now().Before(deadline)) {
+			return 0, false, nil
+		}
+	}
+}
+
+func (s *windowsProcessStopper) Terminate(exitCode uint32) error {
+	ret, _, lastError := procTerminateProcess.Call(s.handle, uintptr(exitCode))
+	if ret == 0 {
+		return fmt.Errorf("Failed to terminate process: %s", lastError)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	modNtdll                      = syscall.NewLazyDLL("ntdll.dll")
+	procNtQueryInformationProcess = modNtdll.NewProc("NtQueryInformationProcess")
+
+	procReadProcessMemory     = modKernel32.NewProc("ReadProcessMemory")
+	procGetProcessTimes       = modKernel32.NewProc("GetProcessTimes")
+	procProcessIdToSessionId  = modKernel32.NewProc("ProcessIdToSessionId")
+	procIsWow64Process        = modKernel32.NewProc("IsWow64Process")
+	procIsWow64Process2       = modKernel32.NewProc("IsWow64Process2")
+	procGetProcessInformation = modKernel32.NewProc("GetProcessInformation")
+	procGetProcessMemoryInfo  = modKernel32.NewProc("K32GetProcessMemoryInfo")
+	procGetProcessHandleCount = modKernel32.NewProc("GetProcessHandleCount")
+)
+
+const (
+	PROCESS_VM_READ = 0x0010
+
+	PROC_BASIC_INFORMATION        = 0
+	PROC_COMMAND_LINE_INFORMATION = 60
+
+	PROC_STATUS_INFO_LENGTH_MISMATCH = 0xC0000004
+
+	PROC_MEMORY_COUNTERS_EX_SIZE = 80
+
+	// ProcessMachineTypeInfo, for GetProcessInformation.
+	PROC_MACHINE_TYPE_INFO = 9
+)
+
+type PROCESS_MACHINE_INFORMATION struct {
+	ProcessMachine    uint16
+	Res0              uint16
+	MachineAttributes uint32
+}
+
+type PROCESS_BASIC_INFORMATION struct {
+	ExitStatus                   uintptr
+	PebBaseAddress               uintptr
+	AffinityMask                 uintptr
+	BasePriority                 uintptr
+	UniqueProcessId              uintptr
+	InheritedFromUniqueProcessId uintptr
+}
+
+// ProcessListFields is ProcessList, additionally collecting the optional
+// fields selected by fields, a combination of the shared PROC_FIELD_*
+// constants.
+//
+// Optional fields are collected on a best effort basis: the ones that were
+// collected for a process are recorded in its Fields, and a process that
+// can't be opened will have none of the fields that need a process handle.
+func ProcessListFields(fields uint32) ([]so.Process, error) {
+	return processList(fields)
+}
+
+// collectProcessFields fills in the optional fields of p.
+func collectProcessFields(p *so.Process, e *PROCESSENTRY32, fields uint32) {
+	if fields&so.PROC_FIELD_SESSION != 0 {
+		var session uint32
+		if ret, _, _ := procProcessIdToSessionId.Call(uintptr(e.ProcessID), uintptr(unsafe.Pointer(&session))); ret != 0 {
+			p.SessionID = session
+			p.Fields |= so.PROC_FIELD_SESSION
+		}
+	}
+
+	if fields&^so.PROC_FIELD_SESSION == 0 {
+		return
+	}
+
+	handle, _, _ := procOpenProcess.Call(uintptr(uint32(PROCESS_QUERY_LIMITED_INFORMATION)), uintptr(0), uintptr(e.ProcessID))
+	if handle == 0 {
+		return
+	}
+	defer procCloseHandle.Call(handle)
+
+	if fields&so.PROC_FIELD_COMMAND_LINE != 0 {
+		if cmdLine, err := processCommandLine(e.ProcessID, handle); err == nil {
+			p.CommandLine = cmdLine
+			p.Fields |= so.PROC_FIELD_COMMAND_LINE
+		}
+	}
+
+	if fields&so.PROC_FIELD_TIMES != 0 {
+		var creation, exit, kernel, user syscall.Filetime
+		ret, _, _ := procGetProcessTimes.Call(
+			handle,
+			uintptr(unsafe.Pointer(&creation)),
+			uintptr(unsafe.Pointer(&exit)),
+			uintptr(unsafe.Pointer(&kernel)),
+			uintptr(unsafe.Pointer(&user)),
+		)
+		if ret != 0 {
+			p.CreationTime, p.KernelTime, p.UserTime = processTimes(filetimeUint64(creation), filetimeUint64(kernel), filetimeUint64(user))
+			p.Fields |= so.PROC_FIELD_TIMES
+		}
+	}
+
+	if fields&so.PROC_FIELD_ARCHITECTURE != 0 {
+		if machine, emulated, err := processArchitecture(handle); err == nil {
+			p.Machine, p.Emulated = machine, emulated
+			p.Fields |= so.PROC_FIELD_ARCHITECTURE
+		}
+	}
+
+	if fields&so.PROC_FIELD_INTEGRITY != 0 {
+		if il, err := processIntegrityLevel(handle); err == nil {
+			p.IntegrityLevel = il
+			p.Fields |= so.PROC_FIELD_INTEGRITY
+		}
+	}
+
+	if fields&so.PROC_FIELD_MEMORY != 0 {
+		var counters [PROC_MEMORY_COUNTERS_EX_SIZE]byte
+		*(*uint32)(unsafe.Pointer(&counters[0])) = PROC_MEMORY_COUNTERS_EX_SIZE
+		ret, _, _ := procGetProcessMemoryInfo.Call(
+			handle,
+			uintptr(unsafe.Pointer(&counters[0])),
+			uintptr(PROC_MEMORY_COUNTERS_EX_SIZE),
+		)
+		if ret != 0 {
+			if ws, private, err := decodeProcessMemoryCounters(counters[:]); err == nil {
+				p.WorkingSetSize, p.PrivateBytes = ws, private
+				p.Fields |= so.PROC_FIELD_MEMORY
+			}
+		}
+	}
+
+	if fields&so.PROC_FIELD_COUNTERS != 0 {
+		var handles uint32
+		if ret, _, _ := procGetProcessHandleCount.Call(handle, uintptr(unsafe.Pointer(&handles))); ret != 0 {
+			p.HandleCount = handles
+			p.ThreadCount = e.CntThreads
+			p.Fields |= so.PROC_FIELD_COUNTERS
+		}
+	}
+}
+
+func filetimeUint64(ft syscall.Filetime) uint64 {
+	return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+}
+
+// processCommandLine queries ProcessCommandLineInformation, available from
+// Windows 8.1, falling back to reading the command line from the process's PEB.
+//
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winternl/nf-winternl-ntqueryinformationprocess
+func processCommandLine(pid uint32, handle uintptr) (string, error) {
+	var length uint32
+	status, _, _ := procNtQueryInformationProcess.Call(
+		handle,
+		uintptr(PROC_COMMAND_LINE_INFORMATION),
+		uintptr(0),
+		uintptr(0),
+		uintptr(unsafe.Pointer(&length)),
+	)
+	if status == PROC_STATUS_INFO_LENGTH_MISMATCH && length > 0 {
+		buf := make([]byte, length)
+		status, _, _ = procNtQueryInformationProcess.Call(
+			handle,
+			uintptr(PROC_COMMAND_LINE_INFORMATION),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(length),
+			uintptr(unsafe.Pointer(&length)),
+		)
+		if status == 0 {
+			return decodeUnicodeString(buf, uintptr(unsafe.Pointer(&buf[0])))
+		}
+	}
+
+	return processCommandLineFromPEB(pid)
+}
+
+func processCommandLineFromPEB(pid uint32) (string, error) {
+	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_QUERY_INFORMATION|PROCESS_VM_READ)), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return "", fmt.Errorf("Unable to open process for reading: %s", lastError)
+	}
+	defer procCloseHandle.Call(handle)
+
+	var pbi PROCESS_BASIC_INFORMATION
+	var length uint32
+	status, _, _ := procNtQueryInformationProcess.Call(
+		handle,
+		uintptr(PROC_BASIC_INFORMATION),
+		uintptr(unsafe.Pointer(&pbi)),
+		uintptr(uint32(unsafe.Sizeof(pbi))),
+		uintptr(unsafe.Pointer(&length)),
+	)
+	if status != 0 {
+		return "", fmt.Errorf("Unable to query process basic information: 0x%x", status)
+	}
+	if pbi.PebBaseAddress == 0 {
+		return "", fmt.Errorf("Process has no PEB")
+	}
+
+	return readPEBCommandLine(processMemory{handle: handle}, uint64(pbi.PebBaseAddress))
+}
+
+// processMemory is a processMemoryReader over ReadProcessMemory.
+type processMemory struct {
+	handle uintptr
+}
+
+func (m processMemory) ReadMemory(addr uint64, buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	var read uintptr
+	ret, _, lastError := procReadProcessMemory.Call(
+		m.handle,
+		uintptr(addr),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&read)),
+	)
+	if ret == 0 {
+		return lastError
+	}
+	if read != uintptr(len(buf)) {
+		return fmt.Errorf("Short read at 0x%x: %d of %d bytes", addr, read, len(buf))
+	}
+	return nil
+}
+
+// processArchitecture uses GetProcessInformation's ProcessMachineTypeInfo
+// where available, as IsWow64Process2 doesn't report x64 emulation on ARM64.
+// Otherwise it uses IsWow64Process2, or IsWow64Process, which can only tell
+// x86 on x64 emulation apart.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/processthreadsapi/ns-processthreadsapi-process_machine_information
+func processArchitecture(handle uintptr) (uint16, bool, error) {
+	if procIsWow64Process2.Find() == nil {
+		var pMachine, nMachine uint16
+		ret, _, lastError := procIsWow64Process2.Call(
+			handle,
+			uintptr(unsafe.Pointer(&pMachine)),
+			uintptr(unsafe.Pointer(&nMachine)),
+		)
+		if ret == 0 {
+			return 0, false, lastError
+		}
+
+		// Only Windows 11 supports ProcessMachineTypeInfo, so the call
+		// fails on Windows 10, which can't emulate x64 on ARM64 anyway.
+		if procGetProcessInformation.Find() == nil {
+			var info PROCESS_MACHINE_INFORMATION
+			ret, _, _ := procGetProcessInformation.Call(
+				handle,
+				uintptr(PROC_MACHINE_TYPE_INFO),
+				uintptr(unsafe.Pointer(&info)),
+				unsafe.Sizeof(info),
+			)
+			if ret != 0 {
+				machine, emulated := processMachineType(info.ProcessMachine, nMachine)
+				return machine, emulated, nil
+			}
+		}
+
+		machine, emulated := processMachine(pMachine, nMachine)
+		return machine, emulated, nil
+	}
+
+	var wow64 int32
+	ret, _, lastError := procIsWow64Process.Call(handle, uintptr(unsafe.Pointer(&wow64)))
+	if ret == 0 {
+		return 0, false, lastError
+	}
+	if wow64 != 0 {
+		return so.IMAGE_FILE_MACHINE_I386, true, nil
+	}
+	return so.IMAGE_FILE_MACHINE_AMD64, false, nil
+}
+
+func processIntegrityLevel(handle uintptr) (uint32, error) {
+	var token uintptr
+	opRes, _, lastError := procOpenProcessToken.Call(
+		handle,
+		uintptr(uint32(PROC_TOKEN_QUERY)),
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if opRes != 1 {
+		return 0, fmt.Errorf("Unable to open process token: %s", lastError)
+	}
+	defer procCloseHandle.Call(token)
+
+	buf, base, err := getTokenInformation(token, TOKEN_INFO_INTEGRITY)
+	if err != nil {
+		return 0, err
+	}
+	return decodeTokenIntegrityLevel(buf, base)
+}
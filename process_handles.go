@@ -0,0 +1,193 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	procNtQuerySystemInformation = modNtdll.NewProc("NtQuerySystemInformation")
+	procNtQueryObject            = modNtdll.NewProc("NtQueryObject")
+	procDuplicateHandle          = modKernel32.NewProc("DuplicateHandle")
+	procGetFileType              = modKernel32.NewProc("GetFileType")
+	procQueryDosDevice           = modKernel32.NewProc("QueryDosDeviceW")
+)
+
+const (
+	PROCESS_DUP_HANDLE = 0x0040
+
+	DUPLICATE_SAME_ACCESS = 0x00000002
+
+	FILE_TYPE_PIPE = 0x0003
+
+	PROC_STATUS_BUFFER_OVERFLOW  = 0x80000005
+	PROC_STATUS_BUFFER_TOO_SMALL = 0xC0000023
+
+	SYSTEM_EXTENDED_HANDLE_INFORMATION = 64
+
+	OBJECT_NAME_INFORMATION  = 1
+	OBJECT_TYPES_INFORMATION = 3
+)
+
+// ProcessHandles lists the handles a process holds open, with their object
+// types and, where they have one, names. File paths are given with drive
+// letters and registry keys with hive names.
+//
+// Names aren't queried for pipes, as querying a synchronous pipe another
+// process is blocked on can hang.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winternl/nf-winternl-ntquerysysteminformation
+func ProcessHandles(pid uint32) ([]so.ProcessHandle, error) {
+	if err := procAssignCorrectPrivs(PROC_SE_DEBUG_NAME); err != nil {
+		return nil, fmt.Errorf("Error assigning privs... %s", err.Error())
+	}
+
+	buf, err := ntQueryGrowing(func(b []byte, retLen *uint32) uintptr {
+		status, _, _ := procNtQuerySystemInformation.Call(
+			uintptr(SYSTEM_EXTENDED_HANDLE_INFORMATION),
+			uintptr(unsafe.Pointer(&b[0])),
+			uintptr(uint32(len(b))),
+			uintptr(unsafe.Pointer(retLen)),
+		)
+		return status
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list system handles: %s", err)
+	}
+	handles, err := decodeSystemHandles(buf, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	typesBuf, err := ntQueryGrowing(func(b []byte, retLen *uint32) uintptr {
+		status, _, _ := procNtQueryObject.Call(
+			uintptr(0),
+			uintptr(OBJECT_TYPES_INFORMATION),
+			uintptr(unsafe.Pointer(&b[0])),
+			uintptr(uint32(len(b))),
+			uintptr(unsafe.Pointer(retLen)),
+		)
+		return status
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list object types: %s", err)
+	}
+	types, err := decodeObjectTypes(typesBuf, uintptr(unsafe.Pointer(&typesBuf[0])))
+	if err != nil {
+		return nil, err
+	}
+
+	process, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_DUP_HANDLE)), uintptr(0), uintptr(pid))
+	if process == 0 {
+		return nil, fmt.Errorf("Unable to open process %d: %s", pid, lastError)
+	}
+	defer procCloseHandle.Call(process)
+	current, _, _ := procGetCurrentProcess.Call()
+	devices := dosDevices()
+
+	retVal := make([]so.ProcessHandle, 0, len(handles))
+	for _, h := range handles {
+		ph := so.ProcessHandle{
+			Handle:        h.Handle,
+			Type:          types[h.TypeIndex],
+			GrantedAccess: h.GrantedAccess,
+		}
+
+		var dup uintptr
+		ret, _, _ := procDuplicateHandle.Call(
+			process,
+			uintptr(h.Handle),
+			current,
+			uintptr(unsafe.Pointer(&dup)),
+			uintptr(0), // desired access, ignored
+			uintptr(0), // inherit handle
+			uintptr(DUPLICATE_SAME_ACCESS),
+		)
+		if ret != 0 {
+			if name, ok := objectName(dup, ph.Type); ok {
+				ph.Name = dosObjectName(ph.Type, name, devices)
+			}
+			procCloseHandle.Call(dup)
+		}
+		retVal = append(retVal, ph)
+	}
+	return retVal, nil
+}
+
+// objectName returns the name of the object behind handle, unless it's a
+// pipe.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winternl/nf-winternl-ntqueryobject
+func objectName(handle uintptr, typeName string) (string, bool) {
+	if typeName == "File" {
+		if ft, _, _ := procGetFileType.Call(handle); ft == FILE_TYPE_PIPE {
+			return "", false
+		}
+	}
+	buf, err := ntQueryGrowing(func(b []byte, retLen *uint32) uintptr {
+		status, _, _ := procNtQueryObject.Call(
+			handle,
+			uintptr(OBJECT_NAME_INFORMATION),
+			uintptr(unsafe.Pointer(&b[0])),
+			uintptr(uint32(len(b))),
+			uintptr(unsafe.Pointer(retLen)),
+		)
+		return status
+	})
+	if err != nil {
+		return "", false
+	}
+	name, err := decodeUnicodeString(buf, uintptr(unsafe.Pointer(&buf[0])))
+	return name, err == nil && name != ""
+}
+
+// ntQueryGrowing calls query with a buffer, growing it for as long as query
+// returns STATUS_INFO_LENGTH_MISMATCH, and returns the filled in buffer.
+func ntQueryGrowing(query func(buf []byte, retLen *uint32) uintptr) ([]byte, error) {
+	buf := make([]byte, 0x1000)
+	for {
+		var retLen uint32
+		status := query(buf, &retLen)
+		switch {
+		case status == 0:
+			return buf, nil
+		case status == PROC_STATUS_INFO_LENGTH_MISMATCH || status == PROC_STATUS_BUFFER_OVERFLOW || status == PROC_STATUS_BUFFER_TOO_SMALL:
+			// The amount needed can grow between calls, so leave some room.
+			size := len(buf) * 2
+			if int(retLen) > len(buf) {
+				size = int(retLen) + 0x1000
+			}
+			if size > 1<<28 {
+				return nil, fmt.Errorf("NTSTATUS 0x%x: buffer would exceed %d bytes", status, 1<<28)
+			}
+			buf = make([]byte, size)
+		default:
+			return nil, fmt.Errorf("NTSTATUS 0x%x", status)
+		}
+	}
+}
+
+// dosDevices maps the device behind each drive letter, such as
+// "\Device\HarddiskVolume3", to the drive, such as "C:".
+// See: https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-querydosdevicew
+func dosDevices() map[string]string {
+	retVal := make(map[string]string)
+	var target [MAX_PATH]uint16
+	for letter := 'A'; letter <= 'Z'; letter++ {
+		drive := string(letter) + ":"
+		drivePtr, _ := syscall.UTF16PtrFromString(drive)
+		n, _, _ := procQueryDosDevice.Call(
+			uintptr(unsafe.Pointer(drivePtr)),
+			uintptr(unsafe.Pointer(&target[0])),
+			uintptr(len(target)),
+		)
+		if n != 0 {
+			retVal[syscall.UTF16ToString(target[:])] = drive
+		}
+	}
+	return retVal
+}
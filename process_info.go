@@ -0,0 +1,132 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// Offsets within the 64-bit PEB and RTL_USER_PROCESS_PARAMETERS used to find a
+// process's command line.
+const (
+	PEB_PROCESS_PARAMETERS_OFFSET     = 0x20
+	PROCESS_PARAMETERS_CMDLINE_OFFSET = 0x70
+)
+
+// A processMemoryReader reads the memory of another process. It's implemented
+// with ReadProcessMemory on Windows, and lets readPEBCommandLine be tested
+// against fake memory.
+type processMemoryReader interface {
+	ReadMemory(addr uint64, buf []byte) error
+}
+
+// readPEBCommandLine follows the PEB at peb to the process parameters and reads
+// the command line UNICODE_STRING it points to.
+func readPEBCommandLine(r processMemoryReader, peb uint64) (string, error) {
+	var ptr [8]byte
+	if err := r.ReadMemory(peb+PEB_PROCESS_PARAMETERS_OFFSET, ptr[:]); err != nil {
+		return "", fmt.Errorf("Unable to read PEB: %s", err)
+	}
+	params := binary.LittleEndian.Uint64(ptr[:])
+	if params == 0 {
+		return "", fmt.Errorf("Process has no process parameters")
+	}
+
+	var us [16]byte
+	if err := r.ReadMemory(params+PROCESS_PARAMETERS_CMDLINE_OFFSET, us[:]); err != nil {
+		return "", fmt.Errorf("Unable to read process parameters: %s", err)
+	}
+	length := binary.LittleEndian.Uint16(us[0:])
+	buffer := binary.LittleEndian.Uint64(us[8:])
+	if length == 0 {
+		return "", nil
+	}
+	if length%2 != 0 || buffer == 0 {
+		return "", fmt.Errorf("Invalid command line UNICODE_STRING (length %d, buffer 0x%x)", length, buffer)
+	}
+
+	b := make([]byte, length)
+	if err := r.ReadMemory(buffer, b); err != nil {
+		return "", fmt.Errorf("Unable to read command line: %s", err)
+	}
+	return utf16BytesToString(b), nil
+}
+
+// decodeUnicodeString decodes a UNICODE_STRING at the start of buf whose
+// characters follow it in the same buffer, as returned by
+// NtQueryInformationProcess for ProcessCommandLineInformation. base is the
+// address buf was at when it was filled in.
+func decodeUnicodeString(buf []byte, base uintptr) (string, error) {
+	if len(buf) < 16 {
+		return "", fmt.Errorf("UNICODE_STRING buffer too short")
+	}
+	length := uint64(binary.LittleEndian.Uint16(buf[0:]))
+	ptr := binary.LittleEndian.Uint64(buf[8:])
+	if length == 0 {
+		return "", nil
+	}
+	if ptr < uint64(base) || ptr-uint64(base)+length > uint64(len(buf)) {
+		return "", fmt.Errorf("UNICODE_STRING buffer 0x%x outside of buffer", ptr)
+	}
+	off := ptr - uint64(base)
+	return utf16BytesToString(buf[off : off+length]), nil
+}
+
+func utf16BytesToString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	// Trim a trailing NUL if the length included one.
+	if len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
+
+// decodeProcessMemoryCounters returns the working set size and private bytes
+// from a 64-bit PROCESS_MEMORY_COUNTERS_EX.
+func decodeProcessMemoryCounters(buf []byte) (workingSet uint64, private uint64, err error) {
+	if len(buf) < 80 {
+		return 0, 0, fmt.Errorf("PROCESS_MEMORY_COUNTERS_EX buffer too short")
+	}
+	return binary.LittleEndian.Uint64(buf[16:]), binary.LittleEndian.Uint64(buf[72:]), nil
+}
+
+// processMachine interprets the result of IsWow64Process2: processMachine is
+// IMAGE_FILE_MACHINE_UNKNOWN unless the process runs under WOW64.
+func processMachine(processMachine, nativeMachine uint16) (machine uint16, emulated bool) {
+	if processMachine == so.IMAGE_FILE_MACHINE_UNKNOWN {
+		return nativeMachine, false
+	}
+	return processMachine, true
+}
+
+// processMachineType interprets the ProcessMachine reported by
+// GetProcessInformation, which is always set, so the process is emulated if
+// it differs from the native machine.
+func processMachineType(processMachine, nativeMachine uint16) (machine uint16, emulated bool) {
+	return processMachine, processMachine != nativeMachine
+}
+
+// processTimes converts the FILETIMEs returned by GetProcessTimes. Processes
+// started with the system, such as System Idle, have a zero creation time.
+func processTimes(creation, kernel, user uint64) (time.Time, time.Duration, time.Duration) {
+	var created time.Time
+	if creation != 0 {
+		created = uint64TimestampToTime(creation)
+	}
+	return created, time.Duration(kernel) * 100, time.Duration(user) * 100
+}
+
+func uint64TimestampToTime(nsec uint64) time.Time {
+	// change starting time to the Epoch (00:00:00 UTC, January 1, 1970)
+	nsec -= 116444736000000000
+	// convert into nanoseconds
+	nsec *= 100
+
+	return time.Unix(0, int64(nsec))
+}
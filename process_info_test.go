@@ -0,0 +1,178 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// fakeProcessMemory is a sparse address space made of regions.
+type fakeProcessMemory map[uint64][]byte
+
+func (m fakeProcessMemory) ReadMemory(addr uint64, buf []byte) error {
+	for start, region := range m {
+		if addr >= start && addr+uint64(len(buf)) <= start+uint64(len(region)) {
+			copy(buf, region[addr-start:])
+			return nil
+		}
+	}
+	return fmt.Errorf("access violation at 0x%x", addr)
+}
+
+func utf16Bytes(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+func newFakePEB(cmdLine string) fakeProcessMemory {
+	const (
+		peb    = 0x7ff000000000
+		params = 0x000001c00000
+		buffer = 0x000001c00800
+	)
+	pebMem := make([]byte, 0x40)
+	binary.LittleEndian.PutUint64(pebMem[PEB_PROCESS_PARAMETERS_OFFSET:], params)
+
+	paramsMem := make([]byte, 0x100)
+	cmd := utf16Bytes(cmdLine)
+	binary.LittleEndian.PutUint16(paramsMem[PROCESS_PARAMETERS_CMDLINE_OFFSET:], uint16(len(cmd)))
+	binary.LittleEndian.PutUint16(paramsMem[PROCESS_PARAMETERS_CMDLINE_OFFSET+2:], uint16(len(cmd)+2))
+	binary.LittleEndian.PutUint64(paramsMem[PROCESS_PARAMETERS_CMDLINE_OFFSET+8:], buffer)
+
+	return fakeProcessMemory{
+		peb:    pebMem,
+		params: paramsMem,
+		buffer: append(cmd, 0, 0),
+	}
+}
+
+func TestReadPEBCommandLine(t *testing.T) {
+	want := `"C:\Program Files\Café\app.exe" --flag "quoted arg"`
+	mem := newFakePEB(want)
+	got, err := readPEBCommandLine(mem, 0x7ff000000000)
+	if err != nil {
+		t.Fatalf("readPEBCommandLine: %v", err)
+	}
+	if got != want {
+		t.Errorf("readPEBCommandLine = %q, want %q", got, want)
+	}
+
+	// The command line buffer being unreadable is reported, not a panic.
+	delete(mem, 0x000001c00800)
+	if _, err := readPEBCommandLine(mem, 0x7ff000000000); err == nil {
+		t.Errorf("expected error for unreadable command line")
+	}
+	if _, err := readPEBCommandLine(mem, 0x1000); err == nil {
+		t.Errorf("expected error for unreadable PEB")
+	}
+}
+
+func TestReadPEBCommandLineEmpty(t *testing.T) {
+	got, err := readPEBCommandLine(newFakePEB(""), 0x7ff000000000)
+	if err != nil || got != "" {
+		t.Errorf("readPEBCommandLine = %q, %v", got, err)
+	}
+}
+
+func TestDecodeUnicodeString(t *testing.T) {
+	const base = 0x20000
+	cmd := utf16Bytes(`cmd.exe /c dir`)
+	buf := make([]byte, 16+len(cmd))
+	binary.LittleEndian.PutUint16(buf[0:], uint16(len(cmd)))
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(cmd)))
+	binary.LittleEndian.PutUint64(buf[8:], base+16)
+	copy(buf[16:], cmd)
+
+	got, err := decodeUnicodeString(buf, base)
+	if err != nil || got != `cmd.exe /c dir` {
+		t.Errorf("decodeUnicodeString = %q, %v", got, err)
+	}
+
+	binary.LittleEndian.PutUint16(buf[0:], uint16(len(cmd)+2))
+	if _, err := decodeUnicodeString(buf, base); err == nil {
+		t.Errorf("expected error for length past end of buffer")
+	}
+}
+
+func TestDecodeProcessMemoryCounters(t *testing.T) {
+	buf := make([]byte, 80)
+	binary.LittleEndian.PutUint32(buf[0:], 80)
+	binary.LittleEndian.PutUint64(buf[8:], 64<<20)  // PeakWorkingSetSize
+	binary.LittleEndian.PutUint64(buf[16:], 48<<20) // WorkingSetSize
+	binary.LittleEndian.PutUint64(buf[56:], 30<<20) // PagefileUsage
+	binary.LittleEndian.PutUint64(buf[72:], 32<<20) // PrivateUsage
+
+	ws, private, err := decodeProcessMemoryCounters(buf)
+	if err != nil || ws != 48<<20 || private != 32<<20 {
+		t.Errorf("decodeProcessMemoryCounters = %d, %d, %v", ws, private, err)
+	}
+	if _, _, err := decodeProcessMemoryCounters(buf[:40]); err == nil {
+		t.Errorf("expected error for PROCESS_MEMORY_COUNTERS without private usage")
+	}
+}
+
+func TestProcessMachine(t *testing.T) {
+	tests := []struct {
+		process, native uint16
+		machine         uint16
+		emulated        bool
+		arch            string
+	}{
+		{so.IMAGE_FILE_MACHINE_UNKNOWN, so.IMAGE_FILE_MACHINE_AMD64, so.IMAGE_FILE_MACHINE_AMD64, false, "x64"},
+		{so.IMAGE_FILE_MACHINE_I386, so.IMAGE_FILE_MACHINE_AMD64, so.IMAGE_FILE_MACHINE_I386, true, "x86"},
+		{so.IMAGE_FILE_MACHINE_UNKNOWN, so.IMAGE_FILE_MACHINE_ARM64, so.IMAGE_FILE_MACHINE_ARM64, false, "ARM64"},
+		{so.IMAGE_FILE_MACHINE_ARMNT, so.IMAGE_FILE_MACHINE_ARM64, so.IMAGE_FILE_MACHINE_ARMNT, true, "ARM"},
+	}
+	for _, tt := range tests {
+		machine, emulated := processMachine(tt.process, tt.native)
+		p := so.Process{Machine: machine, Emulated: emulated}
+		if machine != tt.machine || emulated != tt.emulated || p.GetArchitecture() != tt.arch {
+			t.Errorf("processMachine(0x%x, 0x%x) = 0x%x, %v (%s)", tt.process, tt.native, machine, emulated, p.GetArchitecture())
+		}
+	}
+}
+
+func TestProcessMachineType(t *testing.T) {
+	tests := []struct {
+		process, native uint16
+		emulated        bool
+		arch            string
+	}{
+		{so.IMAGE_FILE_MACHINE_AMD64, so.IMAGE_FILE_MACHINE_AMD64, false, "x64"},
+		{so.IMAGE_FILE_MACHINE_I386, so.IMAGE_FILE_MACHINE_AMD64, true, "x86"},
+		{so.IMAGE_FILE_MACHINE_ARM64, so.IMAGE_FILE_MACHINE_ARM64, false, "ARM64"},
+		// x64 emulation on ARM64, which IsWow64Process2 reports as native.
+		{so.IMAGE_FILE_MACHINE_AMD64, so.IMAGE_FILE_MACHINE_ARM64, true, "x64"},
+	}
+	for _, tt := range tests {
+		machine, emulated := processMachineType(tt.process, tt.native)
+		p := so.Process{Machine: machine, Emulated: emulated}
+		if machine != tt.process || emulated != tt.emulated || p.GetArchitecture() != tt.arch {
+			t.Errorf("processMachineType(0x%x, 0x%x) = 0x%x, %v (%s)", tt.process, tt.native, machine, emulated, p.GetArchitecture())
+		}
+	}
+}
+
+func TestProcessTimes(t *testing.T) {
+	// 2021-01-01T00:00:00Z as a FILETIME.
+	created, kernel, user := processTimes(132539328000000000, 15000000, 2500000)
+	if !created.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("creation time = %v", created)
+	}
+	p := so.Process{KernelTime: kernel, UserTime: user}
+	if kernel != 1500*time.Millisecond || user != 250*time.Millisecond || p.CPUTime() != 1750*time.Millisecond {
+		t.Errorf("kernel = %v, user = %v", kernel, user)
+	}
+
+	if created, _, _ := processTimes(0, 0, 0); !created.IsZero() {
+		t.Errorf("zero creation FILETIME should give a zero time, got %v", created)
+	}
+}
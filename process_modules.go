@@ -0,0 +1,127 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	procModule32First = modKernel32.NewProc("Module32FirstW")
+	procModule32Next  = modKernel32.NewProc("Module32NextW")
+
+	modVersion                = syscall.NewLazyDLL("version.dll")
+	verGetFileVersionInfoSize = modVersion.NewProc("GetFileVersionInfoSizeW")
+	verGetFileVersionInfo     = modVersion.NewProc("GetFileVersionInfoW")
+)
+
+const (
+	TH32CS_SNAPMODULE   = 0x00000008
+	TH32CS_SNAPMODULE32 = 0x00000010
+
+	MAX_MODULE_NAME32 = 255
+
+	// Returned by CreateToolhelp32Snapshot while the target process is still
+	// loading modules.
+	ERROR_BAD_LENGTH = 24
+
+	// How many times to retry a snapshot failing with ERROR_BAD_LENGTH.
+	PROC_MODULE_SNAPSHOT_RETRIES = 5
+
+	INVALID_HANDLE_VALUE = ^uintptr(0)
+)
+
+type MODULEENTRY32 struct {
+	Size         uint32
+	ModuleID     uint32
+	ProcessID    uint32
+	GlblcntUsage uint32
+	ProccntUsage uint32
+	ModBaseAddr  uintptr
+	ModBaseSize  uint32
+	HModule      uintptr
+	Module       [MAX_MODULE_NAME32 + 1]uint16
+	ExePath      [MAX_PATH]uint16
+}
+
+// ProcessModules lists the executable and DLLs loaded by a process, including
+// 32-bit modules of a WOW64 process, with their file versions.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/tlhelp32/nf-tlhelp32-module32firstw
+func ProcessModules(pid uint32) ([]so.ProcessModule, error) {
+	if err := procAssignCorrectPrivs(PROC_SE_DEBUG_NAME); err != nil {
+		return nil, fmt.Errorf("Error assigning privs... %s", err.Error())
+	}
+
+	var handle uintptr
+	for i := 0; ; i++ {
+		h, _, lastError := procCreateToolhelp32Snapshot.Call(uintptr(TH32CS_SNAPMODULE|TH32CS_SNAPMODULE32), uintptr(pid))
+		if h != INVALID_HANDLE_VALUE {
+			handle = h
+			break
+		}
+		if errno, ok := lastError.(syscall.Errno); !ok || errno != ERROR_BAD_LENGTH || i == PROC_MODULE_SNAPSHOT_RETRIES {
+			return nil, fmt.Errorf("Unable to snapshot modules of process %d: %s", pid, lastError)
+		}
+	}
+	defer procCloseHandle.Call(handle)
+
+	var entry MODULEENTRY32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	ret, _, lastError := procModule32First.Call(handle, uintptr(unsafe.Pointer(&entry)))
+	if ret == 0 {
+		return nil, fmt.Errorf("Unable to get first module of process %d: %s", pid, lastError)
+	}
+
+	retVal := make([]so.ProcessModule, 0)
+	for {
+		m := so.ProcessModule{
+			Name:        syscall.UTF16ToString(entry.Module[:]),
+			Path:        syscall.UTF16ToString(entry.ExePath[:]),
+			BaseAddress: uint64(entry.ModBaseAddr),
+			Size:        entry.ModBaseSize,
+		}
+		m.FileVersion, m.ProductVersion, _ = fileVersion(m.Path)
+		retVal = append(retVal, m)
+
+		ret, _, _ := procModule32Next.Call(handle, uintptr(unsafe.Pointer(&entry)))
+		if ret == 0 {
+			break
+		}
+	}
+	return retVal, nil
+}
+
+// fileVersion returns the file and product versions from the version resource
+// of the file at path.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winver/nf-winver-getfileversioninfow
+func fileVersion(path string) (string, string, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", "", fmt.Errorf("Unable to encode path: %s", err)
+	}
+	var ignored uint32
+	size, _, lastError := verGetFileVersionInfoSize.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&ignored)),
+	)
+	if size == 0 {
+		return "", "", fmt.Errorf("Unable to get version info size of %s: %s", path, lastError)
+	}
+
+	block := make([]byte, size)
+	ret, _, lastError := verGetFileVersionInfo.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(0), // ignored
+		size,
+		uintptr(unsafe.Pointer(&block[0])),
+	)
+	if ret == 0 {
+		return "", "", fmt.Errorf("Unable to get version info of %s: %s", path, lastError)
+	}
+	return fixedFileVersion(block)
+}
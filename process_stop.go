@@ -0,0 +1,119 @@
+package winapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// ErrProcessStillRunning is returned by ProcessStop when the polite stages
+// didn't end the process and NoTerminate was set.
+var ErrProcessStillRunning = errors.New("the process is still running")
+
+// errStopStageUnsupported is returned by a processStopper's signals when the
+// stage can't be tried from the current process.
+var errStopStageUnsupported = errors.New("the stop stage is unsupported")
+
+// DefaultProcessStopStageTimeout is used when ProcessStopOptions.StageTimeout
+// is zero.
+const DefaultProcessStopStageTimeout = 5 * time.Second
+
+// ProcessStopOptions controls how ProcessStop escalates.
+type ProcessStopOptions struct {
+	// SkipCloseWindows and SkipCtrlBreak disable the polite stages: posting
+	// WM_CLOSE to the process's top-level windows, and sending CTRL_BREAK to
+	// its console. Stages that can't be tried from the calling process, such
+	// as WM_CLOSE from a service, are listed in the result's Unsupported.
+	SkipCloseWindows bool
+	SkipCtrlBreak    bool
+
+	// StageTimeout is how long to wait for the process to exit after each
+	// polite stage. The wait also ends early when the context is done, in
+	// which case ProcessStop escalates straight to termination.
+	StageTimeout time.Duration
+
+	// NoTerminate stops ProcessStop from calling TerminateProcess if the
+	// polite stages fail.
+	NoTerminate bool
+
+	// ExitCode is the exit code given to TerminateProcess.
+	ExitCode uint32
+}
+
+// processStopper performs the steps of ProcessStop against one process.
+//
+// CloseWindows and CtrlBreak report whether there was anything to signal, or
+// errStopStageUnsupported if they can't tell, and Wait waits up to timeout (or until ctx is done) for the process to
+// exit, returning its exit code if it did.
+type processStopper interface {
+	CloseWindows() (bool, error)
+	CtrlBreak() (bool, error)
+	Wait(ctx context.Context, timeout time.Duration) (uint32, bool, error)
+	Terminate(exitCode uint32) error
+}
+
+// stopProcess runs the ProcessStop escalation using s.
+func stopProcess(ctx context.Context, s processStopper, opts ProcessStopOptions) (so.ProcessStopResult, error) {
+	timeout := opts.StageTimeout
+	if timeout <= 0 {
+		timeout = DefaultProcessStopStageTimeout
+	}
+
+	code, exited, err := s.Wait(ctx, 0)
+	if err != nil {
+		return so.ProcessStopResult{}, err
+	}
+	if exited {
+		return so.ProcessStopResult{Stage: so.PROC_STOP_ALREADY_EXITED, ExitCode: code}, nil
+	}
+
+	stages := []struct {
+		stage  uint32
+		skip   bool
+		signal func() (bool, error)
+	}{
+		{so.PROC_STOP_CLOSE_WINDOWS, opts.SkipCloseWindows, s.CloseWindows},
+		{so.PROC_STOP_CTRL_BREAK, opts.SkipCtrlBreak, s.CtrlBreak},
+	}
+	var unsupported []uint32
+	for _, st := range stages {
+		if st.skip || ctx.Err() != nil {
+			continue
+		}
+		// A failure to signal isn't fatal; the next stage may still work.
+		sent, err := st.signal()
+		if err == errStopStageUnsupported {
+			unsupported = append(unsupported, st.stage)
+		}
+		if err != nil || !sent {
+			continue
+		}
+		code, exited, err := s.Wait(ctx, timeout)
+		if err != nil {
+			return so.ProcessStopResult{}, err
+		}
+		if exited {
+			return so.ProcessStopResult{Stage: st.stage, ExitCode: code, Unsupported: unsupported}, nil
+		}
+	}
+
+	if opts.NoTerminate {
+		return so.ProcessStopResult{Stage: so.PROC_STOP_NONE, Unsupported: unsupported}, ErrProcessStillRunning
+	}
+
+	if err := s.Terminate(opts.ExitCode); err != nil {
+		return so.ProcessStopResult{Stage: so.PROC_STOP_NONE, Unsupported: unsupported}, err
+	}
+	// TerminateProcess is asynchronous, wait for it to take effect regardless
+	// of ctx so the exit code reported is the real one.
+	code, exited, err = s.Wait(context.Background(), timeout)
+	if err != nil {
+		return so.ProcessStopResult{Stage: so.PROC_STOP_NONE, Unsupported: unsupported}, err
+	}
+	if !exited {
+		return so.ProcessStopResult{Stage: so.PROC_STOP_NONE, Unsupported: unsupported}, ErrProcessStillRunning
+	}
+	return so.ProcessStopResult{Stage: so.PROC_STOP_TERMINATE, ExitCode: code, Unsupported: unsupported}, nil
+}
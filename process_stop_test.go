@@ -0,0 +1,161 @@
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// fakeStopper simulates a process that exits in response to the signals in
+// exitOn, recording the calls made to it.
+type fakeStopper struct {
+	hasWindows bool
+	hasConsole bool
+	// unsupported names the signals that can't be sent.
+	unsupported string
+	exitOn      string
+	exitCode    uint32
+	ignoreKill  bool
+
+	exited bool
+	calls  []string
+}
+
+func (f *fakeStopper) signal(name string, present bool) (bool, error) {
+	f.calls = append(f.calls, name)
+	if f.unsupported == name {
+		return false, errStopStageUnsupported
+	}
+	if !present {
+		return false, nil
+	}
+	if f.exitOn == name {
+		f.exited = true
+	}
+	return true, nil
+}
+
+func (f *fakeStopper) CloseWindows() (bool, error) { return f.signal("close", f.hasWindows) }
+func (f *fakeStopper) CtrlBreak() (bool, error)    { return f.signal("break", f.hasConsole) }
+
+func (f *fakeStopper) Wait(ctx context.Context, timeout time.Duration) (uint32, bool, error) {
+	f.calls = append(f.calls, fmt.Sprintf("wait %s", timeout))
+	return f.exitCode, f.exited, nil
+}
+
+func (f *fakeStopper) Terminate(exitCode uint32) error {
+	f.calls = append(f.calls, fmt.Sprintf("terminate %d", exitCode))
+	if !f.ignoreKill {
+		f.exited = true
+		f.exitCode = exitCode
+	}
+	return nil
+}
+
+func TestStopProcessStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		stopper *fakeStopper
+		opts    ProcessStopOptions
+		want    so.ProcessStopResult
+		calls   []string
+	}{
+		{
+			name:    "already exited",
+			stopper: &fakeStopper{exited: true, exitCode: 3},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_ALREADY_EXITED, ExitCode: 3},
+			calls:   []string{"wait 0s"},
+		},
+		{
+			name:    "closes on WM_CLOSE",
+			stopper: &fakeStopper{hasWindows: true, exitOn: "close"},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_CLOSE_WINDOWS},
+			calls:   []string{"wait 0s", "close", "wait 5s"},
+		},
+		{
+			name:    "console app without windows",
+			stopper: &fakeStopper{hasConsole: true, exitOn: "break", exitCode: 0xC000013A},
+			opts:    ProcessStopOptions{StageTimeout: time.Second},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_CTRL_BREAK, ExitCode: 0xC000013A},
+			calls:   []string{"wait 0s", "close", "break", "wait 1s"},
+		},
+		{
+			name:    "ignores polite requests",
+			stopper: &fakeStopper{hasWindows: true, hasConsole: true},
+			opts:    ProcessStopOptions{StageTimeout: time.Second, ExitCode: 1},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_TERMINATE, ExitCode: 1},
+			calls:   []string{"wait 0s", "close", "wait 1s", "break", "wait 1s", "terminate 1", "wait 1s"},
+		},
+		{
+			name:    "skipped stages",
+			stopper: &fakeStopper{hasWindows: true, exitOn: "close"},
+			opts:    ProcessStopOptions{SkipCloseWindows: true, SkipCtrlBreak: true, ExitCode: 9},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_TERMINATE, ExitCode: 9},
+			calls:   []string{"wait 0s", "terminate 9", "wait 5s"},
+		},
+		{
+			name:    "windows out of reach",
+			stopper: &fakeStopper{hasWindows: true, hasConsole: true, exitOn: "break", unsupported: "close"},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_CTRL_BREAK, Unsupported: []uint32{so.PROC_STOP_CLOSE_WINDOWS}},
+			calls:   []string{"wait 0s", "close", "break", "wait 5s"},
+		},
+		{
+			name:    "console of our own",
+			stopper: &fakeStopper{hasConsole: true, exitOn: "break", unsupported: "break"},
+			opts:    ProcessStopOptions{ExitCode: 2},
+			want:    so.ProcessStopResult{Stage: so.PROC_STOP_TERMINATE, ExitCode: 2, Unsupported: []uint32{so.PROC_STOP_CTRL_BREAK}},
+			calls:   []string{"wait 0s", "close", "break", "terminate 2", "wait 5s"},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := stopProcess(context.Background(), tt.stopper, tt.opts)
+		if err != nil {
+			t.Errorf("%s: stopProcess: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: result = %+v (%s), want %+v", tt.name, got, got.GetStage(), tt.want)
+		}
+		if !reflect.DeepEqual(tt.stopper.calls, tt.calls) {
+			t.Errorf("%s: calls = %v, want %v", tt.name, tt.stopper.calls, tt.calls)
+		}
+	}
+}
+
+func TestStopProcessNoTerminate(t *testing.T) {
+	f := &fakeStopper{hasWindows: true}
+	res, err := stopProcess(context.Background(), f, ProcessStopOptions{NoTerminate: true})
+	if err != ErrProcessStillRunning || res.Stage != so.PROC_STOP_NONE {
+		t.Errorf("stopProcess = %+v, %v", res, err)
+	}
+	for _, c := range f.calls {
+		if c == "terminate 0" {
+			t.Errorf("process terminated despite NoTerminate")
+		}
+	}
+
+	f = &fakeStopper{ignoreKill: true}
+	if _, err := stopProcess(context.Background(), f, ProcessStopOptions{}); err != ErrProcessStillRunning {
+		t.Errorf("expected ErrProcessStillRunning when termination doesn't take, got %v", err)
+	}
+}
+
+func TestStopProcessContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// With the context already done the polite stages are skipped entirely.
+	f := &fakeStopper{hasWindows: true, hasConsole: true, exitOn: "close"}
+	res, err := stopProcess(ctx, f, ProcessStopOptions{ExitCode: 5})
+	if err != nil || res.Stage != so.PROC_STOP_TERMINATE || res.ExitCode != 5 {
+		t.Errorf("stopProcess = %+v, %v", res, err)
+	}
+	if want := []string{"wait 0s", "terminate 5", "wait 5s"}; !reflect.DeepEqual(f.calls, want) {
+		t.Errorf("calls = %v, want %v", f.calls, want)
+	}
+}
@@ -0,0 +1,195 @@
+package winapi
+
+import (
+	"fmt"
+	"sort"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// ProcessTree links a process list by parent PID.
+//
+// Windows reuses PIDs, so a process's parent PID may now belong to an
+// unrelated process started after it exited. When creation times were
+// collected (PROC_FIELD_TIMES), a "parent" created after its child is
+// recognised as such and the child is treated as a root instead.
+type ProcessTree struct {
+	procs    map[int]so.Process
+	parent   map[int]int
+	children map[int][]int
+	roots    []int
+}
+
+// NewProcessTree builds a ProcessTree from a process list, such as the one
+// returned by ProcessListFields(so.PROC_FIELD_TIMES).
+func NewProcessTree(procs []so.Process) *ProcessTree {
+	t := &ProcessTree{
+		procs:    make(map[int]so.Process, len(procs)),
+		parent:   make(map[int]int),
+		children: make(map[int][]int),
+	}
+	for _, p := range procs {
+		t.procs[p.Pid] = p
+	}
+
+	pids := make([]int, 0, len(t.procs))
+	for pid := range t.procs {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		p := t.procs[pid]
+		parent, ok := t.procs[p.Ppid]
+		if !ok || p.Ppid == p.Pid || !isParentOf(parent, p) {
+			t.roots = append(t.roots, pid)
+			continue
+		}
+		t.parent[pid] = p.Ppid
+		t.children[p.Ppid] = append(t.children[p.Ppid], pid)
+	}
+
+	// Without creation times, PID reuse can produce cycles; break them so
+	// every process is reachable from a root.
+	reached := make(map[int]bool, len(t.procs))
+	for _, root := range t.roots {
+		t.walk(root, func(pid int) { reached[pid] = true })
+	}
+	for _, pid := range pids {
+		if reached[pid] {
+			continue
+		}
+		t.unlink(pid)
+		t.roots = append(t.roots, pid)
+		t.walk(pid, func(pid int) { reached[pid] = true })
+	}
+	sort.Ints(t.roots)
+
+	return t
+}
+
+// isParentOf reports whether parent can be child's parent, i.e. it wasn't
+// created after child. Processes without creation times are given the
+// benefit of the doubt.
+func isParentOf(parent, child so.Process) bool {
+	if parent.CreationTime.IsZero() || child.CreationTime.IsZero() {
+		return true
+	}
+	return !parent.CreationTime.After(child.CreationTime)
+}
+
+func (t *ProcessTree) unlink(pid int) {
+	ppid, ok := t.parent[pid]
+	if !ok {
+		return
+	}
+	delete(t.parent, pid)
+	siblings := t.children[ppid]
+	for i, c := range siblings {
+		if c == pid {
+			t.children[ppid] = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+}
+
+// walk visits pid and its descendants depth first, parents before children.
+func (t *ProcessTree) walk(pid int, fn func(pid int)) {
+	seen := make(map[int]bool)
+	var visit func(pid int)
+	visit = func(pid int) {
+		if seen[pid] {
+			return
+		}
+		seen[pid] = true
+		fn(pid)
+		for _, c := range t.children[pid] {
+			visit(c)
+		}
+	}
+	visit(pid)
+}
+
+func (t *ProcessTree) list(pids []int) []so.Process {
+	retVal := make([]so.Process, 0, len(pids))
+	for _, pid := range pids {
+		retVal = append(retVal, t.procs[pid])
+	}
+	return retVal
+}
+
+// Get returns the process with the given PID.
+func (t *ProcessTree) Get(pid int) (so.Process, bool) {
+	p, ok := t.procs[pid]
+	return p, ok
+}
+
+// Roots returns the processes without a (live) parent, ordered by PID.
+func (t *ProcessTree) Roots() []so.Process {
+	return t.list(t.roots)
+}
+
+// Parent returns the parent of the process with the given PID, if it is still
+// running.
+func (t *ProcessTree) Parent(pid int) (so.Process, bool) {
+	ppid, ok := t.parent[pid]
+	if !ok {
+		return so.Process{}, false
+	}
+	return t.procs[ppid], true
+}
+
+// Children returns the direct children of the process with the given PID.
+func (t *ProcessTree) Children(pid int) []so.Process {
+	return t.list(t.children[pid])
+}
+
+// Ancestors returns the parent, grandparent and so on of the process with the
+// given PID, nearest first.
+func (t *ProcessTree) Ancestors(pid int) []so.Process {
+	retVal := make([]so.Process, 0)
+	for {
+		ppid, ok := t.parent[pid]
+		if !ok {
+			return retVal
+		}
+		retVal = append(retVal, t.procs[ppid])
+		pid = ppid
+	}
+}
+
+// Descendants returns all processes below the one with the given PID, depth
+// first with every process listed before its own children.
+func (t *ProcessTree) Descendants(pid int) []so.Process {
+	pids := make([]int, 0)
+	t.walk(pid, func(p int) {
+		if p != pid {
+			pids = append(pids, p)
+		}
+	})
+	return t.list(pids)
+}
+
+// killTree terminates the process with the given PID and its descendants
+// using kill, children before their parents so that none are re-parented
+// mid-way. Every process is attempted even if others fail.
+func killTree(t *ProcessTree, pid int, kill func(so.Process) error) ([]so.ProcessKillResult, error) {
+	root, ok := t.Get(pid)
+	if !ok {
+		return nil, fmt.Errorf("Process %d not found", pid)
+	}
+
+	order := append([]so.Process{root}, t.Descendants(pid)...)
+	retVal := make([]so.ProcessKillResult, 0, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		p := order[i]
+		res := so.ProcessKillResult{Pid: p.Pid, Executable: p.Executable}
+		if err := kill(p); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Killed = true
+		}
+		retVal = append(retVal, res)
+	}
+	return retVal, nil
+}
@@ -0,0 +1,129 @@
+package winapi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var treeEpoch = time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+
+func proc(pid, ppid int, exe string, startedMin int) so.Process {
+	p := so.Process{Pid: pid, Ppid: ppid, Executable: exe}
+	if startedMin >= 0 {
+		p.CreationTime = treeEpoch.Add(time.Duration(startedMin) * time.Minute)
+		p.Fields = so.PROC_FIELD_TIMES
+	}
+	return p
+}
+
+func pids(procs []so.Process) []int {
+	retVal := make([]int, 0, len(procs))
+	for _, p := range procs {
+		retVal = append(retVal, p.Pid)
+	}
+	return retVal
+}
+
+func newTestTree() *ProcessTree {
+	return NewProcessTree([]so.Process{
+		proc(0, 0, "[System Process]", -1),
+		proc(4, 0, "System", 0),
+		proc(600, 4, "wininit.exe", 1),
+		proc(700, 600, "services.exe", 1),
+		proc(1200, 700, "msiexec.exe", 10),
+		proc(1300, 1200, "msiexec.exe", 11),
+		proc(1400, 1300, "setup.exe", 12),
+		proc(1500, 1400, "vcredist.exe", 13),
+		proc(1600, 1300, "cmd.exe", 14),
+		// 2000's parent PID 1800 exited and was reused by a newer process.
+		proc(1800, 700, "notepad.exe", 30),
+		proc(2000, 1800, "explorer.exe", 5),
+		proc(2100, 2000, "chrome.exe", 20),
+	})
+}
+
+func TestProcessTreeQueries(t *testing.T) {
+	tree := newTestTree()
+
+	if got, want := pids(tree.Roots()), []int{0, 2000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Roots = %v, want %v", got, want)
+	}
+	if got, want := pids(tree.Children(1300)), []int{1400, 1600}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Children(1300) = %v, want %v", got, want)
+	}
+	if got, want := pids(tree.Ancestors(1500)), []int{1400, 1300, 1200, 700, 600, 4, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Ancestors(1500) = %v, want %v", got, want)
+	}
+	if got, want := pids(tree.Descendants(1200)), []int{1300, 1400, 1500, 1600}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Descendants(1200) = %v, want %v", got, want)
+	}
+
+	// PID reuse: explorer.exe predates the current holder of its parent PID.
+	if p, ok := tree.Parent(2000); ok {
+		t.Errorf("explorer.exe should have no parent, got %+v", p)
+	}
+	if got := pids(tree.Descendants(1800)); len(got) != 0 {
+		t.Errorf("reused PID should have no descendants, got %v", got)
+	}
+	if got, want := pids(tree.Descendants(2000)), []int{2100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Descendants(2000) = %v, want %v", got, want)
+	}
+}
+
+func TestProcessTreeCycleWithoutTimes(t *testing.T) {
+	// Without creation times PID reuse can make processes each other's parent.
+	tree := NewProcessTree([]so.Process{
+		proc(10, 20, "a.exe", -1),
+		proc(20, 10, "b.exe", -1),
+		proc(30, 20, "c.exe", -1),
+	})
+	if got, want := pids(tree.Roots()), []int{10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Roots = %v, want %v", got, want)
+	}
+	if got, want := pids(tree.Descendants(10)), []int{20, 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Descendants(10) = %v, want %v", got, want)
+	}
+	if got := pids(tree.Ancestors(30)); !reflect.DeepEqual(got, []int{20, 10}) {
+		t.Errorf("Ancestors(30) = %v", got)
+	}
+}
+
+func TestKillTree(t *testing.T) {
+	tree := newTestTree()
+	killed := make([]int, 0)
+	results, err := killTree(tree, 1200, func(p so.Process) error {
+		if p.Pid == 1400 {
+			return fmt.Errorf("access denied")
+		}
+		killed = append(killed, p.Pid)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("killTree: %v", err)
+	}
+
+	// Every child is terminated before its parent.
+	if want := []int{1600, 1500, 1300, 1200}; !reflect.DeepEqual(killed, want) {
+		t.Errorf("kill order = %v, want %v", killed, want)
+	}
+	if len(results) != 5 {
+		t.Fatalf("expected 5 results, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Pid == 1400 {
+			if r.Killed || r.Error != "access denied" || r.Executable != "setup.exe" {
+				t.Errorf("unexpected result for failed kill: %+v", r)
+			}
+		} else if !r.Killed || r.Error != "" {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	}
+
+	if _, err := killTree(tree, 9999, func(so.Process) error { return nil }); err == nil {
+		t.Errorf("expected error for unknown PID")
+	}
+}
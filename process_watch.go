@@ -0,0 +1,229 @@
+package winapi
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// DefaultProcessWatchInterval is used when ProcessWatchOptions.Interval is
+// zero.
+const DefaultProcessWatchInterval = 2 * time.Second
+
+// A ProcessSnapshotSource lists the running processes for a ProcessWatcher.
+// Processes should have their creation times (PROC_FIELD_TIMES), so a reused
+// PID is seen as a new process.
+type ProcessSnapshotSource interface {
+	ProcessSnapshot() ([]so.Process, error)
+}
+
+// ProcessSnapshotFunc adapts a function to a ProcessSnapshotSource.
+type ProcessSnapshotFunc func() ([]so.Process, error)
+
+func (f ProcessSnapshotFunc) ProcessSnapshot() ([]so.Process, error) {
+	return f()
+}
+
+// ProcessWatchOptions configures WatchProcesses.
+type ProcessWatchOptions struct {
+	// Interval between snapshots.
+	Interval time.Duration
+	// Source defaults to ProcessListFields(so.PROC_FIELD_TIMES).
+	Source ProcessSnapshotSource
+	// UseWMI reports processes starting as they do via Win32_ProcessStartTrace,
+	// when it's available (it requires administrator rights), with snapshots
+	// still used for exits and anything WMI misses.
+	UseWMI bool
+	// IncludeExisting emits a Started event for every process in the first
+	// snapshot, rather than taking it as the baseline.
+	IncludeExisting bool
+	// OnError is called with errors from the snapshot source or WMI. The
+	// watcher carries on regardless.
+	OnError func(error)
+	// BufferSize of the events channel, 64 if zero.
+	BufferSize int
+}
+
+// ProcessWatcher emits ProcessEvents until its context is done, at which point
+// the events channel is closed.
+type ProcessWatcher struct {
+	events chan so.ProcessEvent
+}
+
+// Events returns the channel events are delivered on.
+func (w *ProcessWatcher) Events() <-chan so.ProcessEvent {
+	return w.events
+}
+
+// newProcessWatcher starts a watcher polling opts.Source, which must be set.
+// Processes received on starts, from an event based source such as WMI, are
+// reported immediately and not again when they appear in a snapshot.
+func newProcessWatcher(ctx context.Context, opts ProcessWatchOptions, starts <-chan so.Process) *ProcessWatcher {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultProcessWatchInterval
+	}
+	size := opts.BufferSize
+	if size <= 0 {
+		size = 64
+	}
+	w := &ProcessWatcher{events: make(chan so.ProcessEvent, size)}
+
+	go func() {
+		defer close(w.events)
+
+		emit := func(events []so.ProcessEvent) bool {
+			for _, ev := range events {
+				select {
+				case w.events <- ev:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+		snapshot := func() ([]so.Process, bool) {
+			procs, err := opts.Source.ProcessSnapshot()
+			if err != nil {
+				if opts.OnError != nil {
+					opts.OnError(err)
+				}
+				return nil, false
+			}
+			return procs, true
+		}
+
+		state := newProcessWatchState()
+		baselined := false
+		if procs, ok := snapshot(); ok {
+			events := state.diff(procs, time.Now())
+			baselined = true
+			if opts.IncludeExisting && !emit(events) {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case p, ok := <-starts:
+				if !ok {
+					starts = nil
+					continue
+				}
+				if state.observeStart(p) && !emit([]so.ProcessEvent{{Type: so.PROC_EVENT_STARTED, Process: p, Time: time.Now()}}) {
+					return
+				}
+			case <-ticker.C:
+				procs, ok := snapshot()
+				if !ok {
+					continue
+				}
+				events := state.diff(procs, time.Now())
+				// Until a first snapshot succeeds, everything would look new.
+				if !baselined {
+					baselined = true
+					if !opts.IncludeExisting {
+						continue
+					}
+				}
+				if !emit(events) {
+					return
+				}
+			}
+		}
+	}()
+
+	return w
+}
+
+// processWatchState diffs successive snapshots, keyed by PID and creation
+// time.
+type processWatchState struct {
+	known    map[int]so.Process
+	reported map[int]so.Process
+}
+
+func newProcessWatchState() *processWatchState {
+	return &processWatchState{
+		known:    make(map[int]so.Process),
+		reported: make(map[int]so.Process),
+	}
+}
+
+// sameProcess reports whether a and b are the same process, rather than two
+// holders of a reused PID. Processes without creation times are matched on
+// PID alone.
+func sameProcess(a, b so.Process) bool {
+	if a.Pid != b.Pid {
+		return false
+	}
+	if a.CreationTime.IsZero() || b.CreationTime.IsZero() {
+		return true
+	}
+	return a.CreationTime.Equal(b.CreationTime)
+}
+
+// observeStart records a start reported outside of snapshots, returning false
+// if the process is already known from one.
+func (s *processWatchState) observeStart(p so.Process) bool {
+	if _, ok := s.known[p.Pid]; ok {
+		return false
+	}
+	if _, ok := s.reported[p.Pid]; ok {
+		return false
+	}
+	s.reported[p.Pid] = p
+	return true
+}
+
+// diff returns the events between the last snapshot and procs, exits first,
+// each ordered by PID.
+func (s *processWatchState) diff(procs []so.Process, now time.Time) []so.ProcessEvent {
+	current := make(map[int]so.Process, len(procs))
+	for _, p := range procs {
+		current[p.Pid] = p
+	}
+
+	exited := make([]so.Process, 0)
+	for pid, old := range s.known {
+		if p, ok := current[pid]; !ok || !sameProcess(old, p) {
+			exited = append(exited, old)
+		}
+	}
+	// A reported process may have come and gone between snapshots.
+	for pid, p := range s.reported {
+		if _, ok := current[pid]; !ok {
+			exited = append(exited, p)
+		}
+	}
+	started := make([]so.Process, 0)
+	for pid, p := range current {
+		if old, ok := s.known[pid]; ok && sameProcess(old, p) {
+			continue
+		}
+		if _, ok := s.reported[pid]; ok {
+			continue
+		}
+		started = append(started, p)
+	}
+	sort.Slice(exited, func(i, j int) bool { return exited[i].Pid < exited[j].Pid })
+	sort.Slice(started, func(i, j int) bool { return started[i].Pid < started[j].Pid })
+
+	events := make([]so.ProcessEvent, 0, len(exited)+len(started))
+	for _, p := range exited {
+		events = append(events, so.ProcessEvent{Type: so.PROC_EVENT_EXITED, Process: p, Time: now})
+	}
+	for _, p := range started {
+		events = append(events, so.ProcessEvent{Type: so.PROC_EVENT_STARTED, Process: p, Time: now})
+	}
+
+	s.known = current
+	s.reported = make(map[int]so.Process)
+	return events
+}
@@ -0,0 +1,187 @@
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// scriptedSnapshots returns each snapshot in turn, then repeats the last.
+type scriptedSnapshots struct {
+	mu    sync.Mutex
+	steps []func() ([]so.Process, error)
+	calls int
+}
+
+func (s *scriptedSnapshots) ProcessSnapshot() ([]so.Process, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.calls
+	if i >= len(s.steps) {
+		i = len(s.steps) - 1
+	}
+	s.calls++
+	return s.steps[i]()
+}
+
+func snap(procs ...so.Process) func() ([]so.Process, error) {
+	return func() ([]so.Process, error) { return procs, nil }
+}
+
+func failSnap() ([]so.Process, error) {
+	return nil, fmt.Errorf("snapshot failed")
+}
+
+type eventSummary struct {
+	Type string
+	Pid  int
+	Exe  string
+}
+
+func summarise(events []so.ProcessEvent) []eventSummary {
+	retVal := make([]eventSummary, 0, len(events))
+	for _, ev := range events {
+		retVal = append(retVal, eventSummary{ev.GetType(), ev.Process.Pid, ev.Process.Executable})
+	}
+	return retVal
+}
+
+func collect(t *testing.T, w *ProcessWatcher, n int) []so.ProcessEvent {
+	events := make([]so.ProcessEvent, 0, n)
+	timeout := time.After(5 * time.Second)
+	for len(events) < n {
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("events channel closed after %d events", len(events))
+			}
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("timed out after %d events: %+v", len(events), summarise(events))
+		}
+	}
+	return events
+}
+
+func TestProcessWatchStateDiff(t *testing.T) {
+	s := newProcessWatchState()
+	if ev := s.diff([]so.Process{proc(4, 0, "System", 0), proc(100, 4, "a.exe", 1)}, treeEpoch); len(ev) != 2 {
+		t.Fatalf("first diff should report everything as started, got %+v", summarise(ev))
+	}
+
+	got := summarise(s.diff([]so.Process{
+		proc(4, 0, "System", 0),
+		proc(100, 4, "b.exe", 5), // PID 100 reused
+		proc(200, 4, "c.exe", 6),
+	}, treeEpoch))
+	want := []eventSummary{
+		{"EXITED", 100, "a.exe"},
+		{"STARTED", 100, "b.exe"},
+		{"STARTED", 200, "c.exe"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %+v, want %+v", got, want)
+	}
+
+	if ev := s.diff([]so.Process{proc(4, 0, "System", 0), proc(100, 4, "b.exe", 5), proc(200, 4, "c.exe", 6)}, treeEpoch); len(ev) != 0 {
+		t.Errorf("unchanged snapshot produced events: %+v", summarise(ev))
+	}
+}
+
+func TestProcessWatchStateObservedStarts(t *testing.T) {
+	s := newProcessWatchState()
+	s.diff([]so.Process{proc(4, 0, "System", 0)}, treeEpoch)
+
+	if s.observeStart(so.Process{Pid: 4}) {
+		t.Errorf("start of a known process should be ignored")
+	}
+	if !s.observeStart(so.Process{Pid: 300, Executable: "quick.exe"}) || !s.observeStart(so.Process{Pid: 400, Executable: "slow.exe"}) {
+		t.Fatalf("new processes should be reported")
+	}
+	if s.observeStart(so.Process{Pid: 300}) {
+		t.Errorf("duplicate start should be ignored")
+	}
+
+	// slow.exe is still running and isn't reported again; quick.exe exited
+	// before the snapshot, which is the only way its exit is seen.
+	got := summarise(s.diff([]so.Process{proc(4, 0, "System", 0), proc(400, 4, "slow.exe", 3)}, treeEpoch))
+	want := []eventSummary{{"EXITED", 300, "quick.exe"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %+v, want %+v", got, want)
+	}
+}
+
+func TestProcessWatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var errs []error
+	var errMu sync.Mutex
+	src := &scriptedSnapshots{steps: []func() ([]so.Process, error){
+		snap(proc(4, 0, "System", 0), proc(100, 4, "svc.exe", 1)),
+		failSnap, // must not be mistaken for every process exiting
+		snap(proc(4, 0, "System", 0), proc(100, 4, "svc.exe", 1), proc(500, 100, "worker.exe", 9)),
+		snap(proc(4, 0, "System", 0), proc(500, 100, "worker.exe", 9)),
+	}}
+	w := newProcessWatcher(ctx, ProcessWatchOptions{
+		Source:   src,
+		Interval: 5 * time.Millisecond,
+		OnError: func(err error) {
+			errMu.Lock()
+			errs = append(errs, err)
+			errMu.Unlock()
+		},
+	}, nil)
+
+	got := summarise(collect(t, w, 2))
+	want := []eventSummary{{"STARTED", 500, "worker.exe"}, {"EXITED", 100, "svc.exe"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+
+	cancel()
+	for range w.Events() {
+	}
+	errMu.Lock()
+	if len(errs) != 1 {
+		t.Errorf("expected 1 snapshot error, got %v", errs)
+	}
+	errMu.Unlock()
+}
+
+func TestProcessWatcherIncludeExistingAndStarts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	starts := make(chan so.Process, 1)
+	src := &scriptedSnapshots{steps: []func() ([]so.Process, error){
+		snap(proc(4, 0, "System", 0)),
+	}}
+	w := newProcessWatcher(ctx, ProcessWatchOptions{Source: src, Interval: time.Hour, IncludeExisting: true}, starts)
+
+	first := summarise(collect(t, w, 1))
+	if want := []eventSummary{{"STARTED", 4, "System"}}; !reflect.DeepEqual(first, want) {
+		t.Errorf("existing = %+v, want %+v", first, want)
+	}
+
+	starts <- so.Process{Pid: 700, Executable: "notepad.exe"}
+	got := collect(t, w, 1)
+	if got[0].Type != so.PROC_EVENT_STARTED || got[0].Process.Pid != 700 {
+		t.Errorf("event from starts = %+v", got[0])
+	}
+
+	cancel()
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Errorf("unexpected event after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("events channel not closed after cancel")
+	}
+}
@@ -0,0 +1,171 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+	"github.com/scjalliance/comshim"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+const (
+	// wbemErrTimedout is returned by SWbemEventSource.NextEvent when no event
+	// arrived within the timeout.
+	wbemErrTimedout = 0x80043001
+
+	// How long each NextEvent call blocks, bounding how long the WMI
+	// goroutine takes to notice its context is done.
+	wmiEventPollMilliseconds = 500
+)
+
+// WatchProcesses starts a ProcessWatcher, which emits an event as each process
+// starts or exits until ctx is done.
+//
+// If opts.UseWMI is set but Win32_ProcessStartTrace can't be subscribed to,
+// the error is passed to opts.OnError and the watcher relies on snapshots
+// alone.
+func WatchProcesses(ctx context.Context, opts ProcessWatchOptions) *ProcessWatcher {
+	if opts.Source == nil {
+		opts.Source = ProcessSnapshotFunc(func() ([]so.Process, error) {
+			return ProcessListFields(so.PROC_FIELD_TIMES)
+		})
+	}
+
+	var starts <-chan so.Process
+	if opts.UseWMI {
+		ch, err := watchProcessStartTrace(ctx)
+		if err != nil {
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+		} else {
+			starts = ch
+		}
+	}
+
+	return newProcessWatcher(ctx, opts, starts)
+}
+
+// watchProcessStartTrace subscribes to Win32_ProcessStartTrace, delivering the
+// started processes on the returned channel until ctx is done. The channel is
+// closed if the subscription fails later on.
+// See: https://docs.microsoft.com/en-us/previous-versions/windows/desktop/krnlprov/win32-processstarttrace
+func watchProcessStartTrace(ctx context.Context) (<-chan so.Process, error) {
+	starts := make(chan so.Process, 64)
+	errc := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		comshim.Add(1)
+		defer comshim.Done()
+
+		unknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
+		if err != nil {
+			errc <- fmt.Errorf("Unable to create initial object, %s", err.Error())
+			return
+		}
+		defer unknown.Release()
+		wmi, err := unknown.QueryInterface(ole.IID_IDispatch)
+		if err != nil {
+			errc <- fmt.Errorf("Unable to create query interface, %s", err.Error())
+			return
+		}
+		defer wmi.Release()
+
+		serviceRaw, err := oleutil.CallMethod(wmi, "ConnectServer")
+		if err != nil {
+			errc <- fmt.Errorf("Error Connecting to WMI Service, %s", err.Error())
+			return
+		}
+		service := serviceRaw.ToIDispatch()
+		defer service.Release()
+
+		sourceRaw, err := oleutil.CallMethod(service, "ExecNotificationQuery", "SELECT ProcessID, ParentProcessID, ProcessName, SessionID FROM Win32_ProcessStartTrace")
+		if err != nil {
+			errc <- fmt.Errorf("Unable to subscribe to Win32_ProcessStartTrace, %s", err.Error())
+			return
+		}
+		source := sourceRaw.ToIDispatch()
+		defer source.Release()
+
+		errc <- nil
+		defer close(starts)
+
+		for ctx.Err() == nil {
+			eventRaw, err := oleutil.CallMethod(source, "NextEvent", wmiEventPollMilliseconds)
+			if err != nil {
+				if isWbemTimeout(err) {
+					continue
+				}
+				return
+			}
+			// Clearing the VARIANT releases the event it holds.
+			p, err := processFromStartTrace(eventRaw.ToIDispatch())
+			eventRaw.Clear()
+			if err != nil {
+				continue
+			}
+
+			select {
+			case starts <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return starts, nil
+}
+
+func isWbemTimeout(err error) bool {
+	oleErr, ok := err.(*ole.OleError)
+	if !ok {
+		return false
+	}
+	if info, ok := oleErr.SubError().(ole.EXCEPINFO); ok {
+		return info.SCODE() == wbemErrTimedout
+	}
+	return uint32(oleErr.Code()) == wbemErrTimedout
+}
+
+func processFromStartTrace(event *ole.IDispatch) (so.Process, error) {
+	pid, err := oleutil.GetProperty(event, "ProcessID")
+	if err != nil {
+		return so.Process{}, err
+	}
+	defer pid.Clear()
+	ppid, err := oleutil.GetProperty(event, "ParentProcessID")
+	if err != nil {
+		return so.Process{}, err
+	}
+	defer ppid.Clear()
+	name, err := oleutil.GetProperty(event, "ProcessName")
+	if err != nil {
+		return so.Process{}, err
+	}
+	defer name.Clear()
+	session, err := oleutil.GetProperty(event, "SessionID")
+	if err != nil {
+		return so.Process{}, err
+	}
+	defer session.Clear()
+
+	return so.Process{
+		Pid:        int(uint32(pid.Val)),
+		Ppid:       int(uint32(ppid.Val)),
+		Executable: name.ToString(),
+		Fields:     so.PROC_FIELD_SESSION,
+		SessionID:  uint32(session.Val),
+	}, nil
+}
@@ -0,0 +1,670 @@
+package winapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Registry value types.
+// See: https://docs.microsoft.com/en-us/windows/win32/sysinfo/registry-value-types
+const (
+	REG_NONE                       = 0
+	REG_SZ                         = 1
+	REG_EXPAND_SZ                  = 2
+	REG_BINARY                     = 3
+	REG_DWORD                      = 4
+	REG_DWORD_BIG_ENDIAN           = 5
+	REG_LINK                       = 6
+	REG_MULTI_SZ                   = 7
+	REG_RESOURCE_LIST              = 8
+	REG_FULL_RESOURCE_DESCRIPTOR   = 9
+	REG_RESOURCE_REQUIREMENTS_LIST = 10
+	REG_QWORD                      = 11
+)
+
+// Hive file layout: a 4KB base block followed by hive bins, each starting
+// with a 32 byte header and holding cells. Cells are referred to by their
+// offset from the first hive bin, and start with their size, negated while
+// the cell is in use.
+// See: https://github.com/msuhanov/regf/blob/master/Windows%20registry%20file%20format%20specification.md
+const (
+	regfSignature       = "regf"
+	regfBinSignature    = "hbin"
+	regfBaseBlockSize   = 4096
+	regfBinHeaderSize   = 32
+	regfNoCell          = 0xffffffff
+	regfBigDataSegment  = 16344
+	regfBigDataMinor    = 4
+	regfKeyCompName     = 0x0020
+	regfValueCompName   = 0x0001
+	regfValueDataInline = 0x80000000
+	regfKeyHeaderSize   = 76
+	regfValueHeaderSize = 20
+)
+
+// ErrHiveNotExist is returned for keys and values that aren't in a hive.
+var ErrHiveNotExist = errors.New("the key or value does not exist in the hive")
+
+// HiveHeader is the base block of a hive file. A hive that wasn't written
+// out cleanly, such as one copied while loaded, has different sequence
+// numbers, and changes still in its transaction logs are missing.
+type HiveHeader struct {
+	PrimarySequence   uint32
+	SecondarySequence uint32
+	LastWritten       time.Time
+	MajorVersion      uint32
+	MinorVersion      uint32
+	RootCell          uint32
+	HiveBinsSize      uint32
+	FileName          string
+}
+
+// Dirty reports whether the hive was being written when it was copied.
+func (h *HiveHeader) Dirty() bool {
+	return h.PrimarySequence != h.SecondarySequence
+}
+
+// Hive reads a registry hive file, such as SOFTWARE or NTUSER.DAT, without
+// loading it into the registry, so it works on hives of other machines and
+// on any operating system.
+type Hive struct {
+	r      io.ReaderAt
+	closer io.Closer
+	header HiveHeader
+}
+
+// HiveKey is a key in a hive.
+type HiveKey struct {
+	Name        string
+	LastWritten time.Time
+
+	hive        *Hive
+	subkeyCount uint32
+	subkeyList  uint32
+	valueCount  uint32
+	valueList   uint32
+}
+
+// HiveValue is a value of a key in a hive, with its data as stored. The
+// default value of a key has an empty name.
+type HiveValue struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// NewHive reads the base block of the hive in r.
+func NewHive(r io.ReaderAt) (*Hive, error) {
+	buf := make([]byte, regfBaseBlockSize+regfBinHeaderSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("Unable to read hive header: %s", err)
+	}
+	header, err := decodeHiveHeader(buf[:regfBaseBlockSize])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf[regfBaseBlockSize:regfBaseBlockSize+4], []byte(regfBinSignature)) {
+		return nil, fmt.Errorf("Hive has no hive bins")
+	}
+	return &Hive{r: r, header: header}, nil
+}
+
+// OpenHive opens the hive file at path. Hives loaded on a running system are
+// locked, so can only be read from a copy or a volume shadow copy.
+func OpenHive(path string) (*Hive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := NewHive(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Unable to read hive %s: %s", path, err)
+	}
+	h.closer = f
+	return h, nil
+}
+
+// Close closes the file of a hive opened with OpenHive.
+func (h *Hive) Close() error {
+	if h.closer == nil {
+		return nil
+	}
+	return h.closer.Close()
+}
+
+// Header returns the base block.
+func (h *Hive) Header() HiveHeader {
+	return h.header
+}
+
+// Root returns the hive's root key.
+func (h *Hive) Root() (*HiveKey, error) {
+	return h.key(h.header.RootCell)
+}
+
+// OpenKey returns the key at path, relative to the root and separated by
+// backslashes. Names are compared case insensitively, as in the registry.
+func (h *Hive) OpenKey(path string) (*HiveKey, error) {
+	root, err := h.Root()
+	if err != nil {
+		return nil, err
+	}
+	return root.OpenSubKey(path)
+}
+
+// OpenSubKey returns the key at path, relative to k.
+func (k *HiveKey) OpenSubKey(path string) (*HiveKey, error) {
+	key := k
+	for _, name := range strings.Split(path, `\`) {
+		if name == "" {
+			continue
+		}
+		sub, err := key.subKey(name)
+		if err != nil {
+			return nil, err
+		}
+		key = sub
+	}
+	return key, nil
+}
+
+// SubKeyNames returns the names of the key's subkeys.
+func (k *HiveKey) SubKeyNames() ([]string, error) {
+	keys, err := k.SubKeys()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, sk := range keys {
+		names = append(names, sk.Name)
+	}
+	return names, nil
+}
+
+// SubKeys returns the key's subkeys, in the order they're stored, which is
+// by upper case name.
+func (k *HiveKey) SubKeys() ([]*HiveKey, error) {
+	entries, err := k.subKeyEntries()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*HiveKey, 0, len(entries))
+	for _, e := range entries {
+		sk, err := k.hive.key(e.cell)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, sk)
+	}
+	return keys, nil
+}
+
+// Values returns the key's values, in the order they're stored.
+func (k *HiveKey) Values() ([]HiveValue, error) {
+	offs, err := k.valueOffsets()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]HiveValue, 0, len(offs))
+	for _, off := range offs {
+		v, err := k.hive.value(off, true)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// ValueNames returns the names of the key's values.
+func (k *HiveKey) ValueNames() ([]string, error) {
+	offs, err := k.valueOffsets()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(offs))
+	for _, off := range offs {
+		v, err := k.hive.value(off, false)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, v.Name)
+	}
+	return names, nil
+}
+
+// Value returns the named value, or ErrHiveNotExist.
+func (k *HiveKey) Value(name string) (HiveValue, error) {
+	offs, err := k.valueOffsets()
+	if err != nil {
+		return HiveValue{}, err
+	}
+	for _, off := range offs {
+		v, err := k.hive.value(off, false)
+		if err != nil {
+			return HiveValue{}, err
+		}
+		if strings.EqualFold(v.Name, name) {
+			return k.hive.value(off, true)
+		}
+	}
+	return HiveValue{}, ErrHiveNotExist
+}
+
+// GetStringValue returns the data and type of a REG_SZ or REG_EXPAND_SZ
+// value, as the registry package's Key.GetStringValue does. Environment
+// variables aren't expanded.
+func (k *HiveKey) GetStringValue(name string) (string, uint32, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return "", 0, err
+	}
+	s, err := v.StringData()
+	return s, v.Type, err
+}
+
+// GetStringsValue returns the strings of a REG_MULTI_SZ value.
+func (k *HiveKey) GetStringsValue(name string) ([]string, uint32, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	s, err := v.StringsData()
+	return s, v.Type, err
+}
+
+// GetIntegerValue returns the data of a REG_DWORD, REG_DWORD_BIG_ENDIAN or
+// REG_QWORD value.
+func (k *HiveKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := v.IntegerData()
+	return n, v.Type, err
+}
+
+// GetBinaryValue returns the data of a REG_BINARY value.
+func (k *HiveKey) GetBinaryValue(name string) ([]byte, uint32, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v.Type != REG_BINARY {
+		return nil, v.Type, fmt.Errorf("Value %s is type %d, not REG_BINARY", v.Name, v.Type)
+	}
+	return v.Data, v.Type, nil
+}
+
+// StringData decodes a REG_SZ, REG_EXPAND_SZ or REG_LINK value, up to the
+// first NUL.
+func (v *HiveValue) StringData() (string, error) {
+	if v.Type != REG_SZ && v.Type != REG_EXPAND_SZ && v.Type != REG_LINK {
+		return "", fmt.Errorf("Value %s is type %d, not a string", v.Name, v.Type)
+	}
+	s := decodeUTF16(v.Data)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return s, nil
+}
+
+// StringsData decodes a REG_MULTI_SZ value.
+func (v *HiveValue) StringsData() ([]string, error) {
+	if v.Type != REG_MULTI_SZ {
+		return nil, fmt.Errorf("Value %s is type %d, not REG_MULTI_SZ", v.Name, v.Type)
+	}
+	s := strings.TrimRight(decodeUTF16(v.Data), "\x00")
+	if s == "" {
+		return []string{}, nil
+	}
+	return strings.Split(s, "\x00"), nil
+}
+
+// IntegerData decodes a REG_DWORD, REG_DWORD_BIG_ENDIAN or REG_QWORD value.
+func (v *HiveValue) IntegerData() (uint64, error) {
+	switch {
+	case v.Type == REG_DWORD && len(v.Data) >= 4:
+		return uint64(binary.LittleEndian.Uint32(v.Data)), nil
+	case v.Type == REG_DWORD_BIG_ENDIAN && len(v.Data) >= 4:
+		return uint64(binary.BigEndian.Uint32(v.Data)), nil
+	case v.Type == REG_QWORD && len(v.Data) >= 8:
+		return binary.LittleEndian.Uint64(v.Data), nil
+	case v.Type == REG_DWORD || v.Type == REG_DWORD_BIG_ENDIAN || v.Type == REG_QWORD:
+		return 0, fmt.Errorf("Value %s has %d bytes of data, too few for its type", v.Name, len(v.Data))
+	}
+	return 0, fmt.Errorf("Value %s is type %d, not an integer", v.Name, v.Type)
+}
+
+// decodeHiveHeader decodes and checks a hive's base block.
+func decodeHiveHeader(buf []byte) (HiveHeader, error) {
+	if len(buf) < regfBaseBlockSize || !bytes.Equal(buf[:4], []byte(regfSignature)) {
+		return HiveHeader{}, fmt.Errorf("Not a registry hive")
+	}
+	if sum := hiveHeaderChecksum(buf); sum != binary.LittleEndian.Uint32(buf[508:]) {
+		return HiveHeader{}, fmt.Errorf("Hive header checksum mismatch")
+	}
+	h := HiveHeader{
+		PrimarySequence:   binary.LittleEndian.Uint32(buf[4:]),
+		SecondarySequence: binary.LittleEndian.Uint32(buf[8:]),
+		LastWritten:       fileTimeToTime(binary.LittleEndian.Uint64(buf[12:])),
+		MajorVersion:      binary.LittleEndian.Uint32(buf[20:]),
+		MinorVersion:      binary.LittleEndian.Uint32(buf[24:]),
+		RootCell:          binary.LittleEndian.Uint32(buf[36:]),
+		HiveBinsSize:      binary.LittleEndian.Uint32(buf[40:]),
+		FileName:          strings.TrimRight(decodeUTF16(buf[48:112]), "\x00"),
+	}
+	if h.MajorVersion != 1 {
+		return h, fmt.Errorf("Unsupported hive version %d.%d", h.MajorVersion, h.MinorVersion)
+	}
+	return h, nil
+}
+
+// hiveHeaderChecksum is the XOR of the base block's first 127 DWORDs, with 0
+// and -1 reserved.
+func hiveHeaderChecksum(buf []byte) uint32 {
+	var sum uint32
+	for i := 0; i < 508; i += 4 {
+		sum ^= binary.LittleEndian.Uint32(buf[i:])
+	}
+	switch sum {
+	case 0:
+		return 1
+	case 0xffffffff:
+		return 0xfffffffe
+	}
+	return sum
+}
+
+// cell returns the data of the allocated cell at off.
+func (h *Hive) cell(off uint32) ([]byte, error) {
+	if off == regfNoCell || uint64(off)+4 > uint64(h.header.HiveBinsSize) {
+		return nil, fmt.Errorf("Hive cell offset %#x is out of range", off)
+	}
+	var sz [4]byte
+	if _, err := h.r.ReadAt(sz[:], regfBaseBlockSize+int64(off)); err != nil {
+		return nil, fmt.Errorf("Unable to read hive cell at %#x: %s", off, err)
+	}
+	size := int32(binary.LittleEndian.Uint32(sz[:]))
+	if size >= 0 {
+		return nil, fmt.Errorf("Hive cell at %#x isn't in use", off)
+	}
+	n := int64(-size)
+	if n < 8 || int64(off)+n > int64(h.header.HiveBinsSize) {
+		return nil, fmt.Errorf("Hive cell at %#x has invalid size %d", off, n)
+	}
+	buf := make([]byte, n-4)
+	if _, err := h.r.ReadAt(buf, regfBaseBlockSize+int64(off)+4); err != nil {
+		return nil, fmt.Errorf("Unable to read hive cell at %#x: %s", off, err)
+	}
+	return buf, nil
+}
+
+// key decodes the key node (nk) cell at off.
+func (h *Hive) key(off uint32) (*HiveKey, error) {
+	c, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < regfKeyHeaderSize || c[0] != 'n' || c[1] != 'k' {
+		return nil, fmt.Errorf("Hive cell at %#x isn't a key", off)
+	}
+	nameLen := int(binary.LittleEndian.Uint16(c[72:]))
+	if regfKeyHeaderSize+nameLen > len(c) {
+		return nil, fmt.Errorf("Hive key at %#x has invalid name length %d", off, nameLen)
+	}
+	return &HiveKey{
+		Name:        decodeHiveName(c[regfKeyHeaderSize:regfKeyHeaderSize+nameLen], binary.LittleEndian.Uint16(c[2:])&regfKeyCompName != 0),
+		LastWritten: fileTimeToTime(binary.LittleEndian.Uint64(c[4:])),
+		hive:        h,
+		subkeyCount: binary.LittleEndian.Uint32(c[20:]),
+		subkeyList:  binary.LittleEndian.Uint32(c[28:]),
+		valueCount:  binary.LittleEndian.Uint32(c[36:]),
+		valueList:   binary.LittleEndian.Uint32(c[40:]),
+	}, nil
+}
+
+// hiveSubKeyEntry is an entry of a subkey list: the subkey's cell, and for lh
+// lists the hash of its name.
+type hiveSubKeyEntry struct {
+	cell    uint32
+	hash    uint32
+	hasHash bool
+}
+
+func (k *HiveKey) subKeyEntries() ([]hiveSubKeyEntry, error) {
+	if k.subkeyCount == 0 {
+		return []hiveSubKeyEntry{}, nil
+	}
+	entries, err := k.hive.subKeyList(k.subkeyList, false)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(entries)) != k.subkeyCount {
+		return nil, fmt.Errorf("Hive key %s lists %d subkeys, not %d", k.Name, len(entries), k.subkeyCount)
+	}
+	return entries, nil
+}
+
+// subKeyList decodes a subkey list: an index leaf (li), fast leaf (lf) or
+// hash leaf (lh) of subkeys, or an index root (ri) of leaves.
+func (h *Hive) subKeyList(off uint32, inRoot bool) ([]hiveSubKeyEntry, error) {
+	c, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < 4 {
+		return nil, fmt.Errorf("Hive subkey list at %#x is truncated", off)
+	}
+	sig := string(c[:2])
+	count := int(binary.LittleEndian.Uint16(c[2:]))
+	stride := 4
+	if sig == "lf" || sig == "lh" {
+		stride = 8
+	} else if sig != "li" && (sig != "ri" || inRoot) {
+		return nil, fmt.Errorf("Hive cell at %#x isn't a subkey list", off)
+	}
+	if 4+count*stride > len(c) {
+		return nil, fmt.Errorf("Hive subkey list at %#x is truncated", off)
+	}
+
+	entries := make([]hiveSubKeyEntry, 0, count)
+	for i := 0; i < count; i++ {
+		e := c[4+i*stride:]
+		cell := binary.LittleEndian.Uint32(e)
+		if sig == "ri" {
+			leaf, err := h.subKeyList(cell, true)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, leaf...)
+			continue
+		}
+		entry := hiveSubKeyEntry{cell: cell}
+		if sig == "lh" {
+			entry.hash, entry.hasHash = binary.LittleEndian.Uint32(e[4:]), true
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// subKey finds a subkey by name, skipping those whose hash doesn't match in
+// lh lists.
+func (k *HiveKey) subKey(name string) (*HiveKey, error) {
+	entries, err := k.subKeyEntries()
+	if err != nil {
+		return nil, err
+	}
+	hash, hashable := hiveNameHash(name)
+	for _, e := range entries {
+		if hashable && e.hasHash && e.hash != hash {
+			continue
+		}
+		sk, err := k.hive.key(e.cell)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(sk.Name, name) {
+			return sk, nil
+		}
+	}
+	return nil, ErrHiveNotExist
+}
+
+// hiveNameHash is the hash of a key name stored in lh lists, which only
+// matches strings.EqualFold for ASCII names.
+func hiveNameHash(name string) (uint32, bool) {
+	var hash uint32
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 0x80 {
+			return 0, false
+		}
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		hash = hash*37 + uint32(c)
+	}
+	return hash, true
+}
+
+func (k *HiveKey) valueOffsets() ([]uint32, error) {
+	if k.valueCount == 0 {
+		return []uint32{}, nil
+	}
+	c, err := k.hive.cell(k.valueList)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(k.valueCount)*4 > uint64(len(c)) {
+		return nil, fmt.Errorf("Hive value list of %s is truncated", k.Name)
+	}
+	offs := make([]uint32, k.valueCount)
+	for i := range offs {
+		offs[i] = binary.LittleEndian.Uint32(c[i*4:])
+	}
+	return offs, nil
+}
+
+// value decodes the key value (vk) cell at off, and its data if withData.
+func (h *Hive) value(off uint32, withData bool) (HiveValue, error) {
+	c, err := h.cell(off)
+	if err != nil {
+		return HiveValue{}, err
+	}
+	if len(c) < regfValueHeaderSize || c[0] != 'v' || c[1] != 'k' {
+		return HiveValue{}, fmt.Errorf("Hive cell at %#x isn't a value", off)
+	}
+	nameLen := int(binary.LittleEndian.Uint16(c[2:]))
+	if regfValueHeaderSize+nameLen > len(c) {
+		return HiveValue{}, fmt.Errorf("Hive value at %#x has invalid name length %d", off, nameLen)
+	}
+	v := HiveValue{
+		Name: decodeHiveName(c[regfValueHeaderSize:regfValueHeaderSize+nameLen], binary.LittleEndian.Uint16(c[16:])&regfValueCompName != 0),
+		Type: binary.LittleEndian.Uint32(c[12:]),
+	}
+	if !withData {
+		return v, nil
+	}
+
+	size := binary.LittleEndian.Uint32(c[4:])
+	dataOff := binary.LittleEndian.Uint32(c[8:])
+	switch {
+	case size&regfValueDataInline != 0:
+		// Up to 4 bytes of data are stored in place of the offset.
+		n := size &^ regfValueDataInline
+		if n > 4 {
+			return v, fmt.Errorf("Hive value %s has %d bytes of inline data", v.Name, n)
+		}
+		v.Data = append([]byte{}, c[8:8+n]...)
+	case size == 0:
+		v.Data = []byte{}
+	case size > regfBigDataSegment && h.header.MinorVersion >= regfBigDataMinor:
+		v.Data, err = h.bigData(dataOff, size)
+	default:
+		var data []byte
+		if data, err = h.cell(dataOff); err == nil {
+			if uint64(size) > uint64(len(data)) {
+				err = fmt.Errorf("Hive value %s has %d bytes of data in a %d byte cell", v.Name, size, len(data))
+			} else {
+				v.Data = data[:size]
+			}
+		}
+	}
+	return v, err
+}
+
+// bigData reads data stored in segments, through a big data (db) cell
+// listing them.
+func (h *Hive) bigData(off uint32, size uint32) ([]byte, error) {
+	c, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < 8 || c[0] != 'd' || c[1] != 'b' {
+		return nil, fmt.Errorf("Hive cell at %#x isn't big data", off)
+	}
+	count := int(binary.LittleEndian.Uint16(c[2:]))
+	list, err := h.cell(binary.LittleEndian.Uint32(c[4:]))
+	if err != nil {
+		return nil, err
+	}
+	// The size is checked against the segments, and the segments against
+	// the hive, before it's trusted to allocate the data.
+	if uint64(size) > uint64(count)*regfBigDataSegment || size > h.header.HiveBinsSize {
+		return nil, fmt.Errorf("Hive big data at %#x claims %d bytes in %d segments", off, size, count)
+	}
+	if count*4 > len(list) {
+		return nil, fmt.Errorf("Hive big data segment list at %#x is truncated", off)
+	}
+	data := make([]byte, 0, size)
+	for i := 0; i < count && uint32(len(data)) < size; i++ {
+		seg, err := h.cell(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		n := size - uint32(len(data))
+		if n > regfBigDataSegment {
+			n = regfBigDataSegment
+		}
+		if int(n) > len(seg) {
+			return nil, fmt.Errorf("Hive big data segment at %#x is truncated", off)
+		}
+		data = append(data, seg[:n]...)
+	}
+	if uint32(len(data)) != size {
+		return nil, fmt.Errorf("Hive big data at %#x has %d of %d bytes", off, len(data), size)
+	}
+	return data, nil
+}
+
+// decodeHiveName decodes a key or value name, which is stored as Latin-1 if
+// compressed, and UTF-16 otherwise.
+func decodeHiveName(b []byte, compressed bool) string {
+	if !compressed {
+		return decodeUTF16(b)
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// decodeUTF16 decodes little endian UTF-16, ignoring an odd trailing byte.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
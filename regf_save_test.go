@@ -0,0 +1,123 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// TestHiveFromRegSave reads a hive written by Windows itself, saving a key
+// created under HKCU with "reg save", which doesn't need elevation.
+func TestHiveFromRegSave(t *testing.T) {
+	// Enough subkeys that Windows indexes them with an ri list.
+	const subkeys = 1100
+	path := fmt.Sprintf(`Software\go-win64api-test-%d`, os.Getpid())
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.ALL_ACCESS)
+	if err != nil {
+		t.Fatalf("Unable to create test key: %s", err)
+	}
+	defer deleteTestKeyTree(t, registry.CURRENT_USER, path)
+	defer k.Close()
+
+	big := bytes.Repeat([]byte("0123456789abcdef"), 2000)
+	for _, err := range []error{
+		k.SetStringValue("", "default"),
+		k.SetStringValue("String", "Hello, wörld"),
+		k.SetExpandStringValue("Expand", `%SystemRoot%\System32`),
+		k.SetStringsValue("Multi", []string{"one", "two"}),
+		k.SetDWordValue("DWORD", 0x12345678),
+		k.SetQWordValue("QWORD", 1<<40),
+		k.SetBinaryValue("Big", big),
+	} {
+		if err != nil {
+			t.Fatalf("Unable to set test value: %s", err)
+		}
+	}
+	for i := 0; i < subkeys; i++ {
+		sk, _, err := registry.CreateKey(k, fmt.Sprintf("Sub%04d", i), registry.ALL_ACCESS)
+		if err != nil {
+			t.Fatalf("Unable to create test subkey: %s", err)
+		}
+		sk.Close()
+	}
+
+	dir, err := ioutil.TempDir("", "hive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.hiv")
+	if out, err := exec.Command("reg", "save", `HKCU\`+path, file, "/y").CombinedOutput(); err != nil {
+		t.Fatalf("reg save: %s: %s", err, out)
+	}
+
+	h, err := OpenHive(file)
+	if err != nil {
+		t.Fatalf("OpenHive: %s", err)
+	}
+	defer h.Close()
+	root, err := h.Root()
+	if err != nil {
+		t.Fatalf("Root: %s", err)
+	}
+	if s, typ, err := root.GetStringValue(""); err != nil || s != "default" || typ != REG_SZ {
+		t.Errorf("default value = %q, %d, %v", s, typ, err)
+	}
+	if s, _, err := root.GetStringValue("String"); err != nil || s != "Hello, wörld" {
+		t.Errorf("String = %q, %v", s, err)
+	}
+	if s, typ, err := root.GetStringValue("Expand"); err != nil || s != `%SystemRoot%\System32` || typ != REG_EXPAND_SZ {
+		t.Errorf("Expand = %q, %d, %v", s, typ, err)
+	}
+	if s, _, err := root.GetStringsValue("Multi"); err != nil || !reflect.DeepEqual(s, []string{"one", "two"}) {
+		t.Errorf("Multi = %q, %v", s, err)
+	}
+	for name, want := range map[string]uint64{"DWORD": 0x12345678, "QWORD": 1 << 40} {
+		if n, _, err := root.GetIntegerValue(name); err != nil || n != want {
+			t.Errorf("%s = %#x, %v, want %#x", name, n, err, want)
+		}
+	}
+	if data, _, err := root.GetBinaryValue("Big"); err != nil || !bytes.Equal(data, big) {
+		t.Errorf("big data value has %d bytes, %v", len(data), err)
+	}
+
+	names, err := root.SubKeyNames()
+	if err != nil || len(names) != subkeys {
+		t.Fatalf("SubKeyNames = %d names, %v", len(names), err)
+	}
+	for _, name := range []string{"Sub0000", "sub0550", "SUB1099"} {
+		if _, err := h.OpenKey(name); err != nil {
+			t.Errorf("OpenKey(%s): %s", name, err)
+		}
+	}
+	if _, err := h.OpenKey("Sub1100"); err != ErrHiveNotExist {
+		t.Errorf("opening a missing key = %v, want ErrHiveNotExist", err)
+	}
+}
+
+// deleteTestKeyTree deletes a key and its subkeys.
+func deleteTestKeyTree(t *testing.T, parent registry.Key, path string) {
+	k, err := registry.OpenKey(parent, path, registry.ALL_ACCESS)
+	if err != nil {
+		t.Errorf("Unable to open test key to delete it: %s", err)
+		return
+	}
+	names, _ := k.ReadSubKeyNames(-1)
+	for _, name := range names {
+		deleteTestKeyTree(t, k, name)
+	}
+	k.Close()
+	if err := registry.DeleteKey(parent, path); err != nil {
+		t.Errorf("Unable to delete test key: %s", err)
+	}
+}
@@ -0,0 +1,397 @@
+package winapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testHiveKey describes a key of a hive built by buildTestHive. list is the
+// kind of subkey list to write: lf, lh, li, or ri of two li lists.
+type testHiveKey struct {
+	name    string
+	list    string
+	values  []HiveValue
+	subkeys []*testHiveKey
+}
+
+// testHiveBuilder lays out cells in a single hive bin, as Windows does for
+// small hives.
+type testHiveBuilder struct {
+	bins []byte
+}
+
+var testHiveTime = time.Date(2021, 3, 15, 12, 30, 0, 0, time.UTC)
+
+func (b *testHiveBuilder) cell(data []byte) uint32 {
+	off := uint32(len(b.bins))
+	size := (4 + len(data) + 7) &^ 7
+	cell := make([]byte, size)
+	binary.LittleEndian.PutUint32(cell, uint32(-int32(size)))
+	copy(cell[4:], data)
+	b.bins = append(b.bins, cell...)
+	return off
+}
+
+func (b *testHiveBuilder) offsets(offs []uint32) uint32 {
+	buf := make([]byte, 4*len(offs))
+	for i, off := range offs {
+		binary.LittleEndian.PutUint32(buf[i*4:], off)
+	}
+	return b.cell(buf)
+}
+
+func (b *testHiveBuilder) subKeyList(sig string, offs []uint32, names []string) uint32 {
+	if sig == "ri" {
+		half := len(offs) / 2
+		offs = []uint32{b.subKeyList("li", offs[:half], nil), b.subKeyList("li", offs[half:], nil)}
+	}
+	buf := bytes.NewBufferString(sig)
+	binary.Write(buf, binary.LittleEndian, uint16(len(offs)))
+	for i, off := range offs {
+		binary.Write(buf, binary.LittleEndian, off)
+		switch sig {
+		case "lf":
+			hint := make([]byte, 4)
+			copy(hint, names[i])
+			buf.Write(hint)
+		case "lh":
+			hash, _ := hiveNameHash(names[i])
+			binary.Write(buf, binary.LittleEndian, hash)
+		}
+	}
+	return b.cell(buf.Bytes())
+}
+
+func (b *testHiveBuilder) value(v HiveValue) uint32 {
+	name, flags := testHiveName(v.Name, regfValueCompName)
+	size := uint32(len(v.Data))
+	var data [4]byte
+	switch {
+	case len(v.Data) <= 4:
+		size |= regfValueDataInline
+		copy(data[:], v.Data)
+	case len(v.Data) > regfBigDataSegment:
+		var segs []uint32
+		for rest := v.Data; len(rest) > 0; {
+			n := len(rest)
+			if n > regfBigDataSegment {
+				n = regfBigDataSegment
+			}
+			segs = append(segs, b.cell(rest[:n]))
+			rest = rest[n:]
+		}
+		db := bytes.NewBufferString("db")
+		binary.Write(db, binary.LittleEndian, uint16(len(segs)))
+		binary.Write(db, binary.LittleEndian, b.offsets(segs))
+		binary.LittleEndian.PutUint32(data[:], b.cell(db.Bytes()))
+	default:
+		binary.LittleEndian.PutUint32(data[:], b.cell(v.Data))
+	}
+
+	buf := bytes.NewBufferString("vk")
+	binary.Write(buf, binary.LittleEndian, uint16(len(name)))
+	binary.Write(buf, binary.LittleEndian, size)
+	buf.Write(data[:])
+	binary.Write(buf, binary.LittleEndian, v.Type)
+	binary.Write(buf, binary.LittleEndian, flags)
+	binary.Write(buf, binary.LittleEndian, uint16(0))
+	buf.Write(name)
+	return b.cell(buf.Bytes())
+}
+
+func (b *testHiveBuilder) key(k *testHiveKey) uint32 {
+	offs := make([]uint32, 0, len(k.subkeys))
+	names := make([]string, 0, len(k.subkeys))
+	for _, sk := range k.subkeys {
+		offs = append(offs, b.key(sk))
+		names = append(names, sk.name)
+	}
+	subkeyList := uint32(regfNoCell)
+	if len(offs) > 0 {
+		list := k.list
+		if list == "" {
+			list = "lh"
+		}
+		subkeyList = b.subKeyList(list, offs, names)
+	}
+	valueList := uint32(regfNoCell)
+	if len(k.values) > 0 {
+		voffs := make([]uint32, 0, len(k.values))
+		for _, v := range k.values {
+			voffs = append(voffs, b.value(v))
+		}
+		valueList = b.offsets(voffs)
+	}
+
+	name, flags := testHiveName(k.name, regfKeyCompName)
+	nk := make([]byte, regfKeyHeaderSize, regfKeyHeaderSize+len(name))
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[2:], flags)
+	binary.LittleEndian.PutUint64(nk[4:], testFileTime(testHiveTime))
+	binary.LittleEndian.PutUint32(nk[20:], uint32(len(offs)))
+	binary.LittleEndian.PutUint32(nk[28:], subkeyList)
+	binary.LittleEndian.PutUint32(nk[36:], uint32(len(k.values)))
+	binary.LittleEndian.PutUint32(nk[40:], valueList)
+	binary.LittleEndian.PutUint32(nk[48:], regfNoCell)
+	binary.LittleEndian.PutUint16(nk[72:], uint16(len(name)))
+	return b.cell(append(nk, name...))
+}
+
+// testHiveName stores names as Latin-1 where they can be, as Windows does.
+func testHiveName(name string, compFlag uint16) ([]byte, uint16) {
+	latin := make([]byte, 0, len(name))
+	for _, r := range name {
+		if r > 0xff {
+			return utf16Bytes(name), 0
+		}
+		latin = append(latin, byte(r))
+	}
+	return latin, compFlag
+}
+
+// buildTestHive returns a hive file with root as its root key.
+func buildTestHive(root *testHiveKey) []byte {
+	b := &testHiveBuilder{bins: make([]byte, regfBinHeaderSize)}
+	rootCell := b.key(root)
+	if pad := len(b.bins) % 4096; pad != 0 {
+		b.bins = append(b.bins, make([]byte, 4096-pad)...)
+	}
+	copy(b.bins, regfBinSignature)
+	binary.LittleEndian.PutUint32(b.bins[8:], uint32(len(b.bins)))
+
+	header := make([]byte, regfBaseBlockSize)
+	copy(header, regfSignature)
+	binary.LittleEndian.PutUint32(header[4:], 7)
+	binary.LittleEndian.PutUint32(header[8:], 7)
+	binary.LittleEndian.PutUint64(header[12:], testFileTime(testHiveTime))
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	binary.LittleEndian.PutUint32(header[24:], 5)
+	binary.LittleEndian.PutUint32(header[32:], 1)
+	binary.LittleEndian.PutUint32(header[36:], rootCell)
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(b.bins)))
+	binary.LittleEndian.PutUint32(header[44:], 1)
+	copy(header[48:], utf16Bytes(`\??\C:\Windows\System32\config\SOFTWARE`)[:64])
+	binary.LittleEndian.PutUint32(header[508:], hiveHeaderChecksum(header))
+	return append(header, b.bins...)
+}
+
+func testFileTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func testStringValue(name string, typ uint32, s string) HiveValue {
+	return HiveValue{Name: name, Type: typ, Data: utf16Bytes(s + "\x00")}
+}
+
+func testDWORDValue(name string, n uint32) HiveValue {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, n)
+	return HiveValue{Name: name, Type: REG_DWORD, Data: data}
+}
+
+func testHiveKeys(names ...string) []*testHiveKey {
+	keys := make([]*testHiveKey, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, &testHiveKey{name: name})
+	}
+	return keys
+}
+
+func TestHive(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789abcdef"), 2500)
+	qword := make([]byte, 8)
+	binary.LittleEndian.PutUint64(qword, 1<<40)
+	root := &testHiveKey{name: "ROOT", subkeys: []*testHiveKey{
+		{name: "Fast", list: "lf", subkeys: testHiveKeys("Alpha", "Beta")},
+		{name: "Hashed", list: "lh", subkeys: testHiveKeys("Alpha", "Ключ")},
+		{name: "Index", list: "li", subkeys: testHiveKeys("Alpha", "Beta")},
+		{name: "Root", list: "ri", subkeys: testHiveKeys("Alpha", "Beta", "Gamma", "Delta")},
+		{name: "Values", values: []HiveValue{
+			testStringValue("", REG_SZ, "default"),
+			testStringValue("String", REG_SZ, "Hello, wörld"),
+			testStringValue("Expand", REG_EXPAND_SZ, `%SystemRoot%\System32`),
+			{Name: "Multi", Type: REG_MULTI_SZ, Data: utf16Bytes("one\x00two\x00\x00")},
+			testDWORDValue("DWORD", 0x12345678),
+			{Name: "BigEndian", Type: REG_DWORD_BIG_ENDIAN, Data: []byte{0x12, 0x34, 0x56, 0x78}},
+			{Name: "QWORD", Type: REG_QWORD, Data: qword},
+			{Name: "Big", Type: REG_BINARY, Data: big},
+			{Name: "Empty", Type: REG_BINARY, Data: []byte{}},
+			testStringValue("Ünïcode värde", REG_SZ, "ok"),
+		}},
+	}}
+	h, err := NewHive(bytes.NewReader(buildTestHive(root)))
+	if err != nil {
+		t.Fatalf("NewHive: %s", err)
+	}
+
+	header := h.Header()
+	if header.MajorVersion != 1 || header.MinorVersion != 5 || header.Dirty() || !header.LastWritten.Equal(testHiveTime) {
+		t.Errorf("unexpected header %+v", header)
+	}
+	if header.FileName != `\??\C:\Windows\System32\config\SOFTWARE`[:32] {
+		t.Errorf("header file name %q", header.FileName)
+	}
+
+	for _, list := range []string{"Fast", "Hashed", "Index", "Root"} {
+		k, err := h.OpenKey(`\` + strings.ToLower(list) + `\ALPHA`)
+		if err != nil || k.Name != "Alpha" {
+			t.Errorf("opening Alpha under %s = %v, %v", list, k, err)
+		}
+		if k != nil && !k.LastWritten.Equal(testHiveTime) {
+			t.Errorf("%s\\Alpha last written %s", list, k.LastWritten)
+		}
+	}
+	rk, err := h.OpenKey("Root")
+	if err != nil {
+		t.Fatalf("OpenKey(Root): %s", err)
+	}
+	if names, err := rk.SubKeyNames(); err != nil || !reflect.DeepEqual(names, []string{"Alpha", "Beta", "Gamma", "Delta"}) {
+		t.Errorf("subkeys of an index root = %v, %v", names, err)
+	}
+	if k, err := h.OpenKey(`Hashed\ключ`); err != nil || k.Name != "Ключ" {
+		t.Errorf("opening a UTF-16 name = %v, %v", k, err)
+	}
+	if _, err := h.OpenKey(`Fast\Missing`); err != ErrHiveNotExist {
+		t.Errorf("opening a missing key = %v, want ErrHiveNotExist", err)
+	}
+
+	vk, err := h.OpenKey("Values")
+	if err != nil {
+		t.Fatalf("OpenKey(Values): %s", err)
+	}
+	names, err := vk.ValueNames()
+	if err != nil || len(names) != 10 || names[0] != "" || names[9] != "Ünïcode värde" {
+		t.Errorf("ValueNames = %q, %v", names, err)
+	}
+	if s, typ, err := vk.GetStringValue(""); err != nil || s != "default" || typ != REG_SZ {
+		t.Errorf("default value = %q, %d, %v", s, typ, err)
+	}
+	if s, _, err := vk.GetStringValue("string"); err != nil || s != "Hello, wörld" {
+		t.Errorf("String = %q, %v", s, err)
+	}
+	if s, typ, err := vk.GetStringValue("Expand"); err != nil || s != `%SystemRoot%\System32` || typ != REG_EXPAND_SZ {
+		t.Errorf("Expand = %q, %d, %v", s, typ, err)
+	}
+	if s, _, err := vk.GetStringsValue("Multi"); err != nil || !reflect.DeepEqual(s, []string{"one", "two"}) {
+		t.Errorf("Multi = %q, %v", s, err)
+	}
+	for name, want := range map[string]uint64{"DWORD": 0x12345678, "BigEndian": 0x12345678, "QWORD": 1 << 40} {
+		if n, _, err := vk.GetIntegerValue(name); err != nil || n != want {
+			t.Errorf("%s = %#x, %v, want %#x", name, n, err, want)
+		}
+	}
+	if data, _, err := vk.GetBinaryValue("Big"); err != nil || !bytes.Equal(data, big) {
+		t.Errorf("big data value has %d bytes, %v", len(data), err)
+	}
+	if data, _, err := vk.GetBinaryValue("Empty"); err != nil || len(data) != 0 {
+		t.Errorf("Empty = %v, %v", data, err)
+	}
+	if s, _, err := vk.GetStringValue("ünïcode VÄRDE"); err != nil || s != "ok" {
+		t.Errorf("UTF-16 value name = %q, %v", s, err)
+	}
+	if _, _, err := vk.GetIntegerValue("String"); err == nil {
+		t.Errorf("reading a string as an integer should fail")
+	}
+	if _, _, err := vk.GetStringValue("Missing"); err != ErrHiveNotExist {
+		t.Errorf("reading a missing value = %v, want ErrHiveNotExist", err)
+	}
+	values, err := vk.Values()
+	if err != nil || len(values) != 10 || values[4].Type != REG_DWORD || !bytes.Equal(values[4].Data, []byte{0x78, 0x56, 0x34, 0x12}) {
+		t.Errorf("Values = %v, %v", values, err)
+	}
+}
+
+func TestHiveDamaged(t *testing.T) {
+	hive := buildTestHive(&testHiveKey{name: "ROOT"})
+
+	notHive := append([]byte{}, hive...)
+	copy(notHive, "evtx")
+	badSum := append([]byte{}, hive...)
+	badSum[100] ^= 1
+	noBins := append([]byte{}, hive...)
+	copy(noBins[regfBaseBlockSize:], "xxxx")
+	for name, data := range map[string][]byte{
+		"signature": notHive,
+		"checksum":  badSum,
+		"hive bins": noBins,
+		"truncated": hive[:1000],
+	} {
+		if _, err := NewHive(bytes.NewReader(data)); err == nil {
+			t.Errorf("a hive with a bad %s should fail", name)
+		}
+	}
+
+	// A root cell pointing past the hive bins.
+	badRoot := append([]byte{}, hive...)
+	binary.LittleEndian.PutUint32(badRoot[36:], 0x100000)
+	binary.LittleEndian.PutUint32(badRoot[508:], hiveHeaderChecksum(badRoot))
+	h, err := NewHive(bytes.NewReader(badRoot))
+	if err != nil {
+		t.Fatalf("NewHive: %s", err)
+	}
+	if _, err := h.Root(); err == nil {
+		t.Errorf("a root cell out of range should fail")
+	}
+
+	// Big data claiming more bytes than its segments can hold.
+	bigHive := buildTestHive(&testHiveKey{name: "ROOT", values: []HiveValue{
+		{Name: "Big", Type: REG_BINARY, Data: make([]byte, regfBigDataSegment+1)},
+	}})
+	vk := bytes.Index(bigHive, []byte("Big")) - regfValueHeaderSize
+	if string(bigHive[vk:vk+2]) != "vk" {
+		t.Fatalf("no value cell at %#x", vk)
+	}
+	for _, size := range []uint32{2*regfBigDataSegment + 1, 0x7fffffff} {
+		binary.LittleEndian.PutUint32(bigHive[vk+4:], size)
+		h, err := NewHive(bytes.NewReader(bigHive))
+		if err != nil {
+			t.Fatalf("NewHive: %s", err)
+		}
+		root, err := h.Root()
+		if err != nil {
+			t.Fatalf("Root: %s", err)
+		}
+		if _, _, err := root.GetBinaryValue("Big"); err == nil {
+			t.Errorf("big data of %d bytes in 2 segments should fail", size)
+		}
+	}
+}
+
+func TestOpenHive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "NTUSER.DAT")
+	root := &testHiveKey{name: "ROOT", subkeys: []*testHiveKey{
+		{name: "Environment", values: []HiveValue{testStringValue("TEMP", REG_EXPAND_SZ, `%USERPROFILE%\AppData\Local\Temp`)}},
+	}}
+	if err := ioutil.WriteFile(path, buildTestHive(root), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenHive(path)
+	if err != nil {
+		t.Fatalf("OpenHive: %s", err)
+	}
+	defer h.Close()
+	k, err := h.OpenKey("Environment")
+	if err != nil {
+		t.Fatalf("OpenKey: %s", err)
+	}
+	if s, _, err := k.GetStringValue("TEMP"); err != nil || s != `%USERPROFILE%\AppData\Local\Temp` {
+		t.Errorf("TEMP = %q, %v", s, err)
+	}
+
+	if _, err := OpenHive(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("opening a missing hive should fail")
+	}
+}
@@ -0,0 +1,378 @@
+package winapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// Where profiles are registered in the SOFTWARE hive, with the path of each
+// user's profile, which holds their NTUSER.DAT.
+const (
+	profileListKey   = `Microsoft\Windows NT\CurrentVersion\ProfileList`
+	currentVersionNT = `Microsoft\Windows NT\CurrentVersion`
+	userHiveFileName = "NTUSER.DAT"
+)
+
+// RegistryKey is an open key, in the live registry or a hive file, with the
+// methods the software inventory needs. Values are read as with the registry
+// package's Key.
+type RegistryKey interface {
+	OpenSubKey(path string) (RegistryKey, error)
+	ReadSubKeyNames() ([]string, error)
+	GetStringValue(name string) (string, uint32, error)
+	GetIntegerValue(name string) (uint64, uint32, error)
+	Close() error
+}
+
+// RegistryHive is the SOFTWARE key of the machine's hive, or of a user's.
+//
+// Path names the key in the RegKey of software found under it, such as
+// `HKLM\SOFTWARE` or `HKU\S-1-5-21-...\SOFTWARE` in the live registry, and
+// the hive file's path for offline hives.
+type RegistryHive struct {
+	User     string
+	Path     string
+	Software RegistryKey
+}
+
+// RegistrySource is a registry software inventory runs over: the live
+// registry, or hive files such as those of an offline Windows image.
+type RegistrySource interface {
+	// SoftwareHives opens the machine's SOFTWARE key, then each user's.
+	// The caller closes them. Users whose hives can't be read are skipped.
+	SoftwareHives() ([]RegistryHive, error)
+}
+
+// InstalledSoftwareFrom returns the software registered to be uninstalled in
+// src, as InstalledSoftwareList does for the live registry.
+func InstalledSoftwareFrom(src RegistrySource) ([]so.Software, error) {
+	hives, err := src.SoftwareHives()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, hive := range hives {
+			hive.Software.Close()
+		}
+	}()
+
+	swList := make([]so.Software, 0)
+	for _, hive := range hives {
+		sw64, err := getSoftwareList(hive, softwareUninstallKey, so.SOFTWARE_VIEW_64)
+		if err != nil && hive.User == "" {
+			return nil, err
+		}
+		swList = append(swList, sw64...)
+
+		// 32-bit Windows has no Wow6432Node.
+		sw32, _ := getSoftwareList(hive, softwareUninstallKey32, so.SOFTWARE_VIEW_32)
+		swList = append(swList, sw32...)
+	}
+	return swList, nil
+}
+
+// getSoftwareList reads the software registered under baseKey, which is
+// relative to the root of the hive, in its SOFTWARE key.
+func getSoftwareList(hive RegistryHive, baseKey string, view uint32) ([]so.Software, error) {
+	path := strings.TrimPrefix(baseKey, `SOFTWARE\`)
+	k, err := hive.Software.OpenSubKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading from registry: %s", err.Error())
+	}
+	defer k.Close()
+
+	swList := make([]so.Software, 0)
+
+	subkeys, err := k.ReadSubKeyNames()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading subkey list from registry: %s", err.Error())
+	}
+	for _, sw := range subkeys {
+		parsed, err := parseSoftware(k, sw)
+		if err != nil {
+			continue
+		}
+		parsed.RegKey = hive.Path + `\` + path + `\` + sw
+		setSoftwareIdentity(&parsed, hive.User, view, baseKey+`\`+sw)
+		swList = append(swList, parsed)
+	}
+
+	return swList, nil
+}
+
+func parseSoftware(k RegistryKey, name string) (so.Software, error) {
+	sk, err := k.OpenSubKey(name)
+	if err != nil {
+		return so.Software{}, fmt.Errorf("Error reading from registry `%s`: %s", name, err.Error())
+	}
+	defer sk.Close()
+
+	dn, _, err := sk.GetStringValue("DisplayName")
+	if err != nil {
+		return so.Software{}, err
+	}
+	swv := so.Software{DisplayName: dn}
+
+	dv, _, err := sk.GetStringValue("DisplayVersion")
+	if err == nil {
+		swv.DisplayVersion = dv
+	}
+
+	pub, _, err := sk.GetStringValue("Publisher")
+	if err == nil {
+		swv.Publisher = pub
+	}
+
+	id, _, err := sk.GetStringValue("InstallDate")
+	if err == nil {
+		swv.InstallDate, _ = time.Parse("20060102", id)
+	}
+
+	es, _, err := sk.GetIntegerValue("EstimatedSize")
+	if err == nil {
+		swv.EstimatedSize = es
+	}
+
+	cont, _, err := sk.GetStringValue("Contact")
+	if err == nil {
+		swv.Contact = cont
+	}
+
+	hlp, _, err := sk.GetStringValue("HelpLink")
+	if err == nil {
+		swv.HelpLink = hlp
+	}
+
+	isource, _, err := sk.GetStringValue("InstallSource")
+	if err == nil {
+		swv.InstallSource = isource
+	}
+
+	ilocaction, _, err := sk.GetStringValue("InstallLocation")
+	if err == nil {
+		swv.InstallLocation = ilocaction
+	}
+
+	ustring, _, err := sk.GetStringValue("UninstallString")
+	if err == nil {
+		swv.UninstallString = ustring
+	}
+
+	qustring, _, err := sk.GetStringValue("QuietUninstallString")
+	if err == nil {
+		swv.QuietUninstallString = qustring
+	}
+
+	mver, _, err := sk.GetIntegerValue("VersionMajor")
+	if err == nil {
+		swv.VersionMajor = mver
+	}
+
+	mnver, _, err := sk.GetIntegerValue("VersionMinor")
+	if err == nil {
+		swv.VersionMinor = mnver
+	}
+	return swv, nil
+}
+
+// hiveRegistryKey is a key of a hive file as a RegistryKey. The key a hive
+// was opened for closes the file.
+type hiveRegistryKey struct {
+	*HiveKey
+	hive *Hive
+}
+
+// openHiveRegistryKey opens the hive file at path, and the key within it.
+func openHiveRegistryKey(path string, key string) (RegistryKey, error) {
+	h, err := OpenHive(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := h.OpenKey(key)
+	if err != nil {
+		h.Close()
+		return nil, fmt.Errorf("Unable to open %s in hive %s: %s", key, path, err)
+	}
+	return hiveRegistryKey{HiveKey: k, hive: h}, nil
+}
+
+func (k hiveRegistryKey) OpenSubKey(path string) (RegistryKey, error) {
+	sk, err := k.HiveKey.OpenSubKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return hiveRegistryKey{HiveKey: sk}, nil
+}
+
+func (k hiveRegistryKey) ReadSubKeyNames() ([]string, error) {
+	return k.SubKeyNames()
+}
+
+func (k hiveRegistryKey) Close() error {
+	if k.hive == nil {
+		return nil
+	}
+	return k.hive.Close()
+}
+
+// OfflineRegistry reads software from hive files, such as those of a Windows
+// image mounted on another machine, or profiles whose users aren't logged on.
+type OfflineRegistry struct {
+	// SoftwareHive is the path of the machine's SOFTWARE hive, which is
+	// Windows\System32\config\SOFTWARE in an image.
+	SoftwareHive string
+	// UserHives are the paths of users' NTUSER.DAT hives, by SID.
+	UserHives map[string]string
+}
+
+// OfflineImageRegistry finds the SOFTWARE hive of the Windows image whose
+// system drive is at root, and the NTUSER.DAT of each profile registered in
+// it. Paths are matched case insensitively, as the image's file system
+// would, so it works on a case sensitive mount too.
+func OfflineImageRegistry(root string) (*OfflineRegistry, error) {
+	software, err := findImagePath(root, `Windows\System32\config\SOFTWARE`)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find the SOFTWARE hive in %s: %s", root, err)
+	}
+	k, err := openHiveRegistryKey(software, "")
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	systemRoot := `C:\Windows`
+	if cv, err := k.OpenSubKey(currentVersionNT); err == nil {
+		if s, _, err := cv.GetStringValue("SystemRoot"); err == nil && s != "" {
+			systemRoot = s
+		}
+		cv.Close()
+	}
+	profiles, err := profileImagePaths(k)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &OfflineRegistry{SoftwareHive: software, UserHives: make(map[string]string)}
+	for sid, p := range profiles {
+		p = expandImagePath(p, systemRoot)
+		if hive, err := findImagePath(root, p+`\`+userHiveFileName); err == nil {
+			r.UserHives[sid] = hive
+		}
+	}
+	return r, nil
+}
+
+// SoftwareHives opens the SOFTWARE hive, and the user hives that can be read.
+func (r *OfflineRegistry) SoftwareHives() ([]RegistryHive, error) {
+	machine, err := openHiveRegistryKey(r.SoftwareHive, "")
+	if err != nil {
+		return nil, err
+	}
+	hives := []RegistryHive{{Path: r.SoftwareHive, Software: machine}}
+
+	sids := make([]string, 0, len(r.UserHives))
+	for sid := range r.UserHives {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+	for _, sid := range sids {
+		path := r.UserHives[sid]
+		k, err := openHiveRegistryKey(path, "SOFTWARE")
+		if err != nil {
+			continue
+		}
+		hives = append(hives, RegistryHive{User: sid, Path: path + `\SOFTWARE`, Software: k})
+	}
+	return hives, nil
+}
+
+// profileImagePaths returns the profile path of each user in the ProfileList
+// of a SOFTWARE key, as stored, with environment variables unexpanded.
+func profileImagePaths(software RegistryKey) (map[string]string, error) {
+	k, err := software.OpenSubKey(profileListKey)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the profile list: %s", err)
+	}
+	defer k.Close()
+
+	sids, err := k.ReadSubKeyNames()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the profile list: %s", err)
+	}
+	profiles := make(map[string]string)
+	for _, sid := range sids {
+		if !isUserHiveName(sid) {
+			continue
+		}
+		pk, err := k.OpenSubKey(sid)
+		if err != nil {
+			continue
+		}
+		if p, _, err := pk.GetStringValue("ProfileImagePath"); err == nil && p != "" {
+			profiles[sid] = p
+		}
+		pk.Close()
+	}
+	return profiles, nil
+}
+
+// expandImagePath turns a path on an image's Windows installation into one
+// relative to its system drive, expanding the environment variables profile
+// paths are written with.
+func expandImagePath(p string, systemRoot string) string {
+	systemRoot = stripDriveLetter(systemRoot)
+	for _, v := range []struct{ name, value string }{
+		{"%SystemDrive%", ""},
+		{"%SystemRoot%", systemRoot},
+		{"%WinDir%", systemRoot},
+	} {
+		if len(p) >= len(v.name) && strings.EqualFold(p[:len(v.name)], v.name) {
+			p = v.value + p[len(v.name):]
+		}
+	}
+	return stripDriveLetter(p)
+}
+
+func stripDriveLetter(p string) string {
+	if len(p) >= 2 && p[1] == ':' {
+		return p[2:]
+	}
+	return p
+}
+
+// findImagePath finds a Windows path, separated by backslashes, under root,
+// matching each name case insensitively where it doesn't match exactly.
+func findImagePath(root string, winPath string) (string, error) {
+	path := root
+	for _, name := range strings.Split(winPath, `\`) {
+		if name == "" {
+			continue
+		}
+		next := filepath.Join(path, name)
+		if _, err := os.Lstat(next); err != nil {
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return "", err
+			}
+			next = ""
+			for _, e := range entries {
+				if strings.EqualFold(e.Name(), name) {
+					next = filepath.Join(path, e.Name())
+					break
+				}
+			}
+			if next == "" {
+				return "", fmt.Errorf("%s not found in %s", name, path)
+			}
+		}
+		path = next
+	}
+	return path, nil
+}
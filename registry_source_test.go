@@ -0,0 +1,170 @@
+package winapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// testHiveKeyPath returns the first key of a path, with the last holding the
+// subkeys.
+func testHiveKeyPath(path []string, subkeys ...*testHiveKey) *testHiveKey {
+	k := &testHiveKey{name: path[len(path)-1], subkeys: subkeys}
+	for i := len(path) - 2; i >= 0; i-- {
+		k = &testHiveKey{name: path[i], subkeys: []*testHiveKey{k}}
+	}
+	return k
+}
+
+func writeTestHive(t *testing.T, path string, root *testHiveKey) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buildTestHive(root), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOfflineImageRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	uninstall := []string{"Microsoft", "Windows", "CurrentVersion", "Uninstall"}
+	software := &testHiveKey{name: "ROOT", subkeys: []*testHiveKey{
+		{name: "Microsoft", subkeys: []*testHiveKey{
+			testHiveKeyPath(uninstall[1:],
+				&testHiveKey{name: "7-Zip", values: []HiveValue{
+					testStringValue("DisplayName", REG_SZ, "7-Zip 19.00 (x64)"),
+					testStringValue("DisplayVersion", REG_SZ, "19.00"),
+					testStringValue("InstallDate", REG_SZ, "20210315"),
+					testStringValue("UninstallString", REG_SZ, `"C:\Program Files\7-Zip\Uninstall.exe"`),
+					testDWORDValue("EstimatedSize", 5421),
+					testDWORDValue("VersionMajor", 19),
+				}},
+				&testHiveKey{name: "NoDisplayName", values: []HiveValue{
+					testStringValue("UninstallString", REG_SZ, `C:\Tools\remove.exe`),
+				}},
+			),
+			{name: "Windows NT", subkeys: []*testHiveKey{
+				{name: "CurrentVersion", values: []HiveValue{
+					testStringValue("SystemRoot", REG_SZ, `C:\WINDOWS`),
+				}, subkeys: []*testHiveKey{
+					{name: "ProfileList", subkeys: []*testHiveKey{
+						{name: "S-1-5-18", values: []HiveValue{
+							testStringValue("ProfileImagePath", REG_EXPAND_SZ, `%systemroot%\system32\config\systemprofile`),
+						}},
+						{name: "S-1-5-21-1-2-3-1001", values: []HiveValue{
+							testStringValue("ProfileImagePath", REG_EXPAND_SZ, `C:\Users\bob`),
+						}},
+						{name: "S-1-5-21-1-2-3-1002", values: []HiveValue{
+							testStringValue("ProfileImagePath", REG_EXPAND_SZ, `%SystemDrive%\Users\alice`),
+						}},
+					}},
+				}},
+			}},
+		}},
+		testHiveKeyPath(append([]string{"Wow6432Node"}, uninstall...),
+			&testHiveKey{name: "{23170F69-40C1-2701-1900-000001000000}", values: []HiveValue{
+				testStringValue("DisplayName", REG_SZ, "7-Zip 19.00"),
+				testStringValue("DisplayVersion", REG_SZ, "19.00.00.0"),
+			}},
+		),
+	}}
+	user := &testHiveKey{name: "ROOT", subkeys: []*testHiveKey{
+		testHiveKeyPath(append([]string{"Software"}, uninstall...),
+			&testHiveKey{name: "UserApp", values: []HiveValue{
+				testStringValue("DisplayName", REG_SZ, "User App"),
+				testStringValue("Publisher", REG_SZ, "Example"),
+			}},
+		),
+	}}
+	// Stored with different case to the paths in the registry, as a case
+	// sensitive mount of an image would see them.
+	softwarePath := filepath.Join(dir, "WINDOWS", "system32", "config", "SOFTWARE")
+	userPath := filepath.Join(dir, "users", "Bob", "ntuser.dat")
+	writeTestHive(t, softwarePath, software)
+	writeTestHive(t, userPath, user)
+	if err := os.MkdirAll(filepath.Join(dir, "users", "alice"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OfflineImageRegistry(dir)
+	if err != nil {
+		t.Fatalf("OfflineImageRegistry: %s", err)
+	}
+	if r.SoftwareHive != softwarePath || len(r.UserHives) != 1 || r.UserHives["S-1-5-21-1-2-3-1001"] != userPath {
+		t.Fatalf("OfflineImageRegistry = %+v", r)
+	}
+
+	list, err := InstalledSoftwareFrom(r)
+	if err != nil {
+		t.Fatalf("InstalledSoftwareFrom: %s", err)
+	}
+	want := []so.Software{
+		{
+			ID:              `machine:64:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\7-Zip`,
+			DisplayName:     "7-Zip 19.00 (x64)",
+			DisplayVersion:  "19.00",
+			Arch:            "X64",
+			InstallDate:     time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC),
+			EstimatedSize:   5421,
+			UninstallString: `"C:\Program Files\7-Zip\Uninstall.exe"`,
+			VersionMajor:    19,
+			RegKey:          softwarePath + `\Microsoft\Windows\CurrentVersion\Uninstall\7-Zip`,
+			RegView:         so.SOFTWARE_VIEW_64,
+		},
+		{
+			ID:             `machine:32:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\{23170F69-40C1-2701-1900-000001000000}`,
+			DisplayName:    "7-Zip 19.00",
+			DisplayVersion: "19.00.00.0",
+			Arch:           "X32",
+			RegKey:         softwarePath + `\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall\{23170F69-40C1-2701-1900-000001000000}`,
+			RegView:        so.SOFTWARE_VIEW_32,
+			ProductCode:    "{23170F69-40C1-2701-1900-000001000000}",
+		},
+		{
+			ID:          `S-1-5-21-1-2-3-1001:64:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\UserApp`,
+			DisplayName: "User App",
+			Arch:        "X64",
+			Publisher:   "Example",
+			RegKey:      userPath + `\SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\UserApp`,
+			RegView:     so.SOFTWARE_VIEW_64,
+			UserSID:     "S-1-5-21-1-2-3-1001",
+		},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d registrations, want %d: %+v", len(list), len(want), list)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("registration %d =\n%+v\nwant\n%+v", i, list[i], want[i])
+		}
+	}
+
+	if _, err := OfflineImageRegistry(filepath.Join(dir, "users")); err == nil {
+		t.Errorf("an image without a SOFTWARE hive should fail")
+	}
+}
+
+func TestExpandImagePath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`C:\Users\bob`, `\Users\bob`},
+		{`%SystemDrive%\Users\bob`, `\Users\bob`},
+		{`%systemroot%\system32\config\systemprofile`, `\WINDOWS\system32\config\systemprofile`},
+		{`%WINDIR%\ServiceProfiles\LocalService`, `\WINDOWS\ServiceProfiles\LocalService`},
+	}
+	for _, tt := range tests {
+		if got := expandImagePath(tt.in, `C:\WINDOWS`); got != tt.want {
+			t.Errorf("expandImagePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,545 @@
+package winapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sddlSIDAliases maps the two letter SDDL account aliases to their SIDs.
+//
+// Aliases relative to a domain (DA, DU, etc.) aren't included, as they can't
+// be resolved without knowing the domain SID.
+var sddlSIDAliases = map[string]string{
+	"AN": "S-1-5-7",      // Anonymous logon
+	"AU": "S-1-5-11",     // Authenticated users
+	"BA": "S-1-5-32-544", // Built-in administrators
+	"BG": "S-1-5-32-546", // Built-in guests
+	"BO": "S-1-5-32-551", // Backup operators
+	"BU": "S-1-5-32-545", // Built-in users
+	"AO": "S-1-5-32-548", // Account operators
+	"SO": "S-1-5-32-549", // Server operators
+	"PO": "S-1-5-32-550", // Printer operators
+	"RE": "S-1-5-32-552", // Replicator
+	"RU": "S-1-5-32-554", // Pre-Windows 2000 compatible access
+	"RD": "S-1-5-32-555", // Remote desktop users
+	"NO": "S-1-5-32-556", // Network configuration operators
+	"PU": "S-1-5-32-547", // Power users
+	"MU": "S-1-5-32-558", // Performance monitor users
+	"LU": "S-1-5-32-559", // Performance log users
+	"IS": "S-1-5-32-568", // IIS_IUSRS
+	"CY": "S-1-5-32-569", // Cryptographic operators
+	"ER": "S-1-5-32-573", // Event log readers
+	"HA": "S-1-5-32-578", // Hyper-V administrators
+	"AA": "S-1-5-32-579", // Access control assistance operators
+	"RM": "S-1-5-32-580", // Remote management users
+	"CO": "S-1-3-0",      // Creator owner
+	"CG": "S-1-3-1",      // Creator group
+	"OW": "S-1-3-4",      // Owner rights
+	"WD": "S-1-1-0",      // Everyone
+	"NU": "S-1-5-2",      // Network logon
+	"IU": "S-1-5-4",      // Interactive logon
+	"SU": "S-1-5-6",      // Service logon
+	"ED": "S-1-5-9",      // Enterprise domain controllers
+	"PS": "S-1-5-10",     // Principal self
+	"RC": "S-1-5-12",     // Restricted code
+	"WR": "S-1-5-33",     // Write restricted code
+	"SY": "S-1-5-18",     // Local system
+	"LS": "S-1-5-19",     // Local service
+	"NS": "S-1-5-20",     // Network service
+	"AC": "S-1-15-2-1",   // All application packages
+	"LW": "S-1-16-4096",  // Low integrity level
+	"ME": "S-1-16-8192",  // Medium integrity level
+	"MP": "S-1-16-8448",  // Medium plus integrity level
+	"HI": "S-1-16-12288", // High integrity level
+	"SI": "S-1-16-16384", // System integrity level
+}
+
+var sddlSIDNames = reverseStringMap(sddlSIDAliases)
+
+var sddlACETypes = map[string]uint8{
+	"A":  ACCESS_ALLOWED_ACE_TYPE,
+	"D":  ACCESS_DENIED_ACE_TYPE,
+	"AU": SYSTEM_AUDIT_ACE_TYPE,
+	"AL": SYSTEM_ALARM_ACE_TYPE,
+	"OA": ACCESS_ALLOWED_OBJECT_ACE_TYPE,
+	"OD": ACCESS_DENIED_OBJECT_ACE_TYPE,
+	"OU": SYSTEM_AUDIT_OBJECT_ACE_TYPE,
+	"OL": SYSTEM_ALARM_OBJECT_ACE_TYPE,
+	"XA": ACCESS_ALLOWED_CALLBACK_ACE_TYPE,
+	"XD": ACCESS_DENIED_CALLBACK_ACE_TYPE,
+	"ZA": ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE,
+	"XU": SYSTEM_AUDIT_CALLBACK_ACE_TYPE,
+	"ML": SYSTEM_MANDATORY_LABEL_ACE_TYPE,
+	"SP": SYSTEM_SCOPED_POLICY_ID_ACE_TYPE,
+}
+
+var sddlACETypeNames = map[uint8]string{}
+
+func init() {
+	for k, v := range sddlACETypes {
+		sddlACETypeNames[v] = k
+	}
+}
+
+type sddlFlag struct {
+	name  string
+	value uint32
+}
+
+// Listed in the order ConvertSecurityDescriptorToStringSecurityDescriptor
+// writes them.
+var sddlACEFlags = []sddlFlag{
+	{"OI", OBJECT_INHERIT_ACE},
+	{"CI", CONTAINER_INHERIT_ACE},
+	{"NP", NO_PROPAGATE_INHERIT_ACE},
+	{"IO", INHERIT_ONLY_ACE},
+	{"ID", INHERITED_ACE},
+	{"CR", CRITICAL_ACE_FLAG},
+	{"SA", SUCCESSFUL_ACCESS_ACE_FLAG},
+	{"FA", FAILED_ACCESS_ACE_FLAG},
+}
+
+// Rights that are a combination of bits, only used when the mask matches
+// exactly. KX is the same as KR, so isn't listed.
+var sddlCombinedRights = []sddlFlag{
+	{"FA", FILE_ALL_ACCESS},
+	{"FR", FILE_GENERIC_READ},
+	{"FW", FILE_GENERIC_WRITE},
+	{"FX", FILE_GENERIC_EXECUTE},
+	{"KA", KEY_ALL_ACCESS},
+	{"KR", KEY_READ},
+	{"KW", KEY_WRITE},
+}
+
+// Listed in the order ConvertSecurityDescriptorToStringSecurityDescriptor
+// writes them.
+var sddlRights = []sddlFlag{
+	{"GA", GENERIC_ALL},
+	{"GR", GENERIC_READ},
+	{"GW", GENERIC_WRITE},
+	{"GX", GENERIC_EXECUTE},
+	{"CC", 0x1},   // ADS_RIGHT_DS_CREATE_CHILD
+	{"DC", 0x2},   // ADS_RIGHT_DS_DELETE_CHILD
+	{"LC", 0x4},   // ADS_RIGHT_ACTRL_DS_LIST
+	{"SW", 0x8},   // ADS_RIGHT_DS_SELF
+	{"RP", 0x10},  // ADS_RIGHT_DS_READ_PROP
+	{"WP", 0x20},  // ADS_RIGHT_DS_WRITE_PROP
+	{"DT", 0x40},  // ADS_RIGHT_DS_DELETE_TREE
+	{"LO", 0x80},  // ADS_RIGHT_DS_LIST_OBJECT
+	{"CR", 0x100}, // ADS_RIGHT_DS_CONTROL_ACCESS
+	{"SD", DELETE},
+	{"RC", READ_CONTROL},
+	{"WD", WRITE_DAC},
+	{"WO", WRITE_OWNER},
+}
+
+var sddlLabelRights = []sddlFlag{
+	{"NW", SYSTEM_MANDATORY_LABEL_NO_WRITE_UP},
+	{"NR", SYSTEM_MANDATORY_LABEL_NO_READ_UP},
+	{"NX", SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP},
+}
+
+func reverseStringMap(m map[string]string) map[string]string {
+	r := make(map[string]string, len(m))
+	for k, v := range m {
+		r[v] = k
+	}
+	return r
+}
+
+// ParseSDDL parses a security descriptor in the Security Descriptor
+// Definition Language, e.g. "O:BAG:SYD:PAI(A;OICI;FA;;;SY)(A;;FR;;;BU)".
+//
+// Conditional ACEs, resource attribute ACEs and aliases for domain relative
+// accounts (such as DA) aren't supported.
+//
+// See: https://docs.microsoft.com/en-us/windows/win32/secauthz/security-descriptor-string-format
+func ParseSDDL(sddl string) (*SecurityDescriptor, error) {
+	sd := &SecurityDescriptor{Revision: SECURITY_DESCRIPTOR_REVISION}
+	s := strings.TrimSpace(sddl)
+
+	// Split into components at each "X:" outside of parentheses.
+	type component struct {
+		tag   byte
+		value string
+	}
+	var components []component
+	depth := 0
+	start := -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ':':
+			if depth != 0 {
+				continue
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("Invalid SDDL: unexpected ':' at offset 0")
+			}
+			if start >= 0 {
+				components[len(components)-1].value = s[start : i-1]
+			} else if i != 1 {
+				return nil, fmt.Errorf("Invalid SDDL: unexpected %q before first component", s[:i-1])
+			}
+			components = append(components, component{tag: s[i-1]})
+			start = i + 1
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("Invalid SDDL: unbalanced parentheses")
+	}
+	if len(components) == 0 {
+		if s == "" {
+			return sd, nil
+		}
+		return nil, fmt.Errorf("Invalid SDDL %q", sddl)
+	}
+	components[len(components)-1].value = s[start:]
+
+	for _, c := range components {
+		var err error
+		switch c.tag {
+		case 'O':
+			sd.Owner, err = parseSDDLSID(c.value)
+		case 'G':
+			sd.Group, err = parseSDDLSID(c.value)
+		case 'D':
+			var control uint16
+			control, sd.DACL, err = parseSDDLACL(c.value)
+			sd.Control |= SE_DACL_PRESENT | control
+		case 'S':
+			var control uint16
+			control, sd.SACL, err = parseSDDLACL(c.value)
+			// The SACL flags use the SACL bits, which are one higher.
+			sd.Control |= SE_SACL_PRESENT | control<<1
+		default:
+			err = fmt.Errorf("unknown component %q", string(c.tag))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SDDL: %s", err)
+		}
+	}
+	return sd, nil
+}
+
+func parseSDDLSID(s string) (*SID, error) {
+	if sid, ok := sddlSIDAliases[strings.ToUpper(s)]; ok {
+		s = sid
+	} else if len(s) == 2 {
+		return nil, fmt.Errorf("unsupported SID alias %q", s)
+	}
+	return ParseSID(s)
+}
+
+// parseSDDLACL parses the DACL or SACL component, returning the DACL control
+// flags it set. A nil ACL is returned for NO_ACCESS_CONTROL.
+func parseSDDLACL(s string) (uint16, *ACL, error) {
+	var control uint16
+	flags := s
+	aces := ""
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		flags, aces = s[:i], s[i:]
+	}
+	nullACL := false
+	for flags != "" {
+		switch {
+		case strings.HasPrefix(flags, "NO_ACCESS_CONTROL"):
+			nullACL = true
+			flags = flags[len("NO_ACCESS_CONTROL"):]
+		case strings.HasPrefix(flags, "P"):
+			control |= SE_DACL_PROTECTED
+			flags = flags[1:]
+		case strings.HasPrefix(flags, "AI"):
+			control |= SE_DACL_AUTO_INHERITED
+			flags = flags[2:]
+		case strings.HasPrefix(flags, "AR"):
+			control |= SE_DACL_AUTO_INHERIT_REQ
+			flags = flags[2:]
+		default:
+			return 0, nil, fmt.Errorf("unknown ACL flags %q", flags)
+		}
+	}
+	if nullACL {
+		if aces != "" {
+			return 0, nil, fmt.Errorf("NO_ACCESS_CONTROL ACL has entries")
+		}
+		return control, nil, nil
+	}
+
+	acl := NewACL()
+	for aces != "" {
+		if aces[0] != '(' {
+			return 0, nil, fmt.Errorf("expected '(' at %q", aces)
+		}
+		end := strings.IndexByte(aces, ')')
+		if end < 0 {
+			return 0, nil, fmt.Errorf("unterminated ACE %q", aces)
+		}
+		ace, err := parseSDDLACE(aces[1:end])
+		if err != nil {
+			return 0, nil, fmt.Errorf("ACE (%s): %s", aces[1:end], err)
+		}
+		if isObjectACE(ace.Type) {
+			acl.Revision = ACL_REVISION_DS
+		}
+		acl.Entries = append(acl.Entries, ace)
+		aces = aces[end+1:]
+	}
+	return control, acl, nil
+}
+
+func parseSDDLACE(s string) (ACE, error) {
+	var ace ACE
+	fields := strings.Split(s, ";")
+	if len(fields) != 6 {
+		return ace, fmt.Errorf("expected 6 fields, got %d (conditional and resource attribute ACEs are not supported)", len(fields))
+	}
+
+	t, ok := sddlACETypes[strings.ToUpper(fields[0])]
+	if !ok {
+		return ace, fmt.Errorf("unknown ACE type %q", fields[0])
+	}
+	ace.Type = t
+
+	for f := strings.ToUpper(fields[1]); f != ""; f = f[2:] {
+		if len(f) < 2 {
+			return ace, fmt.Errorf("unknown ACE flag %q", f)
+		}
+		found := false
+		for _, fl := range sddlACEFlags {
+			if fl.name == f[:2] {
+				ace.Flags |= uint8(fl.value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ace, fmt.Errorf("unknown ACE flag %q", f[:2])
+		}
+	}
+
+	mask, err := parseSDDLRights(fields[2], t == SYSTEM_MANDATORY_LABEL_ACE_TYPE)
+	if err != nil {
+		return ace, err
+	}
+	ace.Mask = mask
+
+	if fields[3] != "" || fields[4] != "" {
+		if !isObjectACE(t) {
+			return ace, fmt.Errorf("object GUIDs on a non-object ACE")
+		}
+	}
+	if fields[3] != "" {
+		g, err := ParseGUID(fields[3])
+		if err != nil {
+			return ace, err
+		}
+		ace.ObjectType = &g
+	}
+	if fields[4] != "" {
+		g, err := ParseGUID(fields[4])
+		if err != nil {
+			return ace, err
+		}
+		ace.InheritedObjectType = &g
+	}
+
+	if ace.SID, err = parseSDDLSID(fields[5]); err != nil {
+		return ace, err
+	}
+	return ace, nil
+}
+
+func parseSDDLRights(s string, label bool) (uint32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid access mask %q", s)
+		}
+		return uint32(v), nil
+	}
+	if s[0] >= '0' && s[0] <= '9' {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid access mask %q", s)
+		}
+		return uint32(v), nil
+	}
+
+	tables := [][]sddlFlag{sddlCombinedRights, sddlRights, {{"KX", KEY_EXECUTE}}}
+	if label {
+		tables = [][]sddlFlag{sddlLabelRights}
+	}
+	var mask uint32
+	for r := strings.ToUpper(s); r != ""; r = r[2:] {
+		if len(r) < 2 {
+			return 0, fmt.Errorf("unknown access right %q", r)
+		}
+		found := false
+		for _, table := range tables {
+			for _, right := range table {
+				if right.name == r[:2] {
+					mask |= right.value
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown access right %q", r[:2])
+		}
+	}
+	return mask, nil
+}
+
+// SDDL formats the security descriptor in the Security Descriptor Definition
+// Language. Well known SIDs and access masks are written using their aliases,
+// the same way ConvertSecurityDescriptorToStringSecurityDescriptor does.
+//
+// An error is returned for ACEs that can't be expressed in SDDL by ParseSDDL,
+// such as conditional ACEs.
+func (sd *SecurityDescriptor) SDDL() (string, error) {
+	var sb strings.Builder
+	if sd.Owner != nil {
+		sb.WriteString("O:")
+		sb.WriteString(formatSDDLSID(sd.Owner))
+	}
+	if sd.Group != nil {
+		sb.WriteString("G:")
+		sb.WriteString(formatSDDLSID(sd.Group))
+	}
+	if sd.DACL != nil || sd.Control&SE_DACL_PRESENT != 0 {
+		sb.WriteString("D:")
+		if err := formatSDDLACL(&sb, sd.DACL, sd.Control); err != nil {
+			return "", fmt.Errorf("DACL: %s", err)
+		}
+	}
+	if sd.SACL != nil || sd.Control&SE_SACL_PRESENT != 0 {
+		sb.WriteString("S:")
+		if err := formatSDDLACL(&sb, sd.SACL, sd.Control>>1); err != nil {
+			return "", fmt.Errorf("SACL: %s", err)
+		}
+	}
+	return sb.String(), nil
+}
+
+// SDDL formats the ACL as the body of an SDDL "D:" component, see
+// SecurityDescriptor.SDDL.
+func (a *ACL) SDDL() (string, error) {
+	var sb strings.Builder
+	if err := formatSDDLACL(&sb, a, 0); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// formatSDDLACL writes the flags and entries of an ACL. control is the
+// descriptor's control flags, shifted so the DACL bits apply.
+func formatSDDLACL(sb *strings.Builder, acl *ACL, control uint16) error {
+	if control&SE_DACL_PROTECTED != 0 {
+		sb.WriteString("P")
+	}
+	if control&SE_DACL_AUTO_INHERIT_REQ != 0 {
+		sb.WriteString("AR")
+	}
+	if control&SE_DACL_AUTO_INHERITED != 0 {
+		sb.WriteString("AI")
+	}
+	if acl == nil {
+		sb.WriteString("NO_ACCESS_CONTROL")
+		return nil
+	}
+	for i := range acl.Entries {
+		ace := &acl.Entries[i]
+		s, err := ace.SDDL()
+		if err != nil {
+			return fmt.Errorf("ACE %d: %s", i, err)
+		}
+		sb.WriteString(s)
+	}
+	return nil
+}
+
+// SDDL formats the ACE as an SDDL ACE string, e.g. "(A;OICI;FA;;;SY)".
+func (a *ACE) SDDL() (string, error) {
+	t, ok := sddlACETypeNames[a.Type]
+	if !ok {
+		return "", fmt.Errorf("ACE type 0x%x has no SDDL representation", a.Type)
+	}
+	if len(a.ApplicationData) != 0 {
+		return "", fmt.Errorf("ACE application data has no SDDL representation")
+	}
+	if a.SID == nil {
+		return "", fmt.Errorf("ACE has no SID")
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('(')
+	sb.WriteString(t)
+	sb.WriteByte(';')
+	for _, fl := range sddlACEFlags {
+		if uint32(a.Flags)&fl.value != 0 {
+			sb.WriteString(fl.name)
+		}
+	}
+	sb.WriteByte(';')
+	sb.WriteString(formatSDDLRights(a.Mask, a.Type == SYSTEM_MANDATORY_LABEL_ACE_TYPE))
+	sb.WriteByte(';')
+	if a.ObjectType != nil {
+		sb.WriteString(a.ObjectType.String())
+	}
+	sb.WriteByte(';')
+	if a.InheritedObjectType != nil {
+		sb.WriteString(a.InheritedObjectType.String())
+	}
+	sb.WriteByte(';')
+	sb.WriteString(formatSDDLSID(a.SID))
+	sb.WriteByte(')')
+	return sb.String(), nil
+}
+
+func formatSDDLSID(sid *SID) string {
+	s := sid.String()
+	if alias, ok := sddlSIDNames[s]; ok {
+		return alias
+	}
+	return s
+}
+
+func formatSDDLRights(mask uint32, label bool) string {
+	if mask == 0 {
+		return ""
+	}
+	table := sddlRights
+	if label {
+		table = sddlLabelRights
+	} else {
+		for _, r := range sddlCombinedRights {
+			if mask == r.value {
+				return r.name
+			}
+		}
+	}
+	var sb strings.Builder
+	remaining := mask
+	for _, r := range table {
+		if remaining&r.value != 0 {
+			sb.WriteString(r.name)
+			remaining &^= r.value
+		}
+	}
+	if remaining != 0 {
+		return fmt.Sprintf("0x%x", mask)
+	}
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+package winapi
+
+import (
+	"testing"
+)
+
+func TestSDDLRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"O:BAG:SYD:PAI(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)(A;OICIIO;GA;;;CO)(A;;0x1200a9;;;BU)",
+		"O:SYD:AI(A;ID;KA;;;SY)(A;CIIOID;GR;;;BU)",
+		"D:(A;;CCLCSWRPWPDTLOCRRC;;;SY)(A;;CCDCLCSWRPWPDTLOCRSDRCWDWO;;;BA)",
+		"D:NO_ACCESS_CONTROL",
+		"D:",
+		"D:P",
+		"S:(ML;;NW;;;HI)",
+		"S:PAI(AU;OICISAFA;FA;;;WD)",
+		"O:S-1-5-21-1-2-3-1001G:S-1-5-21-1-2-3-513",
+		"",
+	} {
+		sd, err := ParseSDDL(s)
+		if err != nil {
+			t.Errorf("ParseSDDL(%q): %v", s, err)
+			continue
+		}
+		got, err := sd.SDDL()
+		if err != nil {
+			t.Errorf("SDDL() of %q: %v", s, err)
+		} else if got != s {
+			t.Errorf("round trip of %q = %q", s, got)
+		}
+	}
+}
+
+func TestParseSDDLDetails(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:PAI(A;OICI;FA;;;SY)(D;;FW;;;S-1-5-21-1-2-3-1001)S:AI(ML;;NWNR;;;LW)")
+	if err != nil {
+		t.Fatalf("ParseSDDL: %v", err)
+	}
+	if sd.Owner.String() != "S-1-5-32-544" || sd.Group.String() != "S-1-5-18" {
+		t.Errorf("owner/group = %s/%s", sd.Owner, sd.Group)
+	}
+	wantControl := uint16(SE_DACL_PRESENT | SE_DACL_PROTECTED | SE_DACL_AUTO_INHERITED | SE_SACL_PRESENT | SE_SACL_AUTO_INHERITED)
+	if sd.Control != wantControl {
+		t.Errorf("control = 0x%x, want 0x%x", sd.Control, wantControl)
+	}
+	if len(sd.DACL.Entries) != 2 {
+		t.Fatalf("expected 2 DACL entries, got %d", len(sd.DACL.Entries))
+	}
+	allow, deny := sd.DACL.Entries[0], sd.DACL.Entries[1]
+	if !allow.IsAllow() || allow.Flags != OBJECT_INHERIT_ACE|CONTAINER_INHERIT_ACE || allow.Mask != FILE_ALL_ACCESS {
+		t.Errorf("unexpected allow ACE: %+v", allow)
+	}
+	if !deny.IsDeny() || deny.Mask != FILE_GENERIC_WRITE || deny.SID.String() != "S-1-5-21-1-2-3-1001" {
+		t.Errorf("unexpected deny ACE: %+v", deny)
+	}
+	label := sd.SACL.Entries[0]
+	if label.Type != SYSTEM_MANDATORY_LABEL_ACE_TYPE || label.Mask != SYSTEM_MANDATORY_LABEL_NO_WRITE_UP|SYSTEM_MANDATORY_LABEL_NO_READ_UP {
+		t.Errorf("unexpected label ACE: %+v", label)
+	}
+
+	null, _ := ParseSDDL("D:NO_ACCESS_CONTROL")
+	empty, _ := ParseSDDL("D:")
+	if !null.HasNullDACL() || empty.HasNullDACL() {
+		t.Errorf("NULL DACL detection wrong: null=%v empty=%v", null.HasNullDACL(), empty.HasNullDACL())
+	}
+
+	lower, err := ParseSDDL("o:ba d:(a;oici;fa;;;sy)")
+	if err == nil {
+		t.Errorf("expected error for lower case component tags, got %s", lower)
+	}
+}
+
+func TestParseSDDLErrors(t *testing.T) {
+	for _, s := range []string{
+		"X:BA",
+		"O:DA",
+		"D:(A;;FA;;SY)",
+		"D:(Q;;FA;;;SY)",
+		"D:(A;ZZ;FA;;;SY)",
+		"D:(A;;QQ;;;SY)",
+		"D:(A;;FA;;;SY",
+		"D:(XA;;FA;;;WD;(Member_of {SID(BA)}))",
+		"D:(A;;FA;bf967aba-0de6-11d0-a285-00aa003049e2;;SY)",
+		"D:NO_ACCESS_CONTROL(A;;FA;;;SY)",
+		"garbage",
+	} {
+		if _, err := ParseSDDL(s); err == nil {
+			t.Errorf("ParseSDDL(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,652 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Security descriptor control flags.
+const (
+	SE_OWNER_DEFAULTED       = 0x0001
+	SE_GROUP_DEFAULTED       = 0x0002
+	SE_DACL_PRESENT          = 0x0004
+	SE_DACL_DEFAULTED        = 0x0008
+	SE_SACL_PRESENT          = 0x0010
+	SE_SACL_DEFAULTED        = 0x0020
+	SE_DACL_AUTO_INHERIT_REQ = 0x0100
+	SE_SACL_AUTO_INHERIT_REQ = 0x0200
+	SE_DACL_AUTO_INHERITED   = 0x0400
+	SE_SACL_AUTO_INHERITED   = 0x0800
+	SE_DACL_PROTECTED        = 0x1000
+	SE_SACL_PROTECTED        = 0x2000
+	SE_SELF_RELATIVE         = 0x8000
+
+	SECURITY_DESCRIPTOR_REVISION = 1
+	ACL_REVISION                 = 2
+	ACL_REVISION_DS              = 4
+)
+
+// ACE types.
+const (
+	ACCESS_ALLOWED_ACE_TYPE                 = 0x00
+	ACCESS_DENIED_ACE_TYPE                  = 0x01
+	SYSTEM_AUDIT_ACE_TYPE                   = 0x02
+	SYSTEM_ALARM_ACE_TYPE                   = 0x03
+	ACCESS_ALLOWED_COMPOUND_ACE_TYPE        = 0x04
+	ACCESS_ALLOWED_OBJECT_ACE_TYPE          = 0x05
+	ACCESS_DENIED_OBJECT_ACE_TYPE           = 0x06
+	SYSTEM_AUDIT_OBJECT_ACE_TYPE            = 0x07
+	SYSTEM_ALARM_OBJECT_ACE_TYPE            = 0x08
+	ACCESS_ALLOWED_CALLBACK_ACE_TYPE        = 0x09
+	ACCESS_DENIED_CALLBACK_ACE_TYPE         = 0x0A
+	ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE = 0x0B
+	ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE  = 0x0C
+	SYSTEM_AUDIT_CALLBACK_ACE_TYPE          = 0x0D
+	SYSTEM_ALARM_CALLBACK_ACE_TYPE          = 0x0E
+	SYSTEM_AUDIT_CALLBACK_OBJECT_ACE_TYPE   = 0x0F
+	SYSTEM_ALARM_CALLBACK_OBJECT_ACE_TYPE   = 0x10
+	SYSTEM_MANDATORY_LABEL_ACE_TYPE         = 0x11
+	SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE      = 0x12
+	SYSTEM_SCOPED_POLICY_ID_ACE_TYPE        = 0x13
+)
+
+// ACE flags, controlling inheritance and auditing.
+const (
+	OBJECT_INHERIT_ACE         = 0x01
+	CONTAINER_INHERIT_ACE      = 0x02
+	NO_PROPAGATE_INHERIT_ACE   = 0x04
+	INHERIT_ONLY_ACE           = 0x08
+	INHERITED_ACE              = 0x10
+	CRITICAL_ACE_FLAG          = 0x20
+	SUCCESSFUL_ACCESS_ACE_FLAG = 0x40
+	FAILED_ACCESS_ACE_FLAG     = 0x80
+
+	// Flags in the body of object ACEs, saying which GUIDs are present.
+	ACE_OBJECT_TYPE_PRESENT           = 0x1
+	ACE_INHERITED_OBJECT_TYPE_PRESENT = 0x2
+)
+
+// Access mask bits.
+const (
+	DELETE                 = 0x00010000
+	READ_CONTROL           = 0x00020000
+	WRITE_DAC              = 0x00040000
+	WRITE_OWNER            = 0x00080000
+	SYNCHRONIZE            = 0x00100000
+	ACCESS_SYSTEM_SECURITY = 0x01000000
+	MAXIMUM_ALLOWED        = 0x02000000
+	GENERIC_ALL            = 0x10000000
+	GENERIC_EXECUTE        = 0x20000000
+	GENERIC_WRITE          = 0x40000000
+	GENERIC_READ           = 0x80000000
+
+	FILE_ALL_ACCESS      = 0x001F01FF
+	FILE_GENERIC_READ    = 0x00120089
+	FILE_GENERIC_WRITE   = 0x00120116
+	FILE_GENERIC_EXECUTE = 0x001200A0
+
+	KEY_ALL_ACCESS = 0x000F003F
+	KEY_READ       = 0x00020019
+	KEY_WRITE      = 0x00020006
+	KEY_EXECUTE    = 0x00020019
+
+	SERVICE_ALL_ACCESS = 0x000F01FF
+
+	SYSTEM_MANDATORY_LABEL_NO_WRITE_UP   = 0x1
+	SYSTEM_MANDATORY_LABEL_NO_READ_UP    = 0x2
+	SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP = 0x4
+)
+
+// A SID is a security identifier, such as S-1-5-32-544.
+//
+// SIDs marshal to and from JSON as their string form.
+type SID struct {
+	Revision            uint8
+	IdentifierAuthority uint64 // 48 bits
+	SubAuthority        []uint32
+}
+
+// ParseSID parses the string form of a SID, e.g. "S-1-5-32-544".
+//
+// It doesn't understand SDDL aliases such as "BA", see ParseSDDL for those.
+func ParseSID(s string) (*SID, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 || (parts[0] != "S" && parts[0] != "s") {
+		return nil, fmt.Errorf("Invalid SID %q", s)
+	}
+	rev, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SID %q: bad revision", s)
+	}
+	var auth uint64
+	if strings.HasPrefix(parts[2], "0x") || strings.HasPrefix(parts[2], "0X") {
+		auth, err = strconv.ParseUint(parts[2][2:], 16, 48)
+	} else {
+		auth, err = strconv.ParseUint(parts[2], 10, 48)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SID %q: bad identifier authority", s)
+	}
+	if len(parts)-3 > 15 {
+		return nil, fmt.Errorf("Invalid SID %q: too many sub authorities", s)
+	}
+	sid := &SID{Revision: uint8(rev), IdentifierAuthority: auth, SubAuthority: make([]uint32, 0, len(parts)-3)}
+	for _, p := range parts[3:] {
+		sa, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SID %q: bad sub authority %q", s, p)
+		}
+		sid.SubAuthority = append(sid.SubAuthority, uint32(sa))
+	}
+	return sid, nil
+}
+
+// ReadSID decodes a binary SID from the start of b, returning the SID and the
+// number of bytes it occupied.
+func ReadSID(b []byte) (*SID, int, error) {
+	if len(b) < 8 {
+		return nil, 0, fmt.Errorf("Invalid SID: buffer too short, expected at least 8 bytes, got %d", len(b))
+	}
+	count := int(b[1])
+	size := 8 + 4*count
+	if len(b) < size {
+		return nil, 0, fmt.Errorf("Invalid SID: %d sub authorities need %d bytes, got %d", count, size, len(b))
+	}
+	sid := &SID{Revision: b[0], SubAuthority: make([]uint32, count)}
+	for i := 2; i < 8; i++ {
+		sid.IdentifierAuthority = sid.IdentifierAuthority<<8 | uint64(b[i])
+	}
+	for i := 0; i < count; i++ {
+		sid.SubAuthority[i] = binary.LittleEndian.Uint32(b[8+4*i:])
+	}
+	return sid, size, nil
+}
+
+// String returns the SID in S-R-I-S-S... form.
+func (s *SID) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "S-%d-", s.Revision)
+	if s.IdentifierAuthority >= 1<<32 {
+		fmt.Fprintf(&sb, "0x%012X", s.IdentifierAuthority)
+	} else {
+		sb.WriteString(strconv.FormatUint(s.IdentifierAuthority, 10))
+	}
+	for _, sa := range s.SubAuthority {
+		sb.WriteByte('-')
+		sb.WriteString(strconv.FormatUint(uint64(sa), 10))
+	}
+	return sb.String()
+}
+
+// Len returns the size of the binary SID in bytes.
+func (s *SID) Len() int {
+	return 8 + 4*len(s.SubAuthority)
+}
+
+// Bytes returns the binary form of the SID, as used by the Windows API.
+func (s *SID) Bytes() []byte {
+	b := make([]byte, s.Len())
+	b[0] = s.Revision
+	b[1] = uint8(len(s.SubAuthority))
+	for i := 0; i < 6; i++ {
+		b[7-i] = byte(s.IdentifierAuthority >> (8 * uint(i)))
+	}
+	for i, sa := range s.SubAuthority {
+		binary.LittleEndian.PutUint32(b[8+4*i:], sa)
+	}
+	return b
+}
+
+// Equal reports whether two SIDs are the same.
+func (s *SID) Equal(o *SID) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	if s.Revision != o.Revision || s.IdentifierAuthority != o.IdentifierAuthority || len(s.SubAuthority) != len(o.SubAuthority) {
+		return false
+	}
+	for i := range s.SubAuthority {
+		if s.SubAuthority[i] != o.SubAuthority[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SID) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *SID) UnmarshalText(text []byte) error {
+	p, err := ParseSID(string(text))
+	if err != nil {
+		return err
+	}
+	*s = *p
+	return nil
+}
+
+// A GUID identifies an object type or property set in an object ACE.
+//
+// GUIDs are stored in their binary (mixed-endian) form and marshal to and from
+// JSON as "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx".
+type GUID [16]byte
+
+// ParseGUID parses a GUID, with or without surrounding braces.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return g, fmt.Errorf("Invalid GUID %q", s)
+	}
+	raw, err := hex.DecodeString(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36])
+	if err != nil {
+		return g, fmt.Errorf("Invalid GUID %q", s)
+	}
+	// The first three groups are little endian in the binary form.
+	g[0], g[1], g[2], g[3] = raw[3], raw[2], raw[1], raw[0]
+	g[4], g[5] = raw[5], raw[4]
+	g[6], g[7] = raw[7], raw[6]
+	copy(g[8:], raw[8:])
+	return g, nil
+}
+
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:16])
+}
+
+func (g GUID) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+func (g *GUID) UnmarshalText(text []byte) error {
+	p, err := ParseGUID(string(text))
+	if err != nil {
+		return err
+	}
+	*g = p
+	return nil
+}
+
+// An ACE is a single access control entry.
+//
+// Type is one of the *_ACE_TYPE constants, and Flags a combination of the
+// inheritance and audit flags (OBJECT_INHERIT_ACE etc.). ObjectType and
+// InheritedObjectType are only used by object ACEs, which are found on
+// directory service objects.
+//
+// ApplicationData holds anything following the SID, such as the condition of
+// a callback ACE, so that unknown ACEs survive a decode/encode round trip.
+type ACE struct {
+	Type                uint8  `json:"type"`
+	Flags               uint8  `json:"flags"`
+	Mask                uint32 `json:"mask"`
+	SID                 *SID   `json:"sid"`
+	ObjectType          *GUID  `json:"objectType,omitempty"`
+	InheritedObjectType *GUID  `json:"inheritedObjectType,omitempty"`
+	ApplicationData     []byte `json:"applicationData,omitempty"`
+}
+
+// IsInherited reports whether the ACE was inherited from a parent object.
+func (a *ACE) IsInherited() bool {
+	return a.Flags&INHERITED_ACE != 0
+}
+
+// IsAllow reports whether the ACE grants access.
+func (a *ACE) IsAllow() bool {
+	switch a.Type {
+	case ACCESS_ALLOWED_ACE_TYPE, ACCESS_ALLOWED_OBJECT_ACE_TYPE, ACCESS_ALLOWED_CALLBACK_ACE_TYPE, ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE:
+		return true
+	}
+	return false
+}
+
+// IsDeny reports whether the ACE denies access.
+func (a *ACE) IsDeny() bool {
+	switch a.Type {
+	case ACCESS_DENIED_ACE_TYPE, ACCESS_DENIED_OBJECT_ACE_TYPE, ACCESS_DENIED_CALLBACK_ACE_TYPE, ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE:
+		return true
+	}
+	return false
+}
+
+func isObjectACE(t uint8) bool {
+	switch t {
+	case ACCESS_ALLOWED_OBJECT_ACE_TYPE, ACCESS_DENIED_OBJECT_ACE_TYPE,
+		SYSTEM_AUDIT_OBJECT_ACE_TYPE, SYSTEM_ALARM_OBJECT_ACE_TYPE,
+		ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE, ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE,
+		SYSTEM_AUDIT_CALLBACK_OBJECT_ACE_TYPE, SYSTEM_ALARM_CALLBACK_OBJECT_ACE_TYPE:
+		return true
+	}
+	return false
+}
+
+// An ACL is an ordered list of ACEs, used as either a DACL or a SACL.
+type ACL struct {
+	Revision uint8 `json:"revision"`
+	Entries  []ACE `json:"entries"`
+}
+
+// NewACL returns an empty ACL. An empty DACL denies all access.
+func NewACL() *ACL {
+	return &ACL{Revision: ACL_REVISION, Entries: make([]ACE, 0)}
+}
+
+// Allow appends an access allowed ACE and returns the ACL, for chaining.
+func (a *ACL) Allow(sid *SID, mask uint32, flags uint8) *ACL {
+	a.Entries = append(a.Entries, ACE{Type: ACCESS_ALLOWED_ACE_TYPE, Flags: flags, Mask: mask, SID: sid})
+	return a
+}
+
+// Deny appends an access denied ACE and returns the ACL, for chaining.
+func (a *ACL) Deny(sid *SID, mask uint32, flags uint8) *ACL {
+	a.Entries = append(a.Entries, ACE{Type: ACCESS_DENIED_ACE_TYPE, Flags: flags, Mask: mask, SID: sid})
+	return a
+}
+
+// Audit appends a system audit ACE, for use in a SACL, and returns the ACL.
+// flags should include SUCCESSFUL_ACCESS_ACE_FLAG and/or FAILED_ACCESS_ACE_FLAG.
+func (a *ACL) Audit(sid *SID, mask uint32, flags uint8) *ACL {
+	a.Entries = append(a.Entries, ACE{Type: SYSTEM_AUDIT_ACE_TYPE, Flags: flags, Mask: mask, SID: sid})
+	return a
+}
+
+// Canonicalize sorts the ACEs into the order Windows expects: explicit deny
+// ACEs, then explicit allow ACEs, then inherited ACEs in their existing order.
+func (a *ACL) Canonicalize() {
+	rank := func(e *ACE) int {
+		switch {
+		case e.IsInherited():
+			return 3
+		case e.IsDeny():
+			return 0
+		case e.IsAllow():
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(a.Entries, func(i, j int) bool {
+		return rank(&a.Entries[i]) < rank(&a.Entries[j])
+	})
+}
+
+// A SecurityDescriptor holds the owner, primary group and access control
+// lists of a securable object.
+//
+// A nil DACL with SE_DACL_PRESENT set in Control is a NULL DACL, which grants
+// everyone full access; an empty DACL grants nobody access.
+type SecurityDescriptor struct {
+	Revision uint8  `json:"revision"`
+	Control  uint16 `json:"control"`
+	Owner    *SID   `json:"owner,omitempty"`
+	Group    *SID   `json:"group,omitempty"`
+	DACL     *ACL   `json:"dacl,omitempty"`
+	SACL     *ACL   `json:"sacl,omitempty"`
+}
+
+// ParseSecurityDescriptor decodes a self-relative security descriptor, as
+// returned by GetSecurityInfo or stored in the registry.
+func ParseSecurityDescriptor(b []byte) (*SecurityDescriptor, error) {
+	if len(b) < 20 {
+		return nil, fmt.Errorf("Invalid security descriptor: buffer too short, expected at least 20 bytes, got %d", len(b))
+	}
+	sd := &SecurityDescriptor{
+		Revision: b[0],
+		Control:  binary.LittleEndian.Uint16(b[2:4]),
+	}
+	if sd.Control&SE_SELF_RELATIVE == 0 {
+		return nil, fmt.Errorf("Invalid security descriptor: not self-relative")
+	}
+	offOwner := binary.LittleEndian.Uint32(b[4:8])
+	offGroup := binary.LittleEndian.Uint32(b[8:12])
+	offSacl := binary.LittleEndian.Uint32(b[12:16])
+	offDacl := binary.LittleEndian.Uint32(b[16:20])
+
+	var err error
+	if offOwner != 0 {
+		if sd.Owner, err = readSIDAt(b, offOwner); err != nil {
+			return nil, fmt.Errorf("Invalid owner: %s", err)
+		}
+	}
+	if offGroup != 0 {
+		if sd.Group, err = readSIDAt(b, offGroup); err != nil {
+			return nil, fmt.Errorf("Invalid group: %s", err)
+		}
+	}
+	if offSacl != 0 && sd.Control&SE_SACL_PRESENT != 0 {
+		if sd.SACL, err = readACLAt(b, offSacl); err != nil {
+			return nil, fmt.Errorf("Invalid SACL: %s", err)
+		}
+	}
+	if offDacl != 0 && sd.Control&SE_DACL_PRESENT != 0 {
+		if sd.DACL, err = readACLAt(b, offDacl); err != nil {
+			return nil, fmt.Errorf("Invalid DACL: %s", err)
+		}
+	}
+	return sd, nil
+}
+
+func readSIDAt(b []byte, off uint32) (*SID, error) {
+	if uint64(off) >= uint64(len(b)) {
+		return nil, fmt.Errorf("offset %d out of range", off)
+	}
+	sid, _, err := ReadSID(b[off:])
+	return sid, err
+}
+
+func readACLAt(b []byte, off uint32) (*ACL, error) {
+	if uint64(off) >= uint64(len(b)) {
+		return nil, fmt.Errorf("offset %d out of range", off)
+	}
+	return ParseACL(b[off:])
+}
+
+// ParseACL decodes a binary ACL from the start of b.
+func ParseACL(b []byte) (*ACL, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("ACL header too short")
+	}
+	size := int(binary.LittleEndian.Uint16(b[2:4]))
+	count := int(binary.LittleEndian.Uint16(b[4:6]))
+	if size < 8 || size > len(b) {
+		return nil, fmt.Errorf("ACL size %d out of range", size)
+	}
+	acl := &ACL{Revision: b[0], Entries: make([]ACE, 0, count)}
+	pos := 8
+	for i := 0; i < count; i++ {
+		if pos+4 > size {
+			return nil, fmt.Errorf("ACE %d header out of range", i)
+		}
+		aceSize := int(binary.LittleEndian.Uint16(b[pos+2 : pos+4]))
+		if aceSize < 4 || pos+aceSize > size {
+			return nil, fmt.Errorf("ACE %d size %d out of range", i, aceSize)
+		}
+		ace, err := parseACE(b[pos : pos+aceSize])
+		if err != nil {
+			return nil, fmt.Errorf("ACE %d: %s", i, err)
+		}
+		acl.Entries = append(acl.Entries, ace)
+		pos += aceSize
+	}
+	return acl, nil
+}
+
+func parseACE(b []byte) (ACE, error) {
+	ace := ACE{Type: b[0], Flags: b[1]}
+	body := b[4:]
+
+	if ace.Type == ACCESS_ALLOWED_COMPOUND_ACE_TYPE || ace.Type > SYSTEM_SCOPED_POLICY_ID_ACE_TYPE {
+		// Unknown layout, keep the body as-is.
+		ace.ApplicationData = append([]byte(nil), body...)
+		return ace, nil
+	}
+
+	if len(body) < 4 {
+		return ace, fmt.Errorf("body too short")
+	}
+	ace.Mask = binary.LittleEndian.Uint32(body)
+	body = body[4:]
+
+	if isObjectACE(ace.Type) {
+		if len(body) < 4 {
+			return ace, fmt.Errorf("object flags missing")
+		}
+		flags := binary.LittleEndian.Uint32(body)
+		body = body[4:]
+		if flags&ACE_OBJECT_TYPE_PRESENT != 0 {
+			if len(body) < 16 {
+				return ace, fmt.Errorf("object type truncated")
+			}
+			var g GUID
+			copy(g[:], body)
+			ace.ObjectType = &g
+			body = body[16:]
+		}
+		if flags&ACE_INHERITED_OBJECT_TYPE_PRESENT != 0 {
+			if len(body) < 16 {
+				return ace, fmt.Errorf("inherited object type truncated")
+			}
+			var g GUID
+			copy(g[:], body)
+			ace.InheritedObjectType = &g
+			body = body[16:]
+		}
+	}
+
+	sid, n, err := ReadSID(body)
+	if err != nil {
+		return ace, err
+	}
+	ace.SID = sid
+	if len(body) > n {
+		ace.ApplicationData = append([]byte(nil), body[n:]...)
+	}
+	return ace, nil
+}
+
+// Bytes returns the binary form of the ACL.
+func (a *ACL) Bytes() []byte {
+	rev := a.Revision
+	if rev == 0 {
+		rev = ACL_REVISION
+	}
+	b := make([]byte, 8)
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		if isObjectACE(e.Type) && rev < ACL_REVISION_DS {
+			rev = ACL_REVISION_DS
+		}
+		b = append(b, e.Bytes()...)
+	}
+	b[0] = rev
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(b)))
+	binary.LittleEndian.PutUint16(b[4:6], uint16(len(a.Entries)))
+	return b
+}
+
+// Bytes returns the binary form of the ACE, including its header.
+func (a *ACE) Bytes() []byte {
+	b := make([]byte, 4, 64)
+	b[0] = a.Type
+	b[1] = a.Flags
+
+	if a.Type == ACCESS_ALLOWED_COMPOUND_ACE_TYPE || a.Type > SYSTEM_SCOPED_POLICY_ID_ACE_TYPE {
+		b = append(b, a.ApplicationData...)
+	} else {
+		var u32 [4]byte
+		binary.LittleEndian.PutUint32(u32[:], a.Mask)
+		b = append(b, u32[:]...)
+		if isObjectACE(a.Type) {
+			var flags uint32
+			if a.ObjectType != nil {
+				flags |= ACE_OBJECT_TYPE_PRESENT
+			}
+			if a.InheritedObjectType != nil {
+				flags |= ACE_INHERITED_OBJECT_TYPE_PRESENT
+			}
+			binary.LittleEndian.PutUint32(u32[:], flags)
+			b = append(b, u32[:]...)
+			if a.ObjectType != nil {
+				b = append(b, a.ObjectType[:]...)
+			}
+			if a.InheritedObjectType != nil {
+				b = append(b, a.InheritedObjectType[:]...)
+			}
+		}
+		if a.SID != nil {
+			b = append(b, a.SID.Bytes()...)
+		}
+		b = append(b, a.ApplicationData...)
+	}
+
+	// ACEs are DWORD aligned.
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(b)))
+	return b
+}
+
+// Bytes returns the security descriptor in self-relative form, suitable for
+// passing to the Windows API or storing in the registry.
+//
+// The parts are laid out in the same order Windows uses: SACL, DACL, owner,
+// then group.
+func (sd *SecurityDescriptor) Bytes() []byte {
+	rev := sd.Revision
+	if rev == 0 {
+		rev = SECURITY_DESCRIPTOR_REVISION
+	}
+	control := sd.Control | SE_SELF_RELATIVE
+	if sd.DACL != nil {
+		control |= SE_DACL_PRESENT
+	}
+	if sd.SACL != nil {
+		control |= SE_SACL_PRESENT
+	}
+
+	b := make([]byte, 20)
+	b[0] = rev
+	binary.LittleEndian.PutUint16(b[2:4], control)
+	if sd.SACL != nil {
+		binary.LittleEndian.PutUint32(b[12:16], uint32(len(b)))
+		b = append(b, sd.SACL.Bytes()...)
+	}
+	if sd.DACL != nil {
+		binary.LittleEndian.PutUint32(b[16:20], uint32(len(b)))
+		b = append(b, sd.DACL.Bytes()...)
+	}
+	if sd.Owner != nil {
+		binary.LittleEndian.PutUint32(b[4:8], uint32(len(b)))
+		b = append(b, sd.Owner.Bytes()...)
+	}
+	if sd.Group != nil {
+		binary.LittleEndian.PutUint32(b[8:12], uint32(len(b)))
+		b = append(b, sd.Group.Bytes()...)
+	}
+	return b
+}
+
+// HasNullDACL reports whether the descriptor has a NULL DACL, granting
+// everyone full access.
+func (sd *SecurityDescriptor) HasNullDACL() bool {
+	return sd.DACL == nil && sd.Control&SE_DACL_PRESENT != 0
+}
+
+// String returns the descriptor in SDDL form.
+func (sd *SecurityDescriptor) String() string {
+	s, err := sd.SDDL()
+	if err != nil {
+		return fmt.Sprintf("<invalid security descriptor: %s>", err)
+	}
+	return s
+}
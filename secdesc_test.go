@@ -0,0 +1,169 @@
+package winapi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// O:SYD:(A;;FA;;;WD) in self-relative form, laid out as Windows does:
+// header, DACL, owner.
+const testSDHex = "01000480" + "30000000" + "00000000" + "00000000" + "14000000" +
+	"02001c0001000000" +
+	"00001400" + "ff011f00" + "010100000000000100000000" +
+	"010100000000000512000000"
+
+func TestSIDRoundTrip(t *testing.T) {
+	for _, s := range []string{"S-1-5-18", "S-1-5-21-3623811015-3361044348-30300820-1013", "S-1-16-12288", "S-1-0x123456789ABC-1"} {
+		sid, err := ParseSID(s)
+		if err != nil {
+			t.Fatalf("ParseSID(%q): %v", s, err)
+		}
+		if sid.String() != s {
+			t.Errorf("ParseSID(%q).String() = %q", s, sid.String())
+		}
+		back, n, err := ReadSID(sid.Bytes())
+		if err != nil || n != sid.Len() || !back.Equal(sid) {
+			t.Errorf("binary round trip of %q = %v, %d, %v", s, back, n, err)
+		}
+	}
+
+	raw, _ := hex.DecodeString("010500000000000515000000c7bb00d87c2554c894571c01f5030000")
+	sid, _, err := ReadSID(raw)
+	if err != nil {
+		t.Fatalf("ReadSID: %v", err)
+	}
+	if want := "S-1-5-21-3623926727-3360957820-18634644-1013"; sid.String() != want {
+		t.Errorf("ReadSID = %s, want %s", sid, want)
+	}
+
+	for _, bad := range []string{"", "S-1", "X-1-5", "S-1-5-abc", "S-1-5-4294967296"} {
+		if _, err := ParseSID(bad); err == nil {
+			t.Errorf("ParseSID(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestGUIDRoundTrip(t *testing.T) {
+	g, err := ParseGUID("{BF967ABA-0DE6-11D0-A285-00AA003049E2}")
+	if err != nil {
+		t.Fatalf("ParseGUID: %v", err)
+	}
+	if want := "ba7a96bfe60dd011a28500aa003049e2"; hex.EncodeToString(g[:]) != want {
+		t.Errorf("binary GUID = %x, want %s", g[:], want)
+	}
+	if g.String() != "bf967aba-0de6-11d0-a285-00aa003049e2" {
+		t.Errorf("GUID.String() = %s", g)
+	}
+}
+
+func TestParseSecurityDescriptor(t *testing.T) {
+	raw, _ := hex.DecodeString(testSDHex)
+	sd, err := ParseSecurityDescriptor(raw)
+	if err != nil {
+		t.Fatalf("ParseSecurityDescriptor: %v", err)
+	}
+	if sd.Owner.String() != "S-1-5-18" || sd.Group != nil || sd.SACL != nil {
+		t.Errorf("unexpected descriptor: %+v", sd)
+	}
+	if len(sd.DACL.Entries) != 1 {
+		t.Fatalf("expected 1 ACE, got %d", len(sd.DACL.Entries))
+	}
+	ace := sd.DACL.Entries[0]
+	if ace.Type != ACCESS_ALLOWED_ACE_TYPE || ace.Mask != FILE_ALL_ACCESS || ace.SID.String() != "S-1-1-0" {
+		t.Errorf("unexpected ACE: %+v", ace)
+	}
+	if got := sd.String(); got != "O:SYD:(A;;FA;;;WD)" {
+		t.Errorf("SDDL = %q", got)
+	}
+	if !bytes.Equal(sd.Bytes(), raw) {
+		t.Errorf("re-encoded descriptor differs:\n got %x\nwant %x", sd.Bytes(), raw)
+	}
+
+	for i := 1; i < len(raw); i += 7 {
+		if _, err := ParseSecurityDescriptor(raw[:i]); err == nil {
+			t.Errorf("ParseSecurityDescriptor accepted truncated buffer of %d bytes", i)
+		}
+	}
+}
+
+func TestBinaryRoundTripObjectACEs(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:BAD:AI(OA;CI;RPWP;bf967aba-0de6-11d0-a285-00aa003049e2;4828cc14-1437-45bc-9b07-ad6f015e5f28;PS)(A;;0x1f01ff;;;SY)S:AI(AU;SAFA;WDWO;;;WD)")
+	if err != nil {
+		t.Fatalf("ParseSDDL: %v", err)
+	}
+	raw := sd.Bytes()
+	back, err := ParseSecurityDescriptor(raw)
+	if err != nil {
+		t.Fatalf("ParseSecurityDescriptor: %v", err)
+	}
+	if back.DACL.Revision != ACL_REVISION_DS {
+		t.Errorf("DACL with object ACEs has revision %d", back.DACL.Revision)
+	}
+	if sd.String() != back.String() {
+		t.Errorf("round trip changed descriptor:\n got %s\nwant %s", back, sd)
+	}
+	if !bytes.Equal(back.Bytes(), raw) {
+		t.Errorf("second encoding differs")
+	}
+}
+
+func TestUnknownACEPreserved(t *testing.T) {
+	// Callback ACE with trailing application data.
+	acl := NewACL()
+	sid, _ := ParseSID("S-1-1-0")
+	acl.Entries = append(acl.Entries, ACE{Type: ACCESS_ALLOWED_CALLBACK_ACE_TYPE, Mask: 1, SID: sid, ApplicationData: []byte("artx")})
+	back, err := ParseACL(acl.Bytes())
+	if err != nil {
+		t.Fatalf("ParseACL: %v", err)
+	}
+	if string(back.Entries[0].ApplicationData) != "artx" {
+		t.Errorf("application data lost: %+v", back.Entries[0])
+	}
+	if _, err := back.SDDL(); err == nil {
+		t.Errorf("expected error formatting callback ACE with application data")
+	}
+}
+
+func TestACLBuilderAndCanonicalize(t *testing.T) {
+	users, _ := ParseSID("S-1-5-32-545")
+	admins, _ := ParseSID("S-1-5-32-544")
+	guests, _ := ParseSID("S-1-5-32-546")
+
+	acl := NewACL().
+		Allow(users, FILE_GENERIC_READ|FILE_GENERIC_EXECUTE, OBJECT_INHERIT_ACE|CONTAINER_INHERIT_ACE).
+		Allow(admins, FILE_ALL_ACCESS, INHERITED_ACE).
+		Deny(guests, FILE_ALL_ACCESS, 0)
+	acl.Canonicalize()
+
+	got, err := acl.SDDL()
+	if err != nil {
+		t.Fatalf("SDDL: %v", err)
+	}
+	if want := "(D;;FA;;;BG)(A;OICI;0x1200a9;;;BU)(A;ID;FA;;;BA)"; got != want {
+		t.Errorf("SDDL = %s, want %s", got, want)
+	}
+}
+
+func TestSecurityDescriptorJSON(t *testing.T) {
+	sd, err := ParseSDDL("O:S-1-5-21-1-2-3-500D:(A;;KR;;;BU)")
+	if err != nil {
+		t.Fatalf("ParseSDDL: %v", err)
+	}
+	j, err := json.Marshal(sd)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if !strings.Contains(string(j), `"owner":"S-1-5-21-1-2-3-500"`) || !strings.Contains(string(j), `"sid":"S-1-5-32-545"`) {
+		t.Errorf("unexpected JSON: %s", j)
+	}
+	var back SecurityDescriptor
+	if err := json.Unmarshal(j, &back); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if back.String() != sd.String() {
+		t.Errorf("JSON round trip = %s, want %s", back.String(), sd.String())
+	}
+}
@@ -0,0 +1,252 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	secGetNamedSecurityInfoW       = modAdvapi32.NewProc("GetNamedSecurityInfoW")
+	secSetNamedSecurityInfoW       = modAdvapi32.NewProc("SetNamedSecurityInfoW")
+	secGetSecurityDescriptorLength = modAdvapi32.NewProc("GetSecurityDescriptorLength")
+)
+
+// SE_OBJECT_TYPE values, for GetNamedSecurityDescriptor and
+// SetNamedSecurityDescriptor.
+const (
+	SE_FILE_OBJECT  = 1
+	SE_SERVICE      = 2
+	SE_PRINTER      = 3
+	SE_REGISTRY_KEY = 4
+	SE_LMSHARE      = 5
+)
+
+// SECURITY_INFORMATION flags, selecting which parts of a security descriptor
+// to read or write.
+const (
+	OWNER_SECURITY_INFORMATION            = 0x00000001
+	GROUP_SECURITY_INFORMATION            = 0x00000002
+	DACL_SECURITY_INFORMATION             = 0x00000004
+	SACL_SECURITY_INFORMATION             = 0x00000008
+	LABEL_SECURITY_INFORMATION            = 0x00000010
+	UNPROTECTED_SACL_SECURITY_INFORMATION = 0x10000000
+	UNPROTECTED_DACL_SECURITY_INFORMATION = 0x20000000
+	PROTECTED_SACL_SECURITY_INFORMATION   = 0x40000000
+	PROTECTED_DACL_SECURITY_INFORMATION   = 0x80000000
+)
+
+// GetNamedSecurityDescriptor reads the parts of an object's security
+// descriptor selected by info (a combination of *_SECURITY_INFORMATION flags).
+//
+// objectType is one of the SE_* object types, and name is in the format
+// GetNamedSecurityInfo expects for it. Reading the SACL requires
+// SeSecurityPrivilege.
+//
+// If the call fails, the returned error will be a syscall.Errno.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/aclapi/nf-aclapi-getnamedsecurityinfow
+func GetNamedSecurityDescriptor(objectType uint32, name string, info uint32) (*SecurityDescriptor, error) {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode object name to UTF16: %s", err)
+	}
+
+	var sdPointer uintptr
+	ret, _, _ := secGetNamedSecurityInfoW.Call(
+		uintptr(unsafe.Pointer(namePtr)),    // object name
+		uintptr(objectType),                 // object type
+		uintptr(info),                       // security info
+		uintptr(0),                          // owner
+		uintptr(0),                          // group
+		uintptr(0),                          // DACL
+		uintptr(0),                          // SACL
+		uintptr(unsafe.Pointer(&sdPointer)), // security descriptor
+	)
+	if ret != 0 {
+		return nil, syscall.Errno(ret)
+	}
+	if sdPointer == 0 {
+		return nil, fmt.Errorf("null pointer while fetching security descriptor")
+	}
+	defer usrLocalFree.Call(sdPointer)
+
+	// The returned descriptor is self-relative, so it's a single buffer.
+	length, _, _ := secGetSecurityDescriptorLength.Call(sdPointer)
+	raw := make([]byte, length)
+	copy(raw, (*[1 << 20]byte)(unsafe.Pointer(sdPointer))[:length:length])
+
+	return ParseSecurityDescriptor(raw)
+}
+
+// SetNamedSecurityDescriptor writes the parts of sd selected by info (a
+// combination of *_SECURITY_INFORMATION flags) to an object.
+//
+// When DACL_SECURITY_INFORMATION is set, whether the DACL inherits from the
+// object's parent is taken from SE_DACL_PROTECTED in sd.Control, and likewise
+// for the SACL. A nil sd.DACL is written as a NULL DACL, granting everyone
+// full access.
+//
+// If the call fails, the returned error will be a syscall.Errno.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/aclapi/nf-aclapi-setnamedsecurityinfow
+func SetNamedSecurityDescriptor(objectType uint32, name string, sd *SecurityDescriptor, info uint32) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return fmt.Errorf("Unable to encode object name to UTF16: %s", err)
+	}
+
+	var owner, group, dacl, sacl []byte
+	if info&OWNER_SECURITY_INFORMATION != 0 {
+		if sd.Owner == nil {
+			return fmt.Errorf("Security descriptor has no owner")
+		}
+		owner = sd.Owner.Bytes()
+	}
+	if info&GROUP_SECURITY_INFORMATION != 0 {
+		if sd.Group == nil {
+			return fmt.Errorf("Security descriptor has no group")
+		}
+		group = sd.Group.Bytes()
+	}
+	if info&DACL_SECURITY_INFORMATION != 0 {
+		if sd.DACL != nil {
+			dacl = sd.DACL.Bytes()
+		}
+		if sd.Control&SE_DACL_PROTECTED != 0 {
+			info |= PROTECTED_DACL_SECURITY_INFORMATION
+		} else {
+			info |= UNPROTECTED_DACL_SECURITY_INFORMATION
+		}
+	}
+	if info&(SACL_SECURITY_INFORMATION|LABEL_SECURITY_INFORMATION) != 0 {
+		if sd.SACL != nil {
+			sacl = sd.SACL.Bytes()
+		}
+		if info&SACL_SECURITY_INFORMATION != 0 {
+			if sd.Control&SE_SACL_PROTECTED != 0 {
+				info |= PROTECTED_SACL_SECURITY_INFORMATION
+			} else {
+				info |= UNPROTECTED_SACL_SECURITY_INFORMATION
+			}
+		}
+	}
+
+	// Empty parts are passed as NULL. The pointers are only converted to
+	// uintptr in the call itself, keeping the buffers alive until it returns.
+	var ownerPtr, groupPtr, daclPtr, saclPtr *byte
+	if len(owner) > 0 {
+		ownerPtr = &owner[0]
+	}
+	if len(group) > 0 {
+		groupPtr = &group[0]
+	}
+	if len(dacl) > 0 {
+		daclPtr = &dacl[0]
+	}
+	if len(sacl) > 0 {
+		saclPtr = &sacl[0]
+	}
+	ret, _, _ := secSetNamedSecurityInfoW.Call(
+		uintptr(unsafe.Pointer(namePtr)),  // object name
+		uintptr(objectType),               // object type
+		uintptr(info),                     // security info
+		uintptr(unsafe.Pointer(ownerPtr)), // owner
+		uintptr(unsafe.Pointer(groupPtr)), // group
+		uintptr(unsafe.Pointer(daclPtr)),  // DACL, NULL for a NULL DACL
+		uintptr(unsafe.Pointer(saclPtr)),  // SACL
+	)
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+// GetFileSecurity returns the owner, group and DACL of a file or directory.
+func GetFileSecurity(path string) (*SecurityDescriptor, error) {
+	return GetNamedSecurityDescriptor(SE_FILE_OBJECT, path, OWNER_SECURITY_INFORMATION|GROUP_SECURITY_INFORMATION|DACL_SECURITY_INFORMATION)
+}
+
+// SetFileDACL replaces the DACL of a file or directory. dacl must not be nil,
+// see SetNamedNullDACL for that.
+//
+// If protected is false, ACEs inheritable from the parent directory are
+// merged in, and inherited ACEs in dacl are ignored.
+func SetFileDACL(path string, dacl *ACL, protected bool) error {
+	return setNamedDACL(SE_FILE_OBJECT, path, dacl, protected)
+}
+
+// GetServiceSecurity returns the owner, group and DACL of a service.
+func GetServiceSecurity(name string) (*SecurityDescriptor, error) {
+	return GetNamedSecurityDescriptor(SE_SERVICE, name, OWNER_SECURITY_INFORMATION|GROUP_SECURITY_INFORMATION|DACL_SECURITY_INFORMATION)
+}
+
+// SetServiceDACL replaces the DACL of a service, controlling who can start,
+// stop and configure it. dacl must not be nil.
+func SetServiceDACL(name string, dacl *ACL) error {
+	return setNamedDACL(SE_SERVICE, name, dacl, true)
+}
+
+// GetRegistryKeySecurity returns the owner, group and DACL of a registry key.
+//
+// The key may be given with a hive prefix such as HKLM\ or
+// HKEY_LOCAL_MACHINE\, or in the MACHINE\ form GetNamedSecurityInfo uses.
+func GetRegistryKeySecurity(key string) (*SecurityDescriptor, error) {
+	return GetNamedSecurityDescriptor(SE_REGISTRY_KEY, registrySecurityPath(key), OWNER_SECURITY_INFORMATION|GROUP_SECURITY_INFORMATION|DACL_SECURITY_INFORMATION)
+}
+
+// SetRegistryKeyDACL replaces the DACL of a registry key, see SetFileDACL for
+// the meaning of protected. dacl must not be nil.
+func SetRegistryKeyDACL(key string, dacl *ACL, protected bool) error {
+	return setNamedDACL(SE_REGISTRY_KEY, registrySecurityPath(key), dacl, protected)
+}
+
+// SetNamedNullDACL gives an object a NULL DACL, which grants everyone full
+// access to it, unlike an empty DACL, which grants no access at all.
+//
+// objectType is one of the SE_* object types, and name is in the format
+// SetNamedSecurityInfo expects for it.
+func SetNamedNullDACL(objectType uint32, name string) error {
+	sd := &SecurityDescriptor{Control: SE_DACL_PRESENT | SE_DACL_PROTECTED}
+	return SetNamedSecurityDescriptor(objectType, name, sd, DACL_SECURITY_INFORMATION)
+}
+
+// setNamedDACL refuses a nil DACL, so a missing one is never silently
+// written as a NULL DACL.
+func setNamedDACL(objectType uint32, name string, dacl *ACL, protected bool) error {
+	if dacl == nil {
+		return fmt.Errorf("No DACL given, use SetNamedNullDACL to set a NULL DACL")
+	}
+	sd := &SecurityDescriptor{DACL: dacl, Control: SE_DACL_PRESENT}
+	if protected {
+		sd.Control |= SE_DACL_PROTECTED
+	}
+	return SetNamedSecurityDescriptor(objectType, name, sd, DACL_SECURITY_INFORMATION)
+}
+
+// registrySecurityPath converts a key path with a hive prefix into the form
+// expected by the *NamedSecurityInfo functions.
+func registrySecurityPath(key string) string {
+	prefixes := map[string]string{
+		"HKLM":                "MACHINE",
+		"HKEY_LOCAL_MACHINE":  "MACHINE",
+		"HKU":                 "USERS",
+		"HKEY_USERS":          "USERS",
+		"HKCU":                "CURRENT_USER",
+		"HKEY_CURRENT_USER":   "CURRENT_USER",
+		"HKCR":                "CLASSES_ROOT",
+		"HKEY_CLASSES_ROOT":   "CLASSES_ROOT",
+		"HKCC":                "MACHINE\\SYSTEM\\CurrentControlSet\\Hardware Profiles\\Current",
+		"HKEY_CURRENT_CONFIG": "MACHINE\\SYSTEM\\CurrentControlSet\\Hardware Profiles\\Current",
+	}
+	hive, rest := key, ""
+	if i := strings.IndexByte(key, '\\'); i >= 0 {
+		hive, rest = key[:i], key[i:]
+	}
+	if p, ok := prefixes[strings.ToUpper(hive)]; ok {
+		return p + rest
+	}
+	return key
+}
@@ -0,0 +1,232 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	wtsRegisterSessionNotification   = modWtsapi32.NewProc("WTSRegisterSessionNotification")
+	wtsUnRegisterSessionNotification = modWtsapi32.NewProc("WTSUnRegisterSessionNotification")
+
+	usrRegisterClassEx  = modUser32.NewProc("RegisterClassExW")
+	usrUnregisterClass  = modUser32.NewProc("UnregisterClassW")
+	usrCreateWindowEx   = modUser32.NewProc("CreateWindowExW")
+	usrDestroyWindow    = modUser32.NewProc("DestroyWindow")
+	usrDefWindowProc    = modUser32.NewProc("DefWindowProcW")
+	usrGetMessage       = modUser32.NewProc("GetMessageW")
+	usrDispatchMessage  = modUser32.NewProc("DispatchMessageW")
+	procGetModuleHandle = modKernel32.NewProc("GetModuleHandleW")
+)
+
+const (
+	WM_QUIT                 = 0x0012
+	WM_WTSSESSION_CHANGE    = 0x02B1
+	HWND_MESSAGE            = ^uintptr(2) // (HWND)-3
+	NOTIFY_FOR_ALL_SESSIONS = 1
+
+	sessionWindowClass = "go-win64api-session-notify"
+)
+
+type WNDCLASSEX struct {
+	Size       uint32
+	Style      uint32
+	WndProc    uintptr
+	ClsExtra   int32
+	WndExtra   int32
+	Instance   uintptr
+	Icon       uintptr
+	Cursor     uintptr
+	Background uintptr
+	MenuName   *uint16
+	ClassName  *uint16
+	IconSm     uintptr
+}
+
+type MSG struct {
+	Hwnd    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      struct{ X, Y int32 }
+}
+
+var (
+	// Callbacks are a limited resource, so the window procedure is only
+	// created once, and finds its watcher by window handle.
+	sessionWndProcCallback = syscall.NewCallback(sessionWndProc)
+	sessionWindowsMu       sync.Mutex
+	sessionWindows         = make(map[uintptr]*SessionWatcher)
+	sessionClassOnce       sync.Once
+	sessionClassErr        error
+)
+
+// WatchSessions starts a SessionWatcher, which emits an event as users log on
+// or off, disconnect or reconnect, and lock or unlock their sessions, until
+// ctx is done.
+//
+// Notifications come from WTSRegisterSessionNotification, or the service
+// control handler with opts.Service. If registering fails the error is passed
+// to opts.OnError and the watcher polls instead. Polled events can be up to an
+// interval late, and lock changes are only seen where the session's lock state
+// is available.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsregistersessionnotification
+func WatchSessions(ctx context.Context, opts SessionWatchOptions) *SessionWatcher {
+	if opts.Source == nil {
+		src := &wtsSessionSource{list: ListSessions, state: sessionState}
+		opts.Source = src.sessions
+	}
+	resolve := func(sessionID uint32) (string, string, bool) {
+		s, err := SessionInfo(sessionID)
+		if err != nil {
+			return "", "", false
+		}
+		return s.Username, s.Domain, true
+	}
+	if opts.Poll || opts.Service {
+		return newSessionWatcher(ctx, opts, opts.Poll, resolve)
+	}
+
+	// The watcher has to exist before the window can deliver to it, so it's
+	// started without polling, and a second, polling watcher replaces it if
+	// the window can't be created.
+	notifyCtx, cancel := context.WithCancel(ctx)
+	w := newSessionWatcher(notifyCtx, opts, false, resolve)
+	if err := watchSessionWindow(notifyCtx, w); err != nil {
+		cancel()
+		if opts.OnError != nil {
+			opts.OnError(err)
+		}
+		return newSessionWatcher(ctx, opts, true, resolve)
+	}
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return w
+}
+
+// ServiceSessionChange passes on a SERVICE_CONTROL_SESSIONCHANGE received by
+// a service's control handler, with its event type and data. With
+// golang.org/x/sys/windows/svc these are the ChangeRequest's EventType and
+// EventData, and the service must accept svc.AcceptSessionChange.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winsvc/nc-winsvc-lphandler_function_ex
+func (w *SessionWatcher) ServiceSessionChange(eventType uint32, eventData uintptr) {
+	if eventData == 0 {
+		return
+	}
+	// WTSSESSION_NOTIFICATION is a cbSize followed by the session ID.
+	notification := (*[2]uint32)(unsafe.Pointer(eventData))
+	w.SessionChange(eventType, notification[1])
+}
+
+// watchSessionWindow creates a message-only window registered for session
+// notifications, on a thread of its own, delivering them to w until ctx is
+// done.
+func watchSessionWindow(ctx context.Context, w *SessionWatcher) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hwnd, err := createSessionWindow()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer usrDestroyWindow.Call(hwnd)
+
+		if ret, _, lastError := wtsRegisterSessionNotification.Call(hwnd, uintptr(NOTIFY_FOR_ALL_SESSIONS)); ret == 0 {
+			errc <- fmt.Errorf("Unable to register for session notifications: %s", lastError)
+			return
+		}
+		defer wtsUnRegisterSessionNotification.Call(hwnd)
+
+		sessionWindowsMu.Lock()
+		sessionWindows[hwnd] = w
+		sessionWindowsMu.Unlock()
+		defer func() {
+			sessionWindowsMu.Lock()
+			delete(sessionWindows, hwnd)
+			sessionWindowsMu.Unlock()
+		}()
+		errc <- nil
+
+		go func() {
+			<-ctx.Done()
+			procPostMessage.Call(hwnd, uintptr(WM_QUIT), 0, 0)
+		}()
+
+		var msg MSG
+		for {
+			ret, _, _ := usrGetMessage.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			// 0 is WM_QUIT, and -1 an error.
+			if ret == 0 || int32(ret) == -1 {
+				return
+			}
+			usrDispatchMessage.Call(uintptr(unsafe.Pointer(&msg)))
+		}
+	}()
+	return <-errc
+}
+
+// createSessionWindow creates a message-only window, registering its class
+// the first time.
+// See: https://docs.microsoft.com/en-us/windows/win32/winmsg/window-features#message-only-windows
+func createSessionWindow() (uintptr, error) {
+	className, _ := syscall.UTF16PtrFromString(sessionWindowClass)
+	instance, _, _ := procGetModuleHandle.Call(0)
+
+	sessionClassOnce.Do(func() {
+		wc := WNDCLASSEX{
+			WndProc:   sessionWndProcCallback,
+			Instance:  instance,
+			ClassName: className,
+		}
+		wc.Size = uint32(unsafe.Sizeof(wc))
+		if ret, _, lastError := usrRegisterClassEx.Call(uintptr(unsafe.Pointer(&wc))); ret == 0 {
+			sessionClassErr = fmt.Errorf("Unable to register window class: %s", lastError)
+		}
+	})
+	if sessionClassErr != nil {
+		return 0, sessionClassErr
+	}
+
+	hwnd, _, lastError := usrCreateWindowEx.Call(
+		uintptr(0), // extended style
+		uintptr(unsafe.Pointer(className)),
+		uintptr(0),                                     // window name
+		uintptr(0),                                     // style
+		uintptr(0), uintptr(0), uintptr(0), uintptr(0), // position and size
+		HWND_MESSAGE,
+		uintptr(0), // menu
+		instance,
+		uintptr(0), // creation data
+	)
+	if hwnd == 0 {
+		return 0, fmt.Errorf("Unable to create notification window: %s", lastError)
+	}
+	return hwnd, nil
+}
+
+func sessionWndProc(hwnd uintptr, msg uint32, wParam uintptr, lParam uintptr) uintptr {
+	if msg == WM_WTSSESSION_CHANGE {
+		sessionWindowsMu.Lock()
+		w := sessionWindows[hwnd]
+		sessionWindowsMu.Unlock()
+		if w != nil {
+			w.SessionChange(uint32(wParam), uint32(lParam))
+		}
+		return 0
+	}
+	ret, _, _ := usrDefWindowProc.Call(hwnd, uintptr(msg), wParam, lParam)
+	return ret
+}
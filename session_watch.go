@@ -0,0 +1,282 @@
+package winapi
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// DefaultSessionWatchInterval is used when SessionWatchOptions.Interval is
+// zero.
+const DefaultSessionWatchInterval = 5 * time.Second
+
+// SessionWatchOptions configures WatchSessions.
+type SessionWatchOptions struct {
+	// Poll compares snapshots every Interval instead of registering for
+	// session notifications. Polling is also used if registering fails.
+	Poll bool
+	// Interval between snapshots when polling.
+	Interval time.Duration
+	// Source lists the logged in users when polling, by default one per
+	// Remote Desktop Services session with a user, so that each of a user's
+	// sessions is seen to log on and off.
+	Source func() ([]so.SessionDetails, error)
+	// Service is set when running as a service, which can't use window
+	// based notifications. The service's control handler must accept
+	// SERVICE_CONTROL_SESSIONCHANGE and pass each one to
+	// SessionWatcher.ServiceSessionChange.
+	Service bool
+	// OnError is called with errors from the source or notifications. The
+	// watcher carries on regardless.
+	OnError func(error)
+	// BufferSize of the events channel, 64 if zero.
+	BufferSize int
+}
+
+// SessionWatcher emits SessionEvents until its context is done, at which point
+// the events channel is closed.
+type SessionWatcher struct {
+	events        chan so.SessionEvent
+	notifications chan sessionNotification
+	done          <-chan struct{}
+}
+
+// sessionNotification is a WTS_* session change code for a session.
+type sessionNotification struct {
+	eventType uint32
+	sessionID uint32
+}
+
+// Events returns the channel events are delivered on.
+func (w *SessionWatcher) Events() <-chan so.SessionEvent {
+	return w.events
+}
+
+// SessionChange reports a session change notification, with its WTS_* event
+// type, to the watcher. It blocks while the watcher is behind, until its
+// context is done.
+func (w *SessionWatcher) SessionChange(eventType uint32, sessionID uint32) {
+	select {
+	case w.notifications <- sessionNotification{eventType, sessionID}:
+	case <-w.done:
+	}
+}
+
+// newSessionWatcher starts a watcher. If poll is set, opts.Source must be set
+// and is compared every interval; notifications passed to SessionChange are
+// delivered either way, with the session's user looked up with resolve.
+func newSessionWatcher(ctx context.Context, opts SessionWatchOptions, poll bool, resolve func(sessionID uint32) (string, string, bool)) *SessionWatcher {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultSessionWatchInterval
+	}
+	size := opts.BufferSize
+	if size <= 0 {
+		size = 64
+	}
+	w := &SessionWatcher{
+		events:        make(chan so.SessionEvent, size),
+		notifications: make(chan sessionNotification, size),
+		done:          ctx.Done(),
+	}
+
+	go func() {
+		defer close(w.events)
+
+		emit := func(events []so.SessionEvent) bool {
+			for _, ev := range events {
+				select {
+				case w.events <- ev:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+		snapshot := func() ([]so.SessionDetails, bool) {
+			sessions, err := opts.Source()
+			if err != nil {
+				if opts.OnError != nil {
+					opts.OnError(err)
+				}
+				return nil, false
+			}
+			return sessions, true
+		}
+
+		// Users are remembered so a logoff can still be attributed once the
+		// session has gone.
+		users := make(map[uint32][2]string)
+		var previous []so.SessionDetails
+		var baselined bool
+		var ticks <-chan time.Time
+		if poll {
+			previous, baselined = snapshot()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-w.notifications:
+				ev := so.SessionEvent{Type: n.eventType, SessionID: n.sessionID, Time: time.Now()}
+				if user, domain, ok := resolve(n.sessionID); ok && user != "" {
+					users[n.sessionID] = [2]string{user, domain}
+				}
+				ev.Username, ev.Domain = users[n.sessionID][0], users[n.sessionID][1]
+				if n.eventType == so.SESS_EVENT_LOGOFF {
+					delete(users, n.sessionID)
+				}
+				if !emit([]so.SessionEvent{ev}) {
+					return
+				}
+			case <-ticks:
+				current, ok := snapshot()
+				if !ok {
+					continue
+				}
+				// Until a first snapshot succeeds, everyone would look new.
+				if !baselined {
+					previous, baselined = current, true
+					continue
+				}
+				events := diffSessions(previous, current, time.Now())
+				previous = current
+				if !emit(events) {
+					return
+				}
+			}
+		}
+	}()
+
+	return w
+}
+
+// sessionKey identifies one logon of a user to a session, as session IDs are
+// reused.
+type sessionKey struct {
+	sessionID uint32
+	user      string
+	logonTime int64
+}
+
+func keyOf(s so.SessionDetails) sessionKey {
+	return sessionKey{s.SessionID, strings.ToLower(s.FullUser()), s.LogonTime.UnixNano()}
+}
+
+// wtsSessionSource lists a SessionDetails for each WTS session with a user,
+// rather than each user as ListLoggedInUsers does, for a SessionWatcher to
+// poll. Only the fields a SessionWatcher compares are filled in.
+type wtsSessionSource struct {
+	list  func() ([]so.WTSSession, error)
+	state func(sessionID uint32) (disconnected bool, locked bool, err error)
+
+	// logonTypes remembers the logon type of each session listed last time,
+	// as a disconnected session no longer has a window station name to tell
+	// whether it's remote.
+	logonTypes map[sessionKey]uint32
+}
+
+func (src *wtsSessionSource) sessions() ([]so.SessionDetails, error) {
+	list, err := src.list()
+	if err != nil {
+		return nil, err
+	}
+	logonTypes := make(map[sessionKey]uint32, len(list))
+	retVal := make([]so.SessionDetails, 0, len(list))
+	for _, s := range list {
+		if s.Username == "" {
+			continue
+		}
+		d := so.SessionDetails{
+			Username:     s.Username,
+			Domain:       s.Domain,
+			LogonType:    so.SESS_INTERACTIVE_LOGON,
+			LogonTime:    s.LogonTime,
+			SessionID:    s.SessionID,
+			Disconnected: s.State == so.WTS_STATE_DISCONNECTED,
+		}
+		switch {
+		case strings.EqualFold(s.WinStationName, "Console"):
+		case s.WinStationName != "":
+			d.LogonType = so.SESS_REMOTE_INTERACTIVE_LOGON
+		default:
+			if t, ok := src.logonTypes[keyOf(d)]; ok {
+				d.LogonType = t
+			}
+		}
+		if disconnected, locked, err := src.state(s.SessionID); err == nil {
+			d.Disconnected, d.Locked = disconnected, locked
+		}
+		logonTypes[keyOf(d)] = d.LogonType
+		retVal = append(retVal, d)
+	}
+	src.logonTypes = logonTypes
+	return retVal, nil
+}
+
+// diffSessions returns the events between two snapshots of logged in users:
+// logoffs, then changes to connection and lock state, then logons, each
+// ordered by session ID.
+func diffSessions(previous, current []so.SessionDetails, now time.Time) []so.SessionEvent {
+	before := make(map[sessionKey]so.SessionDetails, len(previous))
+	for _, s := range previous {
+		before[keyOf(s)] = s
+	}
+	after := make(map[sessionKey]bool, len(current))
+	for _, s := range current {
+		after[keyOf(s)] = true
+	}
+
+	event := func(eventType uint32, s so.SessionDetails) so.SessionEvent {
+		return so.SessionEvent{Type: eventType, SessionID: s.SessionID, Username: s.Username, Domain: s.Domain, Time: now}
+	}
+	var logoffs, changes, logons []so.SessionEvent
+	for k, s := range before {
+		if !after[k] {
+			logoffs = append(logoffs, event(so.SESS_EVENT_LOGOFF, s))
+		}
+	}
+	for _, s := range current {
+		old, ok := before[keyOf(s)]
+		if !ok {
+			logons = append(logons, event(so.SESS_EVENT_LOGON, s))
+			continue
+		}
+		remote := s.LogonType == so.SESS_REMOTE_INTERACTIVE_LOGON
+		switch {
+		case !old.Disconnected && s.Disconnected && remote:
+			changes = append(changes, event(so.SESS_EVENT_REMOTE_DISCONNECT, s))
+		case !old.Disconnected && s.Disconnected:
+			changes = append(changes, event(so.SESS_EVENT_CONSOLE_DISCONNECT, s))
+		case old.Disconnected && !s.Disconnected && remote:
+			changes = append(changes, event(so.SESS_EVENT_REMOTE_CONNECT, s))
+		case old.Disconnected && !s.Disconnected:
+			changes = append(changes, event(so.SESS_EVENT_CONSOLE_CONNECT, s))
+		}
+		switch {
+		case !old.Locked && s.Locked:
+			changes = append(changes, event(so.SESS_EVENT_LOCK, s))
+		case old.Locked && !s.Locked:
+			changes = append(changes, event(so.SESS_EVENT_UNLOCK, s))
+		}
+	}
+
+	events := make([]so.SessionEvent, 0, len(logoffs)+len(changes)+len(logons))
+	for _, group := range [][]so.SessionEvent{logoffs, changes, logons} {
+		sort.SliceStable(group, func(i, j int) bool {
+			if group[i].SessionID != group[j].SessionID {
+				return group[i].SessionID < group[j].SessionID
+			}
+			return group[i].FullUser() < group[j].FullUser()
+		})
+		events = append(events, group...)
+	}
+	return events
+}
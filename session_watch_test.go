@@ -0,0 +1,284 @@
+package winapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var sessionEpoch = time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+func user(id uint32, name string, logonType uint32, minutes int) so.SessionDetails {
+	return so.SessionDetails{
+		Username:  name,
+		Domain:    "CORP",
+		LogonType: logonType,
+		LogonTime: sessionEpoch.Add(time.Duration(minutes) * time.Minute),
+		SessionID: id,
+	}
+}
+
+func disconnected(s so.SessionDetails) so.SessionDetails {
+	s.Disconnected = true
+	return s
+}
+
+func locked(s so.SessionDetails) so.SessionDetails {
+	s.Locked = true
+	return s
+}
+
+type sessionEventSummary struct {
+	Type      string
+	SessionID uint32
+	User      string
+}
+
+func summariseSessions(events []so.SessionEvent) []sessionEventSummary {
+	retVal := make([]sessionEventSummary, 0, len(events))
+	for _, ev := range events {
+		retVal = append(retVal, sessionEventSummary{ev.GetType(), ev.SessionID, ev.FullUser()})
+	}
+	return retVal
+}
+
+func TestDiffSessions(t *testing.T) {
+	alice := user(1, "alice", so.SESS_INTERACTIVE_LOGON, 0)
+	bob := user(2, "bob", so.SESS_REMOTE_INTERACTIVE_LOGON, 5)
+	carol := user(3, "carol", so.SESS_REMOTE_INTERACTIVE_LOGON, 10)
+	dave := user(2, "dave", so.SESS_REMOTE_INTERACTIVE_LOGON, 20) // reuses bob's session ID
+
+	previous := []so.SessionDetails{alice, bob, carol}
+	current := []so.SessionDetails{locked(alice), dave, disconnected(locked(carol))}
+	got := summariseSessions(diffSessions(previous, current, sessionEpoch))
+	want := []sessionEventSummary{
+		{"LOGOFF", 2, "CORP\\bob"},
+		{"LOCK", 1, "CORP\\alice"},
+		{"REMOTE_DISCONNECT", 3, "CORP\\carol"},
+		{"LOCK", 3, "CORP\\carol"},
+		{"LOGON", 2, "CORP\\dave"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSessions = %+v, want %+v", got, want)
+	}
+
+	got = summariseSessions(diffSessions(current, []so.SessionDetails{disconnected(alice), dave, carol}, sessionEpoch))
+	want = []sessionEventSummary{
+		{"CONSOLE_DISCONNECT", 1, "CORP\\alice"},
+		{"UNLOCK", 1, "CORP\\alice"},
+		{"REMOTE_CONNECT", 3, "CORP\\carol"},
+		{"UNLOCK", 3, "CORP\\carol"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSessions = %+v, want %+v", got, want)
+	}
+
+	if ev := diffSessions(current, current, sessionEpoch); len(ev) != 0 {
+		t.Errorf("unchanged sessions produced events: %+v", summariseSessions(ev))
+	}
+}
+
+func TestWTSSessionSource(t *testing.T) {
+	wts := func(id uint32, station string, state uint32, name string, minutes int) so.WTSSession {
+		return so.WTSSession{
+			SessionID:      id,
+			WinStationName: station,
+			State:          state,
+			Username:       name,
+			Domain:         "CORP",
+			LogonTime:      sessionEpoch.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+	services := wts(0, "Services", so.WTS_STATE_DISCONNECTED, "", 0)
+	listener := wts(65536, "RDP-Tcp", so.WTS_STATE_LISTEN, "", 0)
+	steps := [][]so.WTSSession{
+		{services, wts(1, "Console", so.WTS_STATE_ACTIVE, "alice", 0), wts(2, "RDP-Tcp#0", so.WTS_STATE_ACTIVE, "alice", 5), listener},
+		// alice opens a second RDP session, and disconnects the first.
+		{services, wts(1, "Console", so.WTS_STATE_ACTIVE, "alice", 0), wts(2, "", so.WTS_STATE_DISCONNECTED, "alice", 5), wts(3, "RDP-Tcp#1", so.WTS_STATE_ACTIVE, "alice", 9), listener},
+		// Then logs off the disconnected one.
+		{services, wts(1, "Console", so.WTS_STATE_ACTIVE, "alice", 0), wts(3, "RDP-Tcp#1", so.WTS_STATE_ACTIVE, "alice", 9), listener},
+	}
+	step := 0
+	src := &wtsSessionSource{
+		list: func() ([]so.WTSSession, error) {
+			if step == len(steps) {
+				return nil, fmt.Errorf("no more sessions")
+			}
+			step++
+			return steps[step-1], nil
+		},
+		state: func(sessionID uint32) (bool, bool, error) {
+			// Session 1 is locked; the rest have no lock state to report.
+			if sessionID == 1 {
+				return false, true, nil
+			}
+			return false, false, fmt.Errorf("not supported")
+		},
+	}
+
+	first, err := src.sessions()
+	if err != nil {
+		t.Fatalf("sessions: %s", err)
+	}
+	alice := user(1, "alice", so.SESS_INTERACTIVE_LOGON, 0)
+	alice.Locked = true
+	if want := []so.SessionDetails{alice, user(2, "alice", so.SESS_REMOTE_INTERACTIVE_LOGON, 5)}; !reflect.DeepEqual(first, want) {
+		t.Errorf("sessions = %+v, want %+v", first, want)
+	}
+
+	second, _ := src.sessions()
+	got := summariseSessions(diffSessions(first, second, sessionEpoch))
+	want := []sessionEventSummary{{"REMOTE_DISCONNECT", 2, "CORP\\alice"}, {"LOGON", 3, "CORP\\alice"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second RDP session events = %+v, want %+v", got, want)
+	}
+
+	third, _ := src.sessions()
+	got = summariseSessions(diffSessions(second, third, sessionEpoch))
+	want = []sessionEventSummary{{"LOGOFF", 2, "CORP\\alice"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logoff events = %+v, want %+v", got, want)
+	}
+
+	if _, err := src.sessions(); err == nil {
+		t.Errorf("list errors should be returned")
+	}
+}
+
+// scriptedSessions returns each snapshot in turn, then repeats the last.
+type scriptedSessions struct {
+	mu    sync.Mutex
+	steps []func() ([]so.SessionDetails, error)
+	calls int
+}
+
+func (s *scriptedSessions) next() ([]so.SessionDetails, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.calls
+	if i >= len(s.steps) {
+		i = len(s.steps) - 1
+	}
+	s.calls++
+	return s.steps[i]()
+}
+
+func sessions(s ...so.SessionDetails) func() ([]so.SessionDetails, error) {
+	return func() ([]so.SessionDetails, error) { return s, nil }
+}
+
+func collectSessions(t *testing.T, w *SessionWatcher, n int) []so.SessionEvent {
+	events := make([]so.SessionEvent, 0, n)
+	timeout := time.After(5 * time.Second)
+	for len(events) < n {
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("events channel closed after %d events", len(events))
+			}
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("timed out after %d events: %+v", len(events), summariseSessions(events))
+		}
+	}
+	return events
+}
+
+func noResolve(uint32) (string, string, bool) { return "", "", false }
+
+func TestSessionWatcherPolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alice := user(1, "alice", so.SESS_INTERACTIVE_LOGON, 0)
+	bob := user(2, "bob", so.SESS_REMOTE_INTERACTIVE_LOGON, 5)
+	var errs int
+	var errMu sync.Mutex
+	src := &scriptedSessions{steps: []func() ([]so.SessionDetails, error){
+		func() ([]so.SessionDetails, error) { return nil, fmt.Errorf("LSA unavailable") },
+		sessions(alice),
+		func() ([]so.SessionDetails, error) { return nil, fmt.Errorf("LSA unavailable") }, // not everyone logging off
+		sessions(locked(alice), bob),
+	}}
+	w := newSessionWatcher(ctx, SessionWatchOptions{
+		Source:   src.next,
+		Interval: 5 * time.Millisecond,
+		OnError: func(error) {
+			errMu.Lock()
+			errs++
+			errMu.Unlock()
+		},
+	}, true, noResolve)
+
+	got := summariseSessions(collectSessions(t, w, 2))
+	want := []sessionEventSummary{{"LOCK", 1, "CORP\\alice"}, {"LOGON", 2, "CORP\\bob"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+
+	cancel()
+	for range w.Events() {
+	}
+	errMu.Lock()
+	if errs != 2 {
+		t.Errorf("expected 2 source errors, got %d", errs)
+	}
+	errMu.Unlock()
+}
+
+func TestSessionWatcherNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loggedOn := map[uint32]bool{4: true}
+	var mu sync.Mutex
+	resolve := func(id uint32) (string, string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !loggedOn[id] {
+			return "", "", false
+		}
+		return "erin", "CORP", true
+	}
+	w := newSessionWatcher(ctx, SessionWatchOptions{}, false, resolve)
+
+	w.SessionChange(so.SESS_EVENT_LOGON, 4)
+	w.SessionChange(so.SESS_EVENT_LOCK, 4)
+	got := summariseSessions(collectSessions(t, w, 2))
+
+	// By the time the logoff is seen the session has gone, but its user is
+	// remembered.
+	mu.Lock()
+	delete(loggedOn, 4)
+	mu.Unlock()
+	w.SessionChange(so.SESS_EVENT_LOGOFF, 4)
+	w.SessionChange(so.SESS_EVENT_CONSOLE_CONNECT, 1)
+	got = append(got, summariseSessions(collectSessions(t, w, 2))...)
+
+	want := []sessionEventSummary{
+		{"LOGON", 4, "CORP\\erin"},
+		{"LOCK", 4, "CORP\\erin"},
+		{"LOGOFF", 4, "CORP\\erin"},
+		{"CONSOLE_CONNECT", 1, "\\"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		w.SessionChange(so.SESS_EVENT_LOGON, 5) // must not block once done
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("SessionChange blocked after cancel")
+	}
+}
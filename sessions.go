@@ -6,11 +6,7 @@ package winapi
 import (
 	"fmt"
 	"os"
-	"reflect"
-	"sort"
-	"strings"
 	"syscall"
-	"time"
 	"unsafe"
 
 	so "github.com/iamacarpet/go-win64api/shared"
@@ -23,11 +19,6 @@ var (
 	sessLsaGetLogonSessionData    = modSecur32.NewProc("LsaGetLogonSessionData")
 )
 
-type LUID struct {
-	LowPart  uint32
-	HighPart int32
-}
-
 type SECURITY_LOGON_SESSION_DATA struct {
 	Size                  uint32
 	LogonId               LUID
@@ -49,101 +40,162 @@ type LSA_UNICODE_STRING struct {
 	buffer        uintptr
 }
 
+// loggedInUserAdmins caches the administrator checks made by
+// ListLoggedInUsers across calls.
+var loggedInUserAdmins = newUserAdminCache(DefaultUserAdminCacheTTL, getAnyDCName, netUserIsAdmin)
+
 func ListLoggedInUsers() ([]so.SessionDetails, error) {
-	var (
-		logonSessionCount uint64
-		loginSessionList  uintptr
-		sizeTest          LUID
-		uList             []string            = make([]string, 0)
-		uSessList         []so.SessionDetails = make([]so.SessionDetails, 0)
-		PidLUIDList       map[uint32]SessionLUID
-	)
-	PidLUIDList, err := ProcessLUIDList()
+	procs, err := processLogons()
 	if err != nil {
 		return nil, fmt.Errorf("Error getting process list, %s.", err.Error())
 	}
+	sessions, err := logonSessions()
+	if err != nil {
+		return nil, err
+	}
 
-	_, _, _ = sessLsaEnumerateLogonSessions.Call(
-		uintptr(unsafe.Pointer(&logonSessionCount)),
-		uintptr(unsafe.Pointer(&loginSessionList)),
-	)
-	defer sessLsaFreeReturnBuffer.Call(uintptr(unsafe.Pointer(&loginSessionList)))
+	hn, _ := os.Hostname()
+	users := newLogonSnapshot(sessions, procs).loggedInUsers(hn, loggedInUserAdmins.isAdmin)
+	for i := range users {
+		users[i].Disconnected, users[i].Locked, _ = sessionState(users[i].SessionID)
+	}
+	resolvePrivilegedGroups(users)
+	return users, nil
+}
 
-	var iter uintptr = uintptr(unsafe.Pointer(loginSessionList))
+// processLogons returns the logon session of every running process, along
+// with what its token says about the user's administrator rights. Processes
+// whose tokens can't be read are included with a zero LogonID.
+func processLogons() ([]processLogon, error) {
+	err := procAssignCorrectPrivs(PROC_SE_DEBUG_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("Error assigning privs... %s", err.Error())
+	}
 
-	for i := uint64(0); i < logonSessionCount; i++ {
-		var sessionData uintptr
-		_, _, _ = sessLsaGetLogonSessionData.Call(uintptr(iter), uintptr(unsafe.Pointer(&sessionData)))
-		if sessionData != uintptr(0) {
-			var data *SECURITY_LOGON_SESSION_DATA = (*SECURITY_LOGON_SESSION_DATA)(unsafe.Pointer(sessionData))
+	handle, _, _ := procCreateToolhelp32Snapshot.Call(0x00000002, 0)
+	if handle < 0 {
+		return nil, syscall.GetLastError()
+	}
+	defer procCloseHandle.Call(handle)
 
-			if data.Sid != uintptr(0) {
-				validTypes := []uint32{so.SESS_INTERACTIVE_LOGON, so.SESS_CACHED_INTERACTIVE_LOGON, so.SESS_REMOTE_INTERACTIVE_LOGON}
-				if in_array(data.LogonType, validTypes) {
-					strLogonDomain := strings.ToUpper(LsatoString(data.LogonDomain))
-					if strLogonDomain != "WINDOW MANAGER" && strLogonDomain != "FONT DRIVER HOST" {
-						sUser := fmt.Sprintf("%s\\%s", strings.ToUpper(LsatoString(data.LogonDomain)), strings.ToLower(LsatoString(data.UserName)))
-						sort.Strings(uList)
-						i := sort.Search(len(uList), func(i int) bool { return uList[i] >= sUser })
-						if !(i < len(uList) && uList[i] == sUser) {
-							if uok, isAdmin := luidinmap(&data.LogonId, &PidLUIDList); uok {
-								uList = append(uList, sUser)
-								ud := so.SessionDetails{
-									Username:      strings.ToLower(LsatoString(data.UserName)),
-									Domain:        strLogonDomain,
-									LocalAdmin:    isAdmin,
-									LogonType:     data.LogonType,
-									DnsDomainName: LsatoString(data.DnsDomainName),
-									LogonTime:     uint64TimestampToTime(data.LogonTime),
-								}
-								hn, _ := os.Hostname()
-								if strings.ToUpper(ud.Domain) == strings.ToUpper(hn) {
-									ud.LocalUser = true
-									if isAdmin, _ := IsLocalUserAdmin(ud.Username); isAdmin {
-										ud.LocalAdmin = true
-									}
-								} else {
-									if isAdmin, _ := IsDomainUserAdmin(ud.Username, LsatoString(data.DnsDomainName)); isAdmin {
-										ud.LocalAdmin = true
-									}
-								}
-								uSessList = append(uSessList, ud)
-							}
-						}
-					}
-				}
-			}
+	var entry PROCESSENTRY32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	ret, _, _ := procProcess32First.Call(handle, uintptr(unsafe.Pointer(&entry)))
+	if ret == 0 {
+		return nil, fmt.Errorf("Error retrieving process info.")
+	}
+
+	retVal := make([]processLogon, 0)
+	for {
+		p, err := processLogonInfo(entry.ProcessID)
+		if err != nil {
+			p = processLogon{Pid: entry.ProcessID}
 		}
+		retVal = append(retVal, p)
 
-		iter = uintptr(unsafe.Pointer(iter + unsafe.Sizeof(sizeTest)))
-		_, _, _ = sessLsaFreeReturnBuffer.Call(uintptr(unsafe.Pointer(sessionData)))
+		ret, _, _ := procProcess32Next.Call(handle, uintptr(unsafe.Pointer(&entry)))
+		if ret == 0 {
+			break
+		}
 	}
-
-	return uSessList, nil
+	return retVal, nil
 }
 
-func uint64TimestampToTime(nsec uint64) time.Time {
-	// change starting time to the Epoch (00:00:00 UTC, January 1, 1970)
-	nsec -= 116444736000000000
-	// convert into nanoseconds
-	nsec *= 100
+// processLogonInfo reads the logon session, group memberships and elevation
+// of a process's token. Only TOKEN_QUERY on the token is needed, which
+// unlike TOKEN_DUPLICATE is granted on other users' processes to
+// administrators without running as SYSTEM.
+func processLogonInfo(pid uint32) (processLogon, error) {
+	retVal := processLogon{Pid: pid}
+
+	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_QUERY_LIMITED_INFORMATION)), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return retVal, fmt.Errorf("Unable to open process: %s", lastError)
+	}
+	defer procCloseHandle.Call(handle)
+
+	var token uintptr
+	opRes, _, lastError := procOpenProcessToken.Call(
+		uintptr(handle),
+		uintptr(uint32(PROC_TOKEN_QUERY)),
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if opRes != 1 {
+		return retVal, fmt.Errorf("Unable to open process token: %s", lastError)
+	}
+	defer procCloseHandle.Call(token)
+
+	buf, _, err := getTokenInformation(token, TOKEN_INFO_STATISTICS)
+	if err != nil {
+		return retVal, fmt.Errorf("Unable to get token statistics: %s", err)
+	}
+	logonID, err := decodeTokenLogonID(buf)
+	if err != nil {
+		return retVal, fmt.Errorf("Unable to decode token statistics: %s", err)
+	}
+	retVal.LogonID = LUID{LowPart: uint32(logonID), HighPart: int32(logonID >> 32)}
 
-	return time.Unix(0, int64(nsec))
+	// The rest is best effort, the logon session alone is still useful.
+	if buf, base, err := getTokenInformation(token, TOKEN_INFO_GROUPS); err == nil {
+		if groups, err := decodeTokenGroups(buf, base); err == nil {
+			retVal.IsAdmin, retVal.PrivilegedGroups = tokenAdminGroups(groups)
+			retVal.GroupsKnown = true
+		}
+	}
+	if elevationType, err := getTokenUint32(token, TOKEN_INFO_ELEVATION_TYPE); err == nil {
+		retVal.ElevationType = elevationType
+	}
+	if elevated, err := getTokenUint32(token, TOKEN_INFO_ELEVATION); err == nil {
+		retVal.IsElevated = elevated != 0
+	}
+
+	return retVal, nil
 }
 
-func sessUserLUIDs() (map[LUID]string, error) {
+// resolvePrivilegedGroups replaces the SIDs in each user's PrivilegedGroups
+// with DOMAIN\group names, where they can be resolved.
+func resolvePrivilegedGroups(users []so.SessionDetails) {
+	sids := make([]string, 0)
+	for _, u := range users {
+		sids = append(sids, u.PrivilegedGroups...)
+	}
+	if len(sids) == 0 {
+		return
+	}
+	accounts, err := ResolveSids(sids)
+	if err != nil {
+		return
+	}
+	i := 0
+	for u := range users {
+		for g := range users[u].PrivilegedGroups {
+			if accounts[i].IsMapped() {
+				users[u].PrivilegedGroups[g] = accounts[i].FullName()
+			}
+			i++
+		}
+	}
+}
+
+// logonSessions returns the logon sessions on the machine, in the order LSA
+// enumerates them.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/ntsecapi/nf-ntsecapi-lsaenumeratelogonsessions
+func logonSessions() ([]logonSession, error) {
 	var (
 		logonSessionCount uint64
 		loginSessionList  uintptr
 		sizeTest          LUID
-		uList             map[LUID]string = make(map[LUID]string)
+		retVal            = make([]logonSession, 0)
 	)
 
-	_, _, _ = sessLsaEnumerateLogonSessions.Call(
+	ret, _, _ := sessLsaEnumerateLogonSessions.Call(
 		uintptr(unsafe.Pointer(&logonSessionCount)),
 		uintptr(unsafe.Pointer(&loginSessionList)),
 	)
-	defer sessLsaFreeReturnBuffer.Call(uintptr(unsafe.Pointer(&loginSessionList)))
+	if ret != 0 {
+		return nil, fmt.Errorf("Unable to enumerate logon sessions: NTSTATUS 0x%x", ret)
+	}
+	defer sessLsaFreeReturnBuffer.Call(loginSessionList)
 
 	var iter uintptr = uintptr(unsafe.Pointer(loginSessionList))
 
@@ -153,49 +205,38 @@ func sessUserLUIDs() (map[LUID]string, error) {
 		if sessionData != uintptr(0) {
 			var data *SECURITY_LOGON_SESSION_DATA = (*SECURITY_LOGON_SESSION_DATA)(unsafe.Pointer(sessionData))
 
-			if data.Sid != uintptr(0) {
-				uList[data.LogonId] = fmt.Sprintf("%s\\%s", strings.ToUpper(LsatoString(data.LogonDomain)), strings.ToLower(LsatoString(data.UserName)))
-			}
+			retVal = append(retVal, logonSession{
+				LogonID:       data.LogonId,
+				UserName:      LsatoString(data.UserName),
+				Domain:        LsatoString(data.LogonDomain),
+				DnsDomainName: LsatoString(data.DnsDomainName),
+				LogonType:     data.LogonType,
+				LogonTime:     uint64TimestampToTime(data.LogonTime),
+				SessionID:     data.Session,
+				HasSid:        data.Sid != uintptr(0),
+			})
+			_, _, _ = sessLsaFreeReturnBuffer.Call(uintptr(unsafe.Pointer(sessionData)))
 		}
 
 		iter = uintptr(unsafe.Pointer(iter + unsafe.Sizeof(sizeTest)))
-		_, _, _ = sessLsaFreeReturnBuffer.Call(uintptr(unsafe.Pointer(sessionData)))
 	}
 
-	return uList, nil
+	return retVal, nil
 }
 
-func luidinmap(needle *LUID, haystack *map[uint32]SessionLUID) (bool, bool) {
-	for _, l := range *haystack {
-		if reflect.DeepEqual(l.Value, *needle) {
-			if l.IsAdmin {
-				return true, true
-			} else {
-				return true, false
-			}
-		}
+func sessUserLUIDs() (map[LUID]string, error) {
+	sessions, err := logonSessions()
+	if err != nil {
+		return nil, err
 	}
-	return false, false
+	return newLogonSnapshot(sessions, nil).userNames(), nil
 }
 
+// LsatoString converts an LSA_UNICODE_STRING to a Go string.
+// Length is in bytes and the buffer isn't guaranteed to be NULL terminated.
 func LsatoString(p LSA_UNICODE_STRING) string {
-	return syscall.UTF16ToString((*[4096]uint16)(unsafe.Pointer(p.buffer))[:p.Length])
-}
-
-func in_array(val interface{}, array interface{}) (exists bool) {
-	exists = false
-
-	switch reflect.TypeOf(array).Kind() {
-	case reflect.Slice:
-		s := reflect.ValueOf(array)
-
-		for i := 0; i < s.Len(); i++ {
-			if reflect.DeepEqual(val, s.Index(i).Interface()) == true {
-				exists = true
-				return
-			}
-		}
+	if p.buffer == 0 || p.Length == 0 {
+		return ""
 	}
-
-	return
+	return syscall.UTF16ToString((*[1 << 15]uint16)(unsafe.Pointer(p.buffer))[: p.Length/2 : p.Length/2])
 }
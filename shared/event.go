@@ -0,0 +1,63 @@
+package shared
+
+import (
+	"time"
+)
+
+// Event levels, as in an event's System/Level.
+const (
+	EVENT_LEVEL_LOG_ALWAYS  = 0
+	EVENT_LEVEL_CRITICAL    = 1
+	EVENT_LEVEL_ERROR       = 2
+	EVENT_LEVEL_WARNING     = 3
+	EVENT_LEVEL_INFORMATION = 4
+	EVENT_LEVEL_VERBOSE     = 5
+)
+
+// An Event is a Windows event log record, whether read from the live event
+// log or an exported .evtx file.
+//
+// Data holds the event's EventData (or UserData) fields by name. Unnamed
+// fields, as written by classic event sources, are keyed by their position
+// starting at "1", matching the %1 style inserts in their messages. XML is
+// the event rendered as Windows does, where available.
+type Event struct {
+	Provider     string            `json:"provider"`
+	ProviderGUID string            `json:"providerGuid,omitempty"`
+	EventID      uint16            `json:"eventId"`
+	Qualifiers   uint16            `json:"qualifiers,omitempty"`
+	Version      uint8             `json:"version"`
+	Level        uint8             `json:"level"`
+	Task         uint16            `json:"task"`
+	Opcode       uint8             `json:"opcode"`
+	Keywords     uint64            `json:"keywords"`
+	TimeCreated  time.Time         `json:"timeCreated"`
+	RecordID     uint64            `json:"recordId"`
+	ActivityID   string            `json:"activityId,omitempty"`
+	ProcessID    uint32            `json:"processId"`
+	ThreadID     uint32            `json:"threadId"`
+	Channel      string            `json:"channel"`
+	Computer     string            `json:"computer"`
+	UserSID      string            `json:"userSid,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	XML          string            `json:"xml,omitempty"`
+}
+
+func (e *Event) GetLevel() string {
+	switch e.Level {
+	case EVENT_LEVEL_LOG_ALWAYS:
+		return "LOG_ALWAYS"
+	case EVENT_LEVEL_CRITICAL:
+		return "CRITICAL"
+	case EVENT_LEVEL_ERROR:
+		return "ERROR"
+	case EVENT_LEVEL_WARNING:
+		return "WARNING"
+	case EVENT_LEVEL_INFORMATION:
+		return "INFORMATION"
+	case EVENT_LEVEL_VERBOSE:
+		return "VERBOSE"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -7,8 +7,70 @@ type LocalGroup struct {
 }
 
 // A LocalGroupMember contains information about a member of a group.
+//
+// SID and SidUsage (one of the SID_TYPE_* constants) are only set by
+// LocalGroupGetMembersWithSid. Removed is set by LocalGroupOrphans on the
+// orphans it removed from the group.
 type LocalGroupMember struct {
 	Domain        string `json:"domain"`
 	Name          string `json:"name"`
 	DomainAndName string `json:"domainAndName"`
+	SID           string `json:"sid,omitempty"`
+	SidUsage      uint32 `json:"sidUsage,omitempty"`
+	Removed       bool   `json:"removed,omitempty"`
+}
+
+// IsOrphaned reports whether the member's SID no longer resolves to an
+// account, e.g. because it belonged to a deleted domain account.
+func (m *LocalGroupMember) IsOrphaned() bool {
+	if m.SID == "" {
+		return false
+	}
+	switch m.SidUsage {
+	case SID_TYPE_DELETED_ACCOUNT, SID_TYPE_INVALID, SID_TYPE_UNKNOWN:
+		return true
+	}
+	return false
+}
+
+// An EffectiveGroupMember is an account that is a member of a group, either
+// directly or through nested groups.
+//
+// Paths lists every chain of groups through which the account is a member.
+// Each path starts with the group that was queried and ends with the group
+// the account is a direct member of, so a direct member has a path of length 1.
+type EffectiveGroupMember struct {
+	SidAccount
+	Paths [][]SidAccount `json:"paths"`
+}
+
+// IsDirect reports whether the account is a direct member of the group.
+func (m *EffectiveGroupMember) IsDirect() bool {
+	for _, p := range m.Paths {
+		if len(p) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// An UnexpandedGroup is a nested group whose members couldn't be listed,
+// for example because its domain controller was unreachable.
+type UnexpandedGroup struct {
+	Group SidAccount   `json:"group"`
+	Path  []SidAccount `json:"path"`
+	Error string       `json:"error"`
+}
+
+// EffectiveMembership is the result of expanding a group's nested members.
+//
+// Members only contains accounts that aren't expandable groups, i.e. users,
+// computers, well-known groups and unresolvable SIDs; nested groups are
+// listed in the members' paths. Cycles lists each path that led back to a
+// group already on it, which was then not expanded again.
+type EffectiveMembership struct {
+	Group      SidAccount             `json:"group"`
+	Members    []EffectiveGroupMember `json:"members"`
+	Cycles     [][]SidAccount         `json:"cycles,omitempty"`
+	Unexpanded []UnexpandedGroup      `json:"unexpanded,omitempty"`
 }
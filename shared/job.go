@@ -0,0 +1,91 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Bounds for JobLimits.CPURate, which Windows applies in hundredths of a
+// percent.
+const (
+	JOB_CPU_RATE_MIN = 0.01
+	JOB_CPU_RATE_MAX = 100
+)
+
+// ErrInvalidJobLimits is returned, wrapped with the reason, by
+// JobLimits.Validate.
+var ErrInvalidJobLimits = errors.New("invalid job limits")
+
+// JobLimits configures the limits of a Job Object. Zero values leave the
+// corresponding limit unset.
+type JobLimits struct {
+	// ProcessMemory caps the memory each process in the job can commit, in
+	// bytes.
+	ProcessMemory uint64 `json:"processMemory,omitempty"`
+	// JobMemory caps the memory all processes in the job can commit between
+	// them, in bytes.
+	JobMemory uint64 `json:"jobMemory,omitempty"`
+	// CPURate is a hard cap on the job's CPU usage, as a percentage of the
+	// whole machine's processor time, between 0.01 and 100.
+	CPURate float64 `json:"cpuRate,omitempty"`
+	// ActiveProcesses caps the number of processes running in the job at
+	// once; starting another fails.
+	ActiveProcesses uint32 `json:"activeProcesses,omitempty"`
+	// KillOnClose terminates every process in the job when the last handle
+	// to it is closed.
+	KillOnClose bool `json:"killOnClose,omitempty"`
+	// DieOnUnhandledException stops crashing processes from waiting on the
+	// Windows Error Reporting dialog.
+	DieOnUnhandledException bool `json:"dieOnUnhandledException,omitempty"`
+	// AllowBreakaway lets processes in the job start children outside of it
+	// with CREATE_BREAKAWAY_FROM_JOB.
+	AllowBreakaway bool `json:"allowBreakaway,omitempty"`
+}
+
+// Validate checks the limits can be applied to a job.
+func (l *JobLimits) Validate() error {
+	if math.IsNaN(l.CPURate) || l.CPURate < 0 || l.CPURate > JOB_CPU_RATE_MAX {
+		return fmt.Errorf("%w: CPU rate %v%% is outside 0-%v%%", ErrInvalidJobLimits, l.CPURate, JOB_CPU_RATE_MAX)
+	}
+	if l.CPURate != 0 && l.CPURate < JOB_CPU_RATE_MIN {
+		return fmt.Errorf("%w: CPU rate %v%% is below the minimum of %v%%", ErrInvalidJobLimits, l.CPURate, JOB_CPU_RATE_MIN)
+	}
+	if l.JobMemory != 0 && l.ProcessMemory > l.JobMemory {
+		return fmt.Errorf("%w: process memory limit %d exceeds job memory limit %d", ErrInvalidJobLimits, l.ProcessMemory, l.JobMemory)
+	}
+	return nil
+}
+
+// CPURateHundredths returns CPURate in hundredths of a percent, as Windows
+// takes it.
+func (l *JobLimits) CPURateHundredths() uint32 {
+	return uint32(math.Round(l.CPURate * 100))
+}
+
+// JobAccounting is the resource usage of a Job Object, across every process
+// that has run in it.
+type JobAccounting struct {
+	TotalUserTime            time.Duration `json:"totalUserTime"`
+	TotalKernelTime          time.Duration `json:"totalKernelTime"`
+	TotalPageFaults          uint32        `json:"totalPageFaults"`
+	TotalProcesses           uint32        `json:"totalProcesses"`
+	ActiveProcesses          uint32        `json:"activeProcesses"`
+	TotalTerminatedProcesses uint32        `json:"totalTerminatedProcesses"`
+
+	ReadOperations  uint64 `json:"readOperations"`
+	WriteOperations uint64 `json:"writeOperations"`
+	OtherOperations uint64 `json:"otherOperations"`
+	ReadBytes       uint64 `json:"readBytes"`
+	WriteBytes      uint64 `json:"writeBytes"`
+	OtherBytes      uint64 `json:"otherBytes"`
+
+	PeakProcessMemory uint64 `json:"peakProcessMemory"`
+	PeakJobMemory     uint64 `json:"peakJobMemory"`
+}
+
+// CPUTime is the total time processes in the job have spent executing.
+func (a *JobAccounting) CPUTime() time.Duration {
+	return a.TotalUserTime + a.TotalKernelTime
+}
@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"fmt"
+	"time"
+)
+
+// Logon event types, the IDs of the Security log events they're read from.
+const (
+	LOGON_EVENT_LOGON       = 4624
+	LOGON_EVENT_FAILED      = 4625
+	LOGON_EVENT_LOGOFF      = 4634
+	LOGON_EVENT_USER_LOGOFF = 4647
+	LOGON_EVENT_LOCK        = 4800
+	LOGON_EVENT_UNLOCK      = 4801
+)
+
+// LogonEvent is a logon, failed logon, logoff, lock or unlock recorded in the
+// Security event log.
+//
+// LogonID is the logon session's LUID, which ties a logon to its logoff, and
+// LinkedLogonID that of the other half of a UAC split token logon. LogonType
+// is one of the SESS_* constants, and zero for events that don't record it.
+// SourceIP, SourcePort and Workstation are where the logon came from, and
+// are only set for logons and failed logons. Status and SubStatus are the
+// NTSTATUS codes of a failed logon, and FailureReason describes them.
+type LogonEvent struct {
+	Type          uint16    `json:"type"`
+	Time          time.Time `json:"time"`
+	RecordID      uint64    `json:"recordId"`
+	Computer      string    `json:"computer"`
+	Username      string    `json:"username"`
+	Domain        string    `json:"domain"`
+	UserSID       string    `json:"userSid,omitempty"`
+	LogonID       uint64    `json:"logonId"`
+	LinkedLogonID uint64    `json:"linkedLogonId,omitempty"`
+	LogonType     uint32    `json:"logonType,omitempty"`
+	Elevated      bool      `json:"isElevated,omitempty"`
+	SessionID     uint32    `json:"sessionId,omitempty"`
+	SourceIP      string    `json:"sourceIp,omitempty"`
+	SourcePort    uint16    `json:"sourcePort,omitempty"`
+	Workstation   string    `json:"workstation,omitempty"`
+	Status        uint32    `json:"status,omitempty"`
+	SubStatus     uint32    `json:"subStatus,omitempty"`
+	FailureReason string    `json:"failureReason,omitempty"`
+}
+
+func (e *LogonEvent) FullUser() string {
+	return fmt.Sprintf("%s\\%s", e.Domain, e.Username)
+}
+
+func (e *LogonEvent) GetType() string {
+	switch e.Type {
+	case LOGON_EVENT_LOGON:
+		return "LOGON"
+	case LOGON_EVENT_FAILED:
+		return "FAILED"
+	case LOGON_EVENT_LOGOFF:
+		return "LOGOFF"
+	case LOGON_EVENT_USER_LOGOFF:
+		return "USER_LOGOFF"
+	case LOGON_EVENT_LOCK:
+		return "LOCK"
+	case LOGON_EVENT_UNLOCK:
+		return "UNLOCK"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (e *LogonEvent) GetLogonType() string {
+	return logonTypeName(e.LogonType)
+}
+
+// LogonSession is a logon paired with its logoff. The two halves of a UAC
+// split token logon are a single session, with the LUID of the first logged
+// as LogonID and the other as LinkedLogonID.
+//
+// LogoffTime and Duration are zero if the session is still logged on, or its
+// logoff wasn't logged, such as when the computer lost power, as reported by
+// Open. LockedTime is how long the session spent locked.
+type LogonSession struct {
+	Username      string        `json:"username"`
+	Domain        string        `json:"domain"`
+	UserSID       string        `json:"userSid,omitempty"`
+	Computer      string        `json:"computer"`
+	LogonID       uint64        `json:"logonId"`
+	LinkedLogonID uint64        `json:"linkedLogonId,omitempty"`
+	LogonType     uint32        `json:"logonType"`
+	Elevated      bool          `json:"isElevated"`
+	SourceIP      string        `json:"sourceIp,omitempty"`
+	Workstation   string        `json:"workstation,omitempty"`
+	LogonTime     time.Time     `json:"logonTime"`
+	LogoffTime    time.Time     `json:"logoffTime"`
+	Duration      time.Duration `json:"duration,omitempty"`
+	LockedTime    time.Duration `json:"lockedTime,omitempty"`
+}
+
+func (s *LogonSession) FullUser() string {
+	return fmt.Sprintf("%s\\%s", s.Domain, s.Username)
+}
+
+func (s *LogonSession) GetLogonType() string {
+	return logonTypeName(s.LogonType)
+}
+
+// Open reports whether the session has no logoff.
+func (s *LogonSession) Open() bool {
+	return s.LogoffTime.IsZero()
+}
@@ -1,6 +1,32 @@
 package shared
 
-import ()
+import (
+	"time"
+)
+
+// Optional process fields, selected when listing processes. Fields records
+// which of them were collected for a Process.
+const (
+	PROC_FIELD_COMMAND_LINE = 1 << iota
+	PROC_FIELD_TIMES
+	PROC_FIELD_SESSION
+	PROC_FIELD_ARCHITECTURE
+	PROC_FIELD_INTEGRITY
+	PROC_FIELD_MEMORY
+	PROC_FIELD_COUNTERS
+
+	PROC_FIELD_ALL = PROC_FIELD_COMMAND_LINE | PROC_FIELD_TIMES | PROC_FIELD_SESSION |
+		PROC_FIELD_ARCHITECTURE | PROC_FIELD_INTEGRITY | PROC_FIELD_MEMORY | PROC_FIELD_COUNTERS
+)
+
+// IMAGE_FILE_MACHINE_* values for Process.Machine.
+const (
+	IMAGE_FILE_MACHINE_UNKNOWN = 0x0000
+	IMAGE_FILE_MACHINE_I386    = 0x014c
+	IMAGE_FILE_MACHINE_ARMNT   = 0x01c4
+	IMAGE_FILE_MACHINE_AMD64   = 0x8664
+	IMAGE_FILE_MACHINE_ARM64   = 0xaa64
+)
 
 type Process struct {
 	Pid        int    `json:"pid"`
@@ -8,4 +34,145 @@ type Process struct {
 	Executable string `json:"exeName"`
 	Fullpath   string `json:"fullPath"`
 	Username   string `json:"username"`
+
+	Fields uint32 `json:"fields,omitempty"`
+
+	// PROC_FIELD_COMMAND_LINE
+	CommandLine string `json:"commandLine,omitempty"`
+
+	// PROC_FIELD_TIMES. CreationTime is the zero time unless Fields has
+	// PROC_FIELD_TIMES set.
+	CreationTime time.Time     `json:"creationTime"`
+	UserTime     time.Duration `json:"userTime,omitempty"`
+	KernelTime   time.Duration `json:"kernelTime,omitempty"`
+
+	// PROC_FIELD_SESSION
+	SessionID uint32 `json:"sessionId,omitempty"`
+
+	// PROC_FIELD_ARCHITECTURE
+	Machine  uint16 `json:"machine,omitempty"`
+	Emulated bool   `json:"emulated,omitempty"`
+
+	// PROC_FIELD_INTEGRITY, one of the INTEGRITY_LEVEL_* constants.
+	IntegrityLevel uint32 `json:"integrityLevel,omitempty"`
+
+	// PROC_FIELD_MEMORY
+	WorkingSetSize uint64 `json:"workingSetSize,omitempty"`
+	PrivateBytes   uint64 `json:"privateBytes,omitempty"`
+
+	// PROC_FIELD_COUNTERS
+	HandleCount uint32 `json:"handleCount,omitempty"`
+	ThreadCount uint32 `json:"threadCount,omitempty"`
+}
+
+// HasField reports whether the optional field(s) were collected.
+func (p *Process) HasField(field uint32) bool {
+	return p.Fields&field == field
+}
+
+// CPUTime is the total time the process has spent executing.
+func (p *Process) CPUTime() time.Duration {
+	return p.UserTime + p.KernelTime
+}
+
+// GetArchitecture names the architecture the process runs as.
+func (p *Process) GetArchitecture() string {
+	switch p.Machine {
+	case IMAGE_FILE_MACHINE_I386:
+		return "x86"
+	case IMAGE_FILE_MACHINE_ARMNT:
+		return "ARM"
+	case IMAGE_FILE_MACHINE_AMD64:
+		return "x64"
+	case IMAGE_FILE_MACHINE_ARM64:
+		return "ARM64"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ProcessKillResult is the outcome of terminating one process of a tree.
+type ProcessKillResult struct {
+	Pid        int    `json:"pid"`
+	Executable string `json:"exeName"`
+	Killed     bool   `json:"killed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Stages of ProcessStop, in the order they're tried.
+const (
+	PROC_STOP_NONE = iota
+	PROC_STOP_ALREADY_EXITED
+	PROC_STOP_CLOSE_WINDOWS
+	PROC_STOP_CTRL_BREAK
+	PROC_STOP_TERMINATE
+)
+
+// ProcessStopResult reports which stage of ProcessStop ended the process, and
+// the exit code it ended with. Unsupported lists the polite stages that
+// couldn't be tried from the calling process.
+type ProcessStopResult struct {
+	Stage       uint32   `json:"stage"`
+	ExitCode    uint32   `json:"exitCode"`
+	Unsupported []uint32 `json:"unsupported,omitempty"`
+}
+
+func (r *ProcessStopResult) GetStage() string {
+	switch r.Stage {
+	case PROC_STOP_ALREADY_EXITED:
+		return "ALREADY_EXITED"
+	case PROC_STOP_CLOSE_WINDOWS:
+		return "CLOSE_WINDOWS"
+	case PROC_STOP_CTRL_BREAK:
+		return "CTRL_BREAK"
+	case PROC_STOP_TERMINATE:
+		return "TERMINATE"
+	default:
+		return "NONE"
+	}
+}
+
+// Process event types.
+const (
+	PROC_EVENT_STARTED = 1
+	PROC_EVENT_EXITED  = 2
+)
+
+// ProcessEvent reports a process starting or exiting. Time is when the event
+// was observed, which for polled events may be up to an interval late.
+type ProcessEvent struct {
+	Type    uint32    `json:"type"`
+	Process Process   `json:"process"`
+	Time    time.Time `json:"time"`
+}
+
+func (e *ProcessEvent) GetType() string {
+	switch e.Type {
+	case PROC_EVENT_STARTED:
+		return "STARTED"
+	case PROC_EVENT_EXITED:
+		return "EXITED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ProcessModule is an executable or DLL loaded by a process. The versions are
+// empty if the file has no version resource.
+type ProcessModule struct {
+	Name           string `json:"name"`
+	Path           string `json:"path"`
+	BaseAddress    uint64 `json:"baseAddress"`
+	Size           uint32 `json:"size"`
+	FileVersion    string `json:"fileVersion,omitempty"`
+	ProductVersion string `json:"productVersion,omitempty"`
+}
+
+// ProcessHandle is a handle held open by a process. Name is empty for
+// unnamed objects and for those whose name couldn't safely be queried.
+type ProcessHandle struct {
+	Handle        uint64 `json:"handle"`
+	Type          string `json:"type"`
+	Name          string `json:"name,omitempty"`
+	GrantedAccess uint32 `json:"grantedAccess"`
 }
@@ -5,10 +5,19 @@ import (
 	"time"
 )
 
+// Logon types, as in SECURITY_LOGON_TYPE and the LogonType of logon events.
 const (
-	SESS_INTERACTIVE_LOGON        = 2
-	SESS_REMOTE_INTERACTIVE_LOGON = 10
-	SESS_CACHED_INTERACTIVE_LOGON = 11
+	SESS_INTERACTIVE_LOGON               = 2
+	SESS_NETWORK_LOGON                   = 3
+	SESS_BATCH_LOGON                     = 4
+	SESS_SERVICE_LOGON                   = 5
+	SESS_UNLOCK_LOGON                    = 7
+	SESS_NETWORK_CLEARTEXT_LOGON         = 8
+	SESS_NEW_CREDENTIALS_LOGON           = 9
+	SESS_REMOTE_INTERACTIVE_LOGON        = 10
+	SESS_CACHED_INTERACTIVE_LOGON        = 11
+	SESS_CACHED_REMOTE_INTERACTIVE_LOGON = 12
+	SESS_CACHED_UNLOCK_LOGON             = 13
 )
 
 type SessionDetails struct {
@@ -19,20 +28,190 @@ type SessionDetails struct {
 	LogonType     uint32    `json:"logonType"`
 	LogonTime     time.Time `json:"logonTime"`
 	DnsDomainName string    `json:"dnsDomainName"`
+
+	// SessionID is the WTS session the logon belongs to. Disconnected and
+	// Locked are its state when listed, where it could be determined.
+	SessionID    uint32 `json:"sessionId"`
+	Disconnected bool   `json:"isDisconnected"`
+	Locked       bool   `json:"isLocked"`
+
+	// Elevated is set if any of the user's processes is running elevated.
+	// ElevationType is one of the TOKEN_ELEVATION_TYPE_* constants:
+	// TOKEN_ELEVATION_TYPE_LIMITED when the user is an administrator
+	// running with a UAC filtered token, TOKEN_ELEVATION_TYPE_FULL when
+	// they have elevated. PrivilegedGroups names the administrative groups
+	// the user is a member of, as DOMAIN\group or the SID if it can't be
+	// resolved.
+	Elevated         bool     `json:"isElevated"`
+	ElevationType    uint32   `json:"elevationType"`
+	PrivilegedGroups []string `json:"privilegedGroups,omitempty"`
 }
 
 func (s *SessionDetails) FullUser() string {
 	return fmt.Sprintf("%s\\%s", s.Domain, s.Username)
 }
 
+func (s *SessionDetails) GetElevationType() string {
+	switch s.ElevationType {
+	case TOKEN_ELEVATION_TYPE_DEFAULT:
+		return "DEFAULT"
+	case TOKEN_ELEVATION_TYPE_FULL:
+		return "FULL"
+	case TOKEN_ELEVATION_TYPE_LIMITED:
+		return "LIMITED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 func (s *SessionDetails) GetLogonType() string {
-	switch s.LogonType {
+	return logonTypeName(s.LogonType)
+}
+
+func logonTypeName(logonType uint32) string {
+	switch logonType {
 	case SESS_INTERACTIVE_LOGON:
 		return "INTERACTIVE_LOGON"
+	case SESS_NETWORK_LOGON:
+		return "NETWORK_LOGON"
+	case SESS_BATCH_LOGON:
+		return "BATCH_LOGON"
+	case SESS_SERVICE_LOGON:
+		return "SERVICE_LOGON"
+	case SESS_UNLOCK_LOGON:
+		return "UNLOCK_LOGON"
+	case SESS_NETWORK_CLEARTEXT_LOGON:
+		return "NETWORK_CLEARTEXT_LOGON"
+	case SESS_NEW_CREDENTIALS_LOGON:
+		return "NEW_CREDENTIALS_LOGON"
 	case SESS_REMOTE_INTERACTIVE_LOGON:
 		return "REMOTE_INTERACTIVE_LOGON"
 	case SESS_CACHED_INTERACTIVE_LOGON:
 		return "CACHED_INTERACTIVE_LOGON"
+	case SESS_CACHED_REMOTE_INTERACTIVE_LOGON:
+		return "CACHED_REMOTE_INTERACTIVE_LOGON"
+	case SESS_CACHED_UNLOCK_LOGON:
+		return "CACHED_UNLOCK_LOGON"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// WTS session connection states.
+const (
+	WTS_STATE_ACTIVE        = 0
+	WTS_STATE_CONNECTED     = 1
+	WTS_STATE_CONNECT_QUERY = 2
+	WTS_STATE_SHADOW        = 3
+	WTS_STATE_DISCONNECTED  = 4
+	WTS_STATE_IDLE          = 5
+	WTS_STATE_LISTEN        = 6
+	WTS_STATE_RESET         = 7
+	WTS_STATE_DOWN          = 8
+	WTS_STATE_INIT          = 9
+)
+
+// WTSSession is a Remote Desktop Services session, including the console
+// session. Sessions without a user, such as session 0 and listeners, have an
+// empty Username.
+//
+// ClientName and ClientAddress are only set for remote sessions. IdleTime is
+// how long it's been since the user's last input, and is zero if unknown, as
+// are any of the times Windows doesn't report.
+type WTSSession struct {
+	SessionID      uint32        `json:"sessionId"`
+	WinStationName string        `json:"winStationName"`
+	State          uint32        `json:"state"`
+	Username       string        `json:"username,omitempty"`
+	Domain         string        `json:"domain,omitempty"`
+	ClientName     string        `json:"clientName,omitempty"`
+	ClientAddress  string        `json:"clientAddress,omitempty"`
+	ConnectTime    time.Time     `json:"connectTime"`
+	DisconnectTime time.Time     `json:"disconnectTime"`
+	LogonTime      time.Time     `json:"logonTime"`
+	LastInputTime  time.Time     `json:"lastInputTime"`
+	IdleTime       time.Duration `json:"idleTime,omitempty"`
+}
+
+func (s *WTSSession) FullUser() string {
+	return fmt.Sprintf("%s\\%s", s.Domain, s.Username)
+}
+
+func (s *WTSSession) GetState() string {
+	switch s.State {
+	case WTS_STATE_ACTIVE:
+		return "ACTIVE"
+	case WTS_STATE_CONNECTED:
+		return "CONNECTED"
+	case WTS_STATE_CONNECT_QUERY:
+		return "CONNECT_QUERY"
+	case WTS_STATE_SHADOW:
+		return "SHADOW"
+	case WTS_STATE_DISCONNECTED:
+		return "DISCONNECTED"
+	case WTS_STATE_IDLE:
+		return "IDLE"
+	case WTS_STATE_LISTEN:
+		return "LISTEN"
+	case WTS_STATE_RESET:
+		return "RESET"
+	case WTS_STATE_DOWN:
+		return "DOWN"
+	case WTS_STATE_INIT:
+		return "INIT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Session event types, matching the WTS_* codes of WM_WTSSESSION_CHANGE and
+// SERVICE_CONTROL_SESSIONCHANGE.
+const (
+	SESS_EVENT_CONSOLE_CONNECT    = 1
+	SESS_EVENT_CONSOLE_DISCONNECT = 2
+	SESS_EVENT_REMOTE_CONNECT     = 3
+	SESS_EVENT_REMOTE_DISCONNECT  = 4
+	SESS_EVENT_LOGON              = 5
+	SESS_EVENT_LOGOFF             = 6
+	SESS_EVENT_LOCK               = 7
+	SESS_EVENT_UNLOCK             = 8
+	SESS_EVENT_REMOTE_CONTROL     = 9
+)
+
+// SessionEvent reports a change to a user's session. Username and Domain are
+// empty if the session's user couldn't be determined.
+type SessionEvent struct {
+	Type      uint32    `json:"type"`
+	SessionID uint32    `json:"sessionId"`
+	Username  string    `json:"username,omitempty"`
+	Domain    string    `json:"domain,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func (e *SessionEvent) FullUser() string {
+	return fmt.Sprintf("%s\\%s", e.Domain, e.Username)
+}
+
+func (e *SessionEvent) GetType() string {
+	switch e.Type {
+	case SESS_EVENT_CONSOLE_CONNECT:
+		return "CONSOLE_CONNECT"
+	case SESS_EVENT_CONSOLE_DISCONNECT:
+		return "CONSOLE_DISCONNECT"
+	case SESS_EVENT_REMOTE_CONNECT:
+		return "REMOTE_CONNECT"
+	case SESS_EVENT_REMOTE_DISCONNECT:
+		return "REMOTE_DISCONNECT"
+	case SESS_EVENT_LOGON:
+		return "LOGON"
+	case SESS_EVENT_LOGOFF:
+		return "LOGOFF"
+	case SESS_EVENT_LOCK:
+		return "LOCK"
+	case SESS_EVENT_UNLOCK:
+		return "UNLOCK"
+	case SESS_EVENT_REMOTE_CONTROL:
+		return "REMOTE_CONTROL"
 	default:
 		return "UNKNOWN"
 	}
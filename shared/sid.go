@@ -0,0 +1,75 @@
+package shared
+
+import (
+	"fmt"
+)
+
+// SID_NAME_USE values, describing the type of account a SID refers to.
+const (
+	SID_TYPE_USER             = 1
+	SID_TYPE_GROUP            = 2
+	SID_TYPE_DOMAIN           = 3
+	SID_TYPE_ALIAS            = 4
+	SID_TYPE_WELL_KNOWN_GROUP = 5
+	SID_TYPE_DELETED_ACCOUNT  = 6
+	SID_TYPE_INVALID          = 7
+	SID_TYPE_UNKNOWN          = 8
+	SID_TYPE_COMPUTER         = 9
+	SID_TYPE_LABEL            = 10
+)
+
+// A SidAccount is the account a SID resolves to.
+//
+// Type is one of the SID_TYPE_* constants. SIDs that could not be resolved,
+// such as the SID of a deleted domain account, have an empty Name and a Type
+// of SID_TYPE_UNKNOWN.
+type SidAccount struct {
+	SID    string `json:"sid"`
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Type   uint32 `json:"type"`
+}
+
+// FullName returns the account name in DOMAIN\name form, or just the name for
+// accounts without a domain, such as "Everyone".
+func (s *SidAccount) FullName() string {
+	if s.Domain == "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s\\%s", s.Domain, s.Name)
+}
+
+// IsMapped reports whether the SID was resolved to an account name.
+func (s *SidAccount) IsMapped() bool {
+	switch s.Type {
+	case SID_TYPE_DELETED_ACCOUNT, SID_TYPE_INVALID, SID_TYPE_UNKNOWN, 0:
+		return false
+	default:
+		return s.Name != ""
+	}
+}
+
+func (s *SidAccount) GetSidType() string {
+	switch s.Type {
+	case SID_TYPE_USER:
+		return "USER"
+	case SID_TYPE_GROUP:
+		return "GROUP"
+	case SID_TYPE_DOMAIN:
+		return "DOMAIN"
+	case SID_TYPE_ALIAS:
+		return "ALIAS"
+	case SID_TYPE_WELL_KNOWN_GROUP:
+		return "WELL_KNOWN_GROUP"
+	case SID_TYPE_DELETED_ACCOUNT:
+		return "DELETED_ACCOUNT"
+	case SID_TYPE_INVALID:
+		return "INVALID"
+	case SID_TYPE_COMPUTER:
+		return "COMPUTER"
+	case SID_TYPE_LABEL:
+		return "LABEL"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -1,25 +1,48 @@
 package shared
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// Registry views software is registered in, 64-bit or 32-bit (Wow6432Node).
+const (
+	SOFTWARE_VIEW_64 = 64
+	SOFTWARE_VIEW_32 = 32
+)
 
 // EstimatedSize is in KB,
 // As estimated & written to the registry by the installer itself,
 // or Windows Installer for an MSI.
+//
+// QuietUninstallString, if the installer registered one, uninstalls without
+// any UI.
+//
+// ID identifies where the software is registered, which stays the same across
+// listings: the hive's owner, "machine" or a user's SID, the registry view
+// and the key, as "machine:64:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\7-Zip".
+// UserSID is set for software installed for a single user. ProductCode is
+// the Windows Installer product code for software registered under it.
 type Software struct {
-	DisplayName     string    `json:"displayName"`
-	DisplayVersion  string    `json:"displayVersion"`
-	Arch            string    `json:"arch"`
-	Publisher       string    `json:"publisher"`
-	InstallDate     time.Time `json:"installDate"`
-	EstimatedSize   uint64    `json:"estimatedSize"`
-	Contact         string    `json:"Contact"`
-	HelpLink        string    `json:"HelpLink"`
-	InstallSource   string    `json:"InstallSource"`
-	InstallLocation string    `json:"InstallLocation"`
-	UninstallString string    `json:"UninstallString"`
-	VersionMajor    uint64    `json:"VersionMajor"`
-	VersionMinor    uint64    `json:"VersionMinor"`
-	RegKey          string    `json:"RegKey"`
+	ID                   string    `json:"id"`
+	DisplayName          string    `json:"displayName"`
+	DisplayVersion       string    `json:"displayVersion"`
+	Arch                 string    `json:"arch"`
+	Publisher            string    `json:"publisher"`
+	InstallDate          time.Time `json:"installDate"`
+	EstimatedSize        uint64    `json:"estimatedSize"`
+	Contact              string    `json:"Contact"`
+	HelpLink             string    `json:"HelpLink"`
+	InstallSource        string    `json:"InstallSource"`
+	InstallLocation      string    `json:"InstallLocation"`
+	UninstallString      string    `json:"UninstallString"`
+	QuietUninstallString string    `json:"QuietUninstallString,omitempty"`
+	VersionMajor         uint64    `json:"VersionMajor"`
+	VersionMinor         uint64    `json:"VersionMinor"`
+	RegKey               string    `json:"RegKey"`
+	RegView              uint32    `json:"regView"`
+	UserSID              string    `json:"userSid,omitempty"`
+	ProductCode          string    `json:"productCode,omitempty"`
 }
 
 func (s *Software) Name() string {
@@ -33,3 +56,128 @@ func (s *Software) Version() string {
 func (s *Software) Architecture() string {
 	return s.Arch
 }
+
+// ParsedVersion parses DisplayVersion with ParseVersion, or where it's
+// missing, the VersionMajor and VersionMinor some installers only write.
+func (s *Software) ParsedVersion() (Version, error) {
+	if s.DisplayVersion == "" && (s.VersionMajor != 0 || s.VersionMinor != 0) {
+		return ParseVersion(fmt.Sprintf("%d.%d", s.VersionMajor, s.VersionMinor))
+	}
+	return ParseVersion(s.DisplayVersion)
+}
+
+// CompareVersion returns -1, 0 or 1 as the software's version is older than,
+// the same as, or newer than version.
+func (s *Software) CompareVersion(version string) (int, error) {
+	v, err := s.ParsedVersion()
+	if err != nil {
+		return 0, err
+	}
+	o, err := ParseVersion(version)
+	if err != nil {
+		return 0, err
+	}
+	return v.Compare(o), nil
+}
+
+// VersionMatches reports whether the software's version satisfies a
+// constraint, as parsed by ParseVersionConstraint.
+func (s *Software) VersionMatches(constraint string) (bool, error) {
+	c, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+	v, err := s.ParsedVersion()
+	if err != nil {
+		return false, err
+	}
+	return c.Match(v), nil
+}
+
+// Installers recognised from an uninstall command.
+const (
+	INSTALLER_UNKNOWN = iota
+	INSTALLER_MSI
+	INSTALLER_INNO_SETUP
+	INSTALLER_NSIS
+	INSTALLER_INSTALLSHIELD
+)
+
+// UninstallCommand is an UninstallString split into the executable and its
+// arguments, with the installer that wrote it where it can be recognised.
+//
+// ProductCode is the Windows Installer product code of MSI uninstalls, with
+// braces. SilentCommandLine runs the uninstall without any UI, and is empty
+// if there's no known way to do that.
+type UninstallCommand struct {
+	Executable        string   `json:"executable"`
+	Args              []string `json:"args"`
+	Installer         uint32   `json:"installer"`
+	ProductCode       string   `json:"productCode,omitempty"`
+	SilentCommandLine string   `json:"silentCommandLine,omitempty"`
+}
+
+func (c *UninstallCommand) GetInstaller() string {
+	switch c.Installer {
+	case INSTALLER_MSI:
+		return "MSI"
+	case INSTALLER_INNO_SETUP:
+		return "INNO_SETUP"
+	case INSTALLER_NSIS:
+		return "NSIS"
+	case INSTALLER_INSTALLSHIELD:
+		return "INSTALLSHIELD"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Uninstall results, from the uninstaller's exit code.
+const (
+	UNINSTALL_RESULT_NONE = iota
+	UNINSTALL_RESULT_SUCCESS
+	UNINSTALL_RESULT_REBOOT_REQUIRED
+	UNINSTALL_RESULT_REBOOT_INITIATED
+	UNINSTALL_RESULT_NOT_INSTALLED
+	UNINSTALL_RESULT_FAILED
+	UNINSTALL_RESULT_TIMED_OUT
+)
+
+// UninstallResult reports how an uninstall ended. CommandLine is what was
+// run, and ExitCode is only meaningful if it didn't time out.
+type UninstallResult struct {
+	Result      uint32        `json:"result"`
+	ExitCode    uint32        `json:"exitCode"`
+	CommandLine string        `json:"commandLine"`
+	Duration    time.Duration `json:"duration"`
+}
+
+func (r *UninstallResult) GetResult() string {
+	switch r.Result {
+	case UNINSTALL_RESULT_SUCCESS:
+		return "SUCCESS"
+	case UNINSTALL_RESULT_REBOOT_REQUIRED:
+		return "REBOOT_REQUIRED"
+	case UNINSTALL_RESULT_REBOOT_INITIATED:
+		return "REBOOT_INITIATED"
+	case UNINSTALL_RESULT_NOT_INSTALLED:
+		return "NOT_INSTALLED"
+	case UNINSTALL_RESULT_FAILED:
+		return "FAILED"
+	case UNINSTALL_RESULT_TIMED_OUT:
+		return "TIMED_OUT"
+	default:
+		return "NONE"
+	}
+}
+
+// Removed reports whether the software is no longer installed, although it
+// may take a reboot to finish removing it.
+func (r *UninstallResult) Removed() bool {
+	switch r.Result {
+	case UNINSTALL_RESULT_SUCCESS, UNINSTALL_RESULT_REBOOT_REQUIRED,
+		UNINSTALL_RESULT_REBOOT_INITIATED, UNINSTALL_RESULT_NOT_INSTALLED:
+		return true
+	}
+	return false
+}
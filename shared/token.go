@@ -0,0 +1,144 @@
+package shared
+
+// Token group attributes.
+const (
+	SE_GROUP_MANDATORY          = 0x00000001
+	SE_GROUP_ENABLED_BY_DEFAULT = 0x00000002
+	SE_GROUP_ENABLED            = 0x00000004
+	SE_GROUP_OWNER              = 0x00000008
+	SE_GROUP_USE_FOR_DENY_ONLY  = 0x00000010
+	SE_GROUP_INTEGRITY          = 0x00000020
+	SE_GROUP_INTEGRITY_ENABLED  = 0x00000040
+	SE_GROUP_RESOURCE           = 0x20000000
+	SE_GROUP_LOGON_ID           = 0xC0000000
+)
+
+// Token privilege attributes.
+const (
+	SE_PRIVILEGE_ENABLED_BY_DEFAULT = 0x00000001
+	SE_PRIVILEGE_ENABLED            = 0x00000002
+	SE_PRIVILEGE_REMOVED            = 0x00000004
+	SE_PRIVILEGE_USED_FOR_ACCESS    = 0x80000000
+)
+
+// TOKEN_ELEVATION_TYPE values.
+//
+// A full (elevated) token and a limited token are the two halves of a UAC
+// split token; a default token means UAC didn't split the logon.
+const (
+	TOKEN_ELEVATION_TYPE_DEFAULT = 1
+	TOKEN_ELEVATION_TYPE_FULL    = 2
+	TOKEN_ELEVATION_TYPE_LIMITED = 3
+)
+
+// Mandatory integrity levels, as the last sub authority of the label SID.
+const (
+	INTEGRITY_LEVEL_UNTRUSTED   = 0x0000
+	INTEGRITY_LEVEL_LOW         = 0x1000
+	INTEGRITY_LEVEL_MEDIUM      = 0x2000
+	INTEGRITY_LEVEL_MEDIUM_PLUS = 0x2100
+	INTEGRITY_LEVEL_HIGH        = 0x3000
+	INTEGRITY_LEVEL_SYSTEM      = 0x4000
+	INTEGRITY_LEVEL_PROTECTED   = 0x5000
+)
+
+// A TokenGroup is a SID held by an access token, either the token's user or
+// one of its groups, with its SE_GROUP_* attributes.
+type TokenGroup struct {
+	SID        string `json:"sid"`
+	Name       string `json:"name,omitempty"`
+	Attributes uint32 `json:"attributes"`
+}
+
+// IsEnabled reports whether the group is enabled for access checks.
+func (g *TokenGroup) IsEnabled() bool {
+	return g.Attributes&SE_GROUP_ENABLED != 0
+}
+
+// IsDenyOnly reports whether the group is only used to match deny ACEs, as is
+// the case for Administrators in a UAC limited token.
+func (g *TokenGroup) IsDenyOnly() bool {
+	return g.Attributes&SE_GROUP_USE_FOR_DENY_ONLY != 0
+}
+
+// A TokenPrivilege is a privilege held by an access token.
+type TokenPrivilege struct {
+	Name       string `json:"name"`
+	LUID       uint64 `json:"luid"`
+	Attributes uint32 `json:"attributes"`
+}
+
+// IsEnabled reports whether the privilege is currently enabled.
+func (p *TokenPrivilege) IsEnabled() bool {
+	return p.Attributes&SE_PRIVILEGE_ENABLED != 0
+}
+
+// TokenInfo describes a process's access token.
+//
+// IntegrityLevel is one of the INTEGRITY_LEVEL_* constants and ElevationType
+// one of the TOKEN_ELEVATION_TYPE_* constants. LogonID is the LUID of the
+// logon session the token belongs to.
+type TokenInfo struct {
+	User           TokenGroup       `json:"user"`
+	Groups         []TokenGroup     `json:"groups"`
+	Privileges     []TokenPrivilege `json:"privileges"`
+	IntegrityLevel uint32           `json:"integrityLevel"`
+	ElevationType  uint32           `json:"elevationType"`
+	IsElevated     bool             `json:"isElevated"`
+	SessionID      uint32           `json:"sessionId"`
+	LogonID        uint64           `json:"logonId"`
+}
+
+// HasGroup reports whether the token holds the group with the given SID and
+// it's enabled, so it would grant access.
+func (t *TokenInfo) HasGroup(sid string) bool {
+	for i := range t.Groups {
+		if t.Groups[i].SID == sid {
+			return t.Groups[i].IsEnabled() && !t.Groups[i].IsDenyOnly()
+		}
+	}
+	return false
+}
+
+// HasPrivilege reports whether the token holds the named privilege, e.g.
+// "SeDebugPrivilege", regardless of whether it's enabled.
+func (t *TokenInfo) HasPrivilege(name string) bool {
+	for i := range t.Privileges {
+		if t.Privileges[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TokenInfo) GetIntegrityLevel() string {
+	switch {
+	case t.IntegrityLevel >= INTEGRITY_LEVEL_PROTECTED:
+		return "PROTECTED"
+	case t.IntegrityLevel >= INTEGRITY_LEVEL_SYSTEM:
+		return "SYSTEM"
+	case t.IntegrityLevel >= INTEGRITY_LEVEL_HIGH:
+		return "HIGH"
+	case t.IntegrityLevel >= INTEGRITY_LEVEL_MEDIUM_PLUS:
+		return "MEDIUM_PLUS"
+	case t.IntegrityLevel >= INTEGRITY_LEVEL_MEDIUM:
+		return "MEDIUM"
+	case t.IntegrityLevel >= INTEGRITY_LEVEL_LOW:
+		return "LOW"
+	default:
+		return "UNTRUSTED"
+	}
+}
+
+func (t *TokenInfo) GetElevationType() string {
+	switch t.ElevationType {
+	case TOKEN_ELEVATION_TYPE_DEFAULT:
+		return "DEFAULT"
+	case TOKEN_ELEVATION_TYPE_FULL:
+		return "FULL"
+	case TOKEN_ELEVATION_TYPE_LIMITED:
+		return "LIMITED"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,482 @@
+package shared
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version formats recognised by ParseVersion.
+const (
+	VERSION_FORMAT_NUMERIC = iota
+	VERSION_FORMAT_SEMVER
+	VERSION_FORMAT_DATED
+	VERSION_FORMAT_VENDOR
+)
+
+// Version is a parsed version string.
+//
+// Parts are the numeric components, compared in order with missing ones
+// taken as zero, so "10.0" equals "10.0.0.0". Dated versions are split into
+// year, month and day, however they were written.
+//
+// Prerelease marks a version before the release its parts name, such as
+// semver's "1.2.0-rc.1" or a vendor's "1.2 beta 3", and Suffix one after it,
+// such as "1.2 SP1" or "1.2 build 1234". Build is semver build metadata,
+// which is ignored when comparing.
+type Version struct {
+	Original   string   `json:"original"`
+	Format     uint32   `json:"format"`
+	Parts      []uint64 `json:"parts"`
+	Prerelease string   `json:"prerelease,omitempty"`
+	Suffix     string   `json:"suffix,omitempty"`
+	Build      string   `json:"build,omitempty"`
+}
+
+func (v *Version) GetFormat() string {
+	switch v.Format {
+	case VERSION_FORMAT_NUMERIC:
+		return "NUMERIC"
+	case VERSION_FORMAT_SEMVER:
+		return "SEMVER"
+	case VERSION_FORMAT_DATED:
+		return "DATED"
+	case VERSION_FORMAT_VENDOR:
+		return "VENDOR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (v Version) String() string {
+	return v.Original
+}
+
+// prereleaseWords start vendor suffixes that come before the release.
+var prereleaseWords = []string{"alpha", "beta", "rc", "pre", "preview", "dev", "snapshot", "ea", "cr", "a", "b"}
+
+// ParseVersion parses a version as written by Windows and installers:
+//
+//	10.0.19041.1             numeric, with up to any number of parts
+//	1, 0, 0, 1               numeric, as in some version resources
+//	1.2.3-rc.1+build.5       semver
+//	2021-03-15, 20210315     dated
+//	7.0 (x64), 2.4.1b3       vendor, a numeric version followed by text
+//
+// A leading "v" or "version" is ignored, as is text in parentheses. Versions
+// that don't start with a number aren't valid.
+func ParseVersion(s string) (Version, error) {
+	v := Version{Original: s}
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "version") {
+		s = strings.TrimSpace(s[len("version"):])
+	} else if strings.HasPrefix(lower, "v") && len(s) > 1 && isDigit(s[1]) {
+		s = s[1:]
+	}
+	s = strings.TrimSpace(stripParentheses(s))
+	if s == "" || !isDigit(s[0]) {
+		return v, fmt.Errorf("Invalid version %q", v.Original)
+	}
+
+	// Leading numeric parts, separated by dots, or commas in version
+	// resources, or dashes in dates.
+	sep := byte(0)
+	i := 0
+	for {
+		start := i
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+		n, err := strconv.ParseUint(s[start:i], 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("Invalid version %q: %s", v.Original, err)
+		}
+		v.Parts = append(v.Parts, n)
+
+		j := i
+		if j < len(s) && (s[j] == '.' || s[j] == ',' || s[j] == '-') && (sep == 0 || s[j] == sep) {
+			c := s[j]
+			j++
+			for c == ',' && j < len(s) && s[j] == ' ' {
+				j++
+			}
+			if j < len(s) && isDigit(s[j]) {
+				sep = c
+				i = j
+				continue
+			}
+		}
+		break
+	}
+	rest := s[i:]
+
+	switch {
+	case sep == '-':
+		if !splitDatedVersion(&v) {
+			return v, fmt.Errorf("Invalid version %q: dashes only separate dates", v.Original)
+		}
+		v.Format = VERSION_FORMAT_DATED
+		v.Suffix = strings.TrimLeft(rest, ".-_ ")
+		if v.Suffix != "" {
+			v.Format = VERSION_FORMAT_VENDOR
+		}
+		return v, nil
+	case sep != ',' && len(v.Parts) == 3 && isSemverTail(rest):
+		v.Format = VERSION_FORMAT_SEMVER
+		if k := strings.IndexByte(rest, '+'); k >= 0 {
+			v.Build = rest[k+1:]
+			rest = rest[:k]
+		}
+		v.Prerelease = strings.TrimPrefix(rest, "-")
+		return v, nil
+	}
+
+	if len(v.Parts) == 1 && splitDatedVersion(&v) {
+		v.Format = VERSION_FORMAT_DATED
+	} else if v.Parts[0] >= 1990 && v.Parts[0] <= 2099 && len(v.Parts) > 1 && v.Parts[1] <= 12 {
+		v.Format = VERSION_FORMAT_DATED
+	}
+	if rest = strings.Trim(rest, ".-_+ "); rest != "" {
+		v.Format = VERSION_FORMAT_VENDOR
+		if isPrereleaseSuffix(rest) {
+			v.Prerelease = rest
+		} else {
+			v.Suffix = rest
+		}
+	}
+	return v, nil
+}
+
+// splitDatedVersion splits a lone YYYYMMDD part, or checks year, month and
+// day parts are a plausible date.
+func splitDatedVersion(v *Version) bool {
+	p := v.Parts
+	if len(p) == 1 && p[0] >= 19900101 && p[0] <= 20991231 {
+		p = []uint64{p[0] / 10000, p[0] / 100 % 100, p[0] % 100}
+	}
+	if len(p) != 3 || p[0] < 1990 || p[0] > 2099 || p[1] < 1 || p[1] > 12 || p[2] < 1 || p[2] > 31 {
+		return false
+	}
+	v.Parts = p
+	return true
+}
+
+// isSemverTail reports whether what follows three numeric parts is a semver
+// pre-release and build metadata, or nothing.
+func isSemverTail(s string) bool {
+	if s == "" {
+		return true
+	}
+	if s[0] != '-' && s[0] != '+' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-' || r == '.' || r == '+') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrereleaseSuffix(s string) bool {
+	s = strings.ToLower(s)
+	for _, w := range prereleaseWords {
+		if strings.HasPrefix(s, w) && (len(s) == len(w) || !isLetter(s[len(w)])) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripParentheses(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as, or newer than o.
+func (v Version) Compare(o Version) int {
+	n := len(v.Parts)
+	if len(o.Parts) > n {
+		n = len(o.Parts)
+	}
+	for i := 0; i < n; i++ {
+		var a, b uint64
+		if i < len(v.Parts) {
+			a = v.Parts[i]
+		}
+		if i < len(o.Parts) {
+			b = o.Parts[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A pre-release comes before its release, and a suffix after it.
+	switch {
+	case v.Prerelease == "" && o.Prerelease != "":
+		return 1
+	case v.Prerelease != "" && o.Prerelease == "":
+		return -1
+	case v.Prerelease != o.Prerelease:
+		if c := compareVersionText(v.Prerelease, o.Prerelease); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case v.Suffix == "" && o.Suffix != "":
+		return -1
+	case v.Suffix != "" && o.Suffix == "":
+		return 1
+	}
+	return compareVersionText(v.Suffix, o.Suffix)
+}
+
+// compareVersionText compares pre-releases and suffixes naturally: runs of
+// digits by value, and everything else case insensitively, so "rc.2" comes
+// before "rc.10" and "beta" before "RC".
+func compareVersionText(a, b string) int {
+	for a != "" && b != "" {
+		ta, ra := nextVersionToken(a)
+		tb, rb := nextVersionToken(b)
+		da, db := isDigit(ta[0]), isDigit(tb[0])
+		switch {
+		case da && db:
+			na := strings.TrimLeft(ta, "0")
+			nb := strings.TrimLeft(tb, "0")
+			if len(na) != len(nb) {
+				if len(na) < len(nb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+		case da:
+			// As in semver, numbers come before words.
+			return -1
+		case db:
+			return 1
+		default:
+			if c := strings.Compare(strings.ToLower(ta), strings.ToLower(tb)); c != 0 {
+				return c
+			}
+		}
+		a, b = ra, rb
+	}
+	switch {
+	case a == "" && b != "":
+		return -1
+	case a != "" && b == "":
+		return 1
+	}
+	return 0
+}
+
+// nextVersionToken returns the leading run of digits or letters of s, after
+// any separators, and the rest.
+func nextVersionToken(s string) (string, string) {
+	s = strings.TrimLeft(s, ".-_+ ")
+	if s == "" {
+		return "0", ""
+	}
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits && !strings.ContainsRune(".-_+ ", rune(s[i])) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// CompareVersions compares two version strings, as Version.Compare. Strings
+// that aren't valid versions come before those that are, and are compared
+// with each other naturally.
+func CompareVersions(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	switch {
+	case errA == nil && errB == nil:
+		return va.Compare(vb)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	}
+	return compareVersionText(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// VersionConstraint is a set of version ranges, as parsed by
+// ParseVersionConstraint.
+type VersionConstraint struct {
+	Original string
+	groups   [][]versionTerm
+}
+
+type versionTerm struct {
+	op string
+	v  Version
+}
+
+func (c VersionConstraint) String() string {
+	return c.Original
+}
+
+// ParseVersionConstraint parses a constraint such as ">=1.2, <2.0". Terms
+// separated by commas must all match, and groups of them separated by "||"
+// are alternatives, so ">=1.2, <1.4 || >=2.0" excludes 1.4 up to 2.0.
+//
+// Each term is a version, which must be equal, preceded by one of =, !=, >,
+// >=, < or <=, or written as a range:
+//
+//	1.2.*, 1.2.x    >=1.2, <1.3
+//	~1.2.3          >=1.2.3, <1.3, and ~1 is >=1, <2
+//	^1.2.3          >=1.2.3, <2, and ^0.2.3 is >=0.2.3, <0.3
+//	*               any version
+//
+// Versions are parsed by ParseVersion, except that version resource style
+// commas can't be used.
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	c := VersionConstraint{Original: s}
+	for _, group := range strings.Split(s, "||") {
+		terms := make([]versionTerm, 0)
+		for _, term := range strings.Split(group, ",") {
+			t, err := parseVersionTerms(strings.TrimSpace(term))
+			if err != nil {
+				return c, fmt.Errorf("Invalid version constraint %q: %s", s, err)
+			}
+			terms = append(terms, t...)
+		}
+		c.groups = append(c.groups, terms)
+	}
+	return c, nil
+}
+
+// parseVersionTerms parses a single term, expanding ranges into the
+// comparisons they stand for.
+func parseVersionTerms(s string) ([]versionTerm, error) {
+	if s == "" {
+		return nil, fmt.Errorf("Empty term")
+	}
+	if s == "*" || s == "x" || s == "X" {
+		return []versionTerm{}, nil
+	}
+	op := ""
+	for _, o := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			s = strings.TrimSpace(s[len(o):])
+			break
+		}
+	}
+
+	wildcard := false
+	if op == "" || op == "=" || op == "==" {
+		for _, w := range []string{".*", ".x", ".X"} {
+			if strings.HasSuffix(s, w) {
+				wildcard = true
+				s = s[:len(s)-len(w)]
+				break
+			}
+		}
+	}
+	v, err := ParseVersion(s)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsRune(s, ',') {
+		return nil, fmt.Errorf("Commas separate terms, not version parts: %s", s)
+	}
+
+	switch {
+	case wildcard:
+		return []versionTerm{{">=", v}, {"<", versionUpperBound(v, len(v.Parts)-1)}}, nil
+	case op == "~":
+		n := len(v.Parts) - 1
+		if n > 1 {
+			n = 1
+		}
+		return []versionTerm{{">=", v}, {"<", versionUpperBound(v, n)}}, nil
+	case op == "^":
+		n := 0
+		for n < len(v.Parts)-1 && v.Parts[n] == 0 {
+			n++
+		}
+		return []versionTerm{{">=", v}, {"<", versionUpperBound(v, n)}}, nil
+	case op == "" || op == "==":
+		op = "="
+	}
+	return []versionTerm{{op, v}}, nil
+}
+
+// versionUpperBound is the first version after v whose parts up to and
+// including n differ, such as 1.3 for 1.2.5 and n of 1.
+func versionUpperBound(v Version, n int) Version {
+	parts := make([]uint64, n+1)
+	copy(parts, v.Parts[:n+1])
+	parts[n]++
+	text := make([]string, len(parts))
+	for i, p := range parts {
+		text[i] = strconv.FormatUint(p, 10)
+	}
+	return Version{Original: strings.Join(text, "."), Format: VERSION_FORMAT_NUMERIC, Parts: parts}
+}
+
+// Match reports whether v satisfies the constraint.
+func (c VersionConstraint) Match(v Version) bool {
+	for _, group := range c.groups {
+		matched := true
+		for _, t := range group {
+			if !t.match(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (t versionTerm) match(v Version) bool {
+	c := v.Compare(t.v)
+	switch t.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
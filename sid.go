@@ -6,18 +6,70 @@ package winapi
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 	"syscall"
+	"time"
 	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+	"golang.org/x/sys/windows"
 )
 
 var (
 	usrLookupAccountNameW     = modAdvapi32.NewProc("LookupAccountNameW")
 	usrConvertSidToStringSidW = modAdvapi32.NewProc("ConvertSidToStringSidW")
 
+	sidLsaOpenPolicy         = modAdvapi32.NewProc("LsaOpenPolicy")
+	sidLsaLookupSids         = modAdvapi32.NewProc("LsaLookupSids")
+	sidLsaFreeMemory         = modAdvapi32.NewProc("LsaFreeMemory")
+	sidLsaClose              = modAdvapi32.NewProc("LsaClose")
+	sidLsaNtStatusToWinError = modAdvapi32.NewProc("LsaNtStatusToWinError")
+
 	usrLocalFree = modKernel32.NewProc("LocalFree")
 )
 
+const (
+	SID_POLICY_LOOKUP_NAMES = 0x00000800
+
+	SID_STATUS_SUCCESS         = 0x00000000
+	SID_STATUS_SOME_NOT_MAPPED = 0x00000107
+	SID_STATUS_NONE_MAPPED     = 0xC0000073
+
+	// LsaLookupSids accepts at most this many SIDs per call.
+	SID_LSA_LOOKUP_MAX = 20480
+)
+
+// LSA_OBJECT_ATTRIBUTES is passed to LsaOpenPolicy, which requires it to be
+// zeroed.
+type LSA_OBJECT_ATTRIBUTES struct {
+	Length                   uint32
+	RootDirectory            uintptr
+	ObjectName               uintptr
+	Attributes               uint32
+	SecurityDescriptor       uintptr
+	SecurityQualityOfService uintptr
+}
+
+type LSA_TRUST_INFORMATION struct {
+	Name LSA_UNICODE_STRING
+	Sid  uintptr
+}
+
+type LSA_REFERENCED_DOMAIN_LIST struct {
+	Entries uint32
+	Domains uintptr
+}
+
+type LSA_TRANSLATED_NAME struct {
+	Use         uint32
+	Name        LSA_UNICODE_STRING
+	DomainIndex int32
+}
+
+// sidCache backs ResolveSid and ResolveSids.
+var sidCache = NewSidCache(LsaSidResolver{}, 15*time.Minute, 2*time.Minute)
+
 // GetRawSidForAccountName looks up the SID for a given account name using the
 // LookupAccountNameW system call.
 // The SID is returned as a buffer containing the raw _SID struct.
@@ -109,3 +161,220 @@ func ConvertRawSidToStringSid(rawSid []byte) (string, error) {
 
 	return UTF16toString((*uint16)(unsafe.Pointer(sidStringPtr))), nil
 }
+
+// LookupAccountSid looks up the account for a string SID (e.g. "S-1-5-32-544")
+// using the LookupAccountSidW system call.
+//
+// If the SID doesn't map to an account, the returned error is ERROR_NONE_MAPPED.
+//
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-lookupaccountsidw
+func LookupAccountSid(sid string) (so.SidAccount, error) {
+	rawSid, err := windows.StringToSid(sid)
+	if err != nil {
+		return so.SidAccount{}, fmt.Errorf("Invalid SID %q: %s", sid, err)
+	}
+
+	var nameSize uint32
+	var domainSize uint32
+	var eUse uint32
+
+	// Get sizes first, which always returns failure.
+	_, _, err = procLookupAccountSid.Call(
+		uintptr(0),                           // system name
+		uintptr(unsafe.Pointer(rawSid)),      // SID
+		uintptr(0),                           // name
+		uintptr(unsafe.Pointer(&nameSize)),   // name buffer size
+		uintptr(0),                           // referenced domain
+		uintptr(unsafe.Pointer(&domainSize)), // referenced domain buffer size
+		uintptr(unsafe.Pointer(&eUse)),       // Account type enumeration
+	)
+	if nameSize == 0 {
+		return so.SidAccount{SID: sid, Type: so.SID_TYPE_UNKNOWN}, err
+	}
+	if domainSize == 0 {
+		domainSize = 1
+	}
+
+	name := make([]uint16, nameSize)
+	domain := make([]uint16, domainSize)
+
+	// Call for real this time
+	r1, _, err := procLookupAccountSid.Call(
+		uintptr(0),                           // system name
+		uintptr(unsafe.Pointer(rawSid)),      // SID
+		uintptr(unsafe.Pointer(&name[0])),    // name
+		uintptr(unsafe.Pointer(&nameSize)),   // name buffer size
+		uintptr(unsafe.Pointer(&domain[0])),  // referenced domain
+		uintptr(unsafe.Pointer(&domainSize)), // referenced domain buffer size
+		uintptr(unsafe.Pointer(&eUse)),       // Account type enumeration
+	)
+
+	// LookupAccountSidW returns non-zero on success
+	if r1 == 0 {
+		return so.SidAccount{}, err
+	}
+
+	return so.SidAccount{
+		SID:    sid,
+		Domain: syscall.UTF16ToString(domain),
+		Name:   syscall.UTF16ToString(name),
+		Type:   eUse,
+	}, nil
+}
+
+// LookupAccountSids resolves a batch of string SIDs with LsaLookupSids, which
+// is far cheaper than calling LookupAccountSid for each one when the SIDs
+// belong to a remote domain.
+//
+// One entry is returned per SID, in the same order. SIDs that don't map to an
+// account aren't treated as an error; their entries have an empty Name and a
+// Type of SID_TYPE_UNKNOWN.
+//
+// See: https://docs.microsoft.com/en-us/windows/win32/api/ntsecapi/nf-ntsecapi-lsalookupsids
+func LookupAccountSids(sids []string) ([]so.SidAccount, error) {
+	retVal := make([]so.SidAccount, 0, len(sids))
+	if len(sids) == 0 {
+		return retVal, nil
+	}
+
+	policy, err := lsaOpenPolicy(SID_POLICY_LOOKUP_NAMES)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open LSA policy: %s", err)
+	}
+	defer sidLsaClose.Call(policy)
+
+	for start := 0; start < len(sids); start += SID_LSA_LOOKUP_MAX {
+		end := start + SID_LSA_LOOKUP_MAX
+		if end > len(sids) {
+			end = len(sids)
+		}
+		accounts, err := lsaLookupSids(policy, sids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		retVal = append(retVal, accounts...)
+	}
+
+	return retVal, nil
+}
+
+// LsaSidResolver is a SidResolver backed by LookupAccountSids.
+type LsaSidResolver struct{}
+
+func (LsaSidResolver) LookupSids(sids []string) ([]so.SidAccount, error) {
+	return LookupAccountSids(sids)
+}
+
+// ResolveSid is a cached version of LookupAccountSid.
+//
+// Resolved SIDs are cached for 15 minutes, and SIDs that don't map to an
+// account for 2 minutes.
+func ResolveSid(sid string) (so.SidAccount, error) {
+	return sidCache.Lookup(sid)
+}
+
+// ResolveSids is a cached version of LookupAccountSids, see ResolveSid.
+func ResolveSids(sids []string) ([]so.SidAccount, error) {
+	return sidCache.LookupSids(sids)
+}
+
+func lsaOpenPolicy(access uint32) (uintptr, error) {
+	var attrs LSA_OBJECT_ATTRIBUTES
+	var handle uintptr
+
+	ret, _, _ := sidLsaOpenPolicy.Call(
+		uintptr(0),                       // system name
+		uintptr(unsafe.Pointer(&attrs)),  // object attributes
+		uintptr(access),                  // desired access
+		uintptr(unsafe.Pointer(&handle)), // policy handle
+	)
+	if ret != SID_STATUS_SUCCESS {
+		return 0, lsaNtStatusToError(ret)
+	}
+	return handle, nil
+}
+
+func lsaNtStatusToError(status uintptr) error {
+	ret, _, _ := sidLsaNtStatusToWinError.Call(status)
+	return syscall.Errno(ret)
+}
+
+func lsaLookupSids(policy uintptr, sids []string) ([]so.SidAccount, error) {
+	rawSids := make([]*windows.SID, 0, len(sids))
+	sidPointers := make([]uintptr, 0, len(sids))
+	for _, sid := range sids {
+		rawSid, err := windows.StringToSid(sid)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SID %q: %s", sid, err)
+		}
+		rawSids = append(rawSids, rawSid)
+		sidPointers = append(sidPointers, uintptr(unsafe.Pointer(rawSid)))
+	}
+
+	var domainsPointer, namesPointer uintptr
+	ret, _, _ := sidLsaLookupSids.Call(
+		policy,
+		uintptr(len(sidPointers)),
+		uintptr(unsafe.Pointer(&sidPointers[0])),
+		uintptr(unsafe.Pointer(&domainsPointer)),
+		uintptr(unsafe.Pointer(&namesPointer)),
+	)
+	runtime.KeepAlive(rawSids)
+	if domainsPointer != 0 {
+		defer sidLsaFreeMemory.Call(domainsPointer)
+	}
+	if namesPointer != 0 {
+		defer sidLsaFreeMemory.Call(namesPointer)
+	}
+	if ret != SID_STATUS_SUCCESS && ret != SID_STATUS_SOME_NOT_MAPPED && ret != SID_STATUS_NONE_MAPPED {
+		return nil, lsaNtStatusToError(ret)
+	}
+
+	var (
+		domains  *LSA_REFERENCED_DOMAIN_LIST
+		sizeName LSA_TRANSLATED_NAME
+		sizeDom  LSA_TRUST_INFORMATION
+		retVal   = make([]so.SidAccount, 0, len(sids))
+	)
+	if domainsPointer != 0 {
+		domains = (*LSA_REFERENCED_DOMAIN_LIST)(unsafe.Pointer(domainsPointer))
+	}
+
+	for i, sid := range sids {
+		account := so.SidAccount{SID: sid, Type: so.SID_TYPE_UNKNOWN}
+		if namesPointer != 0 {
+			name := (*LSA_TRANSLATED_NAME)(unsafe.Pointer(namesPointer + uintptr(i)*unsafe.Sizeof(sizeName)))
+			account.Type = name.Use
+			// Unmapped SIDs come back with the string SID as their name.
+			if name.Use != so.SID_TYPE_UNKNOWN && name.Use != so.SID_TYPE_INVALID {
+				account.Name = LsatoString(name.Name)
+			}
+			if domains != nil && name.DomainIndex >= 0 && uint32(name.DomainIndex) < domains.Entries {
+				domain := (*LSA_TRUST_INFORMATION)(unsafe.Pointer(domains.Domains + uintptr(name.DomainIndex)*unsafe.Sizeof(sizeDom)))
+				account.Domain = LsatoString(domain.Name)
+			}
+		}
+		retVal = append(retVal, account)
+	}
+
+	return retVal, nil
+}
+
+// lookupAccountName looks up the SID and account type for an account name,
+// which may be qualified with a domain.
+func lookupAccountName(accountName string) (so.SidAccount, error) {
+	sid, domain, accType, err := windows.LookupSID("", accountName)
+	if err != nil {
+		return so.SidAccount{}, err
+	}
+	name := accountName
+	if i := strings.LastIndexByte(name, '\\'); i >= 0 {
+		name = name[i+1:]
+	}
+	return so.SidAccount{
+		SID:    sid.String(),
+		Domain: domain,
+		Name:   name,
+		Type:   accType,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package winapi
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// ERROR_NONE_MAPPED is returned when a SID does not map to any account, for
+// example because the account it belonged to has been deleted.
+const ERROR_NONE_MAPPED syscall.Errno = 1332 // 0x00000534
+
+// A SidResolver resolves string SIDs to the accounts they belong to.
+//
+// LookupSids must return exactly one entry per requested SID, in the same
+// order. SIDs which don't map to an account are returned as entries for which
+// IsMapped() is false, rather than as an error; an error means the lookup
+// itself failed.
+type SidResolver interface {
+	LookupSids(sids []string) ([]so.SidAccount, error)
+}
+
+// SidCache is a SidResolver that remembers the results of an underlying
+// resolver.
+//
+// Resolved SIDs are kept for ttl, and SIDs that didn't map to an account
+// (orphaned SIDs) are kept for negativeTTL, so repeatedly listing a group with
+// a deleted member doesn't hit the domain controller each time.
+//
+// A SidCache is safe for concurrent use.
+type SidCache struct {
+	resolver    SidResolver
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]sidCacheEntry
+}
+
+type sidCacheEntry struct {
+	account so.SidAccount
+	expires time.Time
+}
+
+// NewSidCache returns a SidCache in front of resolver.
+func NewSidCache(resolver SidResolver, ttl, negativeTTL time.Duration) *SidCache {
+	return &SidCache{
+		resolver:    resolver,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]sidCacheEntry),
+	}
+}
+
+// Lookup resolves a single SID.
+//
+// If the SID doesn't map to an account, the returned error is ERROR_NONE_MAPPED.
+func (c *SidCache) Lookup(sid string) (so.SidAccount, error) {
+	accounts, err := c.LookupSids([]string{sid})
+	if err != nil {
+		return so.SidAccount{}, err
+	}
+	if !accounts[0].IsMapped() {
+		return accounts[0], ERROR_NONE_MAPPED
+	}
+	return accounts[0], nil
+}
+
+// LookupSids resolves sids, only passing SIDs that aren't cached (or whose
+// cache entry has expired) to the underlying resolver, in a single batch.
+func (c *SidCache) LookupSids(sids []string) ([]so.SidAccount, error) {
+	retVal := make([]so.SidAccount, len(sids))
+	missing := make([]string, 0)
+	missingIdx := make(map[string][]int)
+
+	c.mu.Lock()
+	now := c.now()
+	for i, sid := range sids {
+		key := strings.ToUpper(sid)
+		if e, ok := c.entries[key]; ok {
+			if now.Before(e.expires) {
+				retVal[i] = e.account
+				retVal[i].SID = sid
+				continue
+			}
+			delete(c.entries, key)
+		}
+		if _, ok := missingIdx[key]; !ok {
+			missing = append(missing, sid)
+		}
+		missingIdx[key] = append(missingIdx[key], i)
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return retVal, nil
+	}
+
+	resolved, err := c.resolver.LookupSids(missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) != len(missing) {
+		return nil, fmt.Errorf("SID resolver returned %d results for %d SIDs", len(resolved), len(missing))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now = c.now()
+	for j, account := range resolved {
+		key := strings.ToUpper(missing[j])
+		account.SID = missing[j]
+		ttl := c.ttl
+		if !account.IsMapped() {
+			ttl = c.negativeTTL
+		}
+		if ttl > 0 {
+			c.entries[key] = sidCacheEntry{account: account, expires: now.Add(ttl)}
+		}
+		for _, i := range missingIdx[key] {
+			retVal[i] = account
+			retVal[i].SID = sids[i]
+		}
+	}
+
+	return retVal, nil
+}
+
+// Forget removes a single SID from the cache.
+func (c *SidCache) Forget(sid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, strings.ToUpper(sid))
+}
+
+// Purge removes every entry from the cache.
+func (c *SidCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]sidCacheEntry)
+}
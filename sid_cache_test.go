@@ -0,0 +1,128 @@
+package winapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+type fakeSidResolver struct {
+	accounts map[string]so.SidAccount
+	calls    [][]string
+	err      error
+}
+
+func (f *fakeSidResolver) LookupSids(sids []string) ([]so.SidAccount, error) {
+	f.calls = append(f.calls, sids)
+	if f.err != nil {
+		return nil, f.err
+	}
+	retVal := make([]so.SidAccount, 0, len(sids))
+	for _, sid := range sids {
+		if a, ok := f.accounts[sid]; ok {
+			retVal = append(retVal, a)
+		} else {
+			retVal = append(retVal, so.SidAccount{SID: sid, Type: so.SID_TYPE_UNKNOWN})
+		}
+	}
+	return retVal, nil
+}
+
+func newTestSidCache() (*SidCache, *fakeSidResolver, *time.Time) {
+	r := &fakeSidResolver{accounts: map[string]so.SidAccount{
+		"S-1-5-32-544":        {Domain: "BUILTIN", Name: "Administrators", Type: so.SID_TYPE_ALIAS},
+		"S-1-5-21-1-2-3-1001": {Domain: "HOST", Name: "alice", Type: so.SID_TYPE_USER},
+	}}
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewSidCache(r, time.Hour, time.Minute)
+	c.now = func() time.Time { return clock }
+	return c, r, &clock
+}
+
+func TestSidCacheBatchesMisses(t *testing.T) {
+	c, r, _ := newTestSidCache()
+
+	got, err := c.LookupSids([]string{"S-1-5-32-544", "S-1-5-21-1-2-3-1001", "S-1-5-32-544"})
+	if err != nil {
+		t.Fatalf("LookupSids: %v", err)
+	}
+	if len(r.calls) != 1 || len(r.calls[0]) != 2 {
+		t.Fatalf("expected one batched call for 2 unique SIDs, got %v", r.calls)
+	}
+	if got[0].FullName() != `BUILTIN\Administrators` || got[2].FullName() != `BUILTIN\Administrators` {
+		t.Errorf("unexpected results: %+v", got)
+	}
+	if got[1].SID != "S-1-5-21-1-2-3-1001" || got[1].Name != "alice" {
+		t.Errorf("unexpected result for user SID: %+v", got[1])
+	}
+
+	// Lookups are case-insensitive and served from the cache.
+	if _, err := c.LookupSids([]string{"s-1-5-32-544", "S-1-5-21-1-2-3-1001"}); err != nil {
+		t.Fatalf("LookupSids: %v", err)
+	}
+	if len(r.calls) != 1 {
+		t.Errorf("expected cached lookup, resolver called %d times", len(r.calls))
+	}
+}
+
+func TestSidCacheExpiry(t *testing.T) {
+	c, r, clock := newTestSidCache()
+
+	if _, err := c.Lookup("S-1-5-32-544"); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	*clock = clock.Add(59 * time.Minute)
+	c.Lookup("S-1-5-32-544")
+	if len(r.calls) != 1 {
+		t.Fatalf("entry expired early, resolver called %d times", len(r.calls))
+	}
+	*clock = clock.Add(2 * time.Minute)
+	c.Lookup("S-1-5-32-544")
+	if len(r.calls) != 2 {
+		t.Fatalf("entry did not expire, resolver called %d times", len(r.calls))
+	}
+}
+
+func TestSidCacheNegative(t *testing.T) {
+	c, r, clock := newTestSidCache()
+	orphan := "S-1-5-21-9-9-9-1105"
+
+	a, err := c.Lookup(orphan)
+	if err != ERROR_NONE_MAPPED {
+		t.Fatalf("expected ERROR_NONE_MAPPED, got %v", err)
+	}
+	if a.SID != orphan || a.IsMapped() {
+		t.Errorf("unexpected orphan result: %+v", a)
+	}
+
+	c.Lookup(orphan)
+	if len(r.calls) != 1 {
+		t.Fatalf("orphan not negatively cached, resolver called %d times", len(r.calls))
+	}
+
+	// Negative entries use the shorter TTL.
+	*clock = clock.Add(2 * time.Minute)
+	c.Lookup(orphan)
+	if len(r.calls) != 2 {
+		t.Fatalf("negative entry did not expire, resolver called %d times", len(r.calls))
+	}
+}
+
+func TestSidCacheForgetAndErrors(t *testing.T) {
+	c, r, _ := newTestSidCache()
+
+	c.Lookup("S-1-5-32-544")
+	c.Forget("S-1-5-32-544")
+	c.Lookup("S-1-5-32-544")
+	if len(r.calls) != 2 {
+		t.Fatalf("Forget did not drop entry, resolver called %d times", len(r.calls))
+	}
+
+	c.Purge()
+	r.err = errors.New("domain controller unreachable")
+	if _, err := c.Lookup("S-1-5-32-544"); err != r.err {
+		t.Fatalf("expected resolver error, got %v", err)
+	}
+}
@@ -5,216 +5,105 @@ package winapi
 
 import (
 	"fmt"
-	"time"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"golang.org/x/sys/windows/registry"
 
 	so "github.com/iamacarpet/go-win64api/shared"
 )
 
+// InstalledSoftwareList returns the software registered to be uninstalled,
+// machine wide in both registry views, and for each user with a profile.
+// Every registration is listed, so a product installed for both
+// architectures, in several versions side by side, or for several users
+// appears once for each; DedupSoftware merges them if that's wanted.
 func InstalledSoftwareList() ([]so.Software, error) {
-	sw64, err := getSoftwareList(`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`, "", "X64")
-	if err != nil {
-		return nil, err
-	}
-	sw32, err := getSoftwareList(`SOFTWARE\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall`, "", "X32")
+	return InstalledSoftwareFrom(LiveRegistry{})
+}
+
+// LiveRegistry is the registry of the running system as a RegistrySource.
+//
+// Users who are logged on have their hives loaded under HKU. The hives of
+// other users are read from the NTUSER.DAT in their profile, which needs
+// administrator rights, and may be missing changes still in its
+// transaction logs if the user logged off uncleanly.
+type LiveRegistry struct{}
+
+// SoftwareHives opens HKLM\SOFTWARE, then the SOFTWARE key of each user.
+func (LiveRegistry) SoftwareHives() ([]RegistryHive, error) {
+	machine, err := registry.OpenKey(registry.LOCAL_MACHINE, "SOFTWARE", registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Error reading from registry: %s", err.Error())
 	}
+	hives := []RegistryHive{{Path: `HKLM\SOFTWARE`, Software: liveRegistryKey{machine}}}
+
 	k, err := registry.OpenKey(registry.USERS, "", registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
 	if err != nil {
+		machine.Close()
 		return nil, err
 	}
 	defer k.Close()
 
 	osUsers, err := k.ReadSubKeyNames(-1)
 	if err != nil {
+		machine.Close()
 		return nil, err
 	}
 
-	swmap := make(map[string]bool)
-	var swList []so.Software
-
-	for _, sw := range sw64 {
-		if !swmap[sw.DisplayName] {
-			swList = append(swList, sw)
-			swmap[sw.DisplayName] = true
-		}
-	}
-	for _, sw := range sw32 {
-		if !swmap[sw.DisplayName] {
-			swList = append(swList, sw)
-			swmap[sw.DisplayName] = true
-		}
-	}
-
+	loaded := make(map[string]bool)
 	for _, osUser := range osUsers {
-		userSoftwareList64, err := getSoftwareList(`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`, osUser, "X64")
-		if err == nil {
-			for _, sw := range userSoftwareList64 {
-				if !swmap[sw.DisplayName] {
-					swList = append(swList, sw)
-					swmap[sw.DisplayName] = true
-				}
-			}
-		}
-		userSoftwareList32, err := getSoftwareList(`SOFTWARE\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall`, osUser, "X32")
-		if err == nil {
-			for _, sw := range userSoftwareList32 {
-				if !swmap[sw.DisplayName] {
-					swList = append(swList, sw)
-					swmap[sw.DisplayName] = true
-				}
-			}
-		}
-		userDataSoftwareList64, err := getSoftwareList(`SOFTWARE\Microsoft\Windows\CurrentVersion\Installer\UserData`, osUser, "X64")
-		if err == nil {
-			for _, sw := range userDataSoftwareList64 {
-				if !swmap[sw.DisplayName] {
-					swList = append(swList, sw)
-					swmap[sw.DisplayName] = true
-				}
-			}
+		if !isUserHiveName(osUser) {
+			continue
 		}
-		userDataSoftwareList32, err := getSoftwareList(`SOFTWARE\Wow6432Node\Microsoft\Windows\CurrentVersion\Installer\UserData`, osUser, "X32")
-		if err == nil {
-			for _, sw := range userDataSoftwareList32 {
-				if !swmap[sw.DisplayName] {
-					swList = append(swList, sw)
-					swmap[sw.DisplayName] = true
-				}
-			}
+		loaded[strings.ToUpper(osUser)] = true
+		uk, err := registry.OpenKey(registry.USERS, osUser+`\SOFTWARE`, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
 		}
+		hives = append(hives, RegistryHive{User: osUser, Path: `HKU\` + osUser + `\SOFTWARE`, Software: liveRegistryKey{uk}})
 	}
-	return swList, nil
-}
 
-func parseSoftware(rootKey registry.Key, path string) (so.Software, error) {
-	sk, err := registry.OpenKey(rootKey, path, registry.QUERY_VALUE)
+	profiles, err := profileImagePaths(liveRegistryKey{machine})
 	if err != nil {
-		return so.Software{}, fmt.Errorf("Error reading from registry `%s`: %s", path, err.Error())
-	}
-	defer sk.Close()
-
-	dn, _, err := sk.GetStringValue("DisplayName")
-	if err != nil {
-		return so.Software{}, err
-	}
-	swv := so.Software{DisplayName: dn}
-
-	if rootKey == registry.LOCAL_MACHINE {
-		swv.RegKey = fmt.Sprintf(`HKLM\%s`, path)
-	} else if rootKey == registry.USERS {
-		swv.RegKey = fmt.Sprintf(`HKU\%s`, path)
-	}
-
-	dv, _, err := sk.GetStringValue("DisplayVersion")
-	if err == nil {
-		swv.DisplayVersion = dv
-	}
-
-	pub, _, err := sk.GetStringValue("Publisher")
-	if err == nil {
-		swv.Publisher = pub
-	}
-
-	id, _, err := sk.GetStringValue("InstallDate")
-	if err == nil {
-		swv.InstallDate, _ = time.Parse("20060102", id)
-	}
-
-	es, _, err := sk.GetIntegerValue("EstimatedSize")
-	if err == nil {
-		swv.EstimatedSize = es
-	}
-
-	cont, _, err := sk.GetStringValue("Contact")
-	if err == nil {
-		swv.Contact = cont
-	}
-
-	hlp, _, err := sk.GetStringValue("HelpLink")
-	if err == nil {
-		swv.HelpLink = hlp
+		return hives, nil
 	}
-
-	isource, _, err := sk.GetStringValue("InstallSource")
-	if err == nil {
-		swv.InstallSource = isource
-	}
-
-	ilocaction, _, err := sk.GetStringValue("InstallLocation")
-	if err == nil {
-		swv.InstallLocation = ilocaction
-	}
-
-	ustring, _, err := sk.GetStringValue("UninstallString")
-	if err == nil {
-		swv.UninstallString = ustring
-	}
-
-	mver, _, err := sk.GetIntegerValue("VersionMajor")
-	if err == nil {
-		swv.VersionMajor = mver
-	}
-
-	mnver, _, err := sk.GetIntegerValue("VersionMinor")
-	if err == nil {
-		swv.VersionMinor = mnver
-	}
-	return swv, nil
-}
-
-func getSoftwareList(baseKey, user, arch string) ([]so.Software, error) {
-	rootKey := registry.LOCAL_MACHINE
-	if user != "" {
-		rootKey = registry.USERS
-		baseKey = user + `\` + baseKey
-	}
-	k, err := registry.OpenKey(rootKey, baseKey, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading from registry: %s", err.Error())
-	}
-	defer k.Close()
-
-	swList := make([]so.Software, 0)
-
-	subkeys, err := k.ReadSubKeyNames(-1)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading subkey list from registry: %s", err.Error())
+	sids := make([]string, 0, len(profiles))
+	for sid := range profiles {
+		if !loaded[strings.ToUpper(sid)] {
+			sids = append(sids, sid)
+		}
 	}
-	for _, sw := range subkeys {
-		parsed, err := parseSoftware(rootKey, baseKey+`\`+sw)
+	sort.Strings(sids)
+	for _, sid := range sids {
+		dir, err := registry.ExpandString(profiles[sid])
 		if err != nil {
 			continue
 		}
-		parsed.Arch = arch
-		swList = append(swList, parsed)
+		path := filepath.Join(dir, userHiveFileName)
+		uk, err := openHiveRegistryKey(path, "SOFTWARE")
+		if err != nil {
+			continue
+		}
+		hives = append(hives, RegistryHive{User: sid, Path: path + `\SOFTWARE`, Software: uk})
 	}
+	return hives, nil
+}
 
-	return swList, nil
+// liveRegistryKey is a key of the live registry as a RegistryKey.
+type liveRegistryKey struct {
+	registry.Key
 }
 
-func getUserDataSoftwareList(baseKey, user, arch string) ([]so.Software, error) {
-	k, err := registry.OpenKey(registry.USERS, baseKey, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+func (k liveRegistryKey) OpenSubKey(path string) (RegistryKey, error) {
+	sk, err := registry.OpenKey(k.Key, path, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
 	if err != nil {
-		return nil, fmt.Errorf("Error reading from registry: %s", err.Error())
+		return nil, err
 	}
-	defer k.Close()
-
-	swList := make([]so.Software, 0)
+	return liveRegistryKey{sk}, nil
+}
 
-	subkeys, err := k.ReadSubKeyNames(-1)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading subkey list from registry: %s", err.Error())
-	}
-	for _, sw := range subkeys {
-		parsed, err := parseSoftware(registry.LOCAL_MACHINE, baseKey+`\`+sw)
-		if err != nil {
-			continue
-		}
-		parsed.Arch = arch
-		swList = append(swList, parsed)
-	}
-	return swList, nil
+func (k liveRegistryKey) ReadSubKeyNames() ([]string, error) {
+	return k.Key.ReadSubKeyNames(-1)
 }
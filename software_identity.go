@@ -0,0 +1,93 @@
+package winapi
+
+import (
+	"fmt"
+	"strings"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// Uninstall registrations, native and under Wow6432Node for 32-bit software.
+const (
+	softwareUninstallKey   = `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`
+	softwareUninstallKey32 = `SOFTWARE\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall`
+)
+
+// Policies for DedupSoftware.
+const (
+	// SOFTWARE_DEDUP_NONE keeps every registration.
+	SOFTWARE_DEDUP_NONE = iota
+	// SOFTWARE_DEDUP_IDENTICAL drops registrations that only differ in
+	// where they're registered, keeping different architectures, versions
+	// and users apart.
+	SOFTWARE_DEDUP_IDENTICAL
+	// SOFTWARE_DEDUP_DISPLAY_NAME keeps only the first registration of each
+	// DisplayName, as InstalledSoftwareList used to.
+	SOFTWARE_DEDUP_DISPLAY_NAME
+)
+
+// DedupSoftware merges registrations of the same software according to
+// policy, keeping the first of each in list order.
+func DedupSoftware(list []so.Software, policy uint32) []so.Software {
+	if policy == SOFTWARE_DEDUP_NONE {
+		return list
+	}
+	seen := make(map[string]bool)
+	retVal := make([]so.Software, 0, len(list))
+	for _, sw := range list {
+		key := sw.DisplayName
+		if policy == SOFTWARE_DEDUP_IDENTICAL {
+			key = strings.Join([]string{sw.DisplayName, sw.DisplayVersion, sw.Publisher, sw.Arch, sw.UserSID}, "\x00")
+		}
+		if !seen[key] {
+			seen[key] = true
+			retVal = append(retVal, sw)
+		}
+	}
+	return retVal
+}
+
+// setSoftwareIdentity records where software was found: the user whose hive
+// it's in, if any, the registry view, and its key relative to the hive.
+func setSoftwareIdentity(sw *so.Software, user string, view uint32, key string) {
+	owner := "machine"
+	if user != "" {
+		owner = user
+	}
+	sw.UserSID = user
+	sw.RegView = view
+	switch view {
+	case so.SOFTWARE_VIEW_64:
+		sw.Arch = "X64"
+	case so.SOFTWARE_VIEW_32:
+		sw.Arch = "X32"
+	}
+	sw.ID = fmt.Sprintf("%s:%d:%s", owner, view, softwareViewPath(key))
+	sw.ProductCode = productCodeFromKeyName(key[strings.LastIndexByte(key, '\\')+1:])
+}
+
+// softwareViewPath is the path of a key within its registry view, without
+// the Wow6432Node that 32-bit keys are stored under.
+func softwareViewPath(key string) string {
+	const wow = `SOFTWARE\Wow6432Node\`
+	if len(key) >= len(wow) && strings.EqualFold(key[:len(wow)], wow) {
+		return key[:len(`SOFTWARE\`)] + key[len(wow):]
+	}
+	return key
+}
+
+// productCodeFromKeyName returns the product code of software registered by
+// Windows Installer, whose uninstall keys are named after it, in upper case
+// with braces.
+func productCodeFromKeyName(name string) string {
+	if len(name) != 38 || productCodePattern.FindString(name) != name {
+		return ""
+	}
+	return strings.ToUpper(name)
+}
+
+// isUserHiveName reports whether a key under HKU is a user's hive, rather
+// than their classes hive or .DEFAULT, which is the system account's.
+func isUserHiveName(name string) bool {
+	return strings.HasPrefix(name, "S-1-") && !strings.HasSuffix(strings.ToLower(name), "_classes")
+}
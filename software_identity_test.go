@@ -0,0 +1,86 @@
+package winapi
+
+import (
+	"reflect"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+func TestSetSoftwareIdentity(t *testing.T) {
+	tests := []struct {
+		user    string
+		view    uint32
+		key     string
+		id      string
+		arch    string
+		product string
+	}{
+		{"", so.SOFTWARE_VIEW_64, softwareUninstallKey + `\7-Zip`,
+			`machine:64:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\7-Zip`, "X64", ""},
+		{"", so.SOFTWARE_VIEW_32, softwareUninstallKey32 + `\{23170f69-40c1-2701-1900-000001000000}`,
+			`machine:32:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\{23170f69-40c1-2701-1900-000001000000}`, "X32",
+			"{23170F69-40C1-2701-1900-000001000000}"},
+		{"S-1-5-21-1-2-3-1001", so.SOFTWARE_VIEW_64, softwareUninstallKey + `\{23170F69-40C1-2701-1900-000001000000}_is1`,
+			`S-1-5-21-1-2-3-1001:64:SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\{23170F69-40C1-2701-1900-000001000000}_is1`, "X64", ""},
+	}
+	for _, tt := range tests {
+		var sw so.Software
+		setSoftwareIdentity(&sw, tt.user, tt.view, tt.key)
+		if sw.ID != tt.id || sw.Arch != tt.arch || sw.ProductCode != tt.product || sw.UserSID != tt.user || sw.RegView != tt.view {
+			t.Errorf("setSoftwareIdentity(%q, %d, %q) = %+v", tt.user, tt.view, tt.key, sw)
+		}
+	}
+
+	// The same key in both views is two registrations.
+	var a, b so.Software
+	setSoftwareIdentity(&a, "", so.SOFTWARE_VIEW_64, softwareUninstallKey+`\Tool`)
+	setSoftwareIdentity(&b, "", so.SOFTWARE_VIEW_32, softwareUninstallKey32+`\Tool`)
+	if a.ID == b.ID {
+		t.Errorf("64 and 32-bit registrations share the ID %s", a.ID)
+	}
+}
+
+func TestIsUserHiveName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"S-1-5-21-1-2-3-1001":         true,
+		"S-1-5-18":                    true,
+		"S-1-5-21-1-2-3-1001_Classes": false,
+		".DEFAULT":                    false,
+	} {
+		if got := isUserHiveName(name); got != want {
+			t.Errorf("isUserHiveName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDedupSoftware(t *testing.T) {
+	list := []so.Software{
+		{ID: "1", DisplayName: "Tool", DisplayVersion: "1.0", Arch: "X64"},
+		{ID: "2", DisplayName: "Tool", DisplayVersion: "1.0", Arch: "X32"},
+		{ID: "3", DisplayName: "Tool", DisplayVersion: "2.0", Arch: "X64"},
+		{ID: "4", DisplayName: "Tool", DisplayVersion: "1.0", Arch: "X64"},
+		{ID: "5", DisplayName: "Tool", DisplayVersion: "1.0", Arch: "X64", UserSID: "S-1-5-21-1-2-3-1001"},
+		{ID: "6", DisplayName: "Other"},
+	}
+	ids := func(l []so.Software) []string {
+		retVal := make([]string, 0, len(l))
+		for _, sw := range l {
+			retVal = append(retVal, sw.ID)
+		}
+		return retVal
+	}
+	tests := []struct {
+		policy uint32
+		want   []string
+	}{
+		{SOFTWARE_DEDUP_NONE, []string{"1", "2", "3", "4", "5", "6"}},
+		{SOFTWARE_DEDUP_IDENTICAL, []string{"1", "2", "3", "5", "6"}},
+		{SOFTWARE_DEDUP_DISPLAY_NAME, []string{"1", "6"}},
+	}
+	for _, tt := range tests {
+		if got := ids(DedupSoftware(list, tt.policy)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DedupSoftware(%d) = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+const (
+	// DefaultUninstallTimeout is used by UninstallSoftware when no timeout
+	// is given.
+	DefaultUninstallTimeout = 30 * time.Minute
+
+	// How often UninstallSoftware checks whether the processes started by
+	// the uninstaller have finished.
+	uninstallPollInterval = 500 * time.Millisecond
+)
+
+// UninstallSoftware runs the uninstaller for sw without any UI: its
+// QuietUninstallString if it has one, otherwise its UninstallString with the
+// silent switches of the installer it was recognised as by
+// ParseUninstallString.
+//
+// The uninstaller runs in a job, and it and anything it starts must finish
+// within timeout, or DefaultUninstallTimeout if zero, before they're
+// terminated and UNINSTALL_RESULT_TIMED_OUT is returned. Waiting on the whole
+// job covers uninstallers that copy themselves elsewhere and exit, as Inno
+// Setup and NSIS do. Otherwise the exit code is mapped to a result. An error
+// is only returned if the uninstaller couldn't be run.
+func UninstallSoftware(sw so.Software, timeout time.Duration) (so.UninstallResult, error) {
+	cmdLine, err := uninstallCommandLine(sw)
+	if err != nil {
+		return so.UninstallResult{}, err
+	}
+	exe, _, _ := splitCommandExecutable(cmdLine)
+	if timeout <= 0 {
+		timeout = DefaultUninstallTimeout
+	}
+
+	job, err := CreateJob("", so.JobLimits{KillOnClose: true, DieOnUnhandledException: true})
+	if err != nil {
+		return so.UninstallResult{}, err
+	}
+	defer job.Close()
+
+	// The command line is passed as registered, rather than re-quoted from
+	// split arguments, as some uninstallers parse it themselves.
+	cmd := exec.Command(exe)
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: cmdLine}
+	start := time.Now()
+	if err := job.StartCommand(cmd); err != nil {
+		return so.UninstallResult{}, fmt.Errorf("Unable to run uninstaller %s: %s", cmdLine, err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	result := so.UninstallResult{CommandLine: cmdLine}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-exited:
+		result.ExitCode = uint32(cmd.ProcessState.ExitCode())
+	case <-deadline.C:
+		job.Terminate(1)
+		<-exited
+		result.Result = so.UNINSTALL_RESULT_TIMED_OUT
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+
+	ticker := time.NewTicker(uninstallPollInterval)
+	defer ticker.Stop()
+	for {
+		acct, err := job.Accounting()
+		if err != nil || acct.ActiveProcesses == 0 {
+			break
+		}
+		select {
+		case <-ticker.C:
+			continue
+		case <-deadline.C:
+			job.Terminate(1)
+			result.Result = so.UNINSTALL_RESULT_TIMED_OUT
+			result.Duration = time.Since(start)
+			return result, nil
+		}
+	}
+	result.Result = uninstallResult(result.ExitCode)
+	result.Duration = time.Since(start)
+	return result, nil
+}
@@ -0,0 +1,600 @@
+//go:build ignore
+// +build ignore
+
+// mkevtx writes Security.evtx, a small Security log laid out the way Windows
+// writes them, for the EVTX reader's tests. Regenerate it with:
+//
+//	go run testdata/mkevtx.go testdata/Security.evtx
+//
+// Every event shares a System template, with its EventData or UserData in a
+// nested template instance, and names and templates are stored once per
+// chunk. The events are made up, with example domains and addresses.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Binary XML value types.
+const (
+	tNull     = 0x00
+	tString   = 0x01
+	tUint8    = 0x04
+	tUint16   = 0x06
+	tUint32   = 0x08
+	tUint64   = 0x0a
+	tGUID     = 0x0f
+	tFileTime = 0x11
+	tSID      = 0x13
+	tHexInt32 = 0x14
+	tHexInt64 = 0x15
+	tBinXML   = 0x21
+)
+
+const chunkSize = 65536
+
+// Template nodes: elements, text, and substitutions of the instance's values.
+type node interface{}
+
+type elem struct {
+	name     string
+	attrs    []attr
+	children []node
+}
+
+type attr struct {
+	name  string
+	value []node
+}
+
+type text string
+
+type sub struct {
+	id       uint16
+	typ      byte
+	optional bool
+}
+
+func e(name string, attrs []attr, children ...node) elem {
+	return elem{name, attrs, children}
+}
+
+func a(name string, value ...node) attr {
+	return attr{name, value}
+}
+
+func s(id uint16, typ byte) sub {
+	return sub{id, typ, true}
+}
+
+type template struct {
+	id   uint32
+	guid string
+	root elem
+}
+
+// value is a template instance's value, either raw data or, for tBinXML,
+// written in place by fragment.
+type value struct {
+	typ      byte
+	data     []byte
+	fragment func(c *chunk)
+}
+
+func le16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return b
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func le64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func utf16le(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		b = append(b, le16(u)...)
+	}
+	return b
+}
+
+func utf16Len(s string) uint16 {
+	return uint16(len(utf16.Encode([]rune(s))))
+}
+
+func fileTime(t time.Time) uint64 {
+	return uint64(t.Unix())*10000000 + 116444736000000000 + uint64(t.Nanosecond()/100)
+}
+
+// guidBytes encodes a GUID as Windows stores it, with its first three fields
+// little endian.
+func guidBytes(s string) []byte {
+	raw, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(raw) != 16 {
+		panic("bad GUID " + s)
+	}
+	return []byte{
+		raw[3], raw[2], raw[1], raw[0],
+		raw[5], raw[4],
+		raw[7], raw[6],
+		raw[8], raw[9], raw[10], raw[11], raw[12], raw[13], raw[14], raw[15],
+	}
+}
+
+func sidBytes(s string) []byte {
+	parts := strings.Split(s, "-")
+	rev, _ := strconv.Atoi(parts[1])
+	auth, _ := strconv.ParseUint(parts[2], 10, 48)
+	b := []byte{byte(rev), byte(len(parts) - 3)}
+	b = append(b, le64(auth)[:6]...)
+	// The authority is big endian.
+	for i, j := 2, 7; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	for _, p := range parts[3:] {
+		n, _ := strconv.ParseUint(p, 10, 32)
+		b = append(b, le32(uint32(n))...)
+	}
+	return b
+}
+
+func nameHash(s string) uint16 {
+	var h uint32
+	for _, r := range s {
+		h = h*65599 + uint32(r)
+	}
+	return uint16(h)
+}
+
+type record struct {
+	id  uint64
+	off uint32
+}
+
+type chunk struct {
+	b         []byte
+	names     map[string]uint32
+	templates map[string]uint32
+	records   []record
+}
+
+func newChunk() *chunk {
+	return &chunk{
+		b:         make([]byte, 512),
+		names:     make(map[string]uint32),
+		templates: make(map[string]uint32),
+	}
+}
+
+func (c *chunk) w(data ...[]byte) {
+	for _, d := range data {
+		c.b = append(c.b, d...)
+	}
+}
+
+func (c *chunk) u8(v byte) {
+	c.b = append(c.b, v)
+}
+
+// putSize writes the size of what follows a placeholder written at at.
+func (c *chunk) putSize(at int) {
+	binary.LittleEndian.PutUint32(c.b[at:], uint32(len(c.b)-at-4))
+}
+
+// name writes a name the first time it's used, and a reference to it after.
+func (c *chunk) name(s string) {
+	if off, ok := c.names[s]; ok {
+		c.w(le32(off))
+		return
+	}
+	off := uint32(len(c.b) + 4)
+	c.names[s] = off
+	c.w(le32(off), le32(0), le16(nameHash(s)), le16(utf16Len(s)), utf16le(s), le16(0))
+}
+
+func (c *chunk) node(n node) {
+	switch n := n.(type) {
+	case text:
+		c.u8(0x05)
+		c.u8(tString)
+		c.w(le16(utf16Len(string(n))), utf16le(string(n)))
+	case sub:
+		if n.optional {
+			c.u8(0x0e)
+		} else {
+			c.u8(0x0d)
+		}
+		c.w(le16(n.id))
+		c.u8(n.typ)
+	case elem:
+		c.element(n)
+	default:
+		panic(fmt.Sprintf("unexpected node %T", n))
+	}
+}
+
+func (c *chunk) element(n elem) {
+	if len(n.attrs) > 0 {
+		c.u8(0x41)
+	} else {
+		c.u8(0x01)
+	}
+	c.w(le16(0xffff))
+	sizeAt := len(c.b)
+	c.w(le32(0))
+	c.name(n.name)
+	if len(n.attrs) > 0 {
+		listAt := len(c.b)
+		c.w(le32(0))
+		for i, at := range n.attrs {
+			if i < len(n.attrs)-1 {
+				c.u8(0x46)
+			} else {
+				c.u8(0x06)
+			}
+			c.name(at.name)
+			for _, v := range at.value {
+				c.node(v)
+			}
+		}
+		c.putSize(listAt)
+	}
+	if len(n.children) > 0 {
+		c.u8(0x02)
+		for _, child := range n.children {
+			c.node(child)
+		}
+		c.u8(0x04)
+	} else {
+		c.u8(0x03)
+	}
+	c.putSize(sizeAt)
+}
+
+// instance writes a template instance, with the template definition the first
+// time key is used in the chunk.
+func (c *chunk) instance(key string, t template, values []value) {
+	c.u8(0x0c)
+	c.u8(0x01)
+	c.w(le32(t.id))
+	if off, ok := c.templates[key]; ok {
+		c.w(le32(off))
+	} else {
+		off := uint32(len(c.b) + 4)
+		c.templates[key] = off
+		c.w(le32(off), le32(0), guidBytes(t.guid))
+		sizeAt := len(c.b)
+		c.w(le32(0))
+		c.w([]byte{0x0f, 0x01, 0x01, 0x00})
+		c.node(t.root)
+		c.u8(0x00)
+		c.putSize(sizeAt)
+	}
+	c.w(le32(uint32(len(values))))
+	descAt := len(c.b)
+	for _, v := range values {
+		c.w(le16(0), []byte{v.typ, 0})
+	}
+	for i, v := range values {
+		start := len(c.b)
+		if v.fragment != nil {
+			v.fragment(c)
+		} else {
+			c.w(v.data)
+		}
+		binary.LittleEndian.PutUint16(c.b[descAt+4*i:], uint16(len(c.b)-start))
+	}
+}
+
+func (c *chunk) record(id uint64, written time.Time, body func(c *chunk)) {
+	off := len(c.b)
+	c.w(le32(0x00002a2a), le32(0), le64(id), le64(fileTime(written)))
+	c.w([]byte{0x0f, 0x01, 0x01, 0x00})
+	body(c)
+	c.u8(0x00)
+	size := uint32(len(c.b) - off + 4)
+	c.w(le32(size))
+	binary.LittleEndian.PutUint32(c.b[off+4:], size)
+	c.records = append(c.records, record{id, uint32(off)})
+	if len(c.b) > chunkSize {
+		panic("chunk overflow")
+	}
+}
+
+func (c *chunk) finish() []byte {
+	free := uint32(len(c.b))
+	b := make([]byte, chunkSize)
+	copy(b, c.b)
+	first, last := c.records[0].id, c.records[len(c.records)-1].id
+	copy(b, "ElfChnk\x00")
+	for i, v := range []uint64{first, last, first, last} {
+		binary.LittleEndian.PutUint64(b[8+8*i:], v)
+	}
+	binary.LittleEndian.PutUint32(b[40:], 128)
+	binary.LittleEndian.PutUint32(b[44:], c.records[len(c.records)-1].off)
+	binary.LittleEndian.PutUint32(b[48:], free)
+	binary.LittleEndian.PutUint32(b[52:], crc32.ChecksumIEEE(b[512:free]))
+	binary.LittleEndian.PutUint32(b[120:], 0)
+	header := append(append([]byte{}, b[0:120]...), b[128:512]...)
+	binary.LittleEndian.PutUint32(b[124:], crc32.ChecksumIEEE(header))
+	return b
+}
+
+const eventNS = "http://schemas.microsoft.com/win/2004/08/events/event"
+
+// systemTemplate is shared by every event, with EventData (or UserData) as a
+// nested binary XML value, as Windows writes it.
+var systemTemplate = template{0x5a2a5ff0, "5a2a5ff0-6c4d-4d6e-8a0e-6b8e1d8f0a11", e("Event", []attr{a("xmlns", text(eventNS))},
+	e("System", nil,
+		e("Provider", []attr{a("Name", s(14, tString)), a("Guid", s(15, tGUID)), a("EventSourceName", s(16, tString))}),
+		e("EventID", []attr{a("Qualifiers", s(4, tUint16))}, s(3, tUint16)),
+		e("Version", nil, s(11, tUint8)),
+		e("Level", nil, s(0, tUint8)),
+		e("Task", nil, s(2, tUint16)),
+		e("Opcode", nil, s(1, tUint8)),
+		e("Keywords", nil, s(5, tHexInt64)),
+		e("TimeCreated", []attr{a("SystemTime", s(6, tFileTime))}),
+		e("EventRecordID", nil, s(10, tUint64)),
+		e("Correlation", []attr{a("ActivityID", s(7, tGUID)), a("RelatedActivityID", s(13, tGUID))}),
+		e("Execution", []attr{a("ProcessID", s(8, tUint32)), a("ThreadID", s(9, tUint32))}),
+		e("Channel", nil, text("Security")),
+		e("Computer", nil, text("PC01.corp.example.com")),
+		e("Security", []attr{a("UserID", s(12, tSID))}),
+	),
+	s(17, tBinXML),
+)}
+
+type field struct {
+	name string
+	typ  byte
+}
+
+func dataTemplate(id uint32, fields []field) template {
+	data := make([]node, 0, len(fields))
+	for i, f := range fields {
+		data = append(data, e("Data", []attr{a("Name", text(f.name))}, sub{uint16(i), f.typ, false}))
+	}
+	return template{id, fmt.Sprintf("%08x-0000-4000-8000-000000000000", id), e("EventData", nil, data...)}
+}
+
+var (
+	fields4624 = []field{{"SubjectUserSid", tSID}, {"SubjectUserName", tString}, {"SubjectDomainName", tString}, {"SubjectLogonId", tHexInt64},
+		{"TargetUserSid", tSID}, {"TargetUserName", tString}, {"TargetDomainName", tString}, {"TargetLogonId", tHexInt64},
+		{"LogonType", tUint32}, {"LogonProcessName", tString}, {"AuthenticationPackageName", tString}, {"WorkstationName", tString},
+		{"LogonGuid", tGUID}, {"TransmittedServices", tString}, {"LmPackageName", tString}, {"KeyLength", tUint32},
+		{"ProcessId", tHexInt64}, {"ProcessName", tString}, {"IpAddress", tString}, {"IpPort", tString},
+		{"ImpersonationLevel", tString}, {"RestrictedAdminMode", tString}, {"TargetOutboundUserName", tString},
+		{"TargetOutboundDomainName", tString}, {"VirtualAccount", tString}, {"TargetLinkedLogonId", tHexInt64},
+		{"ElevatedToken", tString}}
+	fields4625 = []field{{"SubjectUserSid", tSID}, {"SubjectUserName", tString}, {"SubjectDomainName", tString}, {"SubjectLogonId", tHexInt64},
+		{"TargetUserSid", tSID}, {"TargetUserName", tString}, {"TargetDomainName", tString}, {"Status", tHexInt32},
+		{"FailureReason", tString}, {"SubStatus", tHexInt32}, {"LogonType", tUint32}, {"LogonProcessName", tString},
+		{"AuthenticationPackageName", tString}, {"WorkstationName", tString}, {"TransmittedServices", tString},
+		{"LmPackageName", tString}, {"KeyLength", tUint32}, {"ProcessId", tHexInt64}, {"ProcessName", tString},
+		{"IpAddress", tString}, {"IpPort", tString}}
+	fields4634 = []field{{"TargetUserSid", tSID}, {"TargetUserName", tString}, {"TargetDomainName", tString}, {"TargetLogonId", tHexInt64},
+		{"LogonType", tUint32}}
+	fields4647 = []field{{"TargetUserSid", tSID}, {"TargetUserName", tString}, {"TargetDomainName", tString}, {"TargetLogonId", tHexInt64}}
+	fields4800 = []field{{"TargetUserSid", tSID}, {"TargetUserName", tString}, {"TargetDomainName", tString}, {"TargetLogonId", tHexInt64},
+		{"SessionId", tUint32}}
+	fields1102 = []field{{"SubjectUserSid", tSID}, {"SubjectUserName", tString}, {"SubjectDomainName", tString}, {"SubjectLogonId", tHexInt64}}
+
+	eventFields = map[uint16][]field{
+		1102: fields1102,
+		4624: fields4624,
+		4625: fields4625,
+		4634: fields4634,
+		4647: fields4647,
+		4800: fields4800,
+		4801: fields4800,
+	}
+	dataTemplates = map[uint16]template{
+		4624: dataTemplate(0x4624, fields4624),
+		4625: dataTemplate(0x4625, fields4625),
+		4634: dataTemplate(0x4634, fields4634),
+		4647: dataTemplate(0x4647, fields4647),
+		4800: dataTemplate(0x4800, fields4800),
+		4801: dataTemplate(0x4801, fields4800),
+		1102: {0x1102, "00001102-0000-4000-8000-000000000000", e("UserData", nil,
+			e("LogFileCleared", []attr{a("xmlns", text("http://manifests.microsoft.com/win/2004/08/windows/eventlog"))},
+				e("SubjectUserSid", nil, sub{0, tSID, false}),
+				e("SubjectUserName", nil, sub{1, tString, false}),
+				e("SubjectDomainName", nil, sub{2, tString, false}),
+				e("SubjectLogonId", nil, sub{3, tHexInt64, false}),
+			),
+		)},
+	}
+)
+
+// encode returns a value of type typ, or a null value if v is nil.
+func encode(typ byte, v interface{}) value {
+	if v == nil {
+		return value{typ: tNull}
+	}
+	switch typ {
+	case tString:
+		return value{typ: typ, data: utf16le(v.(string))}
+	case tSID:
+		return value{typ: typ, data: sidBytes(v.(string))}
+	case tGUID:
+		return value{typ: typ, data: guidBytes(v.(string))}
+	case tHexInt64, tUint64:
+		return value{typ: typ, data: le64(uint64(v.(int)))}
+	case tUint32, tHexInt32:
+		return value{typ: typ, data: le32(uint32(v.(int)))}
+	case tUint16:
+		return value{typ: typ, data: le16(uint16(v.(int)))}
+	case tUint8:
+		return value{typ: typ, data: []byte{byte(v.(int))}}
+	case tFileTime:
+		return value{typ: typ, data: le64(fileTime(v.(time.Time)))}
+	}
+	panic(fmt.Sprintf("unexpected type %#x", typ))
+}
+
+type provider struct {
+	name string
+	guid string
+}
+
+var (
+	securityAuditing = provider{"Microsoft-Windows-Security-Auditing", "54849625-5478-4994-a5ba-3e3b0328c30d"}
+	eventLog         = provider{"Microsoft-Windows-Eventlog", "fc65ddd8-d6ef-4962-83d5-6e5cfe9ce148"}
+)
+
+const (
+	activity = "c9a2d5f4-1e1f-0003-a1d6-a2c91f1ed601"
+	noGUID   = "00000000-0000-0000-0000-000000000000"
+
+	systemSID = "S-1-5-18"
+	nullSID   = "S-1-0-0"
+	alice     = "S-1-5-21-1004336348-1177238915-682003330-1105"
+	bob       = "S-1-5-21-3623811015-3361044348-30300820-1001"
+	carol     = "S-1-5-21-1004336348-1177238915-682003330-1107"
+)
+
+// eventOptions are the System values that vary between events.
+type eventOptions struct {
+	provider provider
+	keywords uint64
+	pid      int
+	tid      int
+	activity string
+	level    int
+}
+
+func defaults() eventOptions {
+	return eventOptions{securityAuditing, 0x8020000000000000, 708, 3460, activity, 0}
+}
+
+func event(c *chunk, id uint64, when time.Time, eventID uint16, version int, task int, data []interface{}, opts eventOptions) {
+	fields := eventFields[eventID]
+	if len(fields) != len(data) {
+		panic(fmt.Sprintf("event %d has %d values for %d fields", eventID, len(data), len(fields)))
+	}
+	eventData := func(c *chunk) {
+		c.w([]byte{0x0f, 0x01, 0x01, 0x00})
+		values := make([]value, 0, len(data))
+		for i, f := range fields {
+			values = append(values, encode(f.typ, data[i]))
+		}
+		c.instance(fmt.Sprintf("data-%d", eventID), dataTemplates[eventID], values)
+		c.u8(0x00)
+	}
+	keywords := value{typ: tHexInt64, data: le64(opts.keywords)}
+	values := []value{
+		encode(tUint8, opts.level),          // 0 Level
+		encode(tUint8, 0),                   // 1 Opcode
+		encode(tUint16, task),               // 2 Task
+		encode(tUint16, int(eventID)),       // 3 EventID
+		{typ: tNull},                        // 4 Qualifiers
+		keywords,                            // 5 Keywords
+		encode(tFileTime, when),             // 6 TimeCreated
+		encode(tGUID, opts.activity),        // 7 ActivityID
+		encode(tUint32, opts.pid),           // 8 ProcessID
+		encode(tUint32, opts.tid),           // 9 ThreadID
+		{typ: tUint64, data: le64(id)},      // 10 EventRecordID
+		encode(tUint8, version),             // 11 Version
+		{typ: tNull},                        // 12 UserID
+		{typ: tNull},                        // 13 RelatedActivityID
+		encode(tString, opts.provider.name), // 14 Provider Name
+		encode(tGUID, opts.provider.guid),   // 15 Provider Guid
+		{typ: tNull},                        // 16 EventSourceName
+		{typ: tBinXML, fragment: eventData}, // 17 EventData
+	}
+	c.record(id, when, func(c *chunk) {
+		c.instance("system", systemTemplate, values)
+	})
+}
+
+func at(h, m, s, us int) time.Time {
+	return time.Date(2020, 3, 2, h, m, s, us*1000, time.UTC)
+}
+
+func logon(c *chunk, id uint64, when time.Time, sid, user, domain string, logonID, logonType int, proc, pkg, workstation, ip, port string, linked int, elevated bool, logonGUID string) {
+	elevatedToken := "%%1843"
+	if elevated {
+		elevatedToken = "%%1842"
+	}
+	event(c, id, when, 4624, 2, 12544, []interface{}{
+		systemSID, "PC01$", "CORP", 0x3e7, sid, user, domain, logonID, logonType, proc, pkg, workstation, logonGUID,
+		"-", "-", 0, 0x2f4, `C:\Windows\System32\svchost.exe`, ip, port, "%%1833", "-", "-", "-", "%%1843",
+		linked, elevatedToken}, defaults())
+}
+
+func logoff(c *chunk, id uint64, when time.Time, sid, user, domain string, logonID, logonType int) {
+	opts := defaults()
+	opts.tid = 5120
+	event(c, id, when, 4634, 0, 12545, []interface{}{sid, user, domain, logonID, logonType}, opts)
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: go run mkevtx.go Security.evtx")
+		os.Exit(2)
+	}
+
+	c0 := newChunk()
+	logon(c0, 1, at(8, 0, 0, 123456), alice, "alice", "CORP", 0x1a2b3d, 2, "User32 ", "Negotiate", "PC01", "127.0.0.1", "0", 0x1a2b3c, true,
+		"7d3f4a6e-8b2c-4f11-9e0a-5c6d7e8f9a0b")
+	logon(c0, 2, at(8, 0, 0, 123900), alice, "alice", "CORP", 0x1a2b3c, 2, "User32 ", "Negotiate", "PC01", "127.0.0.1", "0", 0x1a2b3d, false,
+		"7d3f4a6e-8b2c-4f11-9e0a-5c6d7e8f9a0b")
+	logon(c0, 3, at(9, 15, 30, 0), bob, "bob", "PC01", 0x2000a1, 10, "User32 ", "Negotiate", "LAPTOP7", "192.0.2.10", "51234", 0, false, noGUID)
+	failed := defaults()
+	failed.keywords = 0x8010000000000000
+	event(c0, 4, at(9, 20, 5, 0), 4625, 0, 12544, []interface{}{
+		nullSID, "-", "-", 0, nullSID, "mallory", "CORP", 0xc000006d, "%%2313", 0xc000006a, 3, "NtLmSsp ", "NTLM",
+		"KALI", "-", "-", 0, 0, "-", "198.51.100.7", "40122"}, failed)
+	event(c0, 5, at(10, 0, 0, 0), 4800, 0, 12551, []interface{}{alice, "alice", "CORP", 0x1a2b3c, 1}, defaults())
+	event(c0, 6, at(10, 30, 0, 0), 4801, 0, 12551, []interface{}{alice, "alice", "CORP", 0x1a2b3c, 1}, defaults())
+	logoff(c0, 7, at(11, 45, 10, 0), bob, "bob", "PC01", 0x2000a1, 10)
+
+	c1 := newChunk()
+	event(c1, 8, at(12, 0, 0, 0), 1102, 0, 104, []interface{}{alice, "alice", "CORP", 0x1a2b3d},
+		eventOptions{eventLog, 0x4020000000000000, 1096, 1400, noGUID, 4})
+	event(c1, 9, at(17, 30, 0, 0), 4647, 0, 12545, []interface{}{alice, "alice", "CORP", 0x1a2b3c}, defaults())
+	logoff(c1, 10, at(17, 30, 2, 0), alice, "alice", "CORP", 0x1a2b3c, 2)
+	logoff(c1, 11, at(17, 30, 2, 0), alice, "alice", "CORP", 0x1a2b3d, 2)
+	logon(c1, 12, at(18, 0, 0, 0), carol, "carol", "CORP", 0x3000f0, 11, "User32 ", "Negotiate", "PC01", "127.0.0.1", "0", 0, false, noGUID)
+
+	chunks := [][]byte{c0.finish(), c1.finish()}
+	header := make([]byte, 4096)
+	copy(header, "ElfFile\x00")
+	binary.LittleEndian.PutUint64(header[8:], 0)                      // first chunk
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(chunks)-1)) // last chunk
+	binary.LittleEndian.PutUint64(header[24:], 13)                    // next record ID
+	binary.LittleEndian.PutUint32(header[32:], 128)                   // header size
+	binary.LittleEndian.PutUint16(header[36:], 1)                     // minor version
+	binary.LittleEndian.PutUint16(header[38:], 3)                     // major version
+	binary.LittleEndian.PutUint16(header[40:], 4096)                  // header block size
+	binary.LittleEndian.PutUint16(header[42:], uint16(len(chunks)))
+	binary.LittleEndian.PutUint32(header[124:], crc32.ChecksumIEEE(header[:120]))
+
+	out := header
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	if err := ioutil.WriteFile(os.Args[1], out, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
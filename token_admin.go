@@ -0,0 +1,86 @@
+package winapi
+
+import (
+	"sort"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// builtinAdministratorsSID is BUILTIN\Administrators.
+const builtinAdministratorsSID = "S-1-5-32-544"
+
+// privilegedBuiltinGroups are the BUILTIN groups (S-1-5-32-*) whose members
+// can administer the machine, by RID.
+var privilegedBuiltinGroups = map[uint32]bool{
+	544: true, // Administrators
+	548: true, // Account Operators
+	549: true, // Server Operators
+	550: true, // Print Operators
+	551: true, // Backup Operators
+	578: true, // Hyper-V Administrators
+}
+
+// privilegedDomainGroups are the domain groups (S-1-5-21-x-y-z-*) whose
+// members administer the domain, by RID.
+var privilegedDomainGroups = map[uint32]bool{
+	512: true, // Domain Admins
+	518: true, // Schema Admins
+	519: true, // Enterprise Admins
+	526: true, // Key Admins
+	527: true, // Enterprise Key Admins
+}
+
+// isPrivilegedGroup reports whether sid is one of the administrative groups
+// reported in SessionDetails.PrivilegedGroups.
+func isPrivilegedGroup(sid string) bool {
+	s, err := ParseSID(sid)
+	if err != nil || s.IdentifierAuthority != 5 || len(s.SubAuthority) == 0 {
+		return false
+	}
+	rid := s.SubAuthority[len(s.SubAuthority)-1]
+	switch {
+	case s.SubAuthority[0] == 32 && len(s.SubAuthority) == 2:
+		return privilegedBuiltinGroups[rid]
+	case s.SubAuthority[0] == 21 && len(s.SubAuthority) == 5:
+		return privilegedDomainGroups[rid]
+	}
+	return false
+}
+
+// tokenAdminGroups returns whether a token's groups make its user a member of
+// BUILTIN\Administrators, and the privileged groups among them, sorted.
+//
+// Windows expands nested membership when it builds a token, so a user who is
+// only an administrator through a domain group holds S-1-5-32-544 directly.
+// In the limited half of a UAC split token the group is still present but
+// deny-only, which counts: the user is a member, just not elevated.
+func tokenAdminGroups(groups []so.TokenGroup) (bool, []string) {
+	admin := false
+	privileged := make([]string, 0)
+	for _, g := range groups {
+		if g.SID == builtinAdministratorsSID {
+			admin = true
+		}
+		if isPrivilegedGroup(g.SID) {
+			privileged = append(privileged, g.SID)
+		}
+	}
+	sort.Strings(privileged)
+	return admin, privileged
+}
+
+// elevationRank orders TOKEN_ELEVATION_TYPE_* values so the most telling one
+// wins when a logon session's processes disagree: an elevated process shows
+// the user has elevated, a limited one that they could.
+func elevationRank(t uint32) int {
+	switch t {
+	case so.TOKEN_ELEVATION_TYPE_FULL:
+		return 3
+	case so.TOKEN_ELEVATION_TYPE_LIMITED:
+		return 2
+	case so.TOKEN_ELEVATION_TYPE_DEFAULT:
+		return 1
+	default:
+		return 0
+	}
+}
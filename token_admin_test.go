@@ -0,0 +1,112 @@
+package winapi
+
+import (
+	"reflect"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+const testDomainSID = "S-1-5-21-1004336348-1177238915-682003330"
+
+func TestIsPrivilegedGroup(t *testing.T) {
+	for sid, want := range map[string]bool{
+		"S-1-5-32-544":               true,
+		"S-1-5-32-551":               true,
+		"S-1-5-32-545":               false, // Users
+		testDomainSID + "-512":       true,
+		testDomainSID + "-519":       true,
+		testDomainSID + "-513":       false, // Domain Users
+		"S-1-5-21-1-2-512":           false, // too few sub authorities for a domain
+		"S-1-5-32-544-1":             false,
+		"S-1-16-12288":               false,
+		"not a SID":                  false,
+		"S-1-5-80-956008885-3418522": false,
+	} {
+		if got := isPrivilegedGroup(sid); got != want {
+			t.Errorf("isPrivilegedGroup(%q) = %v, want %v", sid, got, want)
+		}
+	}
+}
+
+func TestTokenAdminGroups(t *testing.T) {
+	tests := []struct {
+		name       string
+		groups     []so.TokenGroup
+		admin      bool
+		privileged []string
+	}{
+		{
+			name: "standard user",
+			groups: []so.TokenGroup{
+				{SID: testDomainSID + "-513", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED},
+				{SID: "S-1-5-32-545", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED},
+			},
+			privileged: []string{},
+		},
+		{
+			name: "UAC limited token",
+			groups: []so.TokenGroup{
+				{SID: "S-1-5-32-545", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED},
+				{SID: "S-1-5-32-544", Attributes: so.SE_GROUP_USE_FOR_DENY_ONLY},
+			},
+			admin:      true,
+			privileged: []string{"S-1-5-32-544"},
+		},
+		{
+			// Domain Admins is nested in Administrators, which Windows
+			// expands into the token.
+			name: "domain admin",
+			groups: []so.TokenGroup{
+				{SID: testDomainSID + "-512", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED},
+				{SID: "S-1-5-32-551", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED},
+				{SID: "S-1-5-32-544", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED | so.SE_GROUP_OWNER},
+			},
+			admin:      true,
+			privileged: []string{"S-1-5-21-1004336348-1177238915-682003330-512", "S-1-5-32-544", "S-1-5-32-551"},
+		},
+	}
+	for _, test := range tests {
+		admin, privileged := tokenAdminGroups(test.groups)
+		if admin != test.admin || !reflect.DeepEqual(privileged, test.privileged) {
+			t.Errorf("%s: tokenAdminGroups = %v, %q, want %v, %q", test.name, admin, privileged, test.admin, test.privileged)
+		}
+	}
+}
+
+func TestLogonSnapshotTokenGroups(t *testing.T) {
+	limited := LUID{LowPart: 0x200}
+	elevated := LUID{LowPart: 0x201}
+	sessions := []logonSession{
+		{LogonID: limited, UserName: "alice", Domain: "CORP", LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 1, HasSid: true},
+		{LogonID: elevated, UserName: "alice", Domain: "CORP", LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 1, HasSid: true},
+		{LogonID: LUID{LowPart: 0x300}, UserName: "bob", Domain: "CORP", LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 2, HasSid: true},
+	}
+	procs := []processLogon{
+		{Pid: 10, LogonID: limited, IsAdmin: true, GroupsKnown: true, ElevationType: so.TOKEN_ELEVATION_TYPE_LIMITED, PrivilegedGroups: []string{"S-1-5-32-544"}},
+		{Pid: 11, LogonID: limited}, // token couldn't be read
+		{Pid: 12, LogonID: elevated, IsAdmin: true, GroupsKnown: true, IsElevated: true, ElevationType: so.TOKEN_ELEVATION_TYPE_FULL, PrivilegedGroups: []string{"S-1-5-32-544", "S-1-5-32-551"}},
+		{Pid: 20, LogonID: LUID{LowPart: 0x300}, GroupsKnown: true, ElevationType: so.TOKEN_ELEVATION_TYPE_DEFAULT},
+	}
+
+	got := newLogonSnapshot(sessions, procs).loggedInUsers("PC01", func(ud so.SessionDetails) bool {
+		t.Errorf("%s has readable groups, so shouldn't be checked", ud.FullUser())
+		return true
+	})
+	want := []so.SessionDetails{
+		{
+			Username: "alice", Domain: "CORP", LocalAdmin: true, LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 1,
+			Elevated: true, ElevationType: so.TOKEN_ELEVATION_TYPE_FULL, PrivilegedGroups: []string{"S-1-5-32-544", "S-1-5-32-551"},
+		},
+		{
+			Username: "bob", Domain: "CORP", LogonType: so.SESS_INTERACTIVE_LOGON, SessionID: 2,
+			ElevationType: so.TOKEN_ELEVATION_TYPE_DEFAULT,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loggedInUsers = %+v, want %+v", got, want)
+	}
+	if got[0].GetElevationType() != "FULL" || got[1].GetElevationType() != "DEFAULT" {
+		t.Errorf("elevation types = %s, %s", got[0].GetElevationType(), got[1].GetElevationType())
+	}
+}
@@ -0,0 +1,158 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// The decode functions in this file take the raw buffers filled in by
+// GetTokenInformation on 64-bit Windows. SIDs in those buffers are referenced
+// by pointers into the buffer itself, so the address the buffer was at when
+// it was filled in (base) is needed to turn them back into offsets.
+
+// tokenPrivilegeNames maps the fixed LUIDs Windows assigns to privileges to
+// their names, avoiding a LookupPrivilegeName call per privilege.
+var tokenPrivilegeNames = map[uint64]string{
+	2:  "SeCreateTokenPrivilege",
+	3:  "SeAssignPrimaryTokenPrivilege",
+	4:  "SeLockMemoryPrivilege",
+	5:  "SeIncreaseQuotaPrivilege",
+	6:  "SeMachineAccountPrivilege",
+	7:  "SeTcbPrivilege",
+	8:  "SeSecurityPrivilege",
+	9:  "SeTakeOwnershipPrivilege",
+	10: "SeLoadDriverPrivilege",
+	11: "SeSystemProfilePrivilege",
+	12: "SeSystemtimePrivilege",
+	13: "SeProfileSingleProcessPrivilege",
+	14: "SeIncreaseBasePriorityPrivilege",
+	15: "SeCreatePagefilePrivilege",
+	16: "SeCreatePermanentPrivilege",
+	17: "SeBackupPrivilege",
+	18: "SeRestorePrivilege",
+	19: "SeShutdownPrivilege",
+	20: "SeDebugPrivilege",
+	21: "SeAuditPrivilege",
+	22: "SeSystemEnvironmentPrivilege",
+	23: "SeChangeNotifyPrivilege",
+	24: "SeRemoteShutdownPrivilege",
+	25: "SeUndockPrivilege",
+	26: "SeSyncAgentPrivilege",
+	27: "SeEnableDelegationPrivilege",
+	28: "SeManageVolumePrivilege",
+	29: "SeImpersonatePrivilege",
+	30: "SeCreateGlobalPrivilege",
+	31: "SeTrustedCredManAccessPrivilege",
+	32: "SeRelabelPrivilege",
+	33: "SeIncreaseWorkingSetPrivilege",
+	34: "SeTimeZonePrivilege",
+	35: "SeCreateSymbolicLinkPrivilege",
+	36: "SeDelegateSessionUserImpersonatePrivilege",
+}
+
+// decodeSidAndAttributes decodes the SID_AND_ATTRIBUTES struct at off.
+func decodeSidAndAttributes(buf []byte, base uintptr, off int) (so.TokenGroup, error) {
+	if off < 0 || off+16 > len(buf) {
+		return so.TokenGroup{}, fmt.Errorf("SID_AND_ATTRIBUTES at offset %d out of range", off)
+	}
+	ptr := binary.LittleEndian.Uint64(buf[off:])
+	attrs := binary.LittleEndian.Uint32(buf[off+8:])
+	if ptr < uint64(base) || ptr-uint64(base) >= uint64(len(buf)) {
+		return so.TokenGroup{}, fmt.Errorf("SID pointer 0x%x outside of buffer", ptr)
+	}
+	sid, _, err := ReadSID(buf[ptr-uint64(base):])
+	if err != nil {
+		return so.TokenGroup{}, err
+	}
+	return so.TokenGroup{SID: sid.String(), Attributes: attrs}, nil
+}
+
+// decodeTokenUser decodes a TOKEN_USER buffer.
+func decodeTokenUser(buf []byte, base uintptr) (so.TokenGroup, error) {
+	return decodeSidAndAttributes(buf, base, 0)
+}
+
+// decodeTokenGroups decodes a TOKEN_GROUPS buffer.
+func decodeTokenGroups(buf []byte, base uintptr) ([]so.TokenGroup, error) {
+	if len(buf) < 8 {
+		return nil, fmt.Errorf("TOKEN_GROUPS buffer too short")
+	}
+	count := int(binary.LittleEndian.Uint32(buf))
+	// The array of SID_AND_ATTRIBUTES is pointer aligned, after the count.
+	if 8+count*16 > len(buf) {
+		return nil, fmt.Errorf("TOKEN_GROUPS count %d exceeds buffer", count)
+	}
+	retVal := make([]so.TokenGroup, 0, count)
+	for i := 0; i < count; i++ {
+		g, err := decodeSidAndAttributes(buf, base, 8+i*16)
+		if err != nil {
+			return nil, fmt.Errorf("group %d: %s", i, err)
+		}
+		retVal = append(retVal, g)
+	}
+	return retVal, nil
+}
+
+// decodeTokenPrivileges decodes a TOKEN_PRIVILEGES buffer.
+func decodeTokenPrivileges(buf []byte) ([]so.TokenPrivilege, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("TOKEN_PRIVILEGES buffer too short")
+	}
+	count := int(binary.LittleEndian.Uint32(buf))
+	// LUID_AND_ATTRIBUTES is 12 bytes and only 4 byte aligned.
+	if 4+count*12 > len(buf) {
+		return nil, fmt.Errorf("TOKEN_PRIVILEGES count %d exceeds buffer", count)
+	}
+	retVal := make([]so.TokenPrivilege, 0, count)
+	for i := 0; i < count; i++ {
+		off := 4 + i*12
+		luid := uint64(binary.LittleEndian.Uint32(buf[off:])) | uint64(binary.LittleEndian.Uint32(buf[off+4:]))<<32
+		p := so.TokenPrivilege{
+			Name:       tokenPrivilegeNames[luid],
+			LUID:       luid,
+			Attributes: binary.LittleEndian.Uint32(buf[off+8:]),
+		}
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("LUID 0x%x", luid)
+		}
+		retVal = append(retVal, p)
+	}
+	return retVal, nil
+}
+
+// decodeTokenIntegrityLevel decodes a TOKEN_MANDATORY_LABEL buffer into the
+// integrity level, the last sub authority of the label SID.
+func decodeTokenIntegrityLevel(buf []byte, base uintptr) (uint32, error) {
+	label, err := decodeSidAndAttributes(buf, base, 0)
+	if err != nil {
+		return 0, err
+	}
+	sid, err := ParseSID(label.SID)
+	if err != nil {
+		return 0, err
+	}
+	if len(sid.SubAuthority) == 0 {
+		return 0, fmt.Errorf("Invalid integrity label %s", label.SID)
+	}
+	return sid.SubAuthority[len(sid.SubAuthority)-1], nil
+}
+
+// decodeTokenUint32 decodes the single DWORD returned for TokenSessionId,
+// TokenElevationType and TokenElevation.
+func decodeTokenUint32(buf []byte) (uint32, error) {
+	if len(buf) < 4 {
+		return 0, fmt.Errorf("token information buffer too short")
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+// decodeTokenLogonID extracts the AuthenticationId (logon session LUID) from a
+// TOKEN_STATISTICS buffer.
+func decodeTokenLogonID(buf []byte) (uint64, error) {
+	if len(buf) < 16 {
+		return 0, fmt.Errorf("TOKEN_STATISTICS buffer too short")
+	}
+	return uint64(binary.LittleEndian.Uint32(buf[8:])) | uint64(binary.LittleEndian.Uint32(buf[12:]))<<32, nil
+}
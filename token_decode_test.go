@@ -0,0 +1,135 @@
+package winapi
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// All fixtures were laid out as if GetTokenInformation had filled them in at
+// address testTokenBase.
+const testTokenBase = 0x10000
+
+func fixture(t *testing.T, parts ...string) []byte {
+	b, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		t.Fatalf("bad fixture: %v", err)
+	}
+	return b
+}
+
+func TestDecodeTokenUser(t *testing.T) {
+	buf := fixture(t,
+		"1000010000000000",         // Sid -> base+16
+		"00000000",                 // Attributes
+		"00000000",                 // padding
+		"010100000000000512000000", // S-1-5-18
+	)
+	u, err := decodeTokenUser(buf, testTokenBase)
+	if err != nil {
+		t.Fatalf("decodeTokenUser: %v", err)
+	}
+	if u.SID != "S-1-5-18" || u.Attributes != 0 {
+		t.Errorf("decodeTokenUser = %+v", u)
+	}
+
+	if _, err := decodeTokenUser(buf, testTokenBase+0x100); err == nil {
+		t.Errorf("expected error for pointer outside of buffer")
+	}
+	if _, err := decodeTokenUser(buf[:20], testTokenBase); err == nil {
+		t.Errorf("expected error for truncated SID")
+	}
+}
+
+func TestDecodeTokenGroups(t *testing.T) {
+	buf := fixture(t,
+		"02000000", "00000000", // GroupCount, padding
+		"2800010000000000", "07000000", "00000000", // S-1-1-0, mandatory|default|enabled
+		"3400010000000000", "10000000", "00000000", // S-1-5-32-544, deny only
+		"010100000000000100000000",         // S-1-1-0
+		"01020000000000052000000020020000", // S-1-5-32-544
+	)
+	groups, err := decodeTokenGroups(buf, testTokenBase)
+	if err != nil {
+		t.Fatalf("decodeTokenGroups: %v", err)
+	}
+	want := []so.TokenGroup{
+		{SID: "S-1-1-0", Attributes: so.SE_GROUP_MANDATORY | so.SE_GROUP_ENABLED_BY_DEFAULT | so.SE_GROUP_ENABLED},
+		{SID: "S-1-5-32-544", Attributes: so.SE_GROUP_USE_FOR_DENY_ONLY},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("decodeTokenGroups = %+v, want %+v", groups, want)
+	}
+
+	info := so.TokenInfo{Groups: groups}
+	if !info.HasGroup("S-1-1-0") || info.HasGroup("S-1-5-32-544") {
+		t.Errorf("HasGroup should honour enabled and deny-only attributes")
+	}
+
+	// A count larger than the buffer must not panic.
+	buf[0] = 0xff
+	if _, err := decodeTokenGroups(buf, testTokenBase); err == nil {
+		t.Errorf("expected error for oversized count")
+	}
+}
+
+func TestDecodeTokenPrivileges(t *testing.T) {
+	buf := fixture(t,
+		"03000000",                         // PrivilegeCount
+		"14000000", "00000000", "03000000", // SeDebugPrivilege, enabled by default|enabled
+		"13000000", "00000000", "00000000", // SeShutdownPrivilege, disabled
+		"ff000000", "01000000", "00000000", // unknown
+	)
+	privs, err := decodeTokenPrivileges(buf)
+	if err != nil {
+		t.Fatalf("decodeTokenPrivileges: %v", err)
+	}
+	if len(privs) != 3 {
+		t.Fatalf("expected 3 privileges, got %d", len(privs))
+	}
+	if privs[0].Name != "SeDebugPrivilege" || !privs[0].IsEnabled() {
+		t.Errorf("unexpected first privilege: %+v", privs[0])
+	}
+	if privs[1].Name != "SeShutdownPrivilege" || privs[1].IsEnabled() {
+		t.Errorf("unexpected second privilege: %+v", privs[1])
+	}
+	if privs[2].LUID != 0x1000000ff || privs[2].Name != "LUID 0x1000000ff" {
+		t.Errorf("unexpected unknown privilege: %+v", privs[2])
+	}
+}
+
+func TestDecodeTokenIntegrityAndScalars(t *testing.T) {
+	label := fixture(t,
+		"1000010000000000", "60000000", "00000000",
+		"010100000000001000300000", // S-1-16-12288
+	)
+	il, err := decodeTokenIntegrityLevel(label, testTokenBase)
+	if err != nil {
+		t.Fatalf("decodeTokenIntegrityLevel: %v", err)
+	}
+	info := so.TokenInfo{IntegrityLevel: il, ElevationType: so.TOKEN_ELEVATION_TYPE_FULL}
+	if il != so.INTEGRITY_LEVEL_HIGH || info.GetIntegrityLevel() != "HIGH" || info.GetElevationType() != "FULL" {
+		t.Errorf("integrity level = 0x%x (%s)", il, info.GetIntegrityLevel())
+	}
+
+	sess, err := decodeTokenUint32(fixture(t, "02000000"))
+	if err != nil || sess != 2 {
+		t.Errorf("decodeTokenUint32 = %d, %v", sess, err)
+	}
+	if _, err := decodeTokenUint32([]byte{1}); err == nil {
+		t.Errorf("expected error for short DWORD buffer")
+	}
+
+	stats := fixture(t,
+		"0100000000000000", // TokenId
+		"e703000000000000", // AuthenticationId 0x3e7 (SYSTEM)
+		strings.Repeat("00", 40),
+	)
+	luid, err := decodeTokenLogonID(stats)
+	if err != nil || luid != 0x3e7 {
+		t.Errorf("decodeTokenLogonID = 0x%x, %v", luid, err)
+	}
+}
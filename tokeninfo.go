@@ -0,0 +1,195 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// TOKEN_INFORMATION_CLASS values used by GetTokenInfo.
+const (
+	TOKEN_INFO_USER           = 1
+	TOKEN_INFO_GROUPS         = 2
+	TOKEN_INFO_PRIVILEGES     = 3
+	TOKEN_INFO_STATISTICS     = 10
+	TOKEN_INFO_SESSION_ID     = 12
+	TOKEN_INFO_ELEVATION_TYPE = 18
+	TOKEN_INFO_LINKED_TOKEN   = 19
+	TOKEN_INFO_ELEVATION      = 20
+	TOKEN_INFO_INTEGRITY      = 25
+
+	TOKEN_ERROR_INSUFFICIENT_BUFFER syscall.Errno = 122
+)
+
+// GetTokenInfo returns the user, groups, privileges, integrity level, elevation
+// and logon session of the access token of the process with the given PID.
+//
+// Account names are filled in on a best effort basis, using the SID cache.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/securitybaseapi/nf-securitybaseapi-gettokeninformation
+func GetTokenInfo(pid uint32) (*so.TokenInfo, error) {
+	handle, _, lastError := procOpenProcess.Call(uintptr(uint32(PROCESS_QUERY_LIMITED_INFORMATION)), uintptr(0), uintptr(pid))
+	if handle == 0 {
+		return nil, fmt.Errorf("Unable to open process %d: %s", pid, lastError)
+	}
+	defer procCloseHandle.Call(handle)
+
+	return processTokenInfo(handle)
+}
+
+// GetCurrentTokenInfo returns the details of the current process's access
+// token, see GetTokenInfo.
+func GetCurrentTokenInfo() (*so.TokenInfo, error) {
+	handle, _, _ := procGetCurrentProcess.Call()
+	return processTokenInfo(handle)
+}
+
+func processTokenInfo(process uintptr) (*so.TokenInfo, error) {
+	var token uintptr
+	opRes, _, lastError := procOpenProcessToken.Call(
+		uintptr(process),
+		uintptr(uint32(PROC_TOKEN_QUERY)),
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if opRes != 1 {
+		return nil, fmt.Errorf("Unable to open process token: %s", lastError)
+	}
+	defer procCloseHandle.Call(token)
+
+	return tokenInfo(token)
+}
+
+func tokenInfo(token uintptr) (*so.TokenInfo, error) {
+	retVal := &so.TokenInfo{}
+
+	buf, base, err := getTokenInformation(token, TOKEN_INFO_USER)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get token user: %s", err)
+	}
+	if retVal.User, err = decodeTokenUser(buf, base); err != nil {
+		return nil, fmt.Errorf("Unable to decode token user: %s", err)
+	}
+
+	buf, base, err = getTokenInformation(token, TOKEN_INFO_GROUPS)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get token groups: %s", err)
+	}
+	if retVal.Groups, err = decodeTokenGroups(buf, base); err != nil {
+		return nil, fmt.Errorf("Unable to decode token groups: %s", err)
+	}
+
+	buf, _, err = getTokenInformation(token, TOKEN_INFO_PRIVILEGES)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get token privileges: %s", err)
+	}
+	if retVal.Privileges, err = decodeTokenPrivileges(buf); err != nil {
+		return nil, fmt.Errorf("Unable to decode token privileges: %s", err)
+	}
+
+	buf, base, err = getTokenInformation(token, TOKEN_INFO_INTEGRITY)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get token integrity level: %s", err)
+	}
+	if retVal.IntegrityLevel, err = decodeTokenIntegrityLevel(buf, base); err != nil {
+		return nil, fmt.Errorf("Unable to decode token integrity level: %s", err)
+	}
+
+	if retVal.ElevationType, err = getTokenUint32(token, TOKEN_INFO_ELEVATION_TYPE); err != nil {
+		return nil, fmt.Errorf("Unable to get token elevation type: %s", err)
+	}
+	elevated, err := getTokenUint32(token, TOKEN_INFO_ELEVATION)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get token elevation: %s", err)
+	}
+	retVal.IsElevated = elevated != 0
+	if retVal.SessionID, err = getTokenUint32(token, TOKEN_INFO_SESSION_ID); err != nil {
+		return nil, fmt.Errorf("Unable to get token session ID: %s", err)
+	}
+
+	buf, _, err = getTokenInformation(token, TOKEN_INFO_STATISTICS)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get token statistics: %s", err)
+	}
+	if retVal.LogonID, err = decodeTokenLogonID(buf); err != nil {
+		return nil, fmt.Errorf("Unable to decode token statistics: %s", err)
+	}
+
+	resolveTokenNames(retVal)
+
+	return retVal, nil
+}
+
+// resolveTokenNames fills in account names for the token's user and groups,
+// leaving them empty when the SIDs can't be resolved.
+func resolveTokenNames(info *so.TokenInfo) {
+	sids := make([]string, 0, len(info.Groups)+1)
+	sids = append(sids, info.User.SID)
+	for _, g := range info.Groups {
+		sids = append(sids, g.SID)
+	}
+
+	accounts, err := ResolveSids(sids)
+	if err != nil {
+		return
+	}
+	if accounts[0].IsMapped() {
+		info.User.Name = accounts[0].FullName()
+	}
+	for i := range info.Groups {
+		if accounts[i+1].IsMapped() {
+			info.Groups[i].Name = accounts[i+1].FullName()
+		}
+	}
+}
+
+// getTokenInformation returns the raw token information of the given class, and
+// the address of the buffer it was written to, which the decode functions need
+// to follow pointers within the buffer.
+func getTokenInformation(token uintptr, class uint32) ([]byte, uintptr, error) {
+	var length uint32
+	ret, _, lastError := procGetTokenInformation.Call(
+		uintptr(token),
+		uintptr(class),
+		uintptr(0),
+		uintptr(0),
+		uintptr(unsafe.Pointer(&length)),
+	)
+	if ret != 1 && lastError.(syscall.Errno) != TOKEN_ERROR_INSUFFICIENT_BUFFER {
+		return nil, 0, lastError
+	}
+	if length == 0 {
+		return nil, 0, fmt.Errorf("empty token information")
+	}
+
+	buf := make([]byte, length)
+	ret, _, lastError = procGetTokenInformation.Call(
+		uintptr(token),
+		uintptr(class),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(length),
+		uintptr(unsafe.Pointer(&length)),
+	)
+	if ret != 1 {
+		return nil, 0, lastError
+	}
+	return buf[:length], uintptr(unsafe.Pointer(&buf[0])), nil
+}
+
+func getTokenUint32(token uintptr, class uint32) (uint32, error) {
+	var value, length uint32
+	ret, _, lastError := procGetTokenInformation.Call(
+		uintptr(token),
+		uintptr(class),
+		uintptr(unsafe.Pointer(&value)),
+		uintptr(uint32(unsafe.Sizeof(value))),
+		uintptr(unsafe.Pointer(&length)),
+	)
+	if ret != 1 {
+		return 0, lastError
+	}
+	return value, nil
+}
@@ -0,0 +1,262 @@
+package winapi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// Exit codes of Windows Installer, which other installers tend to follow.
+// See: https://docs.microsoft.com/en-us/windows/win32/msi/error-codes
+const (
+	UNINSTALL_EXIT_SUCCESS          = 0
+	UNINSTALL_EXIT_UNKNOWN_PRODUCT  = 1605
+	UNINSTALL_EXIT_REBOOT_INITIATED = 1641
+	UNINSTALL_EXIT_REBOOT_REQUIRED  = 3010
+)
+
+var (
+	productCodePattern = regexp.MustCompile(`\{[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}`)
+	innoSetupPattern   = regexp.MustCompile(`^unins[0-9]{3}\.exe$`)
+	nsisPattern        = regexp.MustCompile(`^uninst(all(er)?)?([ _-].*)?\.exe$`)
+)
+
+// Silent switches of each installer's uninstaller. InstallShield's only
+// work without prompting where a response file was recorded with the setup.
+var (
+	innoSetupSilentArgs     = []string{"/VERYSILENT", "/SUPPRESSMSGBOXES", "/NORESTART"}
+	nsisSilentArgs          = []string{"/S"}
+	installShieldSilentArgs = []string{"/s"}
+)
+
+// ParseUninstallString splits an UninstallString or QuietUninstallString into
+// the executable and its arguments, and recognises the installer behind it.
+//
+// The arguments are split as the Microsoft C runtime does. Executables with
+// spaces in their path are often registered without quotes, relying on
+// CreateProcess trying each space as the end of the path in turn, so an
+// unquoted path runs to the first ".exe" followed by a space.
+//
+// Installers are recognised by their uninstallers' names and arguments:
+// MsiExec.exe for Windows Installer, unins000.exe for Inno Setup, the setup
+// cached under "InstallShield Installation Information" or run with
+// -removeonly for InstallShield, and uninst.exe or uninstall.exe for NSIS.
+func ParseUninstallString(s string) (so.UninstallCommand, error) {
+	s = strings.TrimSpace(s)
+	exe, rest, err := splitCommandExecutable(s)
+	if err != nil {
+		return so.UninstallCommand{}, err
+	}
+	cmd := so.UninstallCommand{
+		Executable: exe,
+		Args:       splitCommandLineArgs(rest),
+	}
+
+	base := strings.ToLower(exe[strings.LastIndexAny(exe, `\/`)+1:])
+	switch {
+	case base == "msiexec.exe" || base == "msiexec":
+		cmd.Installer = so.INSTALLER_MSI
+		for _, a := range cmd.Args {
+			if code := productCodePattern.FindString(a); code != "" {
+				cmd.ProductCode = strings.ToUpper(code)
+				break
+			}
+		}
+		if cmd.ProductCode != "" {
+			cmd.SilentCommandLine = quoteCommandExecutable(exe) + " /X" + cmd.ProductCode + " /qn /norestart"
+		}
+	case innoSetupPattern.MatchString(base):
+		cmd.Installer = so.INSTALLER_INNO_SETUP
+		cmd.SilentCommandLine = silentCommandLine(exe, rest, cmd.Args, innoSetupSilentArgs)
+	case isInstallShieldUninstall(exe, cmd.Args):
+		cmd.Installer = so.INSTALLER_INSTALLSHIELD
+		cmd.SilentCommandLine = silentCommandLine(exe, rest, cmd.Args, installShieldSilentArgs)
+	case nsisPattern.MatchString(base):
+		cmd.Installer = so.INSTALLER_NSIS
+		cmd.SilentCommandLine = silentCommandLine(exe, rest, cmd.Args, nsisSilentArgs)
+	}
+	return cmd, nil
+}
+
+// uninstallCommandLine returns the command line UninstallSoftware runs for
+// sw: its QuietUninstallString as given, or the silent form of its
+// UninstallString.
+func uninstallCommandLine(sw so.Software) (string, error) {
+	if sw.QuietUninstallString != "" {
+		cmd, err := ParseUninstallString(sw.QuietUninstallString)
+		if err != nil {
+			return "", err
+		}
+		_, rest, _ := splitCommandExecutable(strings.TrimSpace(sw.QuietUninstallString))
+		return joinCommandExecutable(cmd.Executable, rest), nil
+	}
+	if sw.UninstallString == "" {
+		return "", fmt.Errorf("%s has no uninstall command", sw.DisplayName)
+	}
+	cmd, err := ParseUninstallString(sw.UninstallString)
+	if err != nil {
+		return "", err
+	}
+	if cmd.SilentCommandLine == "" {
+		return "", fmt.Errorf("No silent uninstall is known for %s: %s", sw.DisplayName, sw.UninstallString)
+	}
+	return cmd.SilentCommandLine, nil
+}
+
+// uninstallResult maps an uninstaller's exit code to an UNINSTALL_RESULT_*.
+func uninstallResult(exitCode uint32) uint32 {
+	switch exitCode {
+	case UNINSTALL_EXIT_SUCCESS:
+		return so.UNINSTALL_RESULT_SUCCESS
+	case UNINSTALL_EXIT_UNKNOWN_PRODUCT:
+		return so.UNINSTALL_RESULT_NOT_INSTALLED
+	case UNINSTALL_EXIT_REBOOT_INITIATED:
+		return so.UNINSTALL_RESULT_REBOOT_INITIATED
+	case UNINSTALL_EXIT_REBOOT_REQUIRED:
+		return so.UNINSTALL_RESULT_REBOOT_REQUIRED
+	default:
+		return so.UNINSTALL_RESULT_FAILED
+	}
+}
+
+func isInstallShieldUninstall(exe string, args []string) bool {
+	if strings.Contains(strings.ToLower(exe), `\installshield installation information\`) {
+		return true
+	}
+	for _, a := range args {
+		switch strings.ToLower(a) {
+		case "-removeonly", "/removeonly", "-runfromtemp", "/runfromtemp":
+			return true
+		}
+	}
+	return false
+}
+
+// silentCommandLine is the command line with the given switches added, unless
+// it already has them.
+func silentCommandLine(exe string, rest string, args []string, switches []string) string {
+	line := joinCommandExecutable(exe, rest)
+	for _, sw := range switches {
+		found := false
+		for _, a := range args {
+			if strings.EqualFold(a, sw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			line += " " + sw
+		}
+	}
+	return line
+}
+
+// splitCommandExecutable splits a command line into the executable and the
+// rest of the line, which is left as it is.
+func splitCommandExecutable(s string) (string, string, error) {
+	if s == "" {
+		return "", "", fmt.Errorf("Empty command line")
+	}
+	if s[0] == '"' {
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return "", "", fmt.Errorf("Unterminated quote in command line: %s", s)
+		}
+		if end == 0 {
+			return "", "", fmt.Errorf("Empty executable in command line: %s", s)
+		}
+		return s[1 : end+1], strings.TrimSpace(s[end+2:]), nil
+	}
+
+	lower := strings.ToLower(s)
+	for off := 0; ; {
+		i := strings.Index(lower[off:], ".exe")
+		if i < 0 {
+			break
+		}
+		end := off + i + len(".exe")
+		if end == len(s) || s[end] == ' ' || s[end] == '\t' || s[end] == '/' || s[end] == '"' {
+			return s[:end], strings.TrimSpace(s[end:]), nil
+		}
+		off = end
+	}
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:]), nil
+	}
+	return s, "", nil
+}
+
+// splitCommandLineArgs splits arguments as the Microsoft C runtime does:
+// whitespace separates arguments except within double quotes, 2n backslashes
+// followed by a quote are n backslashes and a quote that starts or ends
+// quoting, 2n+1 backslashes followed by a quote are n backslashes and a
+// literal quote, and within quotes "" is a literal quote. Other backslashes
+// are literal.
+// See: https://docs.microsoft.com/en-us/cpp/c-language/parsing-c-command-line-arguments
+func splitCommandLineArgs(s string) []string {
+	args := make([]string, 0)
+	var (
+		b       strings.Builder
+		inArg   bool
+		inQuote bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			n := 0
+			for i < len(s) && s[i] == '\\' {
+				n++
+				i++
+			}
+			inArg = true
+			if i < len(s) && s[i] == '"' {
+				b.WriteString(strings.Repeat(`\`, n/2))
+				if n%2 == 1 {
+					b.WriteByte('"')
+					continue
+				}
+			} else {
+				b.WriteString(strings.Repeat(`\`, n))
+			}
+			i--
+		case c == '"':
+			inArg = true
+			if inQuote && i+1 < len(s) && s[i+1] == '"' {
+				b.WriteByte('"')
+				i++
+			} else {
+				inQuote = !inQuote
+			}
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			b.WriteByte(c)
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+func quoteCommandExecutable(exe string) string {
+	if strings.ContainsAny(exe, " \t") {
+		return `"` + exe + `"`
+	}
+	return exe
+}
+
+func joinCommandExecutable(exe string, rest string) string {
+	if rest == "" {
+		return quoteCommandExecutable(exe)
+	}
+	return quoteCommandExecutable(exe) + " " + rest
+}
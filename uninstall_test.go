@@ -0,0 +1,173 @@
+package winapi
+
+import (
+	"reflect"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+func TestSplitCommandLineArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{``, []string{}},
+		{`  a  b	c `, []string{"a", "b", "c"}},
+		{`"a b" c`, []string{"a b", "c"}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{`""`, []string{""}},
+		{`a\\b "c\\d"`, []string{`a\\b`, `c\\d`}},
+		{`a\"b`, []string{`a"b`}},
+		{`a\\\"b`, []string{`a\"b`}},
+		{`"a\\" b`, []string{`a\`, "b"}},
+		{`"a""b" c`, []string{`a"b`, "c"}},
+		{`/X{1234} /qn`, []string{"/X{1234}", "/qn"}},
+		{`-f1"C:\Program Files\setup.iss" -s`, []string{`-f1C:\Program Files\setup.iss`, "-s"}},
+		{`"unterminated arg`, []string{"unterminated arg"}},
+	}
+	for _, tt := range tests {
+		if got := splitCommandLineArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommandLineArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommandExecutable(t *testing.T) {
+	tests := []struct {
+		in        string
+		exe, rest string
+	}{
+		{`MsiExec.exe /X{1234}`, `MsiExec.exe`, `/X{1234}`},
+		{`"C:\Program Files\App\uninst.exe" /S`, `C:\Program Files\App\uninst.exe`, `/S`},
+		{`"C:\Program Files\App\uninst.exe"`, `C:\Program Files\App\uninst.exe`, ``},
+		{`C:\Program Files\App\uninst.exe /S`, `C:\Program Files\App\uninst.exe`, `/S`},
+		{`C:\Program Files\App.exe Data\uninst.exe`, `C:\Program Files\App.exe`, `Data\uninst.exe`},
+		{`C:\Apps\my.executables\u.exe`, `C:\Apps\my.executables\u.exe`, ``},
+		{`MsiExec.exe/X{1234}`, `MsiExec.exe`, `/X{1234}`},
+		{`rundll32 dfshim.dll,ShArpMaintain app.application`, `rundll32`, `dfshim.dll,ShArpMaintain app.application`},
+	}
+	for _, tt := range tests {
+		exe, rest, err := splitCommandExecutable(tt.in)
+		if err != nil || exe != tt.exe || rest != tt.rest {
+			t.Errorf("splitCommandExecutable(%q) = %q, %q, %v, want %q, %q", tt.in, exe, rest, err, tt.exe, tt.rest)
+		}
+	}
+	for _, in := range []string{``, `"C:\unterminated.exe /S`, `"" /S`} {
+		if _, _, err := splitCommandExecutable(in); err == nil {
+			t.Errorf("splitCommandExecutable(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseUninstallString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want so.UninstallCommand
+	}{
+		{`MsiExec.exe /I{23170F69-40C1-2702-1900-000001000000}`, so.UninstallCommand{
+			Executable:        "MsiExec.exe",
+			Args:              []string{"/I{23170F69-40C1-2702-1900-000001000000}"},
+			Installer:         so.INSTALLER_MSI,
+			ProductCode:       "{23170F69-40C1-2702-1900-000001000000}",
+			SilentCommandLine: "MsiExec.exe /X{23170F69-40C1-2702-1900-000001000000} /qn /norestart",
+		}},
+		{`C:\Windows\System32\msiexec.exe /x "{ac76ba86-7ad7-1033-7b44-ac0f074e4100}" /qb`, so.UninstallCommand{
+			Executable:        `C:\Windows\System32\msiexec.exe`,
+			Args:              []string{"/x", "{ac76ba86-7ad7-1033-7b44-ac0f074e4100}", "/qb"},
+			Installer:         so.INSTALLER_MSI,
+			ProductCode:       "{AC76BA86-7AD7-1033-7B44-AC0F074E4100}",
+			SilentCommandLine: `C:\Windows\System32\msiexec.exe /X{AC76BA86-7AD7-1033-7B44-AC0F074E4100} /qn /norestart`,
+		}},
+		{`MsiExec.exe /X "C:\Installers\tool.msi"`, so.UninstallCommand{
+			Executable: "MsiExec.exe",
+			Args:       []string{"/X", `C:\Installers\tool.msi`},
+			Installer:  so.INSTALLER_MSI,
+		}},
+		{`"C:\Program Files\Notepad++\unins000.exe" /SILENT`, so.UninstallCommand{
+			Executable:        `C:\Program Files\Notepad++\unins000.exe`,
+			Args:              []string{"/SILENT"},
+			Installer:         so.INSTALLER_INNO_SETUP,
+			SilentCommandLine: `"C:\Program Files\Notepad++\unins000.exe" /SILENT /VERYSILENT /SUPPRESSMSGBOXES /NORESTART`,
+		}},
+		{`C:\Program Files\7-Zip\Uninstall.exe`, so.UninstallCommand{
+			Executable:        `C:\Program Files\7-Zip\Uninstall.exe`,
+			Args:              []string{},
+			Installer:         so.INSTALLER_NSIS,
+			SilentCommandLine: `"C:\Program Files\7-Zip\Uninstall.exe" /S`,
+		}},
+		{`"C:\Program Files\VLC\uninstall.exe" /S _?=C:\Program Files\VLC`, so.UninstallCommand{
+			Executable:        `C:\Program Files\VLC\uninstall.exe`,
+			Args:              []string{"/S", `_?=C:\Program`, `Files\VLC`},
+			Installer:         so.INSTALLER_NSIS,
+			SilentCommandLine: `"C:\Program Files\VLC\uninstall.exe" /S _?=C:\Program Files\VLC`,
+		}},
+		{`"C:\Program Files (x86)\InstallShield Installation Information\{9D3D8C60-A5EF-4123-B2B9-172095903AB}\setup.exe" -runfromtemp -l0x0409 -removeonly`, so.UninstallCommand{
+			Executable:        `C:\Program Files (x86)\InstallShield Installation Information\{9D3D8C60-A5EF-4123-B2B9-172095903AB}\setup.exe`,
+			Args:              []string{"-runfromtemp", "-l0x0409", "-removeonly"},
+			Installer:         so.INSTALLER_INSTALLSHIELD,
+			SilentCommandLine: `"C:\Program Files (x86)\InstallShield Installation Information\{9D3D8C60-A5EF-4123-B2B9-172095903AB}\setup.exe" -runfromtemp -l0x0409 -removeonly /s`,
+		}},
+		{`rundll32.exe dfshim.dll,ShArpMaintain app.application`, so.UninstallCommand{
+			Executable: "rundll32.exe",
+			Args:       []string{"dfshim.dll,ShArpMaintain", "app.application"},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := ParseUninstallString(tt.in)
+		if err != nil {
+			t.Errorf("ParseUninstallString(%q): %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseUninstallString(%q) =\n%+v\nwant\n%+v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseUninstallString("   "); err == nil {
+		t.Errorf("an empty uninstall string should fail")
+	}
+}
+
+func TestUninstallCommandLine(t *testing.T) {
+	quiet := so.Software{
+		DisplayName:          "Tool",
+		UninstallString:      `C:\Program Files\Tool\uninst.exe`,
+		QuietUninstallString: `C:\Program Files\Tool\uninst.exe /quiet "log file.txt"`,
+	}
+	if got, err := uninstallCommandLine(quiet); err != nil || got != `"C:\Program Files\Tool\uninst.exe" /quiet "log file.txt"` {
+		t.Errorf("uninstallCommandLine with a quiet string = %q, %v", got, err)
+	}
+	msi := so.Software{UninstallString: `MsiExec.exe /I{23170F69-40C1-2702-1900-000001000000}`}
+	if got, err := uninstallCommandLine(msi); err != nil || got != "MsiExec.exe /X{23170F69-40C1-2702-1900-000001000000} /qn /norestart" {
+		t.Errorf("uninstallCommandLine for MSI = %q, %v", got, err)
+	}
+	for _, sw := range []so.Software{
+		{DisplayName: "None"},
+		{DisplayName: "Unknown", UninstallString: `C:\Tools\remove.exe`},
+	} {
+		if got, err := uninstallCommandLine(sw); err == nil {
+			t.Errorf("uninstallCommandLine(%s) = %q, want an error", sw.DisplayName, got)
+		}
+	}
+}
+
+func TestUninstallResult(t *testing.T) {
+	tests := []struct {
+		code    uint32
+		want    string
+		removed bool
+	}{
+		{0, "SUCCESS", true},
+		{1605, "NOT_INSTALLED", true},
+		{1641, "REBOOT_INITIATED", true},
+		{3010, "REBOOT_REQUIRED", true},
+		{1602, "FAILED", false},
+		{1, "FAILED", false},
+	}
+	for _, tt := range tests {
+		r := so.UninstallResult{Result: uninstallResult(tt.code), ExitCode: tt.code}
+		if r.GetResult() != tt.want || r.Removed() != tt.removed {
+			t.Errorf("exit code %d = %s, removed %v, want %s, %v", tt.code, r.GetResult(), r.Removed(), tt.want, tt.removed)
+		}
+	}
+}
@@ -240,55 +240,39 @@ func UserDelete(username string) (bool, error) {
 // IsLocalUserAdmin returns whether the user with the specified user name has
 // administration rights on the local machine.
 func IsLocalUserAdmin(username string) (bool, error) {
-	var dataPointer uintptr
-	uPointer, err := syscall.UTF16PtrFromString(username)
-	if err != nil {
-		return false, fmt.Errorf("unable to encode username to UTF16")
-	}
-	_, _, _ = usrNetUserGetInfo.Call(
-		uintptr(0),                            // servername
-		uintptr(unsafe.Pointer(uPointer)),     // username
-		uintptr(uint32(1)),                    // level, request USER_INFO_1
-		uintptr(unsafe.Pointer(&dataPointer)), // Pointer to struct.
-	)
-	defer usrNetApiBufferFree.Call(dataPointer)
-
-	if dataPointer == uintptr(0) {
-		return false, fmt.Errorf("unable to get data structure")
-	}
-
-	var data = (*USER_INFO_1)(unsafe.Pointer(dataPointer))
-
-	if data.Usri1_priv == USER_PRIV_ADMIN {
-		return true, nil
-	} else {
-		return false, nil
-	}
+	return netUserIsAdmin("", username)
 }
 
 // IsDomainUserAdmin returns whether the specified user is an administrator for
-// the specified domain.
+// the specified domain. If no domain controller can be found, the user is
+// looked up on the local machine instead.
 func IsDomainUserAdmin(username string, domain string) (bool, error) {
-	var dataPointer uintptr
-	var dcPointer uintptr
+	dc, err := getAnyDCName(domain)
+	if err != nil {
+		dc = ""
+	}
+	return netUserIsAdmin(dc, username)
+}
+
+// netUserIsAdmin returns whether username has the USER_PRIV_ADMIN privilege
+// level on server, or the local machine if server is empty.
+func netUserIsAdmin(server string, username string) (bool, error) {
+	var (
+		dataPointer uintptr
+		sPointer    *uint16
+	)
 	uPointer, err := syscall.UTF16PtrFromString(username)
 	if err != nil {
 		return false, fmt.Errorf("unable to encode username to UTF16")
 	}
-	dPointer, err := syscall.UTF16PtrFromString(domain)
-	if err != nil {
-		return false, fmt.Errorf("unable to encode domain to UTF16")
+	if server != "" {
+		sPointer, err = syscall.UTF16PtrFromString(server)
+		if err != nil {
+			return false, fmt.Errorf("unable to encode server name to UTF16")
+		}
 	}
-
-	_, _, _ = usrNetGetAnyDCName.Call(
-		uintptr(0),                        // servername
-		uintptr(unsafe.Pointer(dPointer)), // domainame
-		uintptr(unsafe.Pointer(&dcPointer)),
-	)
-	defer usrNetApiBufferFree.Call(dcPointer)
-
 	_, _, _ = usrNetUserGetInfo.Call(
-		uintptr(dcPointer),                    // servername
+		uintptr(unsafe.Pointer(sPointer)),     // servername
 		uintptr(unsafe.Pointer(uPointer)),     // username
 		uintptr(uint32(1)),                    // level, request USER_INFO_1
 		uintptr(unsafe.Pointer(&dataPointer)), // Pointer to struct.
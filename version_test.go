@@ -0,0 +1,152 @@
+package winapi
+
+import (
+	"reflect"
+	"testing"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in     string
+		format string
+		parts  []uint64
+		pre    string
+		suffix string
+	}{
+		{"10.0.19041.1", "NUMERIC", []uint64{10, 0, 19041, 1}, "", ""},
+		{"19.00", "NUMERIC", []uint64{19, 0}, "", ""},
+		{"1, 0, 0, 1", "NUMERIC", []uint64{1, 0, 0, 1}, "", ""},
+		{"v2.5", "NUMERIC", []uint64{2, 5}, "", ""},
+		{"Version 3.1", "NUMERIC", []uint64{3, 1}, "", ""},
+		{"1.2.3", "SEMVER", []uint64{1, 2, 3}, "", ""},
+		{"1.2.3-rc.1+build.5", "SEMVER", []uint64{1, 2, 3}, "rc.1", ""},
+		{"2021-03-15", "DATED", []uint64{2021, 3, 15}, "", ""},
+		{"20210315", "DATED", []uint64{2021, 3, 15}, "", ""},
+		{"2021.3", "DATED", []uint64{2021, 3}, "", ""},
+		{"7.0 (x64)", "NUMERIC", []uint64{7, 0}, "", ""},
+		{"2.4.1b3", "VENDOR", []uint64{2, 4, 1}, "b3", ""},
+		{"1.2.3 beta 2", "VENDOR", []uint64{1, 2, 3}, "beta 2", ""},
+		{"5.1 SP3", "VENDOR", []uint64{5, 1}, "", "SP3"},
+		{"1.0 Build 1234", "VENDOR", []uint64{1, 0}, "", "Build 1234"},
+		{"3.2r1", "VENDOR", []uint64{3, 2}, "", "r1"},
+	}
+	for _, tt := range tests {
+		v, err := so.ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %s", tt.in, err)
+			continue
+		}
+		if v.GetFormat() != tt.format || !reflect.DeepEqual(v.Parts, tt.parts) || v.Prerelease != tt.pre || v.Suffix != tt.suffix {
+			t.Errorf("ParseVersion(%q) = %s %v %q %q, want %s %v %q %q", tt.in, v.GetFormat(), v.Parts, v.Prerelease, v.Suffix, tt.format, tt.parts, tt.pre, tt.suffix)
+		}
+	}
+	for _, in := range []string{"", "  ", "beta", "unknown", "99999999999999999999.1", "1-2"} {
+		if _, err := so.ParseVersion(in); err == nil {
+			t.Errorf("ParseVersion(%q) should fail", in)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.0.9", "10.0.10", -1},
+		{"10.0", "10.0.0.0", 0},
+		{"10.0.19041.1", "10.0.19041", 1},
+		{"1.2.3-rc.1", "1.2.3", -1},
+		{"1.2.3-rc.2", "1.2.3-rc.10", -1},
+		{"1.2.3-alpha", "1.2.3-beta", -1},
+		{"1.2.3-1", "1.2.3-alpha", -1},
+		{"1.2.3+build.1", "1.2.3+build.2", 0},
+		{"2.4.1b3", "2.4.1", -1},
+		{"5.1", "5.1 SP3", -1},
+		{"5.1 SP2", "5.1 SP10", -1},
+		{"2021-03-15", "20210316", -1},
+		{"1, 0, 0, 2", "1.0.0.10", -1},
+		{"7.0 (x64)", "7.0 (x86)", 0},
+		{"unknown", "1.0", -1},
+		{"abc", "abd", -1},
+	}
+	for _, tt := range tests {
+		if got := so.CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := so.CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=1.2, <2.0", "1.2", true},
+		{">=1.2, <2.0", "1.10", true},
+		{">=1.2, <2.0", "2.0", false},
+		{">=1.2, <2.0", "1.1.9", false},
+		{"1.2", "1.2.0.0", true},
+		{"==1.2", "1.2.1", false},
+		{"!=1.2", "1.2.1", true},
+		{"> 10.0.9", "10.0.10", true},
+		{"<=10.0.9", "10.0.10", false},
+		{"1.2.*", "1.2.99", true},
+		{"1.2.x", "1.3", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9", true},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^0.2.3", "0.3.0", false},
+		{"*", "4.5", true},
+		{">=1.2, <1.4 || >=2.0", "1.5", false},
+		{">=1.2, <1.4 || >=2.0", "2.1", true},
+		{"<1.2.3", "1.2.3-rc.1", true},
+	}
+	for _, tt := range tests {
+		c, err := so.ParseVersionConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseVersionConstraint(%q): %s", tt.constraint, err)
+			continue
+		}
+		v, err := so.ParseVersion(tt.version)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %s", tt.version, err)
+			continue
+		}
+		if got := c.Match(v); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", ">=", ">=1.2,", ">=abc", "~>1.2"} {
+		if _, err := so.ParseVersionConstraint(in); err == nil {
+			t.Errorf("ParseVersionConstraint(%q) should fail", in)
+		}
+	}
+}
+
+func TestSoftwareVersion(t *testing.T) {
+	sw := so.Software{DisplayName: "Tool", DisplayVersion: "10.0.10"}
+	if c, err := sw.CompareVersion("10.0.9"); err != nil || c != 1 {
+		t.Errorf("CompareVersion = %d, %v, want 1", c, err)
+	}
+	if ok, err := sw.VersionMatches(">=10.0.9, <11"); err != nil || !ok {
+		t.Errorf("VersionMatches = %v, %v, want true", ok, err)
+	}
+
+	legacy := so.Software{DisplayName: "Legacy", VersionMajor: 4, VersionMinor: 2}
+	if v, err := legacy.ParsedVersion(); err != nil || !reflect.DeepEqual(v.Parts, []uint64{4, 2}) {
+		t.Errorf("ParsedVersion from VersionMajor and VersionMinor = %v, %v", v.Parts, err)
+	}
+
+	none := so.Software{DisplayName: "None"}
+	if _, err := none.VersionMatches(">=1.0"); err == nil {
+		t.Errorf("VersionMatches without a version should fail")
+	}
+}
@@ -0,0 +1,246 @@
+//go:build windows && amd64
+// +build windows,amd64
+
+package winapi
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+var (
+	wtsEnumerateSessions       = modWtsapi32.NewProc("WTSEnumerateSessionsW")
+	wtsQuerySessionInformation = modWtsapi32.NewProc("WTSQuerySessionInformationW")
+	wtsFreeMemory              = modWtsapi32.NewProc("WTSFreeMemory")
+	wtsLogoffSession           = modWtsapi32.NewProc("WTSLogoffSession")
+	wtsDisconnectSession       = modWtsapi32.NewProc("WTSDisconnectSession")
+	wtsSendMessage             = modWtsapi32.NewProc("WTSSendMessageW")
+	usrLockWorkStation         = modUser32.NewProc("LockWorkStation")
+	procGetCurrentProcessId    = modKernel32.NewProc("GetCurrentProcessId")
+)
+
+const (
+	WTS_CURRENT_SERVER_HANDLE = 0
+
+	// WTS_INFO_CLASS values.
+	WTS_INFO_CLIENT_NAME     = 10
+	WTS_INFO_CLIENT_ADDRESS  = 14
+	WTS_INFO_SESSION_INFO    = 24
+	WTS_INFO_SESSION_INFO_EX = 25
+
+	// Message box styles for SendSessionMessage.
+	MB_OK               = 0x00000000
+	MB_OKCANCEL         = 0x00000001
+	MB_ABORTRETRYIGNORE = 0x00000002
+	MB_YESNOCANCEL      = 0x00000003
+	MB_YESNO            = 0x00000004
+	MB_RETRYCANCEL      = 0x00000005
+	MB_ICONERROR        = 0x00000010
+	MB_ICONQUESTION     = 0x00000020
+	MB_ICONWARNING      = 0x00000030
+	MB_ICONINFORMATION  = 0x00000040
+
+	// Responses from SendSessionMessage.
+	IDOK      = 1
+	IDCANCEL  = 2
+	IDABORT   = 3
+	IDRETRY   = 4
+	IDIGNORE  = 5
+	IDYES     = 6
+	IDNO      = 7
+	IDTIMEOUT = 32000
+	IDASYNC   = 32001
+)
+
+type WTS_SESSION_INFO struct {
+	SessionID      uint32
+	WinStationName *uint16
+	State          uint32
+}
+
+// SessionMessageOptions configures SendSessionMessage.
+type SessionMessageOptions struct {
+	// Style is a combination of MB_* constants, MB_OK if zero.
+	Style uint32
+	// Wait for the user to respond, or the timeout to expire.
+	Wait bool
+	// Timeout closes the message after this long, rounded up to whole
+	// seconds, returning IDTIMEOUT if waiting. Zero waits indefinitely.
+	Timeout time.Duration
+}
+
+// ListSessions lists the Remote Desktop Services sessions on the local
+// machine, including the console and disconnected sessions.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsenumeratesessionsw
+func ListSessions() ([]so.WTSSession, error) {
+	var (
+		dataPointer uintptr
+		count       uint32
+		sizeTest    WTS_SESSION_INFO
+	)
+	ret, _, lastError := wtsEnumerateSessions.Call(
+		uintptr(WTS_CURRENT_SERVER_HANDLE),
+		uintptr(0), // reserved
+		uintptr(1), // version
+		uintptr(unsafe.Pointer(&dataPointer)),
+		uintptr(unsafe.Pointer(&count)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("Unable to enumerate sessions: %s", lastError)
+	}
+	defer wtsFreeMemory.Call(dataPointer)
+
+	retVal := make([]so.WTSSession, 0, count)
+	iter := dataPointer
+	for i := uint32(0); i < count; i++ {
+		info := (*WTS_SESSION_INFO)(unsafe.Pointer(iter))
+		s, err := SessionInfo(info.SessionID)
+		if err != nil {
+			// The session ended since it was enumerated.
+			s = so.WTSSession{
+				SessionID:      info.SessionID,
+				WinStationName: UTF16toString(info.WinStationName),
+				State:          info.State,
+			}
+		}
+		retVal = append(retVal, s)
+		iter = uintptr(unsafe.Pointer(iter + unsafe.Sizeof(sizeTest)))
+	}
+	return retVal, nil
+}
+
+// SessionInfo returns the details of a single session.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsquerysessioninformationw
+func SessionInfo(sessionID uint32) (so.WTSSession, error) {
+	buf, err := wtsQuery(sessionID, WTS_INFO_SESSION_INFO)
+	if err != nil {
+		return so.WTSSession{}, err
+	}
+	s, err := decodeWTSInfo(buf)
+	if err != nil {
+		return so.WTSSession{}, err
+	}
+	if buf, err := wtsQuery(sessionID, WTS_INFO_CLIENT_NAME); err == nil {
+		s.ClientName = utf16BytesToString(trimUTF16(buf))
+	}
+	if buf, err := wtsQuery(sessionID, WTS_INFO_CLIENT_ADDRESS); err == nil {
+		s.ClientAddress = decodeWTSClientAddress(buf)
+	}
+	return s, nil
+}
+
+// sessionState returns whether a session is disconnected and whether it's
+// locked. Lock state is only available from Windows 7 and Server 2008 R2.
+func sessionState(sessionID uint32) (disconnected bool, locked bool, err error) {
+	buf, err := wtsQuery(sessionID, WTS_INFO_SESSION_INFO_EX)
+	if err != nil {
+		return false, false, err
+	}
+	state, lockState, err := decodeWTSInfoEx(buf)
+	if err != nil {
+		return false, false, err
+	}
+	return state == so.WTS_STATE_DISCONNECTED, lockState == WTS_SESSIONSTATE_LOCK, nil
+}
+
+// wtsQuery returns a copy of the session information of the given class.
+func wtsQuery(sessionID uint32, class uint32) ([]byte, error) {
+	var (
+		dataPointer uintptr
+		size        uint32
+	)
+	ret, _, lastError := wtsQuerySessionInformation.Call(
+		uintptr(WTS_CURRENT_SERVER_HANDLE),
+		uintptr(sessionID),
+		uintptr(class),
+		uintptr(unsafe.Pointer(&dataPointer)),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("Unable to query session %d: %s", sessionID, lastError)
+	}
+	defer wtsFreeMemory.Call(dataPointer)
+	if size == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), (*[1 << 20]byte)(unsafe.Pointer(dataPointer))[:size:size]...), nil
+}
+
+// LogoffSession logs off the user of a session, optionally waiting until
+// they're logged off.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtslogoffsession
+func LogoffSession(sessionID uint32, wait bool) error {
+	ret, _, lastError := wtsLogoffSession.Call(uintptr(WTS_CURRENT_SERVER_HANDLE), uintptr(sessionID), boolToUintptr(wait))
+	if ret == 0 {
+		return fmt.Errorf("Unable to log off session %d: %s", sessionID, lastError)
+	}
+	return nil
+}
+
+// DisconnectSession disconnects a session without logging off its user,
+// optionally waiting until it's disconnected.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtsdisconnectsession
+func DisconnectSession(sessionID uint32, wait bool) error {
+	ret, _, lastError := wtsDisconnectSession.Call(uintptr(WTS_CURRENT_SERVER_HANDLE), uintptr(sessionID), boolToUintptr(wait))
+	if ret == 0 {
+		return fmt.Errorf("Unable to disconnect session %d: %s", sessionID, lastError)
+	}
+	return nil
+}
+
+// LockSession locks the workstation in a session. LockWorkStation only works
+// on the caller's own session, so for any other it's run there as the
+// session's user, which requires running as SYSTEM like StartInSession.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-lockworkstation
+func LockSession(sessionID uint32) error {
+	var current uint32
+	pid, _, _ := procGetCurrentProcessId.Call()
+	if ret, _, _ := procProcessIdToSessionId.Call(pid, uintptr(unsafe.Pointer(&current))); ret != 0 && current == sessionID {
+		if ret, _, lastError := usrLockWorkStation.Call(); ret == 0 {
+			return fmt.Errorf("Unable to lock session %d: %s", sessionID, lastError)
+		}
+		return nil
+	}
+
+	p, err := StartInSession(sessionID, "rundll32.exe user32.dll,LockWorkStation", SessionProcessOptions{AsUser: true, Hidden: true})
+	if err != nil {
+		return fmt.Errorf("Unable to lock session %d: %s", sessionID, err)
+	}
+	return p.Close()
+}
+
+// SendSessionMessage shows a message box in a session, returning the user's
+// response (one of the ID* constants), IDASYNC if not waiting, or IDTIMEOUT.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/nf-wtsapi32-wtssendmessagew
+func SendSessionMessage(sessionID uint32, title string, message string, opts SessionMessageOptions) (uint32, error) {
+	titleChars, err := syscall.UTF16FromString(title)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to encode title: %s", err)
+	}
+	messageChars, err := syscall.UTF16FromString(message)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to encode message: %s", err)
+	}
+
+	var response uint32
+	ret, _, lastError := wtsSendMessage.Call(
+		uintptr(WTS_CURRENT_SERVER_HANDLE),
+		uintptr(sessionID),
+		uintptr(unsafe.Pointer(&titleChars[0])),
+		uintptr(2*(len(titleChars)-1)), // length in bytes, without the NUL
+		uintptr(unsafe.Pointer(&messageChars[0])),
+		uintptr(2*(len(messageChars)-1)),
+		uintptr(opts.Style),
+		uintptr(uint32((opts.Timeout+time.Second-1)/time.Second)),
+		uintptr(unsafe.Pointer(&response)),
+		boolToUintptr(opts.Wait),
+	)
+	if ret == 0 {
+		return 0, fmt.Errorf("Unable to send message to session %d: %s", sessionID, lastError)
+	}
+	return response, nil
+}
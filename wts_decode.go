@@ -0,0 +1,114 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	so "github.com/iamacarpet/go-win64api/shared"
+)
+
+// Layout of WTSINFOW, as returned for WTSSessionInfo.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/ns-wtsapi32-wtsinfow
+const (
+	WTSINFO_SIZE                = 216
+	WTSINFO_WINSTATION_OFFSET   = 32
+	WTSINFO_DOMAIN_OFFSET       = 96
+	WTSINFO_USERNAME_OFFSET     = 130
+	WTSINFO_CONNECT_TIME_OFFSET = 176
+
+	WINSTATIONNAME_LENGTH = 32
+	DOMAIN_LENGTH         = 17
+	USERNAME_LENGTH       = 20
+
+	WTS_CLIENT_ADDRESS_SIZE = 24
+
+	AF_INET  = 2
+	AF_INET6 = 23
+)
+
+// decodeWTSInfo decodes a WTSINFOW. CurrentTime, the time on the server when
+// it was filled in, is used to work out the idle time.
+func decodeWTSInfo(buf []byte) (so.WTSSession, error) {
+	if len(buf) < WTSINFO_SIZE {
+		return so.WTSSession{}, fmt.Errorf("WTSINFO buffer too short")
+	}
+	times := make([]time.Time, 5)
+	for i := range times {
+		times[i] = wtsTime(binary.LittleEndian.Uint64(buf[WTSINFO_CONNECT_TIME_OFFSET+8*i:]))
+	}
+	s := so.WTSSession{
+		State:          binary.LittleEndian.Uint32(buf[0:]),
+		SessionID:      binary.LittleEndian.Uint32(buf[4:]),
+		WinStationName: utf16BytesToString(trimUTF16(buf[WTSINFO_WINSTATION_OFFSET : WTSINFO_WINSTATION_OFFSET+2*WINSTATIONNAME_LENGTH])),
+		Domain:         utf16BytesToString(trimUTF16(buf[WTSINFO_DOMAIN_OFFSET : WTSINFO_DOMAIN_OFFSET+2*DOMAIN_LENGTH])),
+		Username:       utf16BytesToString(trimUTF16(buf[WTSINFO_USERNAME_OFFSET : WTSINFO_USERNAME_OFFSET+2*(USERNAME_LENGTH+1)])),
+		ConnectTime:    times[0],
+		DisconnectTime: times[1],
+		LastInputTime:  times[2],
+		LogonTime:      times[3],
+	}
+	if current := times[4]; !s.LastInputTime.IsZero() && current.After(s.LastInputTime) {
+		s.IdleTime = current.Sub(s.LastInputTime)
+	}
+	return s, nil
+}
+
+// trimUTF16 cuts a fixed size UTF-16 field at its first NUL.
+func trimUTF16(b []byte) []byte {
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
+
+// wtsTime converts a FILETIME, which is zero if the event hasn't happened.
+func wtsTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	return uint64TimestampToTime(ft)
+}
+
+// decodeWTSClientAddress decodes a WTS_CLIENT_ADDRESS, returning an empty
+// string for local sessions. The address bytes start at offset 2 of the
+// Address field, as in a sockaddr.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/ns-wtsapi32-wts_client_address
+func decodeWTSClientAddress(buf []byte) string {
+	if len(buf) < WTS_CLIENT_ADDRESS_SIZE {
+		return ""
+	}
+	addr := buf[4:]
+	switch binary.LittleEndian.Uint32(buf[0:]) {
+	case AF_INET:
+		return net.IP(append([]byte(nil), addr[2:6]...)).String()
+	case AF_INET6:
+		return net.IP(append([]byte(nil), addr[2:18]...)).String()
+	default:
+		return ""
+	}
+}
+
+// Values of WTSINFOEX_LEVEL1's SessionFlags.
+const (
+	WTS_SESSIONSTATE_UNKNOWN = -1
+	WTS_SESSIONSTATE_LOCK    = 0
+	WTS_SESSIONSTATE_UNLOCK  = 1
+)
+
+// decodeWTSInfoEx returns the connection state and lock state
+// (WTS_SESSIONSTATE_*) from a level 1 WTSINFOEX, as returned for
+// WTSSessionInfoEx.
+// See: https://docs.microsoft.com/en-us/windows/win32/api/wtsapi32/ns-wtsapi32-wtsinfoex_level1_w
+func decodeWTSInfoEx(buf []byte) (state uint32, lockState int32, err error) {
+	if len(buf) < 20 {
+		return 0, 0, fmt.Errorf("WTSINFOEX buffer too short")
+	}
+	if level := binary.LittleEndian.Uint32(buf[0:]); level != 1 {
+		return 0, 0, fmt.Errorf("Unexpected WTSINFOEX level %d", level)
+	}
+	return binary.LittleEndian.Uint32(buf[12:]), int32(binary.LittleEndian.Uint32(buf[16:])), nil
+}
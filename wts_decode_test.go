@@ -0,0 +1,103 @@
+package winapi
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// filetime converts t to a FILETIME.
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func TestDecodeWTSInfo(t *testing.T) {
+	logon := time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+	input := logon.Add(2 * time.Hour)
+	current := input.Add(15 * time.Minute)
+
+	buf := make([]byte, WTSINFO_SIZE)
+	binary.LittleEndian.PutUint32(buf[0:], 4) // disconnected
+	binary.LittleEndian.PutUint32(buf[4:], 3)
+	copy(buf[WTSINFO_WINSTATION_OFFSET:], utf16Bytes("RDP-Tcp#7"))
+	copy(buf[WTSINFO_DOMAIN_OFFSET:], utf16Bytes("CORP"))
+	copy(buf[WTSINFO_USERNAME_OFFSET:], utf16Bytes("alice"))
+	binary.LittleEndian.PutUint64(buf[WTSINFO_CONNECT_TIME_OFFSET:], filetime(logon))
+	binary.LittleEndian.PutUint64(buf[WTSINFO_CONNECT_TIME_OFFSET+16:], filetime(input))
+	binary.LittleEndian.PutUint64(buf[WTSINFO_CONNECT_TIME_OFFSET+24:], filetime(logon))
+	binary.LittleEndian.PutUint64(buf[WTSINFO_CONNECT_TIME_OFFSET+32:], filetime(current))
+
+	s, err := decodeWTSInfo(buf)
+	if err != nil {
+		t.Fatalf("decodeWTSInfo: %v", err)
+	}
+	if s.SessionID != 3 || s.GetState() != "DISCONNECTED" || s.WinStationName != "RDP-Tcp#7" || s.FullUser() != "CORP\\alice" {
+		t.Errorf("decodeWTSInfo = %+v", s)
+	}
+	if !s.LogonTime.Equal(logon) || !s.ConnectTime.Equal(logon) || !s.LastInputTime.Equal(input) {
+		t.Errorf("times = %s, %s, %s", s.LogonTime, s.ConnectTime, s.LastInputTime)
+	}
+	if !s.DisconnectTime.IsZero() {
+		t.Errorf("DisconnectTime = %s, want zero", s.DisconnectTime)
+	}
+	if s.IdleTime != 15*time.Minute {
+		t.Errorf("IdleTime = %s", s.IdleTime)
+	}
+
+	// A full length user name has no NUL before the domain's padding.
+	copy(buf[WTSINFO_USERNAME_OFFSET:], utf16Bytes("abcdefghijklmnopqrst"))
+	if s, _ := decodeWTSInfo(buf); s.Username != "abcdefghijklmnopqrst" {
+		t.Errorf("20 character user name = %q", s.Username)
+	}
+
+	if _, err := decodeWTSInfo(buf[:WTSINFO_SIZE-1]); err == nil {
+		t.Errorf("expected error for short buffer")
+	}
+}
+
+func TestDecodeWTSClientAddress(t *testing.T) {
+	addr := func(family uint32, ip ...byte) []byte {
+		buf := make([]byte, WTS_CLIENT_ADDRESS_SIZE)
+		binary.LittleEndian.PutUint32(buf[0:], family)
+		copy(buf[6:], ip)
+		return buf
+	}
+	v6 := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+
+	tests := []struct {
+		buf  []byte
+		want string
+	}{
+		{addr(AF_INET, 192, 168, 1, 20), "192.168.1.20"},
+		{addr(AF_INET6, v6...), "2001:db8::1"},
+		{addr(0), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := decodeWTSClientAddress(tt.buf); got != tt.want {
+			t.Errorf("decodeWTSClientAddress(%x) = %q, want %q", tt.buf, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeWTSInfoEx(t *testing.T) {
+	buf := make([]byte, 64)
+	binary.LittleEndian.PutUint32(buf[0:], 1)  // Level
+	binary.LittleEndian.PutUint32(buf[8:], 2)  // SessionId
+	binary.LittleEndian.PutUint32(buf[12:], 4) // WTSDisconnected
+	binary.LittleEndian.PutUint32(buf[16:], WTS_SESSIONSTATE_LOCK)
+	state, lockState, err := decodeWTSInfoEx(buf)
+	if err != nil || state != 4 || lockState != WTS_SESSIONSTATE_LOCK {
+		t.Errorf("decodeWTSInfoEx = %d, %d, %v", state, lockState, err)
+	}
+
+	binary.LittleEndian.PutUint32(buf[16:], 0xFFFFFFFF)
+	if _, lockState, _ := decodeWTSInfoEx(buf); lockState != WTS_SESSIONSTATE_UNKNOWN {
+		t.Errorf("unknown lock state = %d", lockState)
+	}
+
+	binary.LittleEndian.PutUint32(buf[0:], 2)
+	if _, _, err := decodeWTSInfoEx(buf); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+}